@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"go-llm-server/internal/config"
@@ -8,15 +9,29 @@ import (
 	"go-llm-server/internal/utils"
 	"go-llm-server/pkg/logger"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"go.uber.org/zap"
 )
 
+const (
+	// defaultDrainTimeout 未配置 shutdown.drain_timeout 时等待进行中请求完成的时间
+	defaultDrainTimeout = 30 * time.Second
+	// defaultReloadInterval 未配置 reload.interval 时检查配置文件变化的间隔
+	defaultReloadInterval = 5 * time.Second
+)
+
 var Version string
 var BuildTime string
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:]))
+	}
+
 	fmt.Printf("Version: %s, BuildTime: %s\n", Version, BuildTime)
 	configFile := flag.String("f", "", "path to config file (default: configs/config.yml)")
 	flag.Parse()
@@ -35,6 +50,9 @@ func main() {
 	if err != nil {
 		logger.Fatal("Failed to load config", zap.Error(err))
 	}
+	if err := cfg.Validate(); err != nil {
+		logger.Fatal("Invalid config", zap.Error(err))
+	}
 
 	// 初始化代理传输层
 	proxy.InitHttpProxyTransport(cfg)
@@ -46,6 +64,20 @@ func main() {
 	handler := proxy.NewHandler(cfg)
 
 	handler.InitLoadBalancers()
+	reloadable := proxy.NewReloadableHandler(handler)
+
+	configPath := *configFile
+	if configPath == "" {
+		configPath = config.DefaultConfigFile
+	}
+	if cfg.Reload.Interval >= 0 {
+		interval := defaultReloadInterval
+		if cfg.Reload.Interval > 0 {
+			interval = time.Duration(cfg.Reload.Interval) * time.Second
+		}
+		stopWatch := reloadable.WatchConfig(configPath, interval)
+		defer stopWatch()
+	}
 
 	// 创建HTTP服务器
 	// 设置超时时间，确保与 transport 的 ResponseHeaderTimeout (900秒) 相匹配
@@ -54,15 +86,69 @@ func main() {
 	// ReadHeaderTimeout: 读取请求头的最大时间
 	server := &http.Server{
 		Addr:              fmt.Sprintf(":%d", cfg.Port),
-		Handler:           handler,
+		Handler:           reloadable,
 		ReadTimeout:       900 * time.Second, // 读取整个请求的最大时间
 		WriteTimeout:      900 * time.Second, // 写入响应的最大时间
 		ReadHeaderTimeout: 10 * time.Second,  // 读取请求头的最大时间
 		IdleTimeout:       30 * time.Second,  // 空闲连接的超时时间
 	}
 
-	logger.Info("Server starting...", zap.Int("binding port", cfg.Port))
-	if err := server.ListenAndServe(); err != nil {
-		logger.Fatal("Server failed to start", zap.Error(err))
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Server starting...", zap.Int("binding port", cfg.Port))
+		serverErr <- server.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for {
+		select {
+		case err := <-serverErr:
+			// ListenAndServe 只会因启动失败返回，此时没有需要排空的请求
+			reloadable.Current().Close(context.Background())
+			logger.Fatal("Server failed to start", zap.Error(err))
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				logger.Info("Reload signal received", zap.String("file", configPath))
+				_ = reloadable.ReloadFromFile(configPath)
+				continue
+			}
+			logger.Info("Shutdown signal received", zap.String("signal", sig.String()))
+		}
+		// 退出相关配置修改后需要重启才能生效，这里使用启动时的配置
+		shutdown(server, reloadable.Current(), cfg.Shutdown)
+		return
+	}
+}
+
+// shutdown 先将就绪状态置为不可用，再停止接收新连接并等待进行中的请求（含流式响应）完成，
+// 超过 drain_timeout 后强制断开，最后释放缓存写入、存储连接等资源
+func shutdown(server *http.Server, handler *proxy.Handler, cfg config.ShutdownConfig) {
+	handler.BeginShutdown()
+	if cfg.ReadyDelay > 0 {
+		time.Sleep(time.Duration(cfg.ReadyDelay) * time.Second)
+	}
+
+	drainTimeout := defaultDrainTimeout
+	if cfg.DrainTimeout > 0 {
+		drainTimeout = time.Duration(cfg.DrainTimeout) * time.Second
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	startTime := time.Now()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Warn("Drain timeout exceeded, closing remaining connections",
+			zap.Duration("drainTimeout", drainTimeout),
+			zap.Error(err))
+		_ = server.Close()
+	} else {
+		logger.Info("All in-flight requests drained", zap.Duration("duration", time.Since(startTime)))
+	}
+
+	// 强制断开后仍给缓存写入留出少量时间，避免写到一半的记录因连接关闭而丢失
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer closeCancel()
+	handler.Close(closeCtx)
+	logger.Info("Server stopped")
 }
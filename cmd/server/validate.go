@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go-llm-server/internal/config"
+	"os"
+	"strings"
+)
+
+// runValidate 实现 validate 子命令：加载并校验配置文件，输出所有问题，供 CI 在部署前检查。
+// 配置合法时返回 0，存在问题时返回 1，参数错误时返回 2
+func runValidate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	configFile := flags.String("f", config.DefaultConfigFile, "path to config file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *configFile, err)
+		return 1
+	}
+	if err := cfg.Validate(); err != nil {
+		problems := strings.Split(err.Error(), "\n")
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", *configFile, problem)
+		}
+		fmt.Fprintf(os.Stderr, "%d problem(s) found\n", len(problems))
+		return 1
+	}
+	fmt.Printf("%s: ok\n", *configFile)
+	return 0
+}
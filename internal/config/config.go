@@ -4,6 +4,7 @@ import (
 	"go-llm-server/pkg/logger"
 	"os"
 	"regexp"
+	"time"
 
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
@@ -11,27 +12,291 @@ import (
 
 // ModelRoute 模型路由配置
 type ModelRoute struct {
-	URLs []string `yaml:"urls"`
+	URLs        []string            `yaml:"urls"`
+	Weights     []int               `yaml:"-"`        // 与 URLs 一一对应，来自 urls 条目中的 weight，默认 1
+	Strategy    string              `yaml:"strategy"` // 负载均衡策略，为空时使用 round_robin
+	Credentials UpstreamCredentials `yaml:",inline"`
+	Provider    string              `yaml:"provider"`    // 上游接口格式：openai（默认）、anthropic、gemini、azure
+	APIVersion  string              `yaml:"api_version"` // anthropic-version 请求头或 Azure 的 api-version 参数
+	Deployment  string              `yaml:"deployment"`  // Azure 部署名，默认使用模型名
+	// 模型列表（models_api）中展示的元数据，可选
+	OwnedBy       string `yaml:"owned_by"`
+	ContextLength int    `yaml:"context_length"`
 }
 
+// 模型路由的上游接口格式
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderGemini    = "gemini"
+	ProviderAzure     = "azure"
+)
+
+// 上游凭证的注入格式
+const (
+	AuthTypeBearer  = "bearer"    // Authorization: Bearer <key>，OpenAI 兼容服务
+	AuthTypeXAPIKey = "x-api-key" // x-api-key: <key>，Anthropic
+	AuthTypeAPIKey  = "api-key"   // api-key: <key>，Azure OpenAI
+)
+
+// UpstreamCredentials 代理向上游注入的凭证，配置后客户端携带的鉴权头不再透传
+type UpstreamCredentials struct {
+	APIKeys  []string `yaml:"api_keys"`  // 多个 key 轮流使用，返回 401/429 的 key 会被暂时停用
+	AuthType string   `yaml:"auth_type"` // bearer（默认）、x-api-key、api-key
+}
+
+// Configured 是否配置了可用的上游 key
+func (c UpstreamCredentials) Configured() bool {
+	return len(c.APIKeys) > 0
+}
+
+// TargetRoute target_map 条目，可以是 URL 字符串，也可以是 {url, api_key(s), auth_type, strip_prefix, add_prefix} 形式
+type TargetRoute struct {
+	URL         string
+	Credentials UpstreamCredentials
+	Rewrite     PathRewrite
+}
+
+// UnmarshalYAML 兼容字符串与映射两种写法
+func (t *TargetRoute) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&t.URL)
+	}
+	var raw map[string]interface{}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	t.URL, _ = raw["url"].(string)
+	t.Credentials = parseCredentials(raw)
+	t.Rewrite.StripPrefix, _ = raw["strip_prefix"].(string)
+	t.Rewrite.AddPrefix, _ = raw["add_prefix"].(string)
+	return nil
+}
+
+// 请求限流的计数后端
+const (
+	RateLimitBackendMemory = "memory" // 进程内令牌桶，每个副本独立计数
+	RateLimitBackendRedis  = "redis"  // Redis GCRA，多个副本共享额度
+)
+
 type RateLimitConfig struct {
-	Rate  int `yaml:"rate"`
-	Burst int `yaml:"burst"`
+	Rate    int    `yaml:"rate"`
+	Burst   int    `yaml:"burst"`
+	Backend string `yaml:"backend"`  // memory（默认）或 redis
+	IdleTTL int    `yaml:"idle_ttl"` // 进程内限流器空闲多久后回收（秒），默认 600
 }
 
 // Config 应用配置结构
 type Config struct {
-	ProxyURL    string                 `yaml:"proxy_url"`
-	TargetMap   map[string]string      `yaml:"target_map"`
-	ModelRoutes map[string]interface{} `yaml:"model_routes"`  // 支持字符串或ModelRoute
-	ModelAlias  map[string]string      `yaml:"model_aliases"` // 自定义别名到真实模型的映射
-	Port        int                    `yaml:"port"`
-	RateLimit   RateLimitConfig        `yaml:"rate_limit"`
-	LogBody     bool                   `yaml:"log_body"` // 是否记录请求体
-	Database    DatabaseConfig         `yaml:"database"`
-	Redis       RedisConfig            `yaml:"redis"`
+	ProxyURL      string                         `yaml:"proxy_url"`
+	TargetMap     map[string]string              `yaml:"-"`             // 由 target_map 解析，路径规则到目标服务 URL
+	TargetAuth    map[string]UpstreamCredentials `yaml:"-"`             // 由 target_map 解析，路径规则到上游凭证
+	TargetRewrite map[string]PathRewrite         `yaml:"-"`             // 由 target_map 解析，路径规则到转发前的路径改写
+	ModelRoutes   map[string]interface{}         `yaml:"model_routes"`  // 支持字符串或ModelRoute
+	ModelAlias    map[string]string              `yaml:"model_aliases"` // 自定义别名到真实模型的映射
+	Fallbacks     map[string][]string            `yaml:"fallbacks"`     // 模型上游失败时依次尝试的备用模型
+	Port          int                            `yaml:"port"`
+	RateLimit     RateLimitConfig                `yaml:"rate_limit"`
+	LogBody       bool                           `yaml:"log_body"` // 是否记录请求体
+	Database      DatabaseConfig                 `yaml:"database"`
+	Redis         RedisConfig                    `yaml:"redis"`
+	Cache         CacheConfig                    `yaml:"cache"`
+	HealthCheck   HealthCheckConfig              `yaml:"health_check"`
+	Admin         AdminConfig                    `yaml:"admin"`
+	Retry         RetryConfig                    `yaml:"retry"`
+	Auth          AuthConfig                     `yaml:"auth"`
+	TokenLimit    TokenLimitConfig               `yaml:"token_limit"`
+	Metrics       MetricsConfig                  `yaml:"metrics"`
+	Tracing       TracingConfig                  `yaml:"tracing"`
+	Shutdown      ShutdownConfig                 `yaml:"shutdown"`
+	Reload        ReloadConfig                   `yaml:"reload"`
+	MessagesAPI   MessagesAPIConfig              `yaml:"messages_api"`
+	ResponsesAPI  ResponsesAPIConfig             `yaml:"responses_api"`
+	ModelsAPI     ModelsAPIConfig                `yaml:"models_api"`
+
+	unknownFields []error // 解析时发现的未知字段，由 Validate 返回
+}
+
+// MessagesAPIConfig Anthropic Messages API 入口：请求转换为 chat completions 格式后经 chat_path 转发，响应再转换回来
+type MessagesAPIConfig struct {
+	Path     string `yaml:"path"`      // 接收 Messages API 请求的路径，如 /v1/messages，为空表示不启用
+	ChatPath string `yaml:"chat_path"` // 转换后转发到的 target_map 路径，默认 /chat/completions
+}
+
+// DefaultMessagesChatPath Messages API 请求默认转发到的路径
+const DefaultMessagesChatPath = "/chat/completions"
+
+// ChatPathOrDefault 返回转换后转发到的路径
+func (c MessagesAPIConfig) ChatPathOrDefault() string {
+	if c.ChatPath == "" {
+		return DefaultMessagesChatPath
+	}
+	return c.ChatPath
+}
+
+// ResponsesAPIConfig OpenAI Responses API 入口：请求转换为 chat completions 格式后经 chat_path 转发，
+// 响应与对话历史保存在 Postgres，previous_response_id 因此可以续接任意上游的对话
+type ResponsesAPIConfig struct {
+	Path     string `yaml:"path"`      // 接收 Responses API 请求的路径，如 /v1/responses，为空表示不启用
+	ChatPath string `yaml:"chat_path"` // 转换后转发到的 target_map 路径，默认 /chat/completions
+	TTL      int    `yaml:"ttl"`       // 保存的响应存活时间（秒），0 表示永不过期
+}
+
+// ChatPathOrDefault 返回转换后转发到的路径
+func (c ResponsesAPIConfig) ChatPathOrDefault() string {
+	if c.ChatPath == "" {
+		return DefaultMessagesChatPath
+	}
+	return c.ChatPath
+}
+
+// ModelsAPIConfig 模型列表入口：由 model_routes 与 model_aliases 生成 OpenAI 格式的模型列表，
+// 可选合并各上游 /models 返回的模型，开启鉴权时按虚拟 API Key 允许的模型过滤
+type ModelsAPIConfig struct {
+	Path     string `yaml:"path"`      // 返回模型列表的路径，如 /v1/models，为空表示不启用；<path>/{model} 返回单个模型
+	Upstream bool   `yaml:"upstream"`  // 是否合并上游 /models 返回的模型
+	ChatPath string `yaml:"chat_path"` // 未配置 model_routes 的模型转发到的 target_map 路径，该上游的模型全部列出，默认 /chat/completions
+	CacheTTL int    `yaml:"cache_ttl"` // 上游模型列表的缓存时间（秒），默认 300
+	Timeout  int    `yaml:"timeout"`   // 请求单个上游的超时时间（秒），默认 5
+}
+
+// ChatPathOrDefault 返回默认上游所在的 target_map 路径
+func (c ModelsAPIConfig) ChatPathOrDefault() string {
+	if c.ChatPath == "" {
+		return DefaultMessagesChatPath
+	}
+	return c.ChatPath
+}
+
+// ReloadConfig 配置热加载，收到 SIGHUP 或检测到配置文件变化时重新加载
+type ReloadConfig struct {
+	Interval int `yaml:"interval"` // 检查配置文件变化的间隔（秒），默认 5，负数表示只响应 SIGHUP
+}
+
+// ShutdownConfig 优雅退出配置
+type ShutdownConfig struct {
+	DrainTimeout int `yaml:"drain_timeout"` // 收到 SIGTERM 后等待进行中请求（含流式响应）完成的最长时间（秒），默认 30
+	ReadyDelay   int `yaml:"ready_delay"`   // 就绪状态置为不可用后、停止接收新连接前的等待时间（秒），留给负载均衡摘除实例，默认 0
+}
+
+// TracingConfig 分布式追踪配置，span 通过 OTLP/HTTP（JSON）导出到 collector
+type TracingConfig struct {
+	Enabled     bool              `yaml:"enabled"`
+	Endpoint    string            `yaml:"endpoint"`     // collector 的 traces 地址，如 http://otel-collector:4318/v1/traces
+	ServiceName string            `yaml:"service_name"` // 上报的 service.name，默认 go-llm-server
+	SampleRatio float64           `yaml:"sample_ratio"` // 新 trace 的采样比例 (0, 1]，默认 1；携带 traceparent 的请求沿用调用方的采样标记
+	Headers     map[string]string `yaml:"headers"`      // 导出请求附加的请求头，如 collector 鉴权
+	Timeout     int               `yaml:"timeout"`      // 单次导出超时（秒），默认 10
+}
+
+// MetricsConfig Prometheus 指标配置
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"` // 指标路径，默认 /metrics
+}
+
+// TokenLimitConfig 按客户端和模型限制每分钟 token 数，计数保存在 Redis 中由多个副本共享
+type TokenLimitConfig struct {
+	ClientTPM int            `yaml:"client_tpm"` // 每个客户端每分钟 token 数，0 表示不限制
+	Clients   map[string]int `yaml:"clients"`    // 按客户端标识（虚拟 API Key 名称或客户端 IP）覆盖 client_tpm
+	Models    map[string]int `yaml:"models"`     // 每个模型每分钟 token 数，所有客户端共享
+}
+
+// Enabled 是否配置了任何 token 限制
+func (c TokenLimitConfig) Enabled() bool {
+	if c.ClientTPM > 0 || len(c.Models) > 0 {
+		return true
+	}
+	for _, limit := range c.Clients {
+		if limit > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthConfig 虚拟 API Key 鉴权配置，key 存储在 Postgres 的 api_keys 表中
+type AuthConfig struct {
+	Enabled  bool `yaml:"enabled"`   // 开启后所有代理请求必须携带有效的 Authorization: Bearer <key>
+	CacheTTL int  `yaml:"cache_ttl"` // key 信息在 Redis 中的缓存时间（秒），默认 60
+}
+
+// RetryConfig 上游失败重试配置，仅在响应返回客户端之前重试
+type RetryConfig struct {
+	MaxAttempts    int   `yaml:"max_attempts"`    // 最大尝试次数（含首次），小于等于 1 表示不重试
+	Budget         int   `yaml:"budget"`          // 所有尝试的总耗时预算（秒），超出后不再发起新的尝试，0 表示不限制
+	AttemptTimeout int   `yaml:"attempt_timeout"` // 单次尝试等待响应头的超时（秒），0 表示不限制
+	StatusCodes    []int `yaml:"status_codes"`    // 触发重试的上游状态码，默认 429、502、503
+}
+
+// HealthCheckConfig 后端健康检查配置
+type HealthCheckConfig struct {
+	MaxFailures int               `yaml:"max_failures"` // 连续传输错误或 5xx 达到该次数后摘除，默认 3，负数表示关闭被动检测
+	Cooldown    int               `yaml:"cooldown"`     // 摘除后重新接入前的冷却时间（秒），默认 30
+	Active      ActiveCheckConfig `yaml:"active"`
+}
+
+// ActiveCheckConfig 主动探测配置
+type ActiveCheckConfig struct {
+	Interval int    `yaml:"interval"` // 探测间隔（秒），0 表示不启用主动探测
+	Path     string `yaml:"path"`     // 探测路径，拼接在模型路由 URL 之后，默认 /models
+	Timeout  int    `yaml:"timeout"`  // 单次探测超时（秒），默认 5
+}
+
+// AdminConfig 管理接口配置
+type AdminConfig struct {
+	Token string `yaml:"token"` // 管理接口 Bearer Token，为空时管理接口不可用
+}
+
+// CacheConfig 缓存配置
+type CacheConfig struct {
+	IgnoreFields   []string                    `yaml:"ignore_fields"`    // 计算 LLM 缓存键时忽略的请求字段，未配置时使用默认值
+	KeyFields      []string                    `yaml:"key_fields"`       // 仅使用这些请求字段计算 LLM 缓存键，为空表示使用全部字段
+	TTL            int                         `yaml:"ttl"`              // 缓存条目默认存活时间（秒），0 表示永不过期
+	SweepInterval  int                         `yaml:"sweep_interval"`   // 过期条目清理间隔（秒），0 表示不启用
+	SweepBatchSize int                         `yaml:"sweep_batch_size"` // 每批删除的过期条目数
+	Models         map[string]CacheModelConfig `yaml:"models"`           // 按模型覆盖的缓存配置
+	Dedup          DedupConfig                 `yaml:"dedup"`            // 并发相同请求合并
 }
 
+// DedupConfig 并发相同请求合并配置：缓存未命中的相同请求同时只有一个访问上游，
+// 其余请求等待其写入缓存后直接返回缓存结果
+type DedupConfig struct {
+	Enabled     bool `yaml:"enabled"`
+	Wait        int  `yaml:"wait"`        // 等待领头请求的最长时间（秒），超时后自行访问上游，默认 30
+	Distributed bool `yaml:"distributed"` // 通过 Redis 锁在多个副本之间合并请求
+}
+
+// DefaultDedupWait 等待领头请求的默认最长时间（秒）
+const DefaultDedupWait = 30
+
+// CacheModelConfig 单个模型的缓存配置，未配置的字段继承 CacheConfig
+type CacheModelConfig struct {
+	IgnoreFields []string             `yaml:"ignore_fields"`
+	KeyFields    []string             `yaml:"key_fields"`
+	TTL          *int                 `yaml:"ttl"`      // 秒，0 表示永不过期
+	Semantic     *SemanticCacheConfig `yaml:"semantic"` // 语义缓存，未配置时只按请求哈希精确匹配
+}
+
+// SemanticCacheConfig 语义缓存配置：对最后一条用户消息计算 embedding，
+// 除该消息外的请求内容（system prompt、历史消息、tools 与参数）完全一致且向量相似度达到阈值时命中
+type SemanticCacheConfig struct {
+	EmbeddingModel string  `yaml:"embedding_model"` // 计算向量使用的 embedding 模型
+	EmbeddingPath  string  `yaml:"embedding_path"`  // embedding 接口路径，需在 target_map 中配置，默认 /embeddings
+	Threshold      float64 `yaml:"threshold"`       // 余弦相似度阈值 (0, 1]，默认 0.95
+	MaxCandidates  int     `yaml:"max_candidates"`  // 未安装 pgvector 时逐条比较的最近条目数上限，默认 1000
+}
+
+// 语义缓存默认值
+const (
+	DefaultSemanticEmbeddingPath = "/embeddings"
+	DefaultSemanticThreshold     = 0.95
+	DefaultSemanticMaxCandidates = 1000
+)
+
+// DefaultCacheIgnoreFields 默认不参与 LLM 缓存键计算的非语义字段
+var DefaultCacheIgnoreFields = []string{"user", "metadata", "stream", "stream_options"}
+
 // DatabaseConfig 数据库配置
 type DatabaseConfig struct {
 	Host            string `yaml:"host"`
@@ -70,11 +335,14 @@ func expandEnvWithDefault(s string) string {
 	})
 }
 
+// DefaultConfigFile 未指定 -f 时加载的配置文件
+const DefaultConfigFile = "configs/config.yml"
+
 // LoadConfig 加载配置文件
 func LoadConfig(configFile string) (*Config, error) {
 	// 如果未指定配置文件，使用默认值
 	if configFile == "" {
-		configFile = "configs/config.yml"
+		configFile = DefaultConfigFile
 		logger.Info("loading default config file", zap.String("file", configFile))
 	}
 
@@ -94,29 +362,117 @@ func LoadConfig(configFile string) (*Config, error) {
 	return &config, nil
 }
 
+// UnmarshalYAML 解析配置，target_map 条目中的 URL、凭证与路径改写分别写入 TargetMap、TargetAuth 和 TargetRewrite
+func (c *Config) UnmarshalYAML(value *yaml.Node) error {
+	type plainConfig Config
+	var raw struct {
+		plainConfig `yaml:",inline"`
+		TargetMap   map[string]TargetRoute `yaml:"target_map"`
+	}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	*c = Config(raw.plainConfig)
+	c.unknownFields = unknownFields(value)
+	if raw.TargetMap != nil {
+		c.TargetMap = make(map[string]string, len(raw.TargetMap))
+		for path, target := range raw.TargetMap {
+			c.TargetMap[path] = target.URL
+			if target.Credentials.Configured() {
+				if c.TargetAuth == nil {
+					c.TargetAuth = make(map[string]UpstreamCredentials)
+				}
+				c.TargetAuth[path] = target.Credentials
+			}
+			if target.Rewrite.Configured() {
+				if c.TargetRewrite == nil {
+					c.TargetRewrite = make(map[string]PathRewrite)
+				}
+				c.TargetRewrite[path] = target.Rewrite
+			}
+		}
+	}
+	return nil
+}
+
 // GetModelURLs 获取模型的URL列表，支持单个URL和多个URL
 func (c *Config) GetModelURLs(model string) ([]string, bool) {
+	route, ok := c.GetModelRoute(model)
+	if !ok {
+		return nil, false
+	}
+	return route.URLs, true
+}
+
+// GetModelRoute 获取模型的完整路由配置。urls 条目可以是字符串，也可以是 {url, weight} 形式
+func (c *Config) GetModelRoute(model string) (ModelRoute, bool) {
 	if route, exists := c.ModelRoutes[model]; exists {
 		switch v := route.(type) {
 		case string:
 			// 单个URL的情况
-			return []string{v}, true
+			return ModelRoute{URLs: []string{v}, Weights: []int{1}}, true
 		case map[string]interface{}:
 			// 多个URL的情况
 			if urls, ok := v["urls"]; ok {
 				if urlList, ok := urls.([]interface{}); ok {
-					result := make([]string, len(urlList))
+					result := ModelRoute{
+						URLs:    make([]string, len(urlList)),
+						Weights: make([]int, len(urlList)),
+					}
 					for i, url := range urlList {
-						if urlStr, ok := url.(string); ok {
-							result[i] = urlStr
+						result.Weights[i] = 1
+						switch entry := url.(type) {
+						case string:
+							result.URLs[i] = entry
+						case map[string]interface{}:
+							result.URLs[i], _ = entry["url"].(string)
+							if weight, ok := toInt(entry["weight"]); ok {
+								result.Weights[i] = weight
+							}
 						}
 					}
+					result.Strategy, _ = v["strategy"].(string)
+					result.Credentials = parseCredentials(v)
+					result.Provider, _ = v["provider"].(string)
+					result.APIVersion, _ = v["api_version"].(string)
+					result.Deployment, _ = v["deployment"].(string)
+					result.OwnedBy, _ = v["owned_by"].(string)
+					result.ContextLength, _ = toInt(v["context_length"])
 					return result, true
 				}
 			}
 		}
 	}
-	return nil, false
+	return ModelRoute{}, false
+}
+
+// parseCredentials 读取 api_key / api_keys / auth_type，未设置的环境变量展开为空字符串后被忽略
+func parseCredentials(v map[string]interface{}) UpstreamCredentials {
+	var creds UpstreamCredentials
+	if key, ok := v["api_key"].(string); ok && key != "" {
+		creds.APIKeys = append(creds.APIKeys, key)
+	}
+	if keys, ok := v["api_keys"].([]interface{}); ok {
+		for _, k := range keys {
+			if key, ok := k.(string); ok && key != "" {
+				creds.APIKeys = append(creds.APIKeys, key)
+			}
+		}
+	}
+	creds.AuthType, _ = v["auth_type"].(string)
+	return creds
+}
+
+func toInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
 }
 
 func (c *Config) HasRateLimit() bool {
@@ -133,3 +489,104 @@ func (c *Config) ResolveModel(model string) string {
 	}
 	return model
 }
+
+// ClientTPM 返回客户端每分钟 token 限制，0 表示不限制
+func (c *Config) ClientTPM(client string) int {
+	if c == nil {
+		return 0
+	}
+	if limit, ok := c.TokenLimit.Clients[client]; ok {
+		return limit
+	}
+	return c.TokenLimit.ClientTPM
+}
+
+// ModelTPM 返回模型每分钟 token 限制，先按原名查找，再按别名解析后的模型名查找，0 表示不限制
+func (c *Config) ModelTPM(model string) int {
+	if c == nil {
+		return 0
+	}
+	if limit, ok := c.TokenLimit.Models[model]; ok {
+		return limit
+	}
+	return c.TokenLimit.Models[c.ResolveModel(model)]
+}
+
+// ModelFallbacks 返回模型的备用模型列表，先按原名查找，再按别名解析后的模型名查找
+func (c *Config) ModelFallbacks(model string) []string {
+	if c == nil {
+		return nil
+	}
+	if fallbacks, ok := c.Fallbacks[model]; ok {
+		return fallbacks
+	}
+	return c.Fallbacks[c.ResolveModel(model)]
+}
+
+// LLMCacheKeyFields 返回指定模型计算 LLM 缓存键时的忽略字段和保留字段，模型名先经过别名解析
+func (c *Config) LLMCacheKeyFields(model string) (ignoreFields, keyFields []string) {
+	if c == nil {
+		return DefaultCacheIgnoreFields, nil
+	}
+	ignoreFields = c.Cache.IgnoreFields
+	if ignoreFields == nil {
+		ignoreFields = DefaultCacheIgnoreFields
+	}
+	keyFields = c.Cache.KeyFields
+
+	if modelCfg, ok := c.cacheModelConfig(model); ok {
+		if modelCfg.IgnoreFields != nil {
+			ignoreFields = modelCfg.IgnoreFields
+		}
+		if modelCfg.KeyFields != nil {
+			keyFields = modelCfg.KeyFields
+		}
+	}
+	return ignoreFields, keyFields
+}
+
+// CacheTTL 返回指定模型缓存条目的存活时间，0 表示永不过期
+func (c *Config) CacheTTL(model string) time.Duration {
+	if c == nil {
+		return 0
+	}
+	ttl := c.Cache.TTL
+	if modelCfg, ok := c.cacheModelConfig(model); ok && modelCfg.TTL != nil {
+		ttl = *modelCfg.TTL
+	}
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// SemanticCache 返回指定模型的语义缓存配置并填充默认值，未开启时返回 false
+func (c *Config) SemanticCache(model string) (SemanticCacheConfig, bool) {
+	if c == nil {
+		return SemanticCacheConfig{}, false
+	}
+	modelCfg, ok := c.cacheModelConfig(model)
+	if !ok || modelCfg.Semantic == nil || modelCfg.Semantic.EmbeddingModel == "" {
+		return SemanticCacheConfig{}, false
+	}
+	semantic := *modelCfg.Semantic
+	if semantic.EmbeddingPath == "" {
+		semantic.EmbeddingPath = DefaultSemanticEmbeddingPath
+	}
+	if semantic.Threshold == 0 {
+		semantic.Threshold = DefaultSemanticThreshold
+	}
+	if semantic.MaxCandidates == 0 {
+		semantic.MaxCandidates = DefaultSemanticMaxCandidates
+	}
+	return semantic, true
+}
+
+// cacheModelConfig 查找模型的缓存配置，先按原名匹配，再按别名解析后的真实模型匹配
+func (c *Config) cacheModelConfig(model string) (CacheModelConfig, bool) {
+	if modelCfg, ok := c.Cache.Models[model]; ok {
+		return modelCfg, true
+	}
+	modelCfg, ok := c.Cache.Models[c.ResolveModel(model)]
+	return modelCfg, ok
+}
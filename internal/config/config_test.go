@@ -1,8 +1,13 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // TestLoadConfig tests configuration loading functionality
@@ -255,6 +260,240 @@ func TestGetModelURLsWithMixedTypes(t *testing.T) {
 	}
 }
 
+// TestGetModelRoute tests strategy and per-URL weight parsing
+func TestGetModelRoute(t *testing.T) {
+	var config Config
+	data := `
+model_routes:
+  "weighted":
+    strategy: weighted
+    urls:
+      - url: "https://api.example.com/v1"
+        weight: 3
+      - "https://api.example.com/v2"
+  "single": "https://api.example.com/v1"
+  "azure":
+    urls: ["https://example.openai.azure.com"]
+    provider: azure
+    api_version: "2025-01-01-preview"
+    deployment: gpt4o-prod
+    owned_by: openai
+    context_length: 128000
+`
+	if err := yaml.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+
+	route, ok := config.GetModelRoute("weighted")
+	if !ok {
+		t.Fatalf("expected weighted route to exist")
+	}
+	if route.Strategy != "weighted" {
+		t.Errorf("Strategy = %q, expected weighted", route.Strategy)
+	}
+	expectedURLs := []string{"https://api.example.com/v1", "https://api.example.com/v2"}
+	expectedWeights := []int{3, 1}
+	for i := range expectedURLs {
+		if route.URLs[i] != expectedURLs[i] || route.Weights[i] != expectedWeights[i] {
+			t.Errorf("entry[%d] = (%s, %d), expected (%s, %d)", i, route.URLs[i], route.Weights[i], expectedURLs[i], expectedWeights[i])
+		}
+	}
+
+	route, ok = config.GetModelRoute("single")
+	if !ok || route.Strategy != "" || len(route.URLs) != 1 || route.Weights[0] != 1 {
+		t.Errorf("unexpected single route: %+v", route)
+	}
+
+	route, ok = config.GetModelRoute("azure")
+	if !ok || route.Provider != ProviderAzure || route.APIVersion != "2025-01-01-preview" || route.Deployment != "gpt4o-prod" {
+		t.Errorf("unexpected azure route: %+v", route)
+	}
+	if route.OwnedBy != "openai" || route.ContextLength != 128000 {
+		t.Errorf("unexpected azure route metadata: %+v", route)
+	}
+
+	if _, ok := config.GetModelRoute("missing"); ok {
+		t.Errorf("expected missing route to not exist")
+	}
+}
+
+// TestUpstreamCredentials tests credential parsing from model_routes and target_map
+func TestUpstreamCredentials(t *testing.T) {
+	os.Setenv("TEST_UPSTREAM_KEY_1", "sk-one")
+	defer os.Unsetenv("TEST_UPSTREAM_KEY_1")
+	os.Unsetenv("TEST_UPSTREAM_KEY_2")
+
+	configData := `
+target_map:
+  "/chat/completions": "https://api.openai.com/v1"
+  "/v1/messages":
+    url: "https://api.anthropic.com"
+    api_key: "${TEST_UPSTREAM_KEY_1}"
+    auth_type: x-api-key
+model_routes:
+  "gpt-4":
+    urls: ["https://api.openai.com/v1"]
+    api_keys:
+      - "${TEST_UPSTREAM_KEY_1}"
+      - "${TEST_UPSTREAM_KEY_2}"
+      - "sk-literal"
+  "plain": "https://api.example.com/v1"
+`
+	configFile := "test_upstream_credentials.yml"
+	if err := os.WriteFile(configFile, []byte(configData), 0644); err != nil {
+		t.Fatalf("failed to create test config file: %v", err)
+	}
+	defer os.Remove(configFile)
+
+	config, err := LoadConfig(configFile)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if config.TargetMap["/chat/completions"] != "https://api.openai.com/v1" || config.TargetMap["/v1/messages"] != "https://api.anthropic.com" {
+		t.Errorf("unexpected TargetMap: %v", config.TargetMap)
+	}
+	if _, ok := config.TargetAuth["/chat/completions"]; ok {
+		t.Errorf("expected no credentials for /chat/completions")
+	}
+	creds := config.TargetAuth["/v1/messages"]
+	if strings.Join(creds.APIKeys, ",") != "sk-one" || creds.AuthType != AuthTypeXAPIKey {
+		t.Errorf("unexpected /v1/messages credentials: %+v", creds)
+	}
+
+	route, _ := config.GetModelRoute("gpt-4")
+	// 未设置的环境变量展开为空字符串，应被忽略
+	if strings.Join(route.Credentials.APIKeys, ",") != "sk-one,sk-literal" || route.Credentials.AuthType != "" {
+		t.Errorf("unexpected gpt-4 credentials: %+v", route.Credentials)
+	}
+	route, _ = config.GetModelRoute("plain")
+	if route.Credentials.Configured() {
+		t.Errorf("expected no credentials for plain route, got %+v", route.Credentials)
+	}
+}
+
+// TestTargetRouter tests exact, prefix and regex target_map rules and path rewriting
+func TestTargetRouter(t *testing.T) {
+	var config Config
+	data := `
+target_map:
+  /v1/chat/completions: "https://exact.example.com/v1"
+  /v1/*: "https://prefix.example.com/v1"
+  /v1/audio/*:
+    url: "https://audio.example.com"
+    strip_prefix: /v1
+    add_prefix: /openai
+  /legacy/*:
+    url: "https://legacy.example.com"
+    strip_prefix: /legacy
+  "~^/deployments/[^/]+/chat/completions$": "https://azure.example.com"
+  "~^/v1/": "https://never.example.com"
+`
+	if err := yaml.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if got := config.TargetRewrite["/legacy/*"]; got != (PathRewrite{StripPrefix: "/legacy"}) {
+		t.Errorf("TargetRewrite[/legacy/*] = %+v", got)
+	}
+	if _, ok := config.TargetRewrite["/v1/*"]; ok {
+		t.Errorf("expected no rewrite for /v1/*")
+	}
+
+	router, err := NewTargetRouter(&config)
+	if err != nil {
+		t.Fatalf("NewTargetRouter failed: %v", err)
+	}
+	tests := []struct {
+		path, key, url, upstreamPath string
+	}{
+		{"/v1/chat/completions", "/v1/chat/completions", "https://exact.example.com/v1", "/v1/chat/completions"},
+		{"/v1/embeddings", "/v1/*", "https://prefix.example.com/v1", "/v1/embeddings"},
+		// 最长前缀优先
+		{"/v1/audio/speech", "/v1/audio/*", "https://audio.example.com", "/openai/audio/speech"},
+		{"/legacy", "/legacy/*", "", ""},
+		{"/legacy/chat/completions", "/legacy/*", "https://legacy.example.com", "/chat/completions"},
+		{"/legacy/", "/legacy/*", "https://legacy.example.com", "/"},
+		{"/deployments/gpt-4o/chat/completions", "~^/deployments/[^/]+/chat/completions$", "https://azure.example.com", "/deployments/gpt-4o/chat/completions"},
+		{"/deployments/gpt-4o/embeddings", "", "", ""},
+	}
+	for _, tt := range tests {
+		match, ok := router.Match(tt.path)
+		if tt.url == "" {
+			if ok {
+				t.Errorf("Match(%q) = %+v, expected no match", tt.path, match)
+			}
+			continue
+		}
+		if !ok || match.Key != tt.key || match.URL != tt.url || match.Path != tt.upstreamPath {
+			t.Errorf("Match(%q) = %+v, %v, expected {%s %s %s}", tt.path, match, ok, tt.key, tt.url, tt.upstreamPath)
+		}
+	}
+
+	var nilRouter *TargetRouter
+	if _, ok := nilRouter.Match("/v1/chat/completions"); ok {
+		t.Errorf("expected nil router to match nothing")
+	}
+}
+
+// TestTokenLimits tests per-client and per-model token limit lookup
+func TestTokenLimits(t *testing.T) {
+	config := &Config{
+		ModelAlias: map[string]string{"my-gpt": "gpt-4"},
+		TokenLimit: TokenLimitConfig{
+			ClientTPM: 1000,
+			Clients:   map[string]int{"team-a": 5000, "10.0.0.1": 0},
+			Models:    map[string]int{"gpt-4": 20000},
+		},
+	}
+
+	if !config.TokenLimit.Enabled() {
+		t.Errorf("expected token limit to be enabled")
+	}
+	if got := config.ClientTPM("team-a"); got != 5000 {
+		t.Errorf("ClientTPM(team-a) = %d, expected 5000", got)
+	}
+	if got := config.ClientTPM("10.0.0.1"); got != 0 {
+		t.Errorf("ClientTPM(10.0.0.1) = %d, expected 0 (override disables limit)", got)
+	}
+	if got := config.ClientTPM("other"); got != 1000 {
+		t.Errorf("ClientTPM(other) = %d, expected 1000", got)
+	}
+	if got := config.ModelTPM("my-gpt"); got != 20000 {
+		t.Errorf("ModelTPM(my-gpt) = %d, expected 20000", got)
+	}
+	if got := config.ModelTPM("qwen"); got != 0 {
+		t.Errorf("ModelTPM(qwen) = %d, expected 0", got)
+	}
+	if (TokenLimitConfig{}).Enabled() {
+		t.Errorf("expected empty token limit to be disabled")
+	}
+}
+
+// TestModelFallbacks tests fallback lookup by model name and alias
+func TestModelFallbacks(t *testing.T) {
+	config := &Config{
+		ModelAlias: map[string]string{"my-gpt": "gpt-4"},
+		Fallbacks: map[string][]string{
+			"gpt-4": {"qwen3-235b", "deepseek-v3"},
+		},
+	}
+
+	if got := config.ModelFallbacks("gpt-4"); strings.Join(got, ",") != "qwen3-235b,deepseek-v3" {
+		t.Errorf("ModelFallbacks(gpt-4) = %v", got)
+	}
+	if got := config.ModelFallbacks("my-gpt"); strings.Join(got, ",") != "qwen3-235b,deepseek-v3" {
+		t.Errorf("ModelFallbacks(my-gpt) = %v", got)
+	}
+	if got := config.ModelFallbacks("other"); got != nil {
+		t.Errorf("ModelFallbacks(other) = %v, expected nil", got)
+	}
+
+	var nilConfig *Config
+	if got := nilConfig.ModelFallbacks("gpt-4"); got != nil {
+		t.Errorf("nil config ModelFallbacks = %v, expected nil", got)
+	}
+}
+
 // TestConfigStruct tests Config struct field access
 func TestConfigStruct(t *testing.T) {
 	config := &Config{
@@ -790,3 +1029,334 @@ log_body: true
 		}
 	})
 }
+
+// TestLLMCacheKeyFields tests default and per-model LLM cache key settings
+func TestLLMCacheKeyFields(t *testing.T) {
+	var nilCfg *Config
+	ignore, keys := nilCfg.LLMCacheKeyFields("gpt-4")
+	if len(ignore) != len(DefaultCacheIgnoreFields) || keys != nil {
+		t.Errorf("nil config should return defaults, got %v %v", ignore, keys)
+	}
+
+	cfg := &Config{
+		ModelAlias: map[string]string{"my-gpt": "gpt-4"},
+		Cache: CacheConfig{
+			IgnoreFields: []string{"user"},
+			Models: map[string]CacheModelConfig{
+				"gpt-4":    {IgnoreFields: []string{"user", "seed"}},
+				"qwen-max": {KeyFields: []string{"messages"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		model          string
+		expectedIgnore []string
+		expectedKeys   []string
+	}{
+		{model: "deepseek", expectedIgnore: []string{"user"}},
+		{model: "gpt-4", expectedIgnore: []string{"user", "seed"}},
+		{model: "my-gpt", expectedIgnore: []string{"user", "seed"}},
+		{model: "qwen-max", expectedIgnore: []string{"user"}, expectedKeys: []string{"messages"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			ignore, keys := cfg.LLMCacheKeyFields(tt.model)
+			if strings.Join(ignore, ",") != strings.Join(tt.expectedIgnore, ",") {
+				t.Errorf("expected ignore fields %v, got %v", tt.expectedIgnore, ignore)
+			}
+			if strings.Join(keys, ",") != strings.Join(tt.expectedKeys, ",") {
+				t.Errorf("expected key fields %v, got %v", tt.expectedKeys, keys)
+			}
+		})
+	}
+
+	cfg = &Config{}
+	ignore, _ = cfg.LLMCacheKeyFields("gpt-4")
+	if strings.Join(ignore, ",") != strings.Join(DefaultCacheIgnoreFields, ",") {
+		t.Errorf("expected default ignore fields, got %v", ignore)
+	}
+}
+
+// TestCacheTTL tests default and per-model cache TTLs
+func TestCacheTTL(t *testing.T) {
+	var nilCfg *Config
+	if ttl := nilCfg.CacheTTL("gpt-4"); ttl != 0 {
+		t.Errorf("nil config should never expire, got %v", ttl)
+	}
+
+	never := 0
+	short := 60
+	cfg := &Config{
+		ModelAlias: map[string]string{"fast-embedding": "embedding-2"},
+		Cache: CacheConfig{
+			TTL: 3600,
+			Models: map[string]CacheModelConfig{
+				"embedding-2": {TTL: &short},
+				"gpt-4":       {TTL: &never},
+				"qwen-max":    {IgnoreFields: []string{"user"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		model    string
+		expected time.Duration
+	}{
+		{model: "deepseek", expected: time.Hour},
+		{model: "qwen-max", expected: time.Hour},
+		{model: "embedding-2", expected: time.Minute},
+		{model: "fast-embedding", expected: time.Minute},
+		{model: "gpt-4", expected: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if ttl := cfg.CacheTTL(tt.model); ttl != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, ttl)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := &Config{
+		TargetMap: map[string]string{"/chat/completions": "https://api.openai.com/v1"},
+		ModelRoutes: map[string]interface{}{
+			"gpt-4": map[string]interface{}{"urls": []interface{}{"https://a.example.com/v1"}},
+		},
+		ModelAlias: map[string]string{"gpt4": "gpt-4"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+
+	cfg.TargetMap["/embeddings"] = "api.openai.com"
+	cfg.ModelRoutes["broken"] = map[string]interface{}{"urls": []interface{}{}}
+	cfg.ModelAlias["claude"] = "claude-3"
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	// 一次返回所有问题
+	for _, want := range []string{"target_map./embeddings", "model_routes.broken", "model_aliases.claude"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got %v", want, err)
+		}
+	}
+
+	if err := (&Config{}).Validate(); err == nil {
+		t.Error("expected error for empty target_map")
+	}
+}
+
+func TestValidateUnknownFields(t *testing.T) {
+	data := `
+target_map:
+  /chat/completions:
+    url: "https://api.openai.com/v1"
+    api_kye: "sk-test"
+model_routes:
+  gpt-4:
+    url: "https://a.example.com/v1"
+  gpt-3.5:
+    urls:
+      - url: "https://b.example.com/v1"
+        weight: 2
+      - url: "https://c.example.com/v1"
+        wieght: 1
+cache:
+  tll: 60
+  models:
+    gpt-4:
+      ttl: 60
+      key_field: ["model"]
+databse:
+  host: localhost
+`
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{
+		`target_map./chat/completions: line 5: unknown field "api_kye"`,
+		`model_routes.gpt-4: line 8: unknown field "url"`,
+		"model_routes.gpt-4: no urls configured",
+		`model_routes.gpt-3.5.urls: line 14: unknown field "wieght"`,
+		`cache: line 16: unknown field "tll"`,
+		`cache.models.gpt-4: line 20: unknown field "key_field"`,
+		`line 21: unknown field "databse"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestValidateTargetRules(t *testing.T) {
+	cfg := &Config{
+		TargetMap: map[string]string{
+			"/v1/*":     "https://api.openai.com/v1",
+			"v2/*":      "https://api.openai.com/v1",
+			"~^/v3/(":   "https://api.openai.com/v1",
+			"~^/v4/.+$": "https://api.openai.com/v1",
+		},
+		TargetRewrite: map[string]PathRewrite{"/v1/*": {StripPrefix: "v1", AddPrefix: "openai"}},
+		// 前缀与正则规则能匹配的路径同样可以作为 chat_path
+		MessagesAPI: MessagesAPIConfig{Path: "/v1/messages", ChatPath: "/v4/chat/completions"},
+	}
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{
+		"target_map.v2/*: path must start with /",
+		`target_map./v1/*.strip_prefix: must start with /, got "v1"`,
+		`target_map./v1/*.add_prefix: must start with /, got "openai"`,
+		"target_map.~^/v3/(: invalid regex: error parsing regexp",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "messages_api") {
+		t.Errorf("messages_api.chat_path matches a regex rule, got:\n%v", err)
+	}
+}
+
+func TestValidateLimitsAndDependencies(t *testing.T) {
+	ttl := -1
+	cfg := &Config{
+		TargetMap: map[string]string{"/chat/completions": "https://api.openai.com/v1"},
+		ModelRoutes: map[string]interface{}{
+			"gpt-4": "https://a.example.com/v1",
+			"titan": map[string]interface{}{"urls": []interface{}{"https://bedrock.example.com"}, "provider": "bedrock"},
+		},
+		ModelAlias:   map[string]string{"a": "b", "b": "a", "gpt4": "my-gpt", "my-gpt": "gpt-4"},
+		Fallbacks:    map[string][]string{"gpt-4": {"claude"}},
+		RateLimit:    RateLimitConfig{Rate: -1, Burst: 10, Backend: "memcached"},
+		TokenLimit:   TokenLimitConfig{Models: map[string]int{"gpt-4": -100}},
+		Cache:        CacheConfig{Models: map[string]CacheModelConfig{"gpt-4": {TTL: &ttl}}, Dedup: DedupConfig{Enabled: true, Wait: -1}},
+		Auth:         AuthConfig{Enabled: true},
+		Database:     DatabaseConfig{Host: "localhost"},
+		MessagesAPI:  MessagesAPIConfig{Path: "v1/messages", ChatPath: "/v1/chat/completions"},
+		ResponsesAPI: ResponsesAPIConfig{Path: "/chat/completions", TTL: -1},
+		ModelsAPI:    ModelsAPIConfig{Path: "v1/models", Upstream: true, ChatPath: "/v1/chat/completions", CacheTTL: -1},
+	}
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{
+		"model_aliases.a: alias cycle a -> b -> a",
+		"model_aliases.b: alias cycle b -> a -> b",
+		`model_aliases.gpt4: target "my-gpt" is an alias`,
+		`fallbacks.gpt-4: fallback model "claude" has no model_routes entry`,
+		`model_routes.titan: unsupported provider "bedrock", expected openai, anthropic, gemini or azure`,
+		"rate_limit.rate: must not be negative",
+		`rate_limit.backend: unsupported backend "memcached"`,
+		"token_limit.models.gpt-4: must not be negative",
+		"cache.models.gpt-4.ttl: must not be negative",
+		"cache.dedup.wait: must not be negative",
+		"database.user: required by cache, auth, responses_api",
+		"database.dbname: required by cache, auth, responses_api",
+		"redis.addr: required by cache, responses_api, token_limit",
+		`messages_api.path: must start with /, got "v1/messages"`,
+		`messages_api.chat_path: "/v1/chat/completions" has no target_map entry`,
+		`responses_api.path: "/chat/completions" is also a target_map path`,
+		"responses_api.ttl: must not be negative",
+		`models_api.path: must start with /, got "v1/models"`,
+		`models_api.chat_path: "/v1/chat/completions" has no target_map entry`,
+		"models_api.cache_ttl: must not be negative",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "database.host") {
+		t.Errorf("database.host is configured, got:\n%v", err)
+	}
+}
+
+func TestSemanticCache(t *testing.T) {
+	cfg := &Config{
+		TargetMap:  map[string]string{"/chat/completions": "https://api.openai.com/v1", "/embeddings": "https://api.openai.com/v1"},
+		ModelAlias: map[string]string{"faq": "gpt-4"},
+		Cache: CacheConfig{Models: map[string]CacheModelConfig{
+			"gpt-4":   {Semantic: &SemanticCacheConfig{EmbeddingModel: "text-embedding-3-small", Threshold: 0.9}},
+			"gpt-3.5": {},
+		}},
+	}
+	semantic, ok := cfg.SemanticCache("faq")
+	if !ok {
+		t.Fatal("expected semantic cache for alias of gpt-4")
+	}
+	want := SemanticCacheConfig{
+		EmbeddingModel: "text-embedding-3-small",
+		EmbeddingPath:  DefaultSemanticEmbeddingPath,
+		Threshold:      0.9,
+		MaxCandidates:  DefaultSemanticMaxCandidates,
+	}
+	if semantic != want {
+		t.Errorf("SemanticCache(faq) = %+v, want %+v", semantic, want)
+	}
+	if _, ok := cfg.SemanticCache("gpt-3.5"); ok {
+		t.Error("expected semantic cache to be disabled for gpt-3.5")
+	}
+
+	cfg.Cache.Models["gpt-3.5"] = CacheModelConfig{Semantic: &SemanticCacheConfig{EmbeddingPath: "/v1/embeddings", Threshold: 1.5, MaxCandidates: -1}}
+	errs := cfg.validateSemanticCache()
+	got := errors.Join(errs...)
+	for _, want := range []string{
+		"cache.models.gpt-3.5.semantic.embedding_model: required",
+		`cache.models.gpt-3.5.semantic.embedding_path: "/v1/embeddings" has no target_map entry`,
+		"cache.models.gpt-3.5.semantic.threshold: must be between 0 and 1, got 1.5",
+		"cache.models.gpt-3.5.semantic.max_candidates: must not be negative",
+	} {
+		if got == nil || !strings.Contains(got.Error(), want) {
+			t.Errorf("expected error to contain %q, got:\n%v", want, got)
+		}
+	}
+	if len(errs) != 4 {
+		t.Errorf("expected 4 errors, got %d:\n%v", len(errs), got)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := &Config{
+		TargetMap:   map[string]string{"/chat/completions": "https://api.openai.com/v1"},
+		ModelRoutes: map[string]interface{}{"gpt-4": "https://a.example.com/v1", "gpt-3.5": "https://b.example.com/v1"},
+		Database:    DatabaseConfig{Password: "old-secret"},
+		Cache:       CacheConfig{TTL: 60},
+	}
+	updated := &Config{
+		TargetMap:   map[string]string{"/chat/completions": "https://api.openai.com/v1"},
+		ModelRoutes: map[string]interface{}{"gpt-4": "https://c.example.com/v1", "o1": "https://b.example.com/v1"},
+		Database:    DatabaseConfig{Password: "new-secret"},
+		Cache:       CacheConfig{TTL: 120},
+	}
+
+	got := Diff(old, updated)
+	want := []string{
+		"model_routes.gpt-3.5: removed",
+		"model_routes.gpt-4: changed",
+		"model_routes.o1: added",
+		"database.password: changed",
+		"cache.ttl: changed",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Diff() = %v, want %v", got, want)
+	}
+	for _, change := range got {
+		if strings.Contains(change, "secret") {
+			t.Errorf("Diff() leaked a value: %q", change)
+		}
+	}
+
+	if changes := Diff(old, old); len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Diff 比较两份配置，返回发生变化的配置项，如 "model_routes.gpt-4: changed"、
+// "cache.ttl: changed"。只输出配置项名称，不输出值，避免在日志中泄露密码和上游 key
+func Diff(old, updated *Config) []string {
+	if old == nil || updated == nil {
+		return []string{"config: changed"}
+	}
+	return diffStruct("", reflect.ValueOf(*old), reflect.ValueOf(*updated))
+}
+
+func diffStruct(prefix string, old, updated reflect.Value) []string {
+	var changes []string
+	t := old.Type()
+	for i := 0; i < t.NumField(); i++ {
+		of, nf := old.Field(i), updated.Field(i)
+		if !t.Field(i).IsExported() || reflect.DeepEqual(of.Interface(), nf.Interface()) {
+			continue
+		}
+		name := prefix + diffFieldName(t.Field(i))
+		switch {
+		case of.Kind() == reflect.Struct:
+			changes = append(changes, diffStruct(name+".", of, nf)...)
+		case of.Kind() == reflect.Map && of.Type().Key().Kind() == reflect.String:
+			changes = append(changes, diffMap(name, of, nf)...)
+		default:
+			changes = append(changes, name+": changed")
+		}
+	}
+	return changes
+}
+
+// diffFieldName 返回字段在配置文件中的名称；target_map 解析后拆分为 URL、凭证与路径改写三个字段
+func diffFieldName(field reflect.StructField) string {
+	switch field.Name {
+	case "TargetMap":
+		return "target_map"
+	case "TargetAuth":
+		return "target_map.credentials"
+	case "TargetRewrite":
+		return "target_map.rewrite"
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func diffMap(name string, old, updated reflect.Value) []string {
+	keys := map[string]bool{}
+	for _, key := range old.MapKeys() {
+		keys[key.String()] = true
+	}
+	for _, key := range updated.MapKeys() {
+		keys[key.String()] = true
+	}
+
+	var changes []string
+	for _, key := range sortedKeys(keys) {
+		k := reflect.ValueOf(key).Convert(old.Type().Key())
+		ov, nv := old.MapIndex(k), updated.MapIndex(k)
+		switch {
+		case !ov.IsValid():
+			changes = append(changes, name+"."+key+": added")
+		case !nv.IsValid():
+			changes = append(changes, name+"."+key+": removed")
+		case !reflect.DeepEqual(ov.Interface(), nv.Interface()):
+			changes = append(changes, name+"."+key+": changed")
+		}
+	}
+	return changes
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// target_map 与 model_routes 的条目写法较灵活（字符串或映射），不能直接从结构体推导允许的字段
+var (
+	credentialKeys  = []string{"api_key", "api_keys", "auth_type"}
+	targetRouteKeys = append([]string{"url", "strip_prefix", "add_prefix"}, credentialKeys...)
+	modelRouteKeys  = append([]string{"urls", "strategy", "provider", "api_version", "deployment", "owned_by", "context_length"}, credentialKeys...)
+	routeURLKeys    = []string{"url", "weight"}
+)
+
+// unknownFields 对照配置结构检查 YAML 中拼写错误或不支持的字段
+func unknownFields(root *yaml.Node) []error {
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	fields := yamlFields(reflect.TypeOf(Config{}))
+	var errs []error
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		switch key.Value {
+		case "target_map":
+			errs = append(errs, checkEntries(key.Value, value, targetRouteKeys, nil)...)
+		case "model_routes":
+			errs = append(errs, checkEntries(key.Value, value, modelRouteKeys, checkRouteURLs)...)
+		default:
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				errs = append(errs, unknownFieldError("", key))
+				continue
+			}
+			errs = append(errs, checkNode(key.Value, value, fieldType)...)
+		}
+	}
+	return errs
+}
+
+// checkEntries 检查路径或模型到路由条目的映射，条目为映射时只允许 keys 中的字段
+func checkEntries(path string, node *yaml.Node, keys []string, nested func(path string, entry *yaml.Node) []error) []error {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	var errs []error
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, entry := node.Content[i].Value, node.Content[i+1]
+		if entry.Kind != yaml.MappingNode {
+			continue
+		}
+		entryPath := path + "." + name
+		for j := 0; j+1 < len(entry.Content); j += 2 {
+			if !slices.Contains(keys, entry.Content[j].Value) {
+				errs = append(errs, unknownFieldError(entryPath, entry.Content[j]))
+			}
+		}
+		if nested != nil {
+			errs = append(errs, nested(entryPath, entry)...)
+		}
+	}
+	return errs
+}
+
+// checkRouteURLs 检查 model_routes 条目中 urls 的 {url, weight} 写法
+func checkRouteURLs(path string, entry *yaml.Node) []error {
+	var errs []error
+	for i := 0; i+1 < len(entry.Content); i += 2 {
+		if entry.Content[i].Value != "urls" || entry.Content[i+1].Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, item := range entry.Content[i+1].Content {
+			if item.Kind != yaml.MappingNode {
+				continue
+			}
+			for j := 0; j+1 < len(item.Content); j += 2 {
+				if !slices.Contains(routeURLKeys, item.Content[j].Value) {
+					errs = append(errs, unknownFieldError(path+".urls", item.Content[j]))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// checkNode 按字段类型递归检查结构体与映射中的字段
+func checkNode(path string, node *yaml.Node, t reflect.Type) []error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var errs []error
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				errs = append(errs, unknownFieldError(path, key))
+				continue
+			}
+			errs = append(errs, checkNode(path+"."+key.Value, node.Content[i+1], fieldType)...)
+		}
+	case reflect.Map:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			errs = append(errs, checkNode(path+"."+node.Content[i].Value, node.Content[i+1], t.Elem())...)
+		}
+	}
+	return errs
+}
+
+// yamlFields 返回结构体在 YAML 中的字段名及类型，展开 inline 字段
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(opts, "inline") {
+			for inlineName, inlineType := range yamlFields(field.Type) {
+				fields[inlineName] = inlineType
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func unknownFieldError(path string, key *yaml.Node) error {
+	if path == "" {
+		return fmt.Errorf("line %d: unknown field %q", key.Line, key.Value)
+	}
+	return fmt.Errorf("%s: line %d: unknown field %q", path, key.Line, key.Value)
+}
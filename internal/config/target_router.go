@@ -0,0 +1,161 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// target_map 路径规则的类型：~ 开头为正则，末尾 * 为前缀，其余为精确路径
+const (
+	TargetMatchExact  = "exact"
+	TargetMatchPrefix = "prefix"
+	TargetMatchRegex  = "regex"
+)
+
+// PathRewrite 转发前改写请求路径：先去掉 StripPrefix，再加上 AddPrefix
+type PathRewrite struct {
+	StripPrefix string `yaml:"strip_prefix"`
+	AddPrefix   string `yaml:"add_prefix"`
+}
+
+// Configured 是否配置了路径改写
+func (p PathRewrite) Configured() bool {
+	return p.StripPrefix != "" || p.AddPrefix != ""
+}
+
+// Apply 返回改写后的路径，路径不以 StripPrefix 开头时只加 AddPrefix
+func (p PathRewrite) Apply(path string) string {
+	if p.StripPrefix != "" {
+		if rest, ok := strings.CutPrefix(path, p.StripPrefix); ok {
+			path = rest
+		}
+	}
+	path = p.AddPrefix + path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// ParseTargetPath 解析 target_map 的路径规则，返回规则类型与去掉标记后的路径、前缀或正则
+func ParseTargetPath(key string) (kind, pattern string) {
+	if rest, ok := strings.CutPrefix(key, "~"); ok {
+		return TargetMatchRegex, rest
+	}
+	if prefix, ok := strings.CutSuffix(key, "*"); ok {
+		return TargetMatchPrefix, prefix
+	}
+	return TargetMatchExact, key
+}
+
+// TargetMatch 路由结果
+type TargetMatch struct {
+	Key  string // 命中的 target_map 路径规则，用于查找凭证和作为指标标签
+	URL  string // 目标服务 URL
+	Path string // 改写后转发到上游的路径，未配置改写时与请求路径相同
+}
+
+// TargetRouter 编译后的 target_map 路由。精确路径查哈希表，前缀规则查按字节构建的前缀树，
+// 两者的查找耗时都只与路径长度有关；都未命中时按规则字符串的顺序依次尝试正则规则。
+// 优先级：精确路径 > 最长前缀 > 正则
+type TargetRouter struct {
+	exact  map[string]string
+	prefix *prefixNode
+	regex  []regexRule
+	urls   map[string]string
+	rules  map[string]PathRewrite
+}
+
+type prefixNode struct {
+	children map[byte]*prefixNode
+	key      string // 以该节点结尾的前缀规则，为空表示没有
+}
+
+type regexRule struct {
+	key string
+	re  *regexp.Regexp
+}
+
+// NewTargetRouter 编译 target_map 路由，无法编译的正则规则被跳过并在返回的错误中列出
+func NewTargetRouter(c *Config) (*TargetRouter, error) {
+	r := &TargetRouter{
+		exact:  make(map[string]string),
+		prefix: &prefixNode{},
+		urls:   c.TargetMap,
+		rules:  c.TargetRewrite,
+	}
+	var errs []error
+	for _, key := range sortedKeys(c.TargetMap) {
+		kind, pattern := ParseTargetPath(key)
+		switch kind {
+		case TargetMatchRegex:
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("target_map.%s: invalid regex: %w", key, err))
+				continue
+			}
+			r.regex = append(r.regex, regexRule{key: key, re: re})
+		case TargetMatchPrefix:
+			node := r.prefix
+			for i := 0; i < len(pattern); i++ {
+				child, ok := node.children[pattern[i]]
+				if !ok {
+					if node.children == nil {
+						node.children = make(map[byte]*prefixNode)
+					}
+					child = &prefixNode{}
+					node.children[pattern[i]] = child
+				}
+				node = child
+			}
+			node.key = key
+		default:
+			r.exact[pattern] = key
+		}
+	}
+	return r, errors.Join(errs...)
+}
+
+// Match 查找请求路径对应的规则，并按规则的 strip_prefix/add_prefix 改写路径
+func (r *TargetRouter) Match(path string) (TargetMatch, bool) {
+	if r == nil {
+		return TargetMatch{}, false
+	}
+	key, ok := r.exact[path]
+	if !ok {
+		key, ok = r.longestPrefix(path)
+	}
+	if !ok {
+		for _, rule := range r.regex {
+			if rule.re.MatchString(path) {
+				key, ok = rule.key, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return TargetMatch{}, false
+	}
+	match := TargetMatch{Key: key, URL: r.urls[key], Path: path}
+	if rewrite, ok := r.rules[key]; ok {
+		match.Path = rewrite.Apply(path)
+	}
+	return match, true
+}
+
+func (r *TargetRouter) longestPrefix(path string) (string, bool) {
+	node, key := r.prefix, r.prefix.key
+	for i := 0; i < len(path) && node.children != nil; i++ {
+		child, ok := node.children[path[i]]
+		if !ok {
+			break
+		}
+		node = child
+		if node.key != "" {
+			key = node.key
+		}
+	}
+	return key, key != ""
+}
@@ -0,0 +1,414 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Validate 检查配置是否完整、合法，一次返回所有发现的问题
+func (c *Config) Validate() error {
+	errs := append([]error(nil), c.unknownFields...)
+	errs = append(errs, c.validateTargets()...)
+	errs = append(errs, c.validateModelRoutes()...)
+	errs = append(errs, c.validateAliases()...)
+	errs = append(errs, c.validateFallbacks()...)
+	errs = append(errs, c.validateLimits()...)
+	errs = append(errs, c.validateSemanticCache()...)
+	errs = append(errs, c.validateDependencies()...)
+	errs = append(errs, c.validateObservability()...)
+	errs = append(errs, c.validateMessagesAPI()...)
+	errs = append(errs, c.validateResponsesAPI()...)
+	errs = append(errs, c.validateModelsAPI()...)
+	return errors.Join(errs...)
+}
+
+func (c *Config) validateTargets() []error {
+	var errs []error
+	if len(c.TargetMap) == 0 {
+		errs = append(errs, errors.New("target_map: at least one path must be configured"))
+	}
+	for _, path := range sortedKeys(c.TargetMap) {
+		if kind, pattern := ParseTargetPath(path); kind != TargetMatchRegex && !strings.HasPrefix(pattern, "/") {
+			errs = append(errs, fmt.Errorf("target_map.%s: path must start with /", path))
+		}
+		if err := validateURL(c.TargetMap[path]); err != nil {
+			errs = append(errs, fmt.Errorf("target_map.%s: %w", path, err))
+		}
+	}
+	for _, path := range sortedKeys(c.TargetAuth) {
+		if err := validateAuthType(c.TargetAuth[path].AuthType); err != nil {
+			errs = append(errs, fmt.Errorf("target_map.%s: %w", path, err))
+		}
+	}
+	for _, path := range sortedKeys(c.TargetRewrite) {
+		rewrite := c.TargetRewrite[path]
+		if rewrite.StripPrefix != "" && !strings.HasPrefix(rewrite.StripPrefix, "/") {
+			errs = append(errs, fmt.Errorf("target_map.%s.strip_prefix: must start with /, got %q", path, rewrite.StripPrefix))
+		}
+		if rewrite.AddPrefix != "" && !strings.HasPrefix(rewrite.AddPrefix, "/") {
+			errs = append(errs, fmt.Errorf("target_map.%s.add_prefix: must start with /, got %q", path, rewrite.AddPrefix))
+		}
+	}
+	if _, err := NewTargetRouter(c); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// hasTarget 路径能否匹配 target_map 中的某条规则
+func (c *Config) hasTarget(path string) bool {
+	router, _ := NewTargetRouter(c)
+	_, ok := router.Match(path)
+	return ok
+}
+
+func (c *Config) validateModelRoutes() []error {
+	var errs []error
+	for _, model := range sortedKeys(c.ModelRoutes) {
+		route, ok := c.GetModelRoute(model)
+		if !ok || len(route.URLs) == 0 {
+			errs = append(errs, fmt.Errorf("model_routes.%s: no urls configured", model))
+			continue
+		}
+		for i, u := range route.URLs {
+			if err := validateURL(u); err != nil {
+				errs = append(errs, fmt.Errorf("model_routes.%s: %w", model, err))
+			}
+			if route.Weights[i] < 0 {
+				errs = append(errs, fmt.Errorf("model_routes.%s: weight of %q must not be negative", model, u))
+			}
+		}
+		if err := validateAuthType(route.Credentials.AuthType); err != nil {
+			errs = append(errs, fmt.Errorf("model_routes.%s: %w", model, err))
+		}
+		switch route.Provider {
+		case "", ProviderOpenAI, ProviderAnthropic, ProviderGemini, ProviderAzure:
+		default:
+			errs = append(errs, fmt.Errorf("model_routes.%s: unsupported provider %q, expected %s, %s, %s or %s",
+				model, route.Provider, ProviderOpenAI, ProviderAnthropic, ProviderGemini, ProviderAzure))
+		}
+		if route.ContextLength < 0 {
+			errs = append(errs, fmt.Errorf("model_routes.%s: context_length must not be negative, got %d", model, route.ContextLength))
+		}
+	}
+	return errs
+}
+
+// validateAliases 别名只解析一次，必须直接指向 model_routes 中的模型
+func (c *Config) validateAliases() []error {
+	var errs []error
+	for _, alias := range sortedKeys(c.ModelAlias) {
+		target := c.ModelAlias[alias]
+		if _, ok := c.ModelRoutes[target]; ok {
+			continue
+		}
+		if cycle := c.aliasCycle(alias); cycle != nil {
+			errs = append(errs, fmt.Errorf("model_aliases.%s: alias cycle %s", alias, strings.Join(cycle, " -> ")))
+			continue
+		}
+		if _, ok := c.ModelAlias[target]; ok {
+			errs = append(errs, fmt.Errorf("model_aliases.%s: target %q is an alias, aliases must point to a model in model_routes", alias, target))
+			continue
+		}
+		errs = append(errs, fmt.Errorf("model_aliases.%s: target model %q has no model_routes entry", alias, target))
+	}
+	return errs
+}
+
+// aliasCycle 沿别名链查找，返回从 alias 出发形成的环，不存在时返回 nil
+func (c *Config) aliasCycle(alias string) []string {
+	chain := []string{alias}
+	seen := map[string]bool{alias: true}
+	for current := alias; ; {
+		next, ok := c.ModelAlias[current]
+		if !ok {
+			return nil
+		}
+		chain = append(chain, next)
+		if seen[next] {
+			return chain
+		}
+		seen[next] = true
+		current = next
+	}
+}
+
+func (c *Config) validateFallbacks() []error {
+	var errs []error
+	for _, model := range sortedKeys(c.Fallbacks) {
+		for _, fallback := range c.Fallbacks[model] {
+			if _, ok := c.ModelRoutes[c.ResolveModel(fallback)]; !ok {
+				errs = append(errs, fmt.Errorf("fallbacks.%s: fallback model %q has no model_routes entry", model, fallback))
+			}
+		}
+	}
+	return errs
+}
+
+// validateLimits 检查限流、超时、连接池等数值配置不为负数
+func (c *Config) validateLimits() []error {
+	var errs []error
+	nonNegative := func(name string, value int) {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative, got %d", name, value))
+		}
+	}
+
+	if c.Port < 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port: must be between 0 and 65535, got %d", c.Port))
+	}
+	nonNegative("rate_limit.rate", c.RateLimit.Rate)
+	nonNegative("rate_limit.burst", c.RateLimit.Burst)
+	nonNegative("rate_limit.idle_ttl", c.RateLimit.IdleTTL)
+	switch c.RateLimit.Backend {
+	case "", RateLimitBackendMemory, RateLimitBackendRedis:
+	default:
+		errs = append(errs, fmt.Errorf("rate_limit.backend: unsupported backend %q, expected %s or %s",
+			c.RateLimit.Backend, RateLimitBackendMemory, RateLimitBackendRedis))
+	}
+
+	nonNegative("token_limit.client_tpm", c.TokenLimit.ClientTPM)
+	for _, client := range sortedKeys(c.TokenLimit.Clients) {
+		nonNegative("token_limit.clients."+client, c.TokenLimit.Clients[client])
+	}
+	for _, model := range sortedKeys(c.TokenLimit.Models) {
+		nonNegative("token_limit.models."+model, c.TokenLimit.Models[model])
+	}
+
+	nonNegative("retry.max_attempts", c.Retry.MaxAttempts)
+	nonNegative("retry.budget", c.Retry.Budget)
+	nonNegative("retry.attempt_timeout", c.Retry.AttemptTimeout)
+	for _, code := range c.Retry.StatusCodes {
+		if code < 100 || code > 599 {
+			errs = append(errs, fmt.Errorf("retry.status_codes: invalid HTTP status code %d", code))
+		}
+	}
+
+	nonNegative("cache.ttl", c.Cache.TTL)
+	nonNegative("cache.sweep_interval", c.Cache.SweepInterval)
+	nonNegative("cache.sweep_batch_size", c.Cache.SweepBatchSize)
+	nonNegative("cache.dedup.wait", c.Cache.Dedup.Wait)
+	for _, model := range sortedKeys(c.Cache.Models) {
+		if ttl := c.Cache.Models[model].TTL; ttl != nil {
+			nonNegative("cache.models."+model+".ttl", *ttl)
+		}
+	}
+
+	nonNegative("database.max_open_conns", c.Database.MaxOpenConns)
+	nonNegative("database.max_idle_conns", c.Database.MaxIdleConns)
+	nonNegative("database.conn_max_lifetime", c.Database.ConnMaxLifetime)
+	nonNegative("redis.db", c.Redis.DB)
+	nonNegative("auth.cache_ttl", c.Auth.CacheTTL)
+	nonNegative("health_check.cooldown", c.HealthCheck.Cooldown)
+	nonNegative("health_check.active.interval", c.HealthCheck.Active.Interval)
+	nonNegative("health_check.active.timeout", c.HealthCheck.Active.Timeout)
+	nonNegative("shutdown.drain_timeout", c.Shutdown.DrainTimeout)
+	nonNegative("shutdown.ready_delay", c.Shutdown.ReadyDelay)
+	return errs
+}
+
+// validateSemanticCache 语义缓存复用已配置的 embedding 路由计算向量
+func (c *Config) validateSemanticCache() []error {
+	var errs []error
+	for _, model := range sortedKeys(c.Cache.Models) {
+		semantic := c.Cache.Models[model].Semantic
+		if semantic == nil {
+			continue
+		}
+		path := "cache.models." + model + ".semantic"
+		if semantic.EmbeddingModel == "" {
+			errs = append(errs, fmt.Errorf("%s.embedding_model: required", path))
+		}
+		embeddingPath := semantic.EmbeddingPath
+		if embeddingPath == "" {
+			embeddingPath = DefaultSemanticEmbeddingPath
+		}
+		if !c.hasTarget(embeddingPath) {
+			errs = append(errs, fmt.Errorf("%s.embedding_path: %q has no target_map entry", path, embeddingPath))
+		}
+		if semantic.Threshold < 0 || semantic.Threshold > 1 {
+			errs = append(errs, fmt.Errorf("%s.threshold: must be between 0 and 1, got %g", path, semantic.Threshold))
+		}
+		if semantic.MaxCandidates < 0 {
+			errs = append(errs, fmt.Errorf("%s.max_candidates: must not be negative, got %d", path, semantic.MaxCandidates))
+		}
+	}
+	return errs
+}
+
+// validateDependencies 缓存、虚拟 API Key 与 Responses API 依赖 Postgres 和 Redis，token 限流与共享限流依赖 Redis
+func (c *Config) validateDependencies() []error {
+	var errs []error
+	var needsDB, needsRedis []string
+	if c.cacheConfigured() {
+		needsDB = append(needsDB, "cache")
+		needsRedis = append(needsRedis, "cache")
+	}
+	if c.Auth.Enabled {
+		needsDB = append(needsDB, "auth")
+	}
+	if c.ResponsesAPI.Path != "" {
+		needsDB = append(needsDB, "responses_api")
+		needsRedis = append(needsRedis, "responses_api")
+	}
+	if c.TokenLimit.Enabled() {
+		needsRedis = append(needsRedis, "token_limit")
+	}
+	if c.RateLimit.Backend == RateLimitBackendRedis && c.HasRateLimit() {
+		needsRedis = append(needsRedis, "rate_limit")
+	}
+
+	if len(needsDB) > 0 {
+		for _, missing := range c.Database.missing() {
+			errs = append(errs, fmt.Errorf("database.%s: required by %s", missing, strings.Join(needsDB, ", ")))
+		}
+	}
+	if len(needsRedis) > 0 && c.Redis.Addr == "" {
+		errs = append(errs, fmt.Errorf("redis.addr: required by %s", strings.Join(needsRedis, ", ")))
+	}
+	return errs
+}
+
+// cacheConfigured 是否配置了 LLM / Embedding 缓存
+func (c *Config) cacheConfigured() bool {
+	cache := c.Cache
+	return cache.IgnoreFields != nil || cache.KeyFields != nil || cache.TTL != 0 ||
+		cache.SweepInterval != 0 || cache.SweepBatchSize != 0 || len(cache.Models) > 0 || cache.Dedup.Enabled
+}
+
+// missing 返回未配置的必填连接参数
+func (d DatabaseConfig) missing() []string {
+	var result []string
+	if d.Host == "" {
+		result = append(result, "host")
+	}
+	if d.User == "" {
+		result = append(result, "user")
+	}
+	if d.DBName == "" {
+		result = append(result, "dbname")
+	}
+	return result
+}
+
+func (c *Config) validateObservability() []error {
+	var errs []error
+	if c.Metrics.Enabled && c.Metrics.Path != "" && !strings.HasPrefix(c.Metrics.Path, "/") {
+		errs = append(errs, fmt.Errorf("metrics.path: must start with /, got %q", c.Metrics.Path))
+	}
+	if c.Tracing.Enabled {
+		if err := validateURL(c.Tracing.Endpoint); err != nil {
+			errs = append(errs, fmt.Errorf("tracing.endpoint: %w", err))
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing.sample_ratio: must be between 0 and 1, got %g", c.Tracing.SampleRatio))
+	}
+	if c.Tracing.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("tracing.timeout: must not be negative, got %d", c.Tracing.Timeout))
+	}
+	return errs
+}
+
+func (c *Config) validateMessagesAPI() []error {
+	api := c.MessagesAPI
+	if api.Path == "" {
+		return nil
+	}
+	var errs []error
+	if !strings.HasPrefix(api.Path, "/") {
+		errs = append(errs, fmt.Errorf("messages_api.path: must start with /, got %q", api.Path))
+	}
+	if _, ok := c.TargetMap[api.Path]; ok {
+		errs = append(errs, fmt.Errorf("messages_api.path: %q is also a target_map path", api.Path))
+	}
+	if !c.hasTarget(api.ChatPathOrDefault()) {
+		errs = append(errs, fmt.Errorf("messages_api.chat_path: %q has no target_map entry", api.ChatPathOrDefault()))
+	}
+	return errs
+}
+
+func (c *Config) validateResponsesAPI() []error {
+	api := c.ResponsesAPI
+	if api.Path == "" {
+		return nil
+	}
+	var errs []error
+	if !strings.HasPrefix(api.Path, "/") {
+		errs = append(errs, fmt.Errorf("responses_api.path: must start with /, got %q", api.Path))
+	}
+	if _, ok := c.TargetMap[api.Path]; ok {
+		errs = append(errs, fmt.Errorf("responses_api.path: %q is also a target_map path", api.Path))
+	}
+	if api.Path == c.MessagesAPI.Path {
+		errs = append(errs, fmt.Errorf("responses_api.path: %q is also the messages_api path", api.Path))
+	}
+	if !c.hasTarget(api.ChatPathOrDefault()) {
+		errs = append(errs, fmt.Errorf("responses_api.chat_path: %q has no target_map entry", api.ChatPathOrDefault()))
+	}
+	if api.TTL < 0 {
+		errs = append(errs, fmt.Errorf("responses_api.ttl: must not be negative, got %d", api.TTL))
+	}
+	return errs
+}
+
+// validateURL 要求 URL 包含 scheme 和 host
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %w", raw, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid url %q: scheme and host are required", raw)
+	}
+	return nil
+}
+
+func validateAuthType(authType string) error {
+	switch authType {
+	case "", AuthTypeBearer, AuthTypeXAPIKey, AuthTypeAPIKey:
+		return nil
+	}
+	return fmt.Errorf("unsupported auth_type %q, expected %s, %s or %s", authType, AuthTypeBearer, AuthTypeXAPIKey, AuthTypeAPIKey)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *Config) validateModelsAPI() []error {
+	api := c.ModelsAPI
+	if api.Path == "" {
+		return nil
+	}
+	var errs []error
+	if !strings.HasPrefix(api.Path, "/") {
+		errs = append(errs, fmt.Errorf("models_api.path: must start with /, got %q", api.Path))
+	}
+	if _, ok := c.TargetMap[api.Path]; ok {
+		errs = append(errs, fmt.Errorf("models_api.path: %q is also a target_map path", api.Path))
+	}
+	if api.Path == c.MessagesAPI.Path || api.Path == c.ResponsesAPI.Path {
+		errs = append(errs, fmt.Errorf("models_api.path: %q is also the messages_api or responses_api path", api.Path))
+	}
+	if api.Upstream {
+		if api.ChatPath != "" && !c.hasTarget(api.ChatPath) {
+			errs = append(errs, fmt.Errorf("models_api.chat_path: %q has no target_map entry", api.ChatPath))
+		}
+	}
+	if api.CacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("models_api.cache_ttl: must not be negative, got %d", api.CacheTTL))
+	}
+	if api.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("models_api.timeout: must not be negative, got %d", api.Timeout))
+	}
+	return errs
+}
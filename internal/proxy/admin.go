@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// adminPathPrefix 管理接口保留路径前缀
+const adminPathPrefix = "/admin/"
+
+// serveAdmin 处理管理接口请求，返回 true 表示请求已处理
+func (h *Handler) serveAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, adminPathPrefix) {
+		return false
+	}
+	if _, ok := h.cfg.TargetMap[r.URL.Path]; ok {
+		// 显式配置的代理路径优先
+		return false
+	}
+
+	if !h.authorizeAdmin(r) {
+		logger.Warn("Unauthorized admin request",
+			zap.String("requestId", utils.GetRequestID(r)),
+			zap.String("path", r.URL.Path))
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return true
+	}
+
+	switch {
+	case r.URL.Path == adminPathPrefix+"upstreams" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{"upstreams": h.health.Snapshot()})
+	case strings.HasPrefix(r.URL.Path, adminCachePrefix):
+		h.serveAdminCache(w, r)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+	return true
+}
+
+// authorizeAdmin 校验管理接口 Bearer Token，未配置 Token 时拒绝所有请求
+func (h *Handler) authorizeAdmin(r *http.Request) bool {
+	if h.cfg == nil || h.cfg.Admin.Token == "" {
+		return false
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.Admin.Token)) == 1
+}
+
+// writeJSON 以 JSON 格式写入响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warn("Failed to write JSON response", zap.Error(err))
+	}
+}
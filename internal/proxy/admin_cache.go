@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/db"
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+const (
+	adminCachePrefix = adminPathPrefix + "cache/"
+
+	cacheKindLLM       = "llm"
+	cacheKindEmbedding = "embedding"
+
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 500
+)
+
+// cacheAdminStore 管理接口浏览和清理缓存所需的存储操作
+type cacheAdminStore interface {
+	SearchLLMs(ctx context.Context, q db.CacheQuery) ([]db.LLMRecord, int, error)
+	SearchEmbeddings(ctx context.Context, q db.CacheQuery) ([]db.EmbeddingRecord, int, error)
+	GetLLMByHash(ctx context.Context, hash string) (*db.LLMRecord, error)
+	GetEmbeddingByHash(ctx context.Context, hash string) (*db.EmbeddingRecord, error)
+	DeleteLLMs(ctx context.Context, q db.CacheQuery) (int, error)
+	DeleteEmbeddings(ctx context.Context, q db.CacheQuery) (int, error)
+}
+
+// serveAdminCache 处理 /admin/cache/{llm|embedding}[/{hash}]：
+//
+//	GET    /admin/cache/llm?model=&request_id=&since=&until=&limit=&offset=  按条件分页列出
+//	GET    /admin/cache/llm/{hash}                                            查看单条记录
+//	DELETE /admin/cache/llm/{hash}                                            按 hash 删除
+//	DELETE /admin/cache/llm?model=&request_id=&since=&until=                 按条件批量删除
+//
+// 删除同时清理 Postgres 与 Redis，批量删除至少需要一个过滤条件
+func (h *Handler) serveAdminCache(w http.ResponseWriter, r *http.Request) {
+	kind, hash, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, adminCachePrefix), "/")
+	if (kind != cacheKindLLM && kind != cacheKindEmbedding) || strings.Contains(hash, "/") {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	if h.cacheAdmin == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "cache storage is not available"})
+		return
+	}
+
+	query, err := parseCacheQuery(r.URL.Query())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	query.Hash = hash
+
+	switch {
+	case r.Method == http.MethodGet && hash == "":
+		h.listCacheEntries(w, r, kind, query)
+	case r.Method == http.MethodGet:
+		h.getCacheEntry(w, r, kind, hash)
+	case r.Method == http.MethodDelete:
+		h.deleteCacheEntries(w, r, kind, query)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+func (h *Handler) listCacheEntries(w http.ResponseWriter, r *http.Request, kind string, query db.CacheQuery) {
+	var entries interface{}
+	var total int
+	var err error
+	if kind == cacheKindLLM {
+		entries, total, err = h.cacheAdmin.SearchLLMs(r.Context(), query)
+	} else {
+		entries, total, err = h.cacheAdmin.SearchEmbeddings(r.Context(), query)
+	}
+	if err != nil {
+		h.writeAdminError(w, r, "Failed to list cache entries", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"entries": entries,
+		"total":   total,
+		"limit":   query.Limit,
+		"offset":  query.Offset,
+	})
+}
+
+func (h *Handler) getCacheEntry(w http.ResponseWriter, r *http.Request, kind, hash string) {
+	var entry interface{}
+	var err error
+	if kind == cacheKindLLM {
+		var rec *db.LLMRecord
+		if rec, err = h.cacheAdmin.GetLLMByHash(r.Context(), hash); rec != nil {
+			entry = rec
+		}
+	} else {
+		var rec *db.EmbeddingRecord
+		if rec, err = h.cacheAdmin.GetEmbeddingByHash(r.Context(), hash); rec != nil {
+			entry = rec
+		}
+	}
+	if err != nil {
+		h.writeAdminError(w, r, "Failed to get cache entry", err)
+		return
+	}
+	if entry == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "cache entry not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+func (h *Handler) deleteCacheEntries(w http.ResponseWriter, r *http.Request, kind string, query db.CacheQuery) {
+	if query.Empty() {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": db.ErrEmptyQuery.Error()})
+		return
+	}
+
+	var deleted int
+	var err error
+	if kind == cacheKindLLM {
+		deleted, err = h.cacheAdmin.DeleteLLMs(r.Context(), query)
+	} else {
+		deleted, err = h.cacheAdmin.DeleteEmbeddings(r.Context(), query)
+	}
+	logger.Info("Admin purged cache entries",
+		zap.String("requestId", utils.GetRequestID(r)),
+		zap.String("kind", kind),
+		zap.String("hash", query.Hash),
+		zap.String("model", query.ModelName),
+		zap.String("filterRequestId", query.RequestID),
+		zap.Int("deleted", deleted),
+		zap.Error(err))
+	if err != nil {
+		// Postgres 已删除但 Redis 清理失败时仍返回删除数量，Redis 中的副本最迟在 TTL 到期后失效
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": err.Error(), "deleted": deleted})
+		return
+	}
+	if query.Hash != "" && deleted == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "cache entry not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"deleted": deleted})
+}
+
+func (h *Handler) writeAdminError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	logger.Error(msg,
+		zap.String("requestId", utils.GetRequestID(r)),
+		zap.String("path", r.URL.Path),
+		zap.Error(err))
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
+
+// parseCacheQuery 解析过滤与分页参数，since/until 为 RFC 3339 时间
+func parseCacheQuery(values url.Values) (db.CacheQuery, error) {
+	query := db.CacheQuery{
+		ModelName: values.Get("model"),
+		RequestID: values.Get("request_id"),
+		Limit:     defaultAdminPageSize,
+	}
+	var errs []error
+	parseTime := func(name string) time.Time {
+		raw := values.Get(name)
+		if raw == "" {
+			return time.Time{}
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q: expected RFC 3339 time", name, raw))
+		}
+		return t
+	}
+	parseInt := func(name string, lo, hi int, value *int) {
+		raw := values.Get(name)
+		if raw == "" {
+			return
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < lo || n > hi {
+			errs = append(errs, fmt.Errorf("invalid %s %q: expected an integer between %d and %d", name, raw, lo, hi))
+			return
+		}
+		*value = n
+	}
+
+	query.Since = parseTime("since")
+	query.Until = parseTime("until")
+	parseInt("limit", 1, maxAdminPageSize, &query.Limit)
+	parseInt("offset", 0, math.MaxInt32, &query.Offset)
+	return query, errors.Join(errs...)
+}
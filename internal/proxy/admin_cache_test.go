@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCacheAdmin struct {
+	llms    []db.LLMRecord
+	queries []db.CacheQuery
+	deleted []db.CacheQuery
+	err     error
+}
+
+func (f *fakeCacheAdmin) SearchLLMs(_ context.Context, q db.CacheQuery) ([]db.LLMRecord, int, error) {
+	f.queries = append(f.queries, q)
+	return f.llms, len(f.llms), f.err
+}
+
+func (f *fakeCacheAdmin) SearchEmbeddings(_ context.Context, q db.CacheQuery) ([]db.EmbeddingRecord, int, error) {
+	f.queries = append(f.queries, q)
+	return []db.EmbeddingRecord{}, 0, f.err
+}
+
+func (f *fakeCacheAdmin) GetLLMByHash(_ context.Context, hash string) (*db.LLMRecord, error) {
+	for i := range f.llms {
+		if f.llms[i].RequestHash == hash {
+			return &f.llms[i], nil
+		}
+	}
+	return nil, f.err
+}
+
+func (f *fakeCacheAdmin) GetEmbeddingByHash(context.Context, string) (*db.EmbeddingRecord, error) {
+	return nil, f.err
+}
+
+func (f *fakeCacheAdmin) DeleteLLMs(_ context.Context, q db.CacheQuery) (int, error) {
+	f.deleted = append(f.deleted, q)
+	if q.Hash == "missing" {
+		return 0, nil
+	}
+	return 2, f.err
+}
+
+func (f *fakeCacheAdmin) DeleteEmbeddings(_ context.Context, q db.CacheQuery) (int, error) {
+	f.deleted = append(f.deleted, q)
+	return 1, f.err
+}
+
+func newCacheAdminTestHandler(store cacheAdminStore) *Handler {
+	return &Handler{
+		cfg:        &config.Config{Admin: config.AdminConfig{Token: "secret"}},
+		cacheAdmin: store,
+	}
+}
+
+func adminRequest(t *testing.T, handler *Handler, method, target string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp := httptest.NewRecorder()
+	require.True(t, handler.serveAdmin(resp, req))
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	return resp.Code, body
+}
+
+func TestAdminCache_List(t *testing.T) {
+	store := &fakeCacheAdmin{llms: []db.LLMRecord{{RequestHash: "abc", ModelName: "gpt-4", RequestID: "req-1"}}}
+	handler := newCacheAdminTestHandler(store)
+
+	code, body := adminRequest(t, handler, http.MethodGet,
+		"/admin/cache/llm?model=gpt-4&request_id=req-1&since=2024-01-01T00:00:00Z&until=2024-02-01T00:00:00Z&limit=10&offset=20")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, float64(1), body["total"])
+	require.Equal(t, "abc", body["entries"].([]interface{})[0].(map[string]interface{})["request_hash"])
+	require.Equal(t, db.CacheQuery{
+		ModelName: "gpt-4",
+		RequestID: "req-1",
+		Since:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Until:     time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		Limit:     10,
+		Offset:    20,
+	}, store.queries[0])
+
+	code, body = adminRequest(t, handler, http.MethodGet, "/admin/cache/embedding")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []interface{}{}, body["entries"])
+	require.Equal(t, defaultAdminPageSize, store.queries[1].Limit)
+
+	code, body = adminRequest(t, handler, http.MethodGet, "/admin/cache/llm?since=yesterday&limit=10000")
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Contains(t, body["error"], "invalid since")
+	require.Contains(t, body["error"], "invalid limit")
+
+	code, _ = adminRequest(t, handler, http.MethodGet, "/admin/cache/rerank")
+	require.Equal(t, http.StatusNotFound, code)
+}
+
+func TestAdminCache_Get(t *testing.T) {
+	store := &fakeCacheAdmin{llms: []db.LLMRecord{{RequestHash: "abc", ModelName: "gpt-4", Response: json.RawMessage(`{"choices":[]}`)}}}
+	handler := newCacheAdminTestHandler(store)
+
+	code, body := adminRequest(t, handler, http.MethodGet, "/admin/cache/llm/abc")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "gpt-4", body["model_name"])
+	require.Equal(t, map[string]interface{}{"choices": []interface{}{}}, body["response"])
+
+	code, _ = adminRequest(t, handler, http.MethodGet, "/admin/cache/llm/def")
+	require.Equal(t, http.StatusNotFound, code)
+
+	store.err = errors.New("connection refused")
+	code, body = adminRequest(t, handler, http.MethodGet, "/admin/cache/embedding/def")
+	require.Equal(t, http.StatusInternalServerError, code)
+	require.Equal(t, "connection refused", body["error"])
+}
+
+func TestAdminCache_Delete(t *testing.T) {
+	store := &fakeCacheAdmin{}
+	handler := newCacheAdminTestHandler(store)
+
+	code, body := adminRequest(t, handler, http.MethodDelete, "/admin/cache/llm/abc")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, float64(2), body["deleted"])
+	require.Equal(t, "abc", store.deleted[0].Hash)
+
+	code, _ = adminRequest(t, handler, http.MethodDelete, "/admin/cache/llm/missing")
+	require.Equal(t, http.StatusNotFound, code)
+
+	code, body = adminRequest(t, handler, http.MethodDelete, "/admin/cache/embedding?model=text-embedding-3-small")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, float64(1), body["deleted"])
+	require.Equal(t, "text-embedding-3-small", store.deleted[2].ModelName)
+
+	// 不带过滤条件的批量删除被拒绝
+	code, _ = adminRequest(t, handler, http.MethodDelete, "/admin/cache/llm")
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Len(t, store.deleted, 3)
+
+	// Redis 清理失败时返回已删除数量
+	store.err = errors.New("purge redis: timeout")
+	code, body = adminRequest(t, handler, http.MethodDelete, "/admin/cache/llm?model=gpt-4")
+	require.Equal(t, http.StatusInternalServerError, code)
+	require.Equal(t, float64(2), body["deleted"])
+
+	code, _ = adminRequest(t, handler, http.MethodPost, "/admin/cache/llm")
+	require.Equal(t, http.StatusMethodNotAllowed, code)
+}
+
+func TestAdminCache_StorageUnavailable(t *testing.T) {
+	handler := newCacheAdminTestHandler(nil)
+	code, _ := adminRequest(t, handler, http.MethodGet, "/admin/cache/llm")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+}
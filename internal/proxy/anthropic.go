@@ -0,0 +1,518 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Anthropic Messages API 与 OpenAI Chat Completions 之间的格式转换
+
+// anthropicRequest Messages API 请求体
+type anthropicRequest struct {
+	Model         string               `json:"model"`
+	System        json.RawMessage      `json:"system,omitempty"` // 字符串或 text 块数组
+	Messages      []anthropicMessage   `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens,omitempty"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	TopP          *float64             `json:"top_p,omitempty"`
+	TopK          *int                 `json:"top_k,omitempty"`
+	StopSequences []string             `json:"stop_sequences,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	Tools         []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice    *anthropicToolChoice `json:"tool_choice,omitempty"`
+	Metadata      *anthropicMetadata   `json:"metadata,omitempty"`
+}
+
+// anthropicMessage 消息的 content 为字符串或内容块数组
+type anthropicMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// anthropicContentBlock 内容块，按 Type 使用不同字段
+type anthropicContentBlock struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// image
+	Source *anthropicImageSource `json:"source,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result，content 为字符串或内容块数组
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+
+	// thinking
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"` // base64 或 url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type                   string `json:"type"` // auto、any、tool、none
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type anthropicMetadata struct {
+	UserID string `json:"user_id,omitempty"`
+}
+
+// anthropicResponse Messages API 非流式响应
+type anthropicResponse struct {
+	ID           string                  `json:"id"`
+	Type         string                  `json:"type"`
+	Role         string                  `json:"role"`
+	Model        string                  `json:"model"`
+	Content      []anthropicContentBlock `json:"content"`
+	StopReason   *string                 `json:"stop_reason"`
+	StopSequence *string                 `json:"stop_sequence"`
+	Usage        anthropicUsage          `json:"usage"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// anthropicError Messages API 错误响应
+type anthropicError struct {
+	Type  string               `json:"type"`
+	Error anthropicErrorDetail `json:"error"`
+}
+
+type anthropicErrorDetail struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// chatCompletionRequest Chat Completions 请求体中格式转换用到的字段
+type chatCompletionRequest struct {
+	Model               string             `json:"model"`
+	Messages            []chatMessage      `json:"messages"`
+	MaxTokens           *int               `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int               `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64           `json:"temperature,omitempty"`
+	TopP                *float64           `json:"top_p,omitempty"`
+	Stop                stopSequences      `json:"stop,omitempty"`
+	Stream              bool               `json:"stream,omitempty"`
+	StreamOptions       *chatStreamOptions `json:"stream_options,omitempty"`
+	Tools               []chatTool         `json:"tools,omitempty"`
+	ToolChoice          interface{}        `json:"tool_choice,omitempty"`
+	ParallelToolCalls   *bool              `json:"parallel_tool_calls,omitempty"`
+	ResponseFormat      interface{}        `json:"response_format,omitempty"`
+	User                string             `json:"user,omitempty"`
+}
+
+// stopSequences chat completions 的 stop 可以是字符串或字符串数组
+type stopSequences []string
+
+func (s *stopSequences) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = stopSequences{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+type chatStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// chatMessage 的 content 为字符串、chatContentPart 数组或 nil（只有 tool_calls 的 assistant 消息）
+type chatMessage struct {
+	Role       string         `json:"role"`
+	Content    interface{}    `json:"content"`
+	ToolCalls  []chatToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+}
+
+type chatContentPart struct {
+	Type     string        `json:"type"`
+	Text     string        `json:"text,omitempty"`
+	ImageURL *chatImageURL `json:"image_url,omitempty"`
+}
+
+type chatImageURL struct {
+	URL string `json:"url"`
+}
+
+type chatToolCall struct {
+	ID       string                `json:"id"`
+	Type     string                `json:"type"`
+	Function llmStreamToolFunction `json:"function"`
+}
+
+type chatTool struct {
+	Type     string       `json:"type"`
+	Function chatFunction `json:"function"`
+}
+
+type chatFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// parseAnthropicContent 解析字符串或内容块数组形式的 content
+func parseAnthropicContent(raw json.RawMessage) ([]anthropicContentBlock, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		return []anthropicContentBlock{{Type: "text", Text: text}}, nil
+	}
+	var blocks []anthropicContentBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// anthropicToChatRequest 将 Messages API 请求转换为 Chat Completions 请求。
+// thinking 块与 top_k 没有对应字段，直接丢弃
+func anthropicToChatRequest(req *anthropicRequest) (*chatCompletionRequest, error) {
+	if req.Model == "" {
+		return nil, fmt.Errorf("model: field required")
+	}
+	if len(req.Messages) == 0 {
+		return nil, fmt.Errorf("messages: at least one message is required")
+	}
+
+	chat := &chatCompletionRequest{
+		Model:       req.Model,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stop:        req.StopSequences,
+		Stream:      req.Stream,
+	}
+	if req.MaxTokens > 0 {
+		maxTokens := req.MaxTokens
+		chat.MaxTokens = &maxTokens
+	}
+	if req.Stream {
+		// 流式响应的 message_delta 需要 output_tokens
+		chat.StreamOptions = &chatStreamOptions{IncludeUsage: true}
+	}
+	if req.Metadata != nil {
+		chat.User = req.Metadata.UserID
+	}
+
+	system, err := parseAnthropicContent(req.System)
+	if err != nil {
+		return nil, fmt.Errorf("system: %w", err)
+	}
+	if text := joinAnthropicText(system); text != "" {
+		chat.Messages = append(chat.Messages, chatMessage{Role: "system", Content: text})
+	}
+
+	for i, msg := range req.Messages {
+		blocks, err := parseAnthropicContent(msg.Content)
+		if err != nil {
+			return nil, fmt.Errorf("messages.%d.content: %w", i, err)
+		}
+		var converted []chatMessage
+		switch msg.Role {
+		case "user":
+			converted, err = anthropicUserToChat(blocks)
+		case "assistant":
+			converted, err = anthropicAssistantToChat(blocks)
+		default:
+			err = fmt.Errorf("unsupported role %q", msg.Role)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("messages.%d: %w", i, err)
+		}
+		chat.Messages = append(chat.Messages, converted...)
+	}
+
+	for _, tool := range req.Tools {
+		chat.Tools = append(chat.Tools, chatTool{
+			Type: "function",
+			Function: chatFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	if choice := req.ToolChoice; choice != nil {
+		switch choice.Type {
+		case "auto", "none":
+			chat.ToolChoice = choice.Type
+		case "any":
+			chat.ToolChoice = "required"
+		case "tool":
+			chat.ToolChoice = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]string{"name": choice.Name},
+			}
+		default:
+			return nil, fmt.Errorf("tool_choice: unsupported type %q", choice.Type)
+		}
+		if choice.DisableParallelToolUse {
+			parallel := false
+			chat.ParallelToolCalls = &parallel
+		}
+	}
+	return chat, nil
+}
+
+// anthropicUserToChat tool_result 块转换为独立的 tool 消息，放在其余用户内容之前
+func anthropicUserToChat(blocks []anthropicContentBlock) ([]chatMessage, error) {
+	var messages []chatMessage
+	var parts []chatContentPart
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			parts = append(parts, chatContentPart{Type: "text", Text: block.Text})
+		case "image":
+			url, err := anthropicImageURL(block.Source)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, chatContentPart{Type: "image_url", ImageURL: &chatImageURL{URL: url}})
+		case "tool_result":
+			content, err := parseAnthropicContent(block.Content)
+			if err != nil {
+				return nil, fmt.Errorf("tool_result content: %w", err)
+			}
+			messages = append(messages, chatMessage{
+				Role:       "tool",
+				ToolCallID: block.ToolUseID,
+				Content:    joinAnthropicText(content),
+			})
+		default:
+			return nil, fmt.Errorf("unsupported content block type %q", block.Type)
+		}
+	}
+
+	switch {
+	case len(parts) == 0:
+	case len(parts) == 1 && parts[0].Type == "text":
+		messages = append(messages, chatMessage{Role: "user", Content: parts[0].Text})
+	default:
+		messages = append(messages, chatMessage{Role: "user", Content: parts})
+	}
+	return messages, nil
+}
+
+func anthropicAssistantToChat(blocks []anthropicContentBlock) ([]chatMessage, error) {
+	var text strings.Builder
+	var toolCalls []chatToolCall
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			arguments := "{}"
+			if len(block.Input) > 0 {
+				arguments = string(block.Input)
+			}
+			toolCalls = append(toolCalls, chatToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: llmStreamToolFunction{Name: block.Name, Arguments: arguments},
+			})
+		case "thinking", "redacted_thinking":
+		default:
+			return nil, fmt.Errorf("unsupported content block type %q", block.Type)
+		}
+	}
+
+	msg := chatMessage{Role: "assistant", ToolCalls: toolCalls}
+	if text.Len() > 0 || len(toolCalls) == 0 {
+		msg.Content = text.String()
+	}
+	return []chatMessage{msg}, nil
+}
+
+func anthropicImageURL(source *anthropicImageSource) (string, error) {
+	if source == nil {
+		return "", fmt.Errorf("image: source required")
+	}
+	switch source.Type {
+	case "base64":
+		return "data:" + source.MediaType + ";base64," + source.Data, nil
+	case "url":
+		return source.URL, nil
+	}
+	return "", fmt.Errorf("image: unsupported source type %q", source.Type)
+}
+
+// joinAnthropicText 拼接 text 块，忽略其他类型的块
+func joinAnthropicText(blocks []anthropicContentBlock) string {
+	texts := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		if block.Type == "text" {
+			texts = append(texts, block.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// chatToAnthropicResponse 将 Chat Completions 非流式响应转换为 Messages API 响应，model 为客户端请求的模型
+func chatToAnthropicResponse(body []byte, model string) (*anthropicResponse, error) {
+	var completion llmCompletion
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return nil, fmt.Errorf("invalid chat completion: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("chat completion has no choices")
+	}
+	choice := completion.Choices[0]
+
+	resp := &anthropicResponse{
+		ID:      anthropicMessageID(completion.ID),
+		Type:    "message",
+		Role:    "assistant",
+		Model:   model,
+		Content: []anthropicContentBlock{},
+	}
+	if content := choice.Message.Content; content != nil && *content != "" {
+		resp.Content = append(resp.Content, anthropicContentBlock{Type: "text", Text: *content})
+	}
+	for _, call := range choice.Message.ToolCalls {
+		resp.Content = append(resp.Content, anthropicContentBlock{
+			Type:  "tool_use",
+			ID:    anthropicToolUseID(call.ID),
+			Name:  call.Function.Name,
+			Input: toolInput(call.Function.Arguments),
+		})
+	}
+
+	reason := anthropicStopReason(choice.FinishReason, len(choice.Message.ToolCalls) > 0)
+	resp.StopReason = &reason
+	if usage, ok := extractUsage(body); ok {
+		resp.Usage = anthropicUsage{InputTokens: usage.PromptTokens, OutputTokens: usage.CompletionTokens}
+	}
+	return resp, nil
+}
+
+// anthropicStopReason 将 finish_reason 映射为 stop_reason；部分上游在调用工具时仍返回 stop
+func anthropicStopReason(finishReason *string, hasToolCalls bool) string {
+	reason := ""
+	if finishReason != nil {
+		reason = *finishReason
+	}
+	switch reason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	}
+	if hasToolCalls {
+		return "tool_use"
+	}
+	return "end_turn"
+}
+
+// anthropicMessageID Messages API 的消息 ID 以 msg_ 开头
+func anthropicMessageID(id string) string {
+	if id == "" {
+		return "msg_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	}
+	if strings.HasPrefix(id, "msg_") {
+		return id
+	}
+	return "msg_" + id
+}
+
+// anthropicToolUseID 部分上游不返回工具调用 ID，tool_use 块必须带 ID
+func anthropicToolUseID(id string) string {
+	if id != "" {
+		return id
+	}
+	return "toolu_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+}
+
+// toolInput 工具参数不是合法的 JSON 对象时返回空对象，tool_use.input 必须是对象
+func toolInput(arguments string) json.RawMessage {
+	trimmed := strings.TrimSpace(arguments)
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	return json.RawMessage("{}")
+}
+
+// anthropicErrorType 按 HTTP 状态码选择 Messages API 的错误类型
+func anthropicErrorType(status int) string {
+	switch status {
+	case 400, 405, 422:
+		return "invalid_request_error"
+	case 401:
+		return "authentication_error"
+	case 403:
+		return "permission_error"
+	case 404:
+		return "not_found_error"
+	case 413:
+		return "request_too_large"
+	case 429:
+		return "rate_limit_error"
+	case 529:
+		return "overloaded_error"
+	}
+	return "api_error"
+}
+
+// upstreamErrorMessage 从 OpenAI 格式或纯文本的错误响应中提取错误信息
+func upstreamErrorMessage(status int, body []byte) string {
+	var payload struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err == nil && len(payload.Error) > 0 {
+		var detail struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(payload.Error, &detail); err == nil && detail.Message != "" {
+			return detail.Message
+		}
+		var message string
+		if err := json.Unmarshal(payload.Error, &message); err == nil && message != "" {
+			return message
+		}
+	}
+	if text := strings.TrimSpace(string(body)); text != "" && !strings.HasPrefix(text, "{") {
+		return truncateForLog(text)
+	}
+	return fmt.Sprintf("upstream returned status %d", status)
+}
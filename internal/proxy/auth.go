@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/db"
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// apiKeyStore 虚拟 API Key 及其配额计数的存储，由 storage.Storage 实现
+type apiKeyStore interface {
+	counterStore
+	GetAPIKey(ctx context.Context, key string) (*db.APIKeyRecord, error)
+}
+
+// apiKeyContextKey 请求上下文中保存已认证的虚拟 API Key
+type apiKeyContextKey struct{}
+
+func apiKeyFromContext(ctx context.Context) *db.APIKeyRecord {
+	rec, _ := ctx.Value(apiKeyContextKey{}).(*db.APIKeyRecord)
+	return rec
+}
+
+// authenticate 校验虚拟 API Key 的有效性、允许的模型与路径以及配额，通过后移除客户端的鉴权头。
+// 未开启鉴权或前端接口已完成鉴权（内部请求的上下文中已有 Key）时直接放行；
+// 校验失败时已写出 OpenAI 风格的错误响应并返回 false
+func (h *Handler) authenticate(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if h.cfg == nil || !h.cfg.Auth.Enabled || apiKeyFromContext(r.Context()) != nil {
+		return r, true
+	}
+	requestId := utils.GetRequestID(r)
+
+	if h.keys == nil {
+		logger.Error("API key store unavailable, rejecting request", zap.String("requestId", requestId))
+		writeOpenAIError(w, http.StatusServiceUnavailable, "api_error", "service_unavailable",
+			"Authentication backend is unavailable.")
+		return r, false
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		writeOpenAIError(w, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key",
+			"You didn't provide an API key. Provide it in the Authorization header using Bearer auth.")
+		return r, false
+	}
+
+	rec, err := h.keys.GetAPIKey(r.Context(), token)
+	if err != nil {
+		logger.Error("Failed to look up API key", zap.String("requestId", requestId), zap.Error(err))
+		writeOpenAIError(w, http.StatusServiceUnavailable, "api_error", "service_unavailable",
+			"Authentication backend is unavailable.")
+		return r, false
+	}
+	if rec == nil {
+		logger.Warn("Invalid API key", zap.String("requestId", requestId))
+		writeOpenAIError(w, http.StatusUnauthorized, "invalid_request_error", "invalid_api_key",
+			"Incorrect API key provided.")
+		return r, false
+	}
+	if !rec.Enabled {
+		logger.Warn("Disabled API key", zap.String("requestId", requestId), zap.String("apiKey", rec.Name))
+		writeOpenAIError(w, http.StatusUnauthorized, "invalid_request_error", "api_key_disabled",
+			"This API key has been disabled.")
+		return r, false
+	}
+
+	if !pathAllowed(rec.AllowedPaths, r.URL.Path) {
+		logger.Warn("API key not allowed to access path",
+			zap.String("requestId", requestId),
+			zap.String("apiKey", rec.Name),
+			zap.String("path", r.URL.Path))
+		writeOpenAIError(w, http.StatusForbidden, "invalid_request_error", "path_not_allowed",
+			fmt.Sprintf("This API key is not allowed to access %s.", r.URL.Path))
+		return r, false
+	}
+	// 限定模型的 Key 发送请求体时必须能从 JSON 中读到 model，multipart 等无法判断模型的请求一律拒绝；
+	// 没有请求体的请求（如 GET /models）不涉及模型，不受限制
+	if len(rec.AllowedModels) > 0 {
+		hasBody := r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+		model := peekRequestModel(r)
+		if model == "" && hasBody {
+			logger.Warn("API key restricted to models sent a request without a model",
+				zap.String("requestId", requestId),
+				zap.String("apiKey", rec.Name),
+				zap.String("path", r.URL.Path))
+			writeOpenAIError(w, http.StatusForbidden, "invalid_request_error", "model_not_allowed",
+				"This API key is restricted to specific models; the request body must be JSON with a model field.")
+			return r, false
+		}
+		if model != "" && !h.modelAllowed(rec.AllowedModels, model) {
+			logger.Warn("API key not allowed to use model",
+				zap.String("requestId", requestId),
+				zap.String("apiKey", rec.Name),
+				zap.String("model", model))
+			writeOpenAIError(w, http.StatusForbidden, "invalid_request_error", "model_not_allowed",
+				fmt.Sprintf("This API key does not have access to model %s.", model))
+			return r, false
+		}
+	}
+
+	if !h.checkAPIKeyQuota(w, r, rec) {
+		return r, false
+	}
+
+	// 虚拟 API Key 只用于代理自身的鉴权，不能转发给上游服务
+	r = r.Clone(context.WithValue(r.Context(), apiKeyContextKey{}, rec))
+	for _, header := range clientAuthHeaders {
+		r.Header.Del(header)
+	}
+	return r, true
+}
+
+// checkAPIKeyQuota 按分钟统计请求数并检查当日 token 用量；计数存储不可用时放行
+func (h *Handler) checkAPIKeyQuota(w http.ResponseWriter, r *http.Request, rec *db.APIKeyRecord) bool {
+	requestId := utils.GetRequestID(r)
+	now := time.Now()
+
+	if rec.RPMLimit > 0 {
+		window := now.Truncate(time.Minute)
+		count, err := h.keys.IncrCounter(r.Context(), apiKeyRPMCounter(rec.ID, window), 1, 2*time.Minute)
+		if err != nil {
+			logger.Warn("Failed to count API key requests, allowing request",
+				zap.String("requestId", requestId), zap.Error(err))
+		} else if count > int64(rec.RPMLimit) {
+			h.metrics.observeRateLimited("api_key_rpm")
+			retryAfter := int(window.Add(time.Minute).Sub(now).Seconds()) + 1
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			logger.Warn("API key request rate exceeded",
+				zap.String("requestId", requestId),
+				zap.String("apiKey", rec.Name),
+				zap.Int("rpmLimit", rec.RPMLimit))
+			writeOpenAIError(w, http.StatusTooManyRequests, "requests", "rate_limit_exceeded",
+				fmt.Sprintf("Rate limit reached: %d requests per minute.", rec.RPMLimit))
+			return false
+		}
+	}
+
+	if rec.TokensPerDay > 0 {
+		used, err := h.keys.GetCounter(r.Context(), apiKeyTokenCounter(rec.ID, now))
+		if err != nil {
+			logger.Warn("Failed to read API key token usage, allowing request",
+				zap.String("requestId", requestId), zap.Error(err))
+		} else if used >= rec.TokensPerDay {
+			h.metrics.observeRateLimited("api_key_tokens")
+			logger.Warn("API key daily token quota exceeded",
+				zap.String("requestId", requestId),
+				zap.String("apiKey", rec.Name),
+				zap.Int64("used", used),
+				zap.Int64("tokensPerDay", rec.TokensPerDay))
+			writeOpenAIError(w, http.StatusTooManyRequests, "insufficient_quota", "insufficient_quota",
+				fmt.Sprintf("You exceeded your daily quota of %d tokens.", rec.TokensPerDay))
+			return false
+		}
+	}
+	return true
+}
+
+// apiKeyUsageHandler 返回将 usage 计入虚拟 API Key 当日 token 用量的回调，不需要统计时返回 nil
+func (h *Handler) apiKeyUsageHandler(resp *http.Response) func(*llmUsage) {
+	if h.keys == nil {
+		return nil
+	}
+	rec := apiKeyFromContext(resp.Request.Context())
+	if rec == nil || rec.TokensPerDay <= 0 {
+		return nil
+	}
+	requestId := utils.GetRequestID(resp.Request)
+	return func(usage *llmUsage) {
+		tokens := usage.total()
+		if tokens <= 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := h.keys.IncrCounter(ctx, apiKeyTokenCounter(rec.ID, time.Now()), int64(tokens), 48*time.Hour); err != nil {
+			logger.Warn("Failed to record API key token usage",
+				zap.String("requestId", requestId),
+				zap.String("apiKey", rec.Name),
+				zap.Error(err))
+		}
+	}
+}
+
+func apiKeyRPMCounter(id int, window time.Time) string {
+	return fmt.Sprintf("quota:apikey:%d:rpm:%d", id, window.Unix())
+}
+
+// apiKeyTokenCounter 按 UTC 自然日统计 token 用量
+func apiKeyTokenCounter(id int, now time.Time) string {
+	return fmt.Sprintf("quota:apikey:%d:tokens:%s", id, now.UTC().Format("20060102"))
+}
+
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len("Bearer ") || !strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[len("Bearer "):])
+}
+
+// pathAllowed 判断路径是否在允许列表中，空列表表示不限制，末尾 * 表示前缀匹配
+func pathAllowed(patterns []string, path string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if pattern == path {
+			return true
+		}
+	}
+	return false
+}
+
+// modelAllowed 客户端请求的模型名或其别名解析结果出现在允许列表中即可
+func (h *Handler) modelAllowed(allowed []string, model string) bool {
+	resolved := h.cfg.ResolveModel(model)
+	for _, m := range allowed {
+		if m == model || m == resolved {
+			return true
+		}
+	}
+	return false
+}
+
+// peekRequestModel 读取请求体中的 model 字段并还原请求体，无法解析时返回空字符串
+func peekRequestModel(r *http.Request) string {
+	if r.Body == nil || r.Body == http.NoBody {
+		return ""
+	}
+	bodyBytes, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	if err != nil {
+		return ""
+	}
+	var payload struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+		return ""
+	}
+	return payload.Model
+}
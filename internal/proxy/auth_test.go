@@ -0,0 +1,363 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAPIKeyStore struct {
+	mu       sync.Mutex
+	keys     map[string]*db.APIKeyRecord
+	counters map[string]int64
+	err      error
+}
+
+func newFakeAPIKeyStore(keys map[string]*db.APIKeyRecord) *fakeAPIKeyStore {
+	return &fakeAPIKeyStore{keys: keys, counters: make(map[string]int64)}
+}
+
+func (f *fakeAPIKeyStore) GetAPIKey(_ context.Context, key string) (*db.APIKeyRecord, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.keys[key], nil
+}
+
+func (f *fakeAPIKeyStore) IncrCounter(_ context.Context, key string, delta int64, _ time.Duration) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counters[key] += delta
+	return f.counters[key], nil
+}
+
+func (f *fakeAPIKeyStore) GetCounter(_ context.Context, key string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.counters[key], nil
+}
+
+func newAuthTestHandler(store *fakeAPIKeyStore) *Handler {
+	return &Handler{
+		cfg: &config.Config{
+			Auth:       config.AuthConfig{Enabled: true},
+			ModelAlias: map[string]string{"my-gpt": "gpt-4"},
+		},
+		keys: store,
+	}
+}
+
+func newAuthTestRequest(path, key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	return req
+}
+
+func requireOpenAIError(t *testing.T, resp *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	require.Equal(t, status, resp.Code)
+	require.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+	var payload struct {
+		Error struct {
+			Message string  `json:"message"`
+			Type    string  `json:"type"`
+			Param   *string `json:"param"`
+			Code    string  `json:"code"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &payload))
+	require.Equal(t, code, payload.Error.Code)
+	require.NotEmpty(t, payload.Error.Message)
+	require.NotEmpty(t, payload.Error.Type)
+}
+
+func TestAuthenticate_Disabled(t *testing.T) {
+	handler := &Handler{cfg: &config.Config{}}
+	req := newAuthTestRequest("/chat/completions", "", `{}`)
+	out, ok := handler.authenticate(httptest.NewRecorder(), req)
+	require.True(t, ok)
+	require.Nil(t, apiKeyFromContext(out.Context()))
+}
+
+func TestAuthenticate_Rejections(t *testing.T) {
+	store := newFakeAPIKeyStore(map[string]*db.APIKeyRecord{
+		"sk-disabled": {ID: 1, Name: "disabled", Enabled: false},
+		"sk-paths":    {ID: 2, Name: "paths", Enabled: true, AllowedPaths: []string{"/embeddings", "/v1/*"}},
+		"sk-models":   {ID: 3, Name: "models", Enabled: true, AllowedModels: []string{"gpt-4"}},
+	})
+	handler := newAuthTestHandler(store)
+
+	tests := []struct {
+		name   string
+		path   string
+		key    string
+		body   string
+		status int
+		code   string
+	}{
+		{"missing key", "/chat/completions", "", `{}`, http.StatusUnauthorized, "invalid_api_key"},
+		{"unknown key", "/chat/completions", "sk-unknown", `{}`, http.StatusUnauthorized, "invalid_api_key"},
+		{"disabled key", "/chat/completions", "sk-disabled", `{}`, http.StatusUnauthorized, "api_key_disabled"},
+		{"path not allowed", "/chat/completions", "sk-paths", `{}`, http.StatusForbidden, "path_not_allowed"},
+		{"model not allowed", "/chat/completions", "sk-models", `{"model":"qwen"}`, http.StatusForbidden, "model_not_allowed"},
+		{"model missing", "/chat/completions", "sk-models", `{}`, http.StatusForbidden, "model_not_allowed"},
+		{"model unreadable", "/audio/transcriptions", "sk-models", "--boundary\r\n", http.StatusForbidden, "model_not_allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			_, ok := handler.authenticate(resp, newAuthTestRequest(tt.path, tt.key, tt.body))
+			require.False(t, ok)
+			requireOpenAIError(t, resp, tt.status, tt.code)
+		})
+	}
+}
+
+func TestAuthenticate_Allowlists(t *testing.T) {
+	store := newFakeAPIKeyStore(map[string]*db.APIKeyRecord{
+		"sk-paths":  {ID: 2, Name: "paths", Enabled: true, AllowedPaths: []string{"/embeddings", "/v1/*"}},
+		"sk-models": {ID: 3, Name: "models", Enabled: true, AllowedModels: []string{"gpt-4"}},
+	})
+	handler := newAuthTestHandler(store)
+
+	for _, path := range []string{"/embeddings", "/v1/chat/completions"} {
+		_, ok := handler.authenticate(httptest.NewRecorder(), newAuthTestRequest(path, "sk-paths", `{}`))
+		require.True(t, ok, path)
+	}
+
+	// 别名解析后的模型在允许列表中，且请求体被还原
+	req := newAuthTestRequest("/chat/completions", "sk-models", `{"model":"my-gpt"}`)
+	out, ok := handler.authenticate(httptest.NewRecorder(), req)
+	require.True(t, ok)
+	require.Equal(t, "models", apiKeyFromContext(out.Context()).Name)
+	body, err := io.ReadAll(out.Body)
+	require.NoError(t, err)
+	require.Equal(t, `{"model":"my-gpt"}`, string(body))
+
+	// 没有请求体的请求不涉及模型
+	req = httptest.NewRequest(http.MethodGet, "/models", nil)
+	req.Header.Set("Authorization", "Bearer sk-models")
+	_, ok = handler.authenticate(httptest.NewRecorder(), req)
+	require.True(t, ok)
+}
+
+func TestAuthenticate_StripsClientAuthHeaders(t *testing.T) {
+	store := newFakeAPIKeyStore(map[string]*db.APIKeyRecord{
+		"sk-valid": {ID: 1, Name: "valid", Enabled: true},
+	})
+	handler := newAuthTestHandler(store)
+
+	req := newAuthTestRequest("/chat/completions", "sk-valid", `{}`)
+	req.Header.Set("X-Api-Key", "sk-valid")
+	req.Header.Set("Api-Key", "sk-valid")
+	out, ok := handler.authenticate(httptest.NewRecorder(), req)
+	require.True(t, ok)
+	// 虚拟 API Key 不会转发给上游
+	for _, header := range clientAuthHeaders {
+		require.Empty(t, out.Header.Get(header), header)
+	}
+	require.Equal(t, "Bearer sk-valid", req.Header.Get("Authorization"))
+	require.Equal(t, "valid", apiKeyFromContext(out.Context()).Name)
+}
+
+func TestAuthenticate_RequestsPerMinute(t *testing.T) {
+	store := newFakeAPIKeyStore(map[string]*db.APIKeyRecord{
+		"sk-rpm": {ID: 4, Name: "rpm", Enabled: true, RPMLimit: 2},
+	})
+	handler := newAuthTestHandler(store)
+
+	for i := 0; i < 2; i++ {
+		_, ok := handler.authenticate(httptest.NewRecorder(), newAuthTestRequest("/chat/completions", "sk-rpm", `{}`))
+		require.True(t, ok)
+	}
+	resp := httptest.NewRecorder()
+	_, ok := handler.authenticate(resp, newAuthTestRequest("/chat/completions", "sk-rpm", `{}`))
+	require.False(t, ok)
+	requireOpenAIError(t, resp, http.StatusTooManyRequests, "rate_limit_exceeded")
+	require.NotEmpty(t, resp.Header().Get("Retry-After"))
+}
+
+func TestAuthenticate_TokensPerDay(t *testing.T) {
+	store := newFakeAPIKeyStore(map[string]*db.APIKeyRecord{
+		"sk-tokens": {ID: 5, Name: "tokens", Enabled: true, TokensPerDay: 100},
+	})
+	handler := newAuthTestHandler(store)
+
+	req := newAuthTestRequest("/chat/completions", "sk-tokens", `{}`)
+	out, ok := handler.authenticate(httptest.NewRecorder(), req)
+	require.True(t, ok)
+
+	// 响应读取完成后计入当日用量
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"choices":[],"usage":{"prompt_tokens":60,"completion_tokens":40,"total_tokens":100}}`)),
+		Request:    out,
+	}
+	handler.recordUsage(resp)
+	_, _ = io.ReadAll(resp.Body)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, int64(100), store.counters[apiKeyTokenCounter(5, time.Now())])
+
+	rec := httptest.NewRecorder()
+	_, ok = handler.authenticate(rec, newAuthTestRequest("/chat/completions", "sk-tokens", `{}`))
+	require.False(t, ok)
+	requireOpenAIError(t, rec, http.StatusTooManyRequests, "insufficient_quota")
+}
+
+func TestServeHTTP_TokensPerDayStreamWithoutUsage(t *testing.T) {
+	var received map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, testLLMStreamBody)
+	}))
+	defer upstream.Close()
+
+	store := newFakeAPIKeyStore(map[string]*db.APIKeyRecord{
+		"sk-tokens": {ID: 6, Name: "tokens", Enabled: true, TokensPerDay: 100},
+	})
+	handler := newAuthTestHandler(store)
+	handler.cfg.TargetMap = map[string]string{"/chat/completions": upstream.URL}
+	handler.lbManager = NewLoadBalancerManager()
+	handler.configure(handler.cfg, nil)
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, newAuthTestRequest("/chat/completions", "sk-tokens",
+		`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	// 代为请求 usage 并计入当日用量，客户端收到的流中不含用量分片
+	require.Equal(t, map[string]interface{}{"include_usage": true}, received["stream_options"])
+	require.Equal(t, int64(5), store.counters[apiKeyTokenCounter(6, time.Now())])
+	require.NotContains(t, resp.Body.String(), `"usage"`)
+	require.Contains(t, resp.Body.String(), `"content":"lo"`)
+	require.True(t, strings.HasSuffix(resp.Body.String(), "data: [DONE]\n\n"))
+
+	// 客户端自己请求 usage 时原样返回
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, newAuthTestRequest("/chat/completions", "sk-tokens",
+		`{"model":"gpt-4","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`))
+	require.Contains(t, resp.Body.String(), `"usage":{"prompt_tokens":3`)
+	require.Equal(t, int64(10), store.counters[apiKeyTokenCounter(6, time.Now())])
+}
+
+func TestAuthenticate_StoreUnavailable(t *testing.T) {
+	store := newFakeAPIKeyStore(nil)
+	store.err = errors.New("connection refused")
+	resp := httptest.NewRecorder()
+	_, ok := newAuthTestHandler(store).authenticate(resp, newAuthTestRequest("/chat/completions", "sk-any", `{}`))
+	require.False(t, ok)
+	requireOpenAIError(t, resp, http.StatusServiceUnavailable, "service_unavailable")
+
+	resp = httptest.NewRecorder()
+	handler := &Handler{cfg: &config.Config{Auth: config.AuthConfig{Enabled: true}}}
+	_, ok = handler.authenticate(resp, newAuthTestRequest("/chat/completions", "sk-any", `{}`))
+	require.False(t, ok)
+	requireOpenAIError(t, resp, http.StatusServiceUnavailable, "service_unavailable")
+}
+
+func TestServeHTTP_RejectsUnauthenticated(t *testing.T) {
+	handler := newAuthTestHandler(newFakeAPIKeyStore(nil))
+	handler.cfg.TargetMap = map[string]string{"/chat/completions": "https://api.example.com/v1"}
+	handler.router, _ = config.NewTargetRouter(handler.cfg)
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, newAuthTestRequest("/chat/completions", "", `{"model":"gpt-4"}`))
+	requireOpenAIError(t, resp, http.StatusUnauthorized, "invalid_api_key")
+}
+
+func TestExtractUsage(t *testing.T) {
+	usage, ok := extractUsage([]byte(`{"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`))
+	require.True(t, ok)
+	require.Equal(t, 5, usage.total())
+
+	usage, ok = extractUsage([]byte(testLLMStreamBody))
+	require.True(t, ok)
+	require.Equal(t, 3, usage.PromptTokens)
+	require.Equal(t, 5, usage.total())
+
+	usage, ok = extractUsage([]byte(`{"usage":{"prompt_tokens":7}}`))
+	require.True(t, ok)
+	require.Equal(t, 7, usage.total())
+
+	_, ok = extractUsage([]byte(`{"choices":[]}`))
+	require.False(t, ok)
+	_, ok = extractUsage([]byte("data: [DONE]\n"))
+	require.False(t, ok)
+}
+
+func TestHasUsage(t *testing.T) {
+	tests := []struct {
+		path        string
+		contentType string
+		expected    bool
+	}{
+		{"/chat/completions", "application/json", true},
+		{"/v1/chat/completions", "text/event-stream; charset=utf-8", true},
+		{"/v1/embeddings", "application/json", true},
+		{"/v1/files/file-1/content", "application/octet-stream", false},
+		{"/v1/audio/speech", "audio/mpeg", false},
+		{"/chat/completions", "text/html", false},
+		{"/v1/files", "application/json", false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{
+			Header:  http.Header{"Content-Type": {tt.contentType}},
+			Request: httptest.NewRequest(http.MethodPost, tt.path, nil),
+		}
+		require.Equal(t, tt.expected, hasUsage(resp), "%s %s", tt.path, tt.contentType)
+	}
+}
+
+func TestCaptureUsage_KeepsOnlyTail(t *testing.T) {
+	chunk := `data: {"choices":[{"index":0,"delta":{"content":"` + strings.Repeat("x", 1000) + `"}}]}` + "\n\n"
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"stream", "text/event-stream", strings.Repeat(chunk, 3000) +
+			`data: {"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}` + "\n\ndata: [DONE]\n\n"},
+		{"json", "application/json", `{"object":"list","data":[{"embedding":[` + strings.Repeat("0.01,", 600000) +
+			`0.01]}],"usage":{"prompt_tokens":5,"total_tokens":5}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *llmUsage
+			resp := &http.Response{
+				Header: http.Header{"Content-Type": {tt.contentType}},
+				Body:   io.NopCloser(strings.NewReader(tt.body)),
+			}
+			captureUsage(resp, func(usage *llmUsage) { got = usage })
+
+			buf := make([]byte, 32*1024)
+			for {
+				_, err := resp.Body.Read(buf)
+				require.LessOrEqual(t, len(resp.Body.(*usageCaptureBody).buf), 2*usageCaptureLimit)
+				if err != nil {
+					require.ErrorIs(t, err, io.EOF)
+					break
+				}
+			}
+			require.True(t, resp.Body.(*usageCaptureBody).truncated)
+			require.NoError(t, resp.Body.Close())
+			require.NotNil(t, got)
+			require.Equal(t, 5, got.total())
+		})
+	}
+}
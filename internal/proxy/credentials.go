@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCredentialUnauthorizedBench = 5 * time.Minute
+	defaultCredentialRateLimitBench    = 30 * time.Second
+)
+
+// clientAuthHeaders 虚拟 API Key 鉴权通过或配置上游凭证后从客户端请求中移除的鉴权头
+var clientAuthHeaders = []string{"Authorization", "X-Api-Key", "Api-Key"}
+
+// credentialPool 同一路由下的多个上游 key，轮流使用并暂时停用返回 401/429 的 key
+type credentialPool struct {
+	authType string
+	keys     []string
+	next     int
+	benched  map[string]time.Time // key -> 恢复时间
+}
+
+// pick 选择下一个未停用的 key；全部停用时选择最早恢复的 key，保证请求仍能发出
+func (p *credentialPool) pick(now time.Time) string {
+	var earliest string
+	var earliestUntil time.Time
+	for i := 0; i < len(p.keys); i++ {
+		key := p.keys[(p.next+i)%len(p.keys)]
+		until, benched := p.benched[key]
+		if !benched || !now.Before(until) {
+			p.next = (p.next + i + 1) % len(p.keys)
+			delete(p.benched, key)
+			return key
+		}
+		if earliest == "" || until.Before(earliestUntil) {
+			earliest, earliestUntil = key, until
+		}
+	}
+	return earliest
+}
+
+// upstreamCredentials 按模型路由和 target_map 路径管理上游凭证
+type upstreamCredentials struct {
+	mu      sync.Mutex
+	models  map[string]*credentialPool
+	targets map[string]*credentialPool
+	now     func() time.Time
+}
+
+// newUpstreamCredentials 根据配置创建凭证管理器，没有任何路由配置凭证时返回 nil
+func newUpstreamCredentials(cfg *config.Config) *upstreamCredentials {
+	if cfg == nil {
+		return nil
+	}
+	uc := &upstreamCredentials{
+		models:  make(map[string]*credentialPool),
+		targets: make(map[string]*credentialPool),
+		now:     time.Now,
+	}
+	for model := range cfg.ModelRoutes {
+		if route, ok := cfg.GetModelRoute(model); ok && route.Credentials.Configured() {
+			uc.models[model] = newCredentialPool(route.Credentials)
+		}
+	}
+	for path, creds := range cfg.TargetAuth {
+		if creds.Configured() {
+			uc.targets[path] = newCredentialPool(creds)
+		}
+	}
+	if len(uc.models) == 0 && len(uc.targets) == 0 {
+		return nil
+	}
+	return uc
+}
+
+func newCredentialPool(creds config.UpstreamCredentials) *credentialPool {
+	authType := strings.ToLower(creds.AuthType)
+	if authType == "" {
+		authType = config.AuthTypeBearer
+	}
+	return &credentialPool{
+		authType: authType,
+		keys:     append([]string(nil), creds.APIKeys...),
+		benched:  make(map[string]time.Time),
+	}
+}
+
+// pool 查找本次上游请求使用的凭证：走模型路由时只使用模型的凭证，否则使用 target_map 路径的凭证
+func (uc *upstreamCredentials) pool(route *upstreamRoute) *credentialPool {
+	if route == nil {
+		return nil
+	}
+	if route.baseURL != "" {
+		return uc.models[route.model]
+	}
+	return uc.targets[route.target]
+}
+
+// acquire 为请求选择一个 key，没有配置凭证时返回 false
+func (uc *upstreamCredentials) acquire(route *upstreamRoute) (*credentialPool, string, bool) {
+	if uc == nil {
+		return nil, "", false
+	}
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	pool := uc.pool(route)
+	if pool == nil {
+		return nil, "", false
+	}
+	return pool, pool.pick(uc.now()), true
+}
+
+// bench 暂时停用 key，期满后重新参与轮询
+func (uc *upstreamCredentials) bench(pool *credentialPool, key string, d time.Duration) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	pool.benched[key] = uc.now().Add(d)
+}
+
+// credentialTransport 为上游请求注入凭证并替换客户端的鉴权头，位于重试层之内，每次尝试重新选择 key
+type credentialTransport struct {
+	next  http.RoundTripper
+	creds *upstreamCredentials
+}
+
+func newCredentialTransport(next http.RoundTripper, creds *upstreamCredentials) http.RoundTripper {
+	if creds == nil {
+		return next
+	}
+	return &credentialTransport{next: next, creds: creds}
+}
+
+func (t *credentialTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	pool, key, ok := t.creds.acquire(upstreamRouteFromContext(r.Context()))
+	if !ok {
+		return t.next.RoundTrip(r)
+	}
+
+	req := r.Clone(r.Context())
+	for _, header := range clientAuthHeaders {
+		req.Header.Del(header)
+	}
+	setUpstreamAuth(req.Header, pool.authType, key)
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if d := credentialBenchDuration(resp); d > 0 {
+		t.creds.bench(pool, key, d)
+		logger.Warn("Upstream credential benched",
+			zap.String("requestId", utils.GetRequestID(r)),
+			zap.String("target", req.URL.Host),
+			zap.String("key", maskKey(key)),
+			zap.Int("status", resp.StatusCode),
+			zap.Duration("duration", d))
+	}
+	return resp, nil
+}
+
+// setUpstreamAuth 按 auth_type 设置上游鉴权头
+func setUpstreamAuth(header http.Header, authType, key string) {
+	switch authType {
+	case config.AuthTypeXAPIKey:
+		header.Set("X-Api-Key", key)
+	case config.AuthTypeAPIKey:
+		header.Set("Api-Key", key)
+	default:
+		header.Set("Authorization", "Bearer "+key)
+	}
+}
+
+// credentialBenchDuration 401 表示 key 失效，较长时间停用；429 优先遵循上游的 Retry-After
+func credentialBenchDuration(resp *http.Response) time.Duration {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return defaultCredentialUnauthorizedBench
+	case http.StatusTooManyRequests:
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		return defaultCredentialRateLimitBench
+	}
+	return 0
+}
+
+// maskKey 日志中只保留 key 的末尾 4 位
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
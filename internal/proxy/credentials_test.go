@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-llm-server/internal/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newCredentialServer 记录收到的鉴权头，按 key 返回指定状态码（未指定时返回 200）
+func newCredentialServer(t *testing.T, statusByKey map[string]int) (*httptest.Server, func() []http.Header) {
+	var mu sync.Mutex
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if status, ok := statusByKey[key]; ok {
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]http.Header(nil), headers...)
+	}
+}
+
+func newCredentialTestRequest(t *testing.T, target, model, baseURL, path string) *http.Request {
+	ctx, route := withUpstreamRoute(context.Background())
+	route.requestedModel = model
+	route.model = model
+	route.baseURL = baseURL
+	route.path = path
+	route.target = path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target+path, strings.NewReader(`{}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer sk-client")
+	req.Header.Set("X-Api-Key", "sk-client")
+	return req
+}
+
+func roundTripStatus(t *testing.T, transport http.RoundTripper, req *http.Request) int {
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp.StatusCode
+}
+
+func TestNewUpstreamCredentials_NoneConfigured(t *testing.T) {
+	cfg := &config.Config{ModelRoutes: map[string]interface{}{"gpt-4": "https://api.openai.com/v1"}}
+	require.Nil(t, newUpstreamCredentials(cfg))
+	require.Nil(t, newUpstreamCredentials(nil))
+	require.Equal(t, http.DefaultTransport, newCredentialTransport(http.DefaultTransport, nil))
+}
+
+func TestCredentialTransport_InjectsFormats(t *testing.T) {
+	server, headers := newCredentialServer(t, nil)
+	cfg := &config.Config{
+		ModelRoutes: map[string]interface{}{
+			"gpt-4": map[string]interface{}{
+				"urls":     []interface{}{server.URL},
+				"api_keys": []interface{}{"sk-openai"},
+			},
+			"claude": map[string]interface{}{
+				"urls":      []interface{}{server.URL},
+				"api_key":   "sk-anthropic",
+				"auth_type": "x-api-key",
+			},
+			"plain": server.URL,
+		},
+		TargetAuth: map[string]config.UpstreamCredentials{
+			"/embeddings": {APIKeys: []string{"sk-azure"}, AuthType: config.AuthTypeAPIKey},
+		},
+	}
+	transport := newCredentialTransport(http.DefaultTransport, newUpstreamCredentials(cfg))
+
+	roundTripStatus(t, transport, newCredentialTestRequest(t, server.URL, "gpt-4", server.URL, "/chat/completions"))
+	roundTripStatus(t, transport, newCredentialTestRequest(t, server.URL, "claude", server.URL, "/chat/completions"))
+	roundTripStatus(t, transport, newCredentialTestRequest(t, server.URL, "", "", "/embeddings"))
+	roundTripStatus(t, transport, newCredentialTestRequest(t, server.URL, "plain", server.URL, "/chat/completions"))
+
+	got := headers()
+	require.Len(t, got, 4)
+
+	require.Equal(t, "Bearer sk-openai", got[0].Get("Authorization"))
+	require.Empty(t, got[0].Get("X-Api-Key"))
+
+	require.Equal(t, "sk-anthropic", got[1].Get("X-Api-Key"))
+	require.Empty(t, got[1].Get("Authorization"))
+
+	require.Equal(t, "sk-azure", got[2].Get("Api-Key"))
+	require.Empty(t, got[2].Get("Authorization"))
+	require.Empty(t, got[2].Get("X-Api-Key"))
+
+	// 未配置凭证的路由保持透传客户端的鉴权头
+	require.Equal(t, "Bearer sk-client", got[3].Get("Authorization"))
+}
+
+func TestCredentialTransport_RotatesAndBenches(t *testing.T) {
+	server, headers := newCredentialServer(t, map[string]int{"sk-bad": http.StatusUnauthorized})
+	cfg := &config.Config{
+		ModelRoutes: map[string]interface{}{
+			"gpt-4": map[string]interface{}{
+				"urls":     []interface{}{server.URL},
+				"api_keys": []interface{}{"sk-a", "sk-bad", "sk-b"},
+			},
+		},
+	}
+	creds := newUpstreamCredentials(cfg)
+	now := time.Now()
+	creds.now = func() time.Time { return now }
+	transport := newCredentialTransport(http.DefaultTransport, creds)
+
+	statuses := make([]int, 0, 6)
+	for i := 0; i < 6; i++ {
+		statuses = append(statuses, roundTripStatus(t, transport, newCredentialTestRequest(t, server.URL, "gpt-4", server.URL, "/chat/completions")))
+	}
+	require.Equal(t, []int{200, 401, 200, 200, 200, 200}, statuses)
+
+	var keys []string
+	for _, h := range headers() {
+		keys = append(keys, strings.TrimPrefix(h.Get("Authorization"), "Bearer "))
+	}
+	require.Equal(t, []string{"sk-a", "sk-bad", "sk-b", "sk-a", "sk-b", "sk-a"}, keys)
+
+	// 停用期满后重新参与轮询
+	now = now.Add(defaultCredentialUnauthorizedBench)
+	roundTripStatus(t, transport, newCredentialTestRequest(t, server.URL, "gpt-4", server.URL, "/chat/completions"))
+	got := headers()
+	require.Equal(t, "Bearer sk-bad", got[len(got)-1].Get("Authorization"))
+}
+
+func TestCredentialPool_AllBenched(t *testing.T) {
+	now := time.Now()
+	pool := newCredentialPool(config.UpstreamCredentials{APIKeys: []string{"sk-a", "sk-b"}})
+	pool.benched["sk-a"] = now.Add(time.Minute)
+	pool.benched["sk-b"] = now.Add(10 * time.Second)
+	require.Equal(t, "sk-b", pool.pick(now))
+}
+
+func TestCredentialBenchDuration(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"7"}}}
+	require.Equal(t, 7*time.Second, credentialBenchDuration(resp))
+	resp.Header.Del("Retry-After")
+	require.Equal(t, defaultCredentialRateLimitBench, credentialBenchDuration(resp))
+	require.Equal(t, defaultCredentialUnauthorizedBench, credentialBenchDuration(&http.Response{StatusCode: http.StatusUnauthorized}))
+	require.Zero(t, credentialBenchDuration(&http.Response{StatusCode: http.StatusOK}))
+}
+
+func TestCredentialTransport_RetryUsesNextKey(t *testing.T) {
+	server, headers := newCredentialServer(t, map[string]int{"sk-limited": http.StatusTooManyRequests})
+	cfg := &config.Config{
+		ModelRoutes: map[string]interface{}{
+			"gpt-4": map[string]interface{}{
+				"urls":     []interface{}{server.URL},
+				"api_keys": []interface{}{"sk-limited", "sk-ok"},
+			},
+		},
+	}
+	lbm := NewLoadBalancerManager()
+	lbm.AddLoadBalancer("gpt-4", []string{server.URL})
+	transport := newRetryTransport(
+		newCredentialTransport(http.DefaultTransport, newUpstreamCredentials(cfg)),
+		lbm,
+		config.RetryConfig{MaxAttempts: 2},
+	)
+
+	require.Equal(t, http.StatusOK, roundTripStatus(t, transport, newCredentialTestRequest(t, server.URL, "gpt-4", server.URL, "/chat/completions")))
+	got := headers()
+	require.Len(t, got, 2)
+	require.Equal(t, "Bearer sk-limited", got[0].Get("Authorization"))
+	require.Equal(t, "Bearer sk-ok", got[1].Get("Authorization"))
+}
@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/logger"
+	cache "go-llm-server/pkg/redis"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// dedupPollInterval 跨副本等待时轮询 Redis 锁的间隔
+	dedupPollInterval = 100 * time.Millisecond
+	// coalescedHeader 等待其他请求完成后由缓存返回的响应带有该响应头
+	coalescedHeader = "X-Request-Coalesced"
+)
+
+// dedupLockScript 获取锁：key 不存在时写入 token，返回 {1}；已被其他请求持有时返回 {0}
+var dedupLockScript = cache.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+  return {1}
+end
+return {0}
+`)
+
+// dedupUnlockScript 仅在锁仍由 token 持有时删除，避免误删超时后被其他请求重新获取的锁
+var dedupUnlockScript = cache.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+  return {redis.call("DEL", KEYS[1])}
+end
+return {0}
+`)
+
+var dedupLockExistsScript = cache.NewScript(`return {redis.call("EXISTS", KEYS[1])}`)
+
+// requestDeduper 合并并发的相同请求：同一缓存键同时只有一个领头请求访问上游，
+// 其余请求等待领头请求结束后重新查询缓存，等待超时或缓存仍未命中时自行访问上游
+type requestDeduper struct {
+	wait   time.Duration
+	locker scriptRunner // 为 nil 时只合并本进程内的请求
+
+	mu      sync.Mutex
+	flights map[string]chan struct{}
+}
+
+// newRequestDeduper 按配置创建请求合并器；未开启时返回 nil，Redis 不可用时只在进程内合并
+func newRequestDeduper(cfg *config.Config, redisClient *cache.Redis) *requestDeduper {
+	if cfg == nil || !cfg.Cache.Dedup.Enabled {
+		return nil
+	}
+	wait := cfg.Cache.Dedup.Wait
+	if wait == 0 {
+		wait = config.DefaultDedupWait
+	}
+	d := &requestDeduper{
+		wait:    time.Duration(wait) * time.Second,
+		flights: make(map[string]chan struct{}),
+	}
+	if cfg.Cache.Dedup.Distributed {
+		if redisClient != nil {
+			d.locker = redisClient
+		} else {
+			logger.Warn("Redis unavailable, deduplicating requests within this replica only")
+		}
+	}
+	return d
+}
+
+// acquire 加入 key 对应的请求组。release 非 nil 时调用方负责访问上游，
+// 必须在响应写入缓存（或失败）后调用 release；waited 为 true 表示已等待其他请求结束，
+// 调用方应先重新查询缓存。两者可能同时成立：本进程内领头、但其他副本正在处理同一请求
+func (d *requestDeduper) acquire(ctx context.Context, key string) (release func(), waited bool) {
+	if d == nil {
+		return nil, false
+	}
+
+	d.mu.Lock()
+	if done, ok := d.flights[key]; ok {
+		d.mu.Unlock()
+		d.waitLocal(ctx, done)
+		return nil, true
+	}
+	done := make(chan struct{})
+	d.flights[key] = done
+	d.mu.Unlock()
+
+	var once sync.Once
+	releaseLocal := func() {
+		once.Do(func() {
+			d.mu.Lock()
+			delete(d.flights, key)
+			d.mu.Unlock()
+			close(done)
+		})
+	}
+	if d.locker == nil {
+		return releaseLocal, false
+	}
+
+	lockKey := "dedup:" + key
+	token := uuid.NewString()
+	vals, err := d.locker.RunInt64s(ctx, dedupLockScript, []string{lockKey}, token, d.wait.Milliseconds())
+	if err != nil || len(vals) != 1 {
+		logger.Warn("Failed to acquire dedup lock, deduplicating within this replica only",
+			zap.String("key", lockKey), zap.Error(err))
+		return releaseLocal, false
+	}
+	if vals[0] == 1 {
+		return func() {
+			// 请求上下文可能已取消，释放锁使用独立的上下文
+			unlockCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if _, err := d.locker.RunInt64s(unlockCtx, dedupUnlockScript, []string{lockKey}, token); err != nil {
+				logger.Warn("Failed to release dedup lock", zap.String("key", lockKey), zap.Error(err))
+			}
+			releaseLocal()
+		}, false
+	}
+
+	// 其他副本正在处理：本进程内的相同请求排在当前请求之后，由当前请求轮询锁
+	d.waitRemote(ctx, lockKey)
+	return releaseLocal, true
+}
+
+func (d *requestDeduper) waitLocal(ctx context.Context, done <-chan struct{}) {
+	timer := time.NewTimer(d.wait)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// waitRemote 轮询直到其他副本释放锁、锁过期或等待超时
+func (d *requestDeduper) waitRemote(ctx context.Context, lockKey string) {
+	deadline := time.NewTimer(d.wait)
+	defer deadline.Stop()
+	ticker := time.NewTicker(dedupPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			vals, err := d.locker.RunInt64s(ctx, dedupLockExistsScript, []string{lockKey})
+			if err != nil || len(vals) != 1 || vals[0] == 0 {
+				return
+			}
+		case <-deadline.C:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// embeddingFlightKey 由未命中输入的缓存键计算请求组 key，未命中输入集合相同的请求合并
+func embeddingFlightKey(model string, misses []embeddingInputMeta, dimensions *int) string {
+	keys := make([]string, 0, len(misses))
+	for _, miss := range misses {
+		keys = append(keys, utils.MakeEmbeddingCacheKey(miss.Value, model, dimensions))
+	}
+	sort.Strings(keys)
+	return "embedding:" + utils.MakeHash(strings.Join(keys, ","))
+}
+
+// markCoalesced 标记由合并等待后命中缓存的响应
+func markCoalesced(w http.ResponseWriter) {
+	w.Header().Set(coalescedHeader, "true")
+}
@@ -0,0 +1,244 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/pkg/db"
+	cache "go-llm-server/pkg/redis"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLockStore 模拟 dedup 使用的 Redis 脚本
+type fakeLockStore struct {
+	mu    sync.Mutex
+	locks map[string]string
+	err   error
+}
+
+func (f *fakeLockStore) RunInt64s(_ context.Context, script *cache.Script, keys []string, args ...interface{}) ([]int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	key := keys[0]
+	switch script {
+	case dedupLockScript:
+		if _, ok := f.locks[key]; ok {
+			return []int64{0}, nil
+		}
+		f.locks[key] = args[0].(string)
+		return []int64{1}, nil
+	case dedupUnlockScript:
+		if f.locks[key] == args[0].(string) {
+			delete(f.locks, key)
+			return []int64{1}, nil
+		}
+		return []int64{0}, nil
+	case dedupLockExistsScript:
+		if _, ok := f.locks[key]; ok {
+			return []int64{1}, nil
+		}
+		return []int64{0}, nil
+	}
+	return nil, errUnexpectedScriptResult
+}
+
+func (f *fakeLockStore) release(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.locks, key)
+}
+
+func TestRequestDeduper_Local(t *testing.T) {
+	d := &requestDeduper{wait: time.Second, flights: make(map[string]chan struct{})}
+
+	release, waited := d.acquire(context.Background(), "llm:a")
+	require.NotNil(t, release)
+	require.False(t, waited)
+
+	// 不同 key 互不影响
+	other, waited := d.acquire(context.Background(), "llm:b")
+	require.NotNil(t, other)
+	require.False(t, waited)
+	other()
+
+	followerDone := make(chan bool)
+	go func() {
+		followerRelease, waited := d.acquire(context.Background(), "llm:a")
+		followerDone <- followerRelease == nil && waited
+	}()
+	select {
+	case <-followerDone:
+		t.Fatal("follower returned before the leader released")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	require.True(t, <-followerDone)
+	release() // 重复调用无副作用
+
+	// 领头请求结束后，新的请求成为领头请求
+	release, waited = d.acquire(context.Background(), "llm:a")
+	require.NotNil(t, release)
+	require.False(t, waited)
+
+	// 等待超时后跟随者自行访问上游
+	d.wait = 20 * time.Millisecond
+	followerRelease, waited := d.acquire(context.Background(), "llm:a")
+	require.Nil(t, followerRelease)
+	require.True(t, waited)
+	release()
+}
+
+func TestRequestDeduper_Distributed(t *testing.T) {
+	locks := &fakeLockStore{locks: map[string]string{}}
+	d := &requestDeduper{wait: time.Second, locker: locks, flights: make(map[string]chan struct{})}
+
+	release, waited := d.acquire(context.Background(), "llm:a")
+	require.False(t, waited)
+	require.Contains(t, locks.locks, "dedup:llm:a")
+	release()
+	require.Empty(t, locks.locks)
+
+	// 其他副本持有锁：等待锁释放，之后本进程内的相同请求排在当前请求之后
+	locks.locks["dedup:llm:a"] = "other-replica"
+	go func() {
+		time.Sleep(3 * dedupPollInterval)
+		locks.release("dedup:llm:a")
+	}()
+	start := time.Now()
+	release, waited = d.acquire(context.Background(), "llm:a")
+	require.True(t, waited)
+	require.NotNil(t, release)
+	require.GreaterOrEqual(t, time.Since(start), 2*dedupPollInterval)
+	release()
+
+	// 有界等待：锁一直未释放时超时返回
+	d.wait = 2 * dedupPollInterval
+	locks.locks["dedup:llm:a"] = "stuck"
+	release, waited = d.acquire(context.Background(), "llm:a")
+	require.True(t, waited)
+	release()
+	require.Equal(t, "stuck", locks.locks["dedup:llm:a"])
+
+	// Redis 出错时退回进程内合并
+	locks.err = errUnexpectedScriptResult
+	release, waited = d.acquire(context.Background(), "llm:b")
+	require.NotNil(t, release)
+	require.False(t, waited)
+	release()
+}
+
+func TestDedup_CoalescesConcurrentLLMRequests(t *testing.T) {
+	var upstreamCalls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer upstream.Close()
+
+	var mu sync.Mutex
+	stored := map[string]*db.LLMRecord{}
+	storage := &fakeLLMCacheStorage{
+		getLLMFn: func(_ context.Context, request, _ string) (*db.LLMRecord, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return stored[request], nil
+		},
+		upsertLLMFn: func(_ context.Context, rec *db.LLMRecord) error {
+			mu.Lock()
+			defer mu.Unlock()
+			stored[string(rec.Request)] = rec
+			return nil
+		},
+	}
+	handler := NewHandler(&config.Config{
+		TargetMap: map[string]string{"/chat/completions": upstream.URL},
+		Cache:     config.CacheConfig{Dedup: config.DedupConfig{Enabled: true}},
+	})
+	defer handler.health.Stop()
+	handler.storage = storage
+
+	const concurrency = 10
+	var wg sync.WaitGroup
+	var coalesced int32
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/chat/completions",
+				strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`))
+			handler.ServeHTTP(resp, req)
+			if resp.Code == http.StatusOK && resp.Header().Get(coalescedHeader) == "true" {
+				require.Equal(t, "HIT", resp.Header().Get("X-LLM-Cache"))
+				atomic.AddInt32(&coalesced, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&upstreamCalls))
+	require.Equal(t, int32(concurrency-1), atomic.LoadInt32(&coalesced))
+	require.Empty(t, handler.dedup.flights)
+}
+
+func TestDedup_CoalescesConcurrentEmbeddingRequests(t *testing.T) {
+	var upstreamCalls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamCalls, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"usage":{"prompt_tokens":1,"total_tokens":1}}`))
+	}))
+	defer upstream.Close()
+
+	var mu sync.Mutex
+	stored := map[string]*db.EmbeddingRecord{}
+	storage := &fakeCacheStorage{
+		getEmbeddingFn: func(_ context.Context, inputText, _ string, _ *int) (*db.EmbeddingRecord, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return stored[inputText], nil
+		},
+		upsertEmbeddingFn: func(_ context.Context, rec *db.EmbeddingRecord) error {
+			mu.Lock()
+			defer mu.Unlock()
+			stored[rec.InputText] = rec
+			return nil
+		},
+	}
+	handler := NewHandler(&config.Config{
+		TargetMap: map[string]string{"/v1/embeddings": upstream.URL},
+		Cache:     config.CacheConfig{Dedup: config.DedupConfig{Enabled: true}},
+	})
+	defer handler.health.Stop()
+	handler.storage = storage
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/v1/embeddings",
+				strings.NewReader(`{"model":"text-embedding-3-small","input":"hello"}`))
+			handler.ServeHTTP(resp, req)
+			require.Equal(t, http.StatusOK, resp.Code)
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&upstreamCalls))
+}
@@ -29,6 +29,7 @@ type embeddingCacheMetadata struct {
 	dimensions *int
 	startTime  time.Time
 	requestID  string
+	release    func() // 合并相同请求时由领头请求在写入缓存后调用
 }
 
 type embeddingInputMeta struct {
@@ -152,21 +153,28 @@ func (h *Handler) handleEmbeddingCachePreProxy(w http.ResponseWriter, r *http.Re
 
 	// 全部命中：直接返回合并的 response
 	if len(misses) == 0 {
-		responseBytes, err := marshalEmbeddingResponseFromRecords(modelName, inputs, hits)
-		if err != nil {
-			logger.Warn("embedding-cache: failed to marshal HIT response",
-				zap.String("requestId", requestID),
-				zap.Error(err))
-			return false, nil
+		return h.writeEmbeddingCacheHit(w, requestID, modelName, inputs, hits), nil
+	}
+
+	// 相同的未命中输入正在由其他请求访问上游时，等待其写入缓存后重新查询
+	release, waited := h.dedup.acquire(r.Context(), embeddingFlightKey(modelName, misses, dimensions))
+	if waited {
+		remaining := make([]embeddingInputMeta, 0, len(misses))
+		for _, input := range misses {
+			if rec, err := h.storage.GetEmbedding(r.Context(), input.Value, modelName, dimensions); err == nil && rec != nil {
+				hits[input.Index] = rec
+			} else {
+				remaining = append(remaining, input)
+			}
+		}
+		misses = remaining
+		if len(misses) == 0 {
+			if release != nil {
+				release()
+			}
+			markCoalesced(w)
+			return h.writeEmbeddingCacheHit(w, requestID, modelName, inputs, hits), nil
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("X-Embedding-Cache", "HIT")
-		_, _ = w.Write(responseBytes)
-		logger.Info("embedding-cache: served embeddings from cache",
-			zap.String("requestId", requestID),
-			zap.String("model", modelName),
-			zap.Int("hits", len(inputs)))
-		return true, nil
 	}
 
 	// 有 miss：重写请求 body 只包含 misses
@@ -176,6 +184,9 @@ func (h *Handler) handleEmbeddingCachePreProxy(w http.ResponseWriter, r *http.Re
 		logger.Warn("embedding-cache: failed to marshal payload for misses",
 			zap.String("requestId", requestID),
 			zap.Error(err))
+		if release != nil {
+			release()
+		}
 		return false, nil
 	}
 	r.Body = io.NopCloser(bytes.NewReader(newBody))
@@ -190,11 +201,31 @@ func (h *Handler) handleEmbeddingCachePreProxy(w http.ResponseWriter, r *http.Re
 		dimensions: dimensions,
 		startTime:  time.Now(),
 		requestID:  requestID,
+		release:    release,
 	}
 
 	return false, meta
 }
 
+// writeEmbeddingCacheHit 所有输入均命中时直接返回合并的 response；序列化失败时返回 false，请求继续转发到上游
+func (h *Handler) writeEmbeddingCacheHit(w http.ResponseWriter, requestID, modelName string, inputs []embeddingInputMeta, hits map[int]*db.EmbeddingRecord) bool {
+	responseBytes, err := marshalEmbeddingResponseFromRecords(modelName, inputs, hits)
+	if err != nil {
+		logger.Warn("embedding-cache: failed to marshal HIT response",
+			zap.String("requestId", requestID),
+			zap.Error(err))
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Embedding-Cache", "HIT")
+	_, _ = w.Write(responseBytes)
+	logger.Info("embedding-cache: served embeddings from cache",
+		zap.String("requestId", requestID),
+		zap.String("model", modelName),
+		zap.Int("hits", len(inputs)))
+	return true
+}
+
 func extractDimensionsField(payload map[string]interface{}) *int {
 	var dimensions *int
 	if dimVal, ok := payload["dimensions"]; ok {
@@ -311,6 +342,11 @@ func (h *Handler) handleEmbeddingCachePostResponse(resp *http.Response, meta *em
 
 	// 保存 upstream 返回的 embeddings（假设 upstream 返回的 data index 是 0..n-1，顺序对应我们发送的 misses）
 	newRecords := make(map[int]*db.EmbeddingRecord) // original index -> record
+	// 退出流程中存储已关闭时只返回结果，不再写入缓存
+	persist := h.life.beginWrite()
+	if persist {
+		defer h.life.endWrite()
+	}
 	endTime := time.Now()
 	totalTokens := 0
 	singleRecordTokens := 0
@@ -337,6 +373,10 @@ func (h *Handler) handleEmbeddingCachePostResponse(resp *http.Response, meta *em
 			StartTime:  &meta.startTime,
 			EndTime:    &endTime,
 		}
+		if !persist {
+			newRecords[miss.Index] = rec
+			continue
+		}
 		if err := h.storage.UpsertEmbedding(resp.Request.Context(), rec); err != nil {
 			logger.Warn("embedding-cache: failed to persist embedding",
 				zap.String("requestId", meta.requestID),
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// servedModelHeader 响应头，标识实际处理请求的模型
+const servedModelHeader = "X-LLM-Model"
+
+// fallbackTransport 当前模型的上游返回 429/5xx 或超时、连接失败时，按 fallbacks 配置依次切换到备用模型。
+// 与重试一样只发生在响应交给 ReverseProxy 之前。
+type fallbackTransport struct {
+	next     http.RoundTripper
+	strategy *ModelSpecifyStrategy
+}
+
+func newFallbackTransport(next http.RoundTripper, strategy *ModelSpecifyStrategy) http.RoundTripper {
+	return &fallbackTransport{next: next, strategy: strategy}
+}
+
+func (t *fallbackTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	route := upstreamRouteFromContext(r.Context())
+	if route == nil || route.model == "" {
+		return t.next.RoundTrip(r)
+	}
+
+	fallbacks := t.strategy.fallbackModels(route.model)
+	if len(fallbacks) == 0 {
+		resp, err := t.next.RoundTrip(r)
+		setServedModel(resp, route)
+		return resp, err
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		_ = r.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to buffer request body for fallback: %w", err)
+		}
+	}
+	req := r.Clone(r.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	resp, err := t.next.RoundTrip(req)
+	for _, model := range fallbacks {
+		reason := fallbackReason(resp, err)
+		if reason == "" || r.Context().Err() != nil {
+			break
+		}
+		fallbackReq, ok := t.strategy.routeFallback(r, body, model)
+		if !ok {
+			continue
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			_ = resp.Body.Close()
+		}
+		logger.Warn("Falling back to next model",
+			zap.String("requestId", utils.GetRequestID(r)),
+			zap.String("requestedModel", route.requestedModel),
+			zap.String("fallbackModel", model),
+			zap.String("target", route.baseURL),
+			zap.String("reason", reason))
+		resp, err = t.next.RoundTrip(fallbackReq)
+	}
+
+	setServedModel(resp, route)
+	return resp, err
+}
+
+// fallbackReason 返回切换备用模型的原因，空字符串表示无需切换
+func fallbackReason(resp *http.Response, err error) string {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return ""
+		}
+		return err.Error()
+	}
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError) {
+		return fmt.Sprintf("status %d", resp.StatusCode)
+	}
+	return ""
+}
+
+func setServedModel(resp *http.Response, route *upstreamRoute) {
+	if resp == nil || route == nil || route.model == "" {
+		return
+	}
+	resp.Header.Set(servedModelHeader, route.model)
+}
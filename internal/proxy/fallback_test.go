@@ -0,0 +1,211 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newModelServer 返回固定状态码的上游，并记录收到的请求体中的 model
+func newModelServer(t *testing.T, status int, models *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Model string `json:"model"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(body, &payload))
+		*models = append(*models, payload.Model)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"model":"` + payload.Model + `"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newFallbackTestTransport(cfg *config.Config) http.RoundTripper {
+	lbm := NewLoadBalancerManager()
+	for model := range cfg.ModelRoutes {
+		urls, _ := cfg.GetModelURLs(model)
+		lbm.AddLoadBalancer(model, urls)
+	}
+	return newFallbackTransport(http.DefaultTransport, NewModelSpecifyStrategy(lbm, cfg))
+}
+
+func newFallbackTestRequest(t *testing.T, baseURL, model string) (*http.Request, *upstreamRoute) {
+	ctx, route := withUpstreamRoute(context.Background())
+	route.requestedModel = model
+	route.model = model
+	route.baseURL = baseURL
+	route.path = "/chat/completions"
+	body := `{"model":"` + model + `","messages":[{"role":"user","content":"hi"}]}`
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/chat/completions", strings.NewReader(body))
+	require.NoError(t, err)
+	return req, route
+}
+
+func TestFallbackTransport_WalksChain(t *testing.T) {
+	var models []string
+	primary := newModelServer(t, http.StatusServiceUnavailable, &models)
+	second := newModelServer(t, http.StatusTooManyRequests, &models)
+	third := newModelServer(t, http.StatusOK, &models)
+
+	cfg := &config.Config{
+		ModelRoutes: map[string]interface{}{
+			"gpt-4":       primary.URL,
+			"qwen3-235b":  second.URL,
+			"deepseek-v3": third.URL,
+		},
+		Fallbacks: map[string][]string{"gpt-4": {"qwen3-235b", "deepseek-v3"}},
+	}
+	transport := newFallbackTestTransport(cfg)
+	req, route := newFallbackTestRequest(t, primary.URL, "gpt-4")
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "deepseek-v3", resp.Header.Get(servedModelHeader))
+	require.Equal(t, []string{"gpt-4", "qwen3-235b", "deepseek-v3"}, models)
+	require.Equal(t, third.URL, route.baseURL)
+	require.True(t, route.servedByFallback())
+}
+
+func TestFallbackTransport_StopsOnSuccessOrClientError(t *testing.T) {
+	var models []string
+	primary := newModelServer(t, http.StatusBadRequest, &models)
+	backup := newModelServer(t, http.StatusOK, &models)
+
+	cfg := &config.Config{
+		ModelRoutes: map[string]interface{}{"gpt-4": primary.URL, "qwen3-235b": backup.URL},
+		Fallbacks:   map[string][]string{"gpt-4": {"qwen3-235b"}},
+	}
+	transport := newFallbackTestTransport(cfg)
+	req, route := newFallbackTestRequest(t, primary.URL, "gpt-4")
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Equal(t, "gpt-4", resp.Header.Get(servedModelHeader))
+	require.Equal(t, []string{"gpt-4"}, models)
+	require.False(t, route.servedByFallback())
+}
+
+func TestFallbackTransport_SkipsUnroutedModels(t *testing.T) {
+	var models []string
+	primary := newModelServer(t, http.StatusBadGateway, &models)
+	backup := newModelServer(t, http.StatusOK, &models)
+
+	cfg := &config.Config{
+		ModelRoutes: map[string]interface{}{"gpt-4": primary.URL, "deepseek-v3": backup.URL},
+		ModelAlias:  map[string]string{"ds": "deepseek-v3"},
+		Fallbacks:   map[string][]string{"gpt-4": {"missing", "gpt-4", "ds"}},
+	}
+	transport := newFallbackTestTransport(cfg)
+	req, _ := newFallbackTestRequest(t, primary.URL, "gpt-4")
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "deepseek-v3", resp.Header.Get(servedModelHeader))
+	require.Equal(t, []string{"gpt-4", "deepseek-v3"}, models)
+}
+
+func TestFallbackTransport_AttemptTimeout(t *testing.T) {
+	var models []string
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer hanging.Close()
+	defer close(release)
+	backup := newModelServer(t, http.StatusOK, &models)
+
+	cfg := &config.Config{
+		ModelRoutes: map[string]interface{}{"gpt-4": hanging.URL, "qwen3-235b": backup.URL},
+		Fallbacks:   map[string][]string{"gpt-4": {"qwen3-235b"}},
+	}
+	lbm := NewLoadBalancerManager()
+	lbm.AddLoadBalancer("gpt-4", []string{hanging.URL})
+	lbm.AddLoadBalancer("qwen3-235b", []string{backup.URL})
+	// 单次尝试超时由重试层产生，备用模型切换在其外层
+	retry := newRetryTransport(http.DefaultTransport, lbm, config.RetryConfig{MaxAttempts: 2, AttemptTimeout: 1})
+	transport := newFallbackTransport(retry, NewModelSpecifyStrategy(lbm, cfg))
+
+	req, route := newFallbackTestRequest(t, hanging.URL, "gpt-4")
+	start := time.Now()
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "qwen3-235b", resp.Header.Get(servedModelHeader))
+	require.Equal(t, []string{"qwen3-235b"}, models)
+	require.Equal(t, 1, route.attempts)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestFallbackTransport_NoFallbacksConfigured(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{ModelRoutes: map[string]interface{}{"gpt-4": server.URL}}
+	transport := newFallbackTestTransport(cfg)
+	req, _ := newFallbackTestRequest(t, server.URL, "gpt-4")
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, "gpt-4", resp.Header.Get(servedModelHeader))
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestModifyResponse_SkipsCacheForFallback(t *testing.T) {
+	upsertCalled := false
+	handler := newLLMTestHandler(&fakeLLMCacheStorage{
+		upsertLLMFn: func(ctx context.Context, rec *db.LLMRecord) error {
+			upsertCalled = true
+			return nil
+		},
+	})
+
+	ctx, route := withUpstreamRoute(context.Background())
+	route.requestedModel = "gpt-4"
+	route.model = "qwen3-235b"
+	ctx = context.WithValue(ctx, llmCacheContextKey, &llmCacheMetadata{prompt: `{"model":"gpt-4"}`, model: "gpt-4"})
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(`{"choices":[]}`)),
+		Request:    httptest.NewRequest(http.MethodPost, "/chat/completions", nil).WithContext(ctx),
+	}
+
+	require.NoError(t, handler.modifyResponse(resp))
+	_, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	require.False(t, upsertCalled)
+	require.Empty(t, resp.Header.Get("X-LLM-Cache"))
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// frontendStreamWriter 将 chat completions 的 SSE 流转换为前端接口的流式事件，接收任意切分的数据
+type frontendStreamWriter interface {
+	Write(p []byte) error
+	Close()
+}
+
+// frontendResponseWriter 接收 Messages API、Responses API 等前端接口内部 chat completions 请求的响应：
+// 流式响应交给 newStream 创建的转换器逐个事件写出，非流式响应与错误响应缓存在内存中，由 finish 转换后写出
+type frontendResponseWriter struct {
+	http.ResponseWriter
+	newStream func(w io.Writer) frontendStreamWriter
+	// onError 写出非 200 响应，body 为 OpenAI 错误格式（上游或代理自身返回）
+	onError func(w http.ResponseWriter, status int, body []byte)
+	// onSuccess 转换并写出非流式的 chat completion
+	onSuccess func(w http.ResponseWriter, body []byte)
+
+	status int
+	stream frontendStreamWriter
+	body   bytes.Buffer
+}
+
+func (w *frontendResponseWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	if status == http.StatusOK && strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.Header().Del("Content-Length")
+		w.ResponseWriter.WriteHeader(status)
+		w.stream = w.newStream(w.ResponseWriter)
+	}
+}
+
+func (w *frontendResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.stream != nil {
+		if err := w.stream.Write(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	return w.body.Write(p)
+}
+
+func (w *frontendResponseWriter) Flush() {
+	if w.stream == nil {
+		return
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish 在内部请求处理完成后写出转换后的响应
+func (w *frontendResponseWriter) finish() {
+	if w.stream != nil {
+		w.stream.Close()
+		return
+	}
+
+	header := w.Header()
+	header.Del("Content-Length")
+	body, err := decodeResponseBody(w.body.Bytes(), header.Get("Content-Encoding"))
+	header.Del("Content-Encoding")
+	if err != nil {
+		header.Set("Content-Type", "application/json")
+		body, _ = json.Marshal(openAIError{Error: openAIErrorDetail{
+			Message: "Failed to decode upstream response",
+			Type:    "server_error",
+		}})
+		w.onError(w.ResponseWriter, http.StatusBadGateway, body)
+		return
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.status != http.StatusOK {
+		w.onError(w.ResponseWriter, w.status, body)
+		return
+	}
+	w.onSuccess(w.ResponseWriter, body)
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingStreamWriter struct {
+	data   []byte
+	closed bool
+}
+
+func (s *recordingStreamWriter) Write(p []byte) error {
+	s.data = append(s.data, p...)
+	return nil
+}
+
+func (s *recordingStreamWriter) Close() {
+	s.closed = true
+}
+
+func newRecordingFrontendWriter(w http.ResponseWriter, stream *recordingStreamWriter) (*frontendResponseWriter, *int, *[]byte) {
+	var status int
+	var body []byte
+	fw := &frontendResponseWriter{
+		ResponseWriter: w,
+		newStream:      func(io.Writer) frontendStreamWriter { return stream },
+		onError: func(_ http.ResponseWriter, s int, b []byte) {
+			status, body = s, b
+		},
+		onSuccess: func(_ http.ResponseWriter, b []byte) {
+			status, body = http.StatusOK, b
+		},
+	}
+	return fw, &status, &body
+}
+
+func TestFrontendResponseWriter(t *testing.T) {
+	// 非流式响应缓存后交给 onSuccess
+	stream := &recordingStreamWriter{}
+	fw, status, body := newRecordingFrontendWriter(httptest.NewRecorder(), stream)
+	fw.Header().Set("Content-Type", "application/json")
+	_, _ = fw.Write([]byte(`{"ok":`))
+	_, _ = fw.Write([]byte(`true}`))
+	fw.finish()
+	require.Equal(t, http.StatusOK, *status)
+	require.Equal(t, `{"ok":true}`, string(*body))
+	require.Empty(t, stream.data)
+
+	// 错误响应交给 onError
+	fw, status, body = newRecordingFrontendWriter(httptest.NewRecorder(), stream)
+	fw.WriteHeader(http.StatusTooManyRequests)
+	_, _ = fw.Write([]byte(`{"error":{"message":"Slow down"}}`))
+	fw.finish()
+	require.Equal(t, http.StatusTooManyRequests, *status)
+	require.Equal(t, "Slow down", upstreamErrorMessage(*status, *body))
+
+	// 无法解压的响应按 502 交给 onError
+	fw, status, body = newRecordingFrontendWriter(httptest.NewRecorder(), stream)
+	fw.Header().Set("Content-Encoding", "gzip")
+	_, _ = fw.Write([]byte("not gzip"))
+	fw.finish()
+	require.Equal(t, http.StatusBadGateway, *status)
+	require.Equal(t, "Failed to decode upstream response", upstreamErrorMessage(*status, *body))
+
+	// 流式响应逐段交给转换器，finish 时关闭
+	rec := httptest.NewRecorder()
+	fw, status, _ = newRecordingFrontendWriter(rec, stream)
+	fw.Header().Set("Content-Type", "text/event-stream")
+	fw.Header().Set("Content-Length", "42")
+	_, _ = fw.Write([]byte("data: {}\n\n"))
+	fw.finish()
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("Content-Length"))
+	require.Equal(t, "data: {}\n\n", string(stream.data))
+	require.True(t, stream.closed)
+	require.Zero(t, *status)
+}
@@ -9,15 +9,17 @@ import (
 	"go-llm-server/internal/utils"
 	"go-llm-server/pkg/db"
 	"go-llm-server/pkg/logger"
+	cache "go-llm-server/pkg/redis"
+	"go-llm-server/pkg/tracing"
 	"io"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"sync"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
-	"golang.org/x/time/rate"
 )
 
 type cacheStorage interface {
@@ -27,15 +29,36 @@ type cacheStorage interface {
 	UpsertLLM(ctx context.Context, rec *db.LLMRecord) error
 }
 
-// Handler 代理处理器
+// configurableStorage 存储按配置计算缓存、Responses 与 API Key 的过期时间，热加载后需要同步新配置
+type configurableStorage interface {
+	SetConfig(cfg *config.Config)
+}
+
+// Handler 代理处理器。配置热加载时按新配置创建新的 Handler（见 withConfig），
+// 存储、负载均衡器、健康检查等与配置文件无关的组件在新旧 Handler 之间共享
 type Handler struct {
+	// 以下字段随配置重新生成
 	cfg        *config.Config
-	lbManager  *LoadBalancerManager
 	strategies []URLRouteStrategy
 	proxy      *httputil.ReverseProxy
-	storage    cacheStorage
-
-	ipLimiters sync.Map // map[string]*rate.Limiter
+	limiter    RateLimiter
+	dedup      *requestDeduper
+	models     *modelCatalog
+	router     *config.TargetRouter
+
+	lbManager   *LoadBalancerManager
+	storage     cacheStorage
+	keys        apiKeyStore
+	counters    counterStore
+	cacheAdmin  cacheAdminStore
+	responses   responseStore
+	redisClient *cache.Redis
+	health      *HealthChecker
+	metrics     *proxyMetrics
+	tracer      *tracing.Tracer
+	// dependencies 就绪检查需要探测的存储连接，存储未初始化时为空
+	dependencies map[string]dependencyPinger
+	life         *lifecycle
 }
 
 type cacheContextKey struct{}
@@ -44,60 +67,206 @@ type cacheContextKey struct{}
 func NewHandler(cfg *config.Config) *Handler {
 	manager := NewLoadBalancerManager()
 	var storageInstance cacheStorage
+	var keyStore apiKeyStore
+	var counters counterStore
+	var cacheAdmin cacheAdminStore
+	var responses responseStore
+	var redisClient *cache.Redis
+	var pgPool *pgxpool.Pool
+	dependencies := make(map[string]dependencyPinger)
 	if cfg != nil {
 		if s, err := stor.NewStorage(cfg); err != nil {
 			logger.Warn("Failed to initialize storage, cache disabled", zap.Error(err))
 		} else {
 			storageInstance = s
+			keyStore = s
+			counters = s
+			cacheAdmin = s
+			responses = s
+			redisClient = s.Cache
+			if s.DB != nil {
+				pgPool = s.DB.Pool
+				dependencies["postgres"] = s.DB
+			}
+			if s.Cache != nil {
+				dependencies["redis"] = s.Cache
+			}
+		}
+		if counters == nil && cfg.TokenLimit.Enabled() {
+			logger.Warn("Token limits configured but Redis is unavailable, token limits disabled")
+		}
+	}
+	var health *HealthChecker
+	var metricsInstance *proxyMetrics
+	if cfg != nil {
+		health = NewHealthChecker(cfg.HealthCheck)
+		manager.SetHealthChecker(health)
+		if cfg.Metrics.Enabled {
+			metricsInstance = newProxyMetrics()
+			metricsInstance.registerPoolStats(pgPool, redisClient)
+			manager.SetSelectionObserver(metricsInstance.observeSelection)
 		}
 	}
 	h := &Handler{
-		cfg:       cfg,
-		lbManager: manager,
-		strategies: []URLRouteStrategy{
-			NewModelSpecifyStrategy(manager, cfg),
-			NewDefaultStrategy(),
-		},
-		storage: storageInstance,
+		lbManager:   manager,
+		storage:     storageInstance,
+		keys:        keyStore,
+		counters:    counters,
+		cacheAdmin:  cacheAdmin,
+		responses:   responses,
+		redisClient: redisClient,
+		health:      health,
+		metrics:     metricsInstance,
+		tracer:      newTracer(cfg),
+
+		dependencies: dependencies,
+		life:         &lifecycle{},
+	}
+	h.configure(cfg, nil)
+	return h
+}
+
+// withConfig 按新配置创建 Handler，与当前 Handler 共享存储、负载均衡器等组件，
+// 存储随之切换到新配置的 TTL；当前 Handler 不受影响，进行中的请求继续使用旧配置
+func (h *Handler) withConfig(cfg *config.Config) *Handler {
+	next := *h
+	next.configure(cfg, h)
+	return &next
+}
+
+// configure 构建依赖配置的路由策略、限流器、请求合并器、模型列表与 ReverseProxy；
+// 限流配置未变化时沿用 previous 的限流器，保留各客户端的令牌桶状态；合并配置未变化时沿用进行中的请求组
+func (h *Handler) configure(cfg *config.Config, previous *Handler) {
+	h.cfg = cfg
+	if s, ok := h.storage.(configurableStorage); ok && previous != nil {
+		s.SetConfig(cfg)
+	}
+	modelStrategy := NewModelSpecifyStrategy(h.lbManager, cfg)
+	h.strategies = []URLRouteStrategy{
+		modelStrategy,
+		NewDefaultStrategy(),
+	}
+	if previous != nil && previous.cfg != nil && cfg != nil && previous.cfg.RateLimit == cfg.RateLimit {
+		h.limiter = previous.limiter
+	} else {
+		h.limiter = newRateLimiter(cfg, h.redisClient)
+	}
+	if previous != nil && previous.cfg != nil && cfg != nil && previous.cfg.Cache.Dedup == cfg.Cache.Dedup {
+		h.dedup = previous.dedup
+	} else {
+		h.dedup = newRequestDeduper(cfg, h.redisClient)
+	}
+
+	h.models = newModelCatalog(cfg)
+	h.router = nil
+	if cfg != nil {
+		router, err := config.NewTargetRouter(cfg)
+		if err != nil {
+			logger.Warn("Invalid target_map rules ignored", zap.Error(err))
+		}
+		h.router = router
+	}
+
+	transport := &TransportWithProxyAutoDetected{observers: []upstreamObserver{h.lbManager}}
+	if h.health != nil {
+		transport.observers = append(transport.observers, h.health)
+	}
+	if h.metrics != nil {
+		transport.observers = append(transport.observers, h.metrics)
 	}
 
 	// 构造单例 ReverseProxy
 	h.proxy = &httputil.ReverseProxy{
 		Director:     h.director,
 		ErrorHandler: h.errorHandler,
-		Transport:    &TransportWithProxyAutoDetected{},
+		Transport: newFallbackTransport(
+			newRetryTransport(
+				newCredentialTransport(newProviderTransport(transport, cfg), newUpstreamCredentials(cfg)),
+				h.lbManager, retryConfig(cfg)),
+			modelStrategy),
 		ModifyResponse: func(resp *http.Response) error {
 			return h.modifyResponse(resp)
 		},
 	}
+}
 
-	return h
+func retryConfig(cfg *config.Config) config.RetryConfig {
+	if cfg == nil {
+		return config.RetryConfig{}
+	}
+	return cfg.Retry
 }
 
 // InitLoadBalancers 初始化负载均衡器
 func (h *Handler) InitLoadBalancers() {
+	for key, route := range h.loadBalancerRoutes() {
+		h.addRouteLoadBalancer(key, route)
+		logger.Info("Initialized load balancer",
+			zap.String("model", key),
+			zap.String("strategy", route.Strategy),
+			zap.Strings("urls", route.URLs))
+	}
+
+	h.health.StartActiveProbe()
+}
+
+// syncLoadBalancers 按当前配置更新负载均衡器：路由未变化的保留原实例（轮询计数、
+// 连接数等状态不丢失），变化的重新创建，已删除的模型和别名一并移除；
+// 不再被负载均衡器或 target_map 使用的 URL 同时从健康检查中移除
+func (h *Handler) syncLoadBalancers() {
+	routes := h.loadBalancerRoutes()
+	for key, route := range routes {
+		if h.lbManager.HasRoute(key, route) {
+			continue
+		}
+		h.addRouteLoadBalancer(key, route)
+		logger.Info("Reloaded load balancer",
+			zap.String("model", key),
+			zap.String("strategy", route.Strategy),
+			zap.Strings("urls", route.URLs))
+	}
+	h.lbManager.RetainLoadBalancers(func(key string) bool {
+		_, ok := routes[key]
+		return ok
+	})
+
+	urls := h.lbManager.URLs()
+	for _, target := range h.cfg.TargetMap {
+		urls = append(urls, target)
+	}
+	h.health.Retain(urls...)
+}
+
+// loadBalancerRoutes 返回需要负载均衡器的模型与别名，别名使用目标模型的路由
+func (h *Handler) loadBalancerRoutes() map[string]config.ModelRoute {
+	routes := make(map[string]config.ModelRoute)
 	for model := range h.cfg.ModelRoutes {
-		if urls, exists := h.cfg.GetModelURLs(model); exists {
-			h.lbManager.AddLoadBalancer(model, urls)
-			logger.Info("Initialized load balancer for model",
-				zap.String("model", model),
-				zap.Strings("urls", urls))
+		if route, exists := h.cfg.GetModelRoute(model); exists {
+			routes[model] = route
 		}
 	}
 
 	for alias, canonical := range h.cfg.ModelAlias {
-		urls, exists := h.cfg.GetModelURLs(canonical)
+		route, exists := h.cfg.GetModelRoute(canonical)
 		if !exists {
 			logger.Warn("Alias has no target model routes configured",
 				zap.String("alias", alias),
 				zap.String("canonical", canonical))
 			continue
 		}
-		h.lbManager.AddLoadBalancer(alias, urls)
-		logger.Info("Initialized load balancer for alias",
-			zap.String("alias", alias),
-			zap.String("canonical", canonical),
-			zap.Strings("urls", urls))
+		routes[alias] = route
+	}
+	return routes
+}
+
+// addRouteLoadBalancer 按路由策略创建负载均衡器，策略无效时退回轮询
+func (h *Handler) addRouteLoadBalancer(key string, route config.ModelRoute) {
+	if err := h.lbManager.AddRouteLoadBalancer(key, route); err != nil {
+		logger.Warn("Invalid load balancing strategy, falling back to round robin",
+			zap.String("model", key),
+			zap.String("strategy", route.Strategy),
+			zap.Error(err))
+		h.lbManager.AddLoadBalancer(key, route.URLs)
 	}
 }
 
@@ -109,20 +278,6 @@ func (h *Handler) director(request *http.Request) {
 		return
 	}
 
-	// 创建一个新的 context，与客户端断开连接时不会立即取消
-	// 使用 900 秒超时，与 transport 的 ResponseHeaderTimeout 保持一致
-	// 这样可以确保代理请求不会因为客户端断开而立即取消
-	ctx := request.Context()
-	newCtx, _ := context.WithTimeout(context.Background(), 900*time.Second)
-
-	// 如果原 context 中有 LLM cache metadata，保留它
-	if meta := ctx.Value(llmCacheContextKey); meta != nil {
-		newCtx = context.WithValue(newCtx, llmCacheContextKey, meta)
-	}
-
-	// 更新请求的 context，使其不受客户端断开影响
-	*request = *request.WithContext(newCtx)
-
 	request.URL = targetURL
 	request.Host = targetURL.Host
 }
@@ -130,6 +285,7 @@ func (h *Handler) director(request *http.Request) {
 // errorHandler 处理代理错误
 func (h *Handler) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
 	requestId := utils.GetRequestID(r)
+	h.releaseTokenReservation(tokenReservationFromContext(r.Context()))
 
 	// 检查是否是上下文取消错误（使用 errors.Is 以处理可能的错误包装）
 	if errors.Is(err, context.Canceled) {
@@ -154,13 +310,28 @@ func (h *Handler) errorHandler(w http.ResponseWriter, r *http.Request, err error
 	http.Error(w, "Bad Gateway", http.StatusBadGateway)
 }
 
-// getTargetURL 按策略选取后端 URL
+// hasDotSegment 路径中是否有 . 或 .. 段
+func hasDotSegment(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// getTargetURL 按策略选取后端 URL，默认使用 ServeHTTP 中命中的 target_map 规则的目标服务
 func (h *Handler) getTargetURL(request *http.Request) (*url.URL, bool) {
 	path := request.URL.Path
 	base := h.cfg.TargetMap[path]
+	if route := upstreamRouteFromContext(request.Context()); route != nil && route.target != "" {
+		base = h.cfg.TargetMap[route.target]
+	}
 	for _, strategy := range h.strategies {
 		if strategy.ShouldApply(path) {
+			span := startRouteSpan(request)
 			target, err := strategy.GetTargetURL(request, base)
+			endRouteSpan(span, request, err)
 			if err != nil {
 				logger.Error("Strategy failed to get target URL",
 					zap.String("requestId", utils.GetRequestID(request)),
@@ -176,51 +347,75 @@ func (h *Handler) getTargetURL(request *http.Request) (*url.URL, bool) {
 	return nil, false
 }
 
-// getIPLimiter 获取或创建指定IP的限流器
-func (h *Handler) getIPLimiter(ip string) *rate.Limiter {
-	if !h.cfg.HasRateLimit() {
-		return nil
-	}
-	v, ok := h.ipLimiters.Load(ip)
-	if ok {
-		return v.(*rate.Limiter)
-	}
-	limiter := rate.NewLimiter(rate.Limit(h.cfg.RateLimit.Rate), h.cfg.RateLimit.Burst)
-	h.ipLimiters.Store(ip, limiter)
-	return limiter
-}
-
 // ServeHTTP 处理 HTTP 请求，复用已初始化的 ReverseProxy
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.serveProbe(w, r) || h.serveMetrics(w, r) || h.serveMessagesAPI(w, r) {
+		return
+	}
+
 	// 注入请求 ID
-	requestId := utils.GetOrGenerateRequestID(r)
+	utils.GetOrGenerateRequestID(r)
+
+	// 路由结果在整个请求内共享，前端接口（如 Responses API）的内部请求同样记录到这里
+	ctx, route := withUpstreamRoute(r.Context())
+	r = r.WithContext(ctx)
+	r, span := h.startRequestSpan(r)
+	if span != nil {
+		recorder := &statusRecorder{ResponseWriter: w}
+		w = recorder
+		defer func() {
+			endRequestSpan(span, route, recorder.Header(), recorder.statusCode())
+		}()
+	}
+	if h.metrics != nil {
+		startTime := time.Now()
+		model := h.metricsModelLabel(peekRequestModel(r))
+		path := h.metricsPathLabel(r.URL.Path)
+		recorder := &statusRecorder{ResponseWriter: w}
+		w = recorder
+		defer func() {
+			h.metrics.observeRequest(path, model, route.baseURL, recorder.statusCode(), time.Since(startTime))
+			h.metrics.observeCache(recorder.Header())
+		}()
+	}
 
-	clientIP := utils.GetClientIP(r)
-	limiter := h.getIPLimiter(clientIP)
-	if limiter != nil && !limiter.Allow() {
-		logger.Warn("Rate limit exceeded", zap.String("clientIp", clientIP), zap.String("requestId", requestId))
-		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	if !h.allowRequest(w, r) {
 		return
 	}
 
-	logFields := []zap.Field{
-		zap.String("requestId", requestId),
-		zap.String("clientIp", clientIP),
+	logger.Info("Request received", requestLogFields(r)...)
+
+	if h.serveAdmin(w, r) || h.serveModelsAPI(w, r) || h.serveResponsesAPI(w, r) {
+		return
+	}
+	h.forward(w, r)
+}
+
+// requestLogFields 请求日志的公共字段
+func requestLogFields(r *http.Request) []zap.Field {
+	return []zap.Field{
+		zap.String("requestId", utils.GetRequestID(r)),
+		zap.String("clientIp", utils.GetClientIP(r)),
 		zap.String("path", r.URL.Path),
 		zap.String("method", r.Method),
 		zap.String("targetUrl", r.URL.String()),
 		zap.Int("Content-length", int(r.ContentLength)),
 	}
+}
 
+// forward 按 target_map 鉴权、查询缓存、token 限流后转发到上游。
+// 限流、指标与追踪由 ServeHTTP 负责，前端接口的内部请求直接调用 forward，不会重复计数
+func (h *Handler) forward(w http.ResponseWriter, r *http.Request) {
+	requestId := utils.GetRequestID(r)
+	logFields := requestLogFields(r)
 	var requestBodyBuf bytes.Buffer
 	if h.cfg.LogBody && r.Body != nil {
 		r.Body = newTeeReadCloser(r.Body, &requestBodyBuf)
 	}
 
-	logger.Info("Request received", logFields...)
-
-	// 校验路径
-	if _, ok := h.cfg.TargetMap[r.URL.Path]; !ok {
+	// 校验路径。含 . 或 .. 段的路径在拼接上游地址时会被折叠，可能越过前缀规则与 allowed_paths 的限制，直接拒绝
+	target, ok := h.router.Match(r.URL.Path)
+	if !ok || hasDotSegment(r.URL.Path) {
 		logger.Warn("Path not found, returning 404",
 			zap.String("requestId", requestId),
 			zap.String("path", r.URL.Path),
@@ -230,12 +425,31 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	r, ok = h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	// 鉴权按客户端请求的路径判断，之后的缓存、模型路由与转发都使用改写后的路径
+	if target.Path != r.URL.Path {
+		logger.Info("Rewriting request path",
+			zap.String("requestId", requestId),
+			zap.String("path", r.URL.Path),
+			zap.String("rewritten", target.Path))
+		r = r.Clone(r.Context())
+		r.URL.Path, r.URL.RawPath = target.Path, ""
+	}
+
+	// 合并相同请求时，领头请求在 forward 返回（响应已写入缓存）后唤醒等待的请求
 	if h.shouldUseEmbeddingCache(r) {
 		handled, meta := h.handleEmbeddingCachePreProxy(w, r)
 		if handled {
 			return
 		}
 		if meta != nil {
+			if meta.release != nil {
+				defer meta.release()
+			}
 			r = r.WithContext(context.WithValue(r.Context(), embeddingCacheContextKey, meta))
 		}
 	}
@@ -246,14 +460,37 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		if meta != nil {
+			if meta.release != nil {
+				defer meta.release()
+			}
 			r = r.WithContext(context.WithValue(r.Context(), llmCacheContextKey, meta))
 		}
 	}
 
+	// 缓存命中的请求不消耗上游 token，因此在缓存检查之后再做 token 限流
+	r, ok = h.checkTokenLimit(w, r)
+	if !ok {
+		return
+	}
+	r = h.requestStreamUsage(r)
+
 	var responseBodyBuf bytes.Buffer
 	multiWriter := io.MultiWriter(w, &responseBodyBuf)
 	w = &teeResponseWriter{ResponseWriter: w, writer: multiWriter}
 
+	// 创建一个新的 context，与客户端断开连接时不会立即取消（保留已注入的 cache metadata）
+	// 使用 900 秒超时，与 transport 的 ResponseHeaderTimeout 保持一致
+	// 这样可以确保代理请求不会因为客户端断开而立即取消，流式响应也能完整写入缓存
+	proxyCtx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 900*time.Second)
+	defer cancel()
+	route := upstreamRouteFromContext(proxyCtx)
+	if route == nil {
+		proxyCtx, route = withUpstreamRoute(proxyCtx)
+	}
+	route.path = r.URL.Path
+	route.target = target.Key
+	r = r.WithContext(proxyCtx)
+
 	// 交给同一个 ReverseProxy 实例处理
 	h.proxy.ServeHTTP(w, r)
 
@@ -268,11 +505,21 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) modifyResponse(resp *http.Response) error {
+	// 缓存与用量统计读取完整的流，返回给客户端前再去掉代为请求的用量分片
+	defer stripStreamUsage(resp)
+	h.recordUsage(resp)
 	if h.storage == nil || resp == nil || resp.Request == nil {
 		return nil
 	}
+	// 备用模型的结果不写入原模型的缓存
+	if upstreamRouteFromContext(resp.Request.Context()).servedByFallback() {
+		return nil
+	}
 
-	if meta, _ := resp.Request.Context().Value(llmCacheContextKey).(*llmCacheMetadata); meta != nil && !meta.stream {
+	if meta, _ := resp.Request.Context().Value(llmCacheContextKey).(*llmCacheMetadata); meta != nil {
+		if meta.stream {
+			return h.handleLLMStreamCachePostResponse(resp, meta)
+		}
 		return h.handleLLMCachePostResponse(resp, meta)
 	}
 
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newUpstreamTestHandler 启动 upstream 作为上游，用 newConfig 生成指向它的配置后创建 Handler
+func newUpstreamTestHandler(t *testing.T, upstream http.HandlerFunc, newConfig func(upstreamURL string) *config.Config) *Handler {
+	t.Helper()
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+	handler := NewHandler(newConfig(server.URL))
+	handler.InitLoadBalancers()
+	t.Cleanup(handler.health.Stop)
+	return handler
+}
+
+// sendAPIRequest 以 JSON 请求体发送请求，key 非空时作为 Bearer 令牌
+func sendAPIRequest(handler http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	handler.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestServeHTTP_PrefixAndRegexTargets(t *testing.T) {
+	type received struct{ path, auth string }
+	var mu sync.Mutex
+	var got []received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, received{path: r.URL.Path, auth: r.Header.Get("Authorization")})
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+
+	handler := NewHandler(&config.Config{
+		TargetMap: map[string]string{
+			"/chat/completions":                      server.URL,
+			"/openai/*":                              server.URL + "/v1",
+			"~^/deployments/[^/]+/chat/completions$": server.URL + "/azure",
+		},
+		TargetAuth:    map[string]config.UpstreamCredentials{"/openai/*": {APIKeys: []string{"sk-prefix"}}},
+		TargetRewrite: map[string]config.PathRewrite{"/openai/*": {StripPrefix: "/openai"}},
+	})
+	t.Cleanup(handler.health.Stop)
+
+	send := func(path string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"model":"gpt-4o"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	require.Equal(t, http.StatusOK, send("/chat/completions"))
+	// 前缀规则去掉 /openai 后拼接到目标 URL，并使用该规则配置的上游 key
+	require.Equal(t, http.StatusOK, send("/openai/chat/completions"))
+	require.Equal(t, http.StatusOK, send("/deployments/gpt-4o/chat/completions"))
+	require.Equal(t, http.StatusNotFound, send("/deployments/gpt-4o/embeddings"))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []received{
+		{path: "/chat/completions"},
+		{path: "/v1/chat/completions", auth: "Bearer sk-prefix"},
+		{path: "/azure/deployments/gpt-4o/chat/completions"},
+	}, got)
+
+	require.Equal(t, "/openai/*", handler.metricsPathLabel("/openai/embeddings"))
+	require.Equal(t, "other", handler.metricsPathLabel("/v2/chat/completions"))
+}
+
+func TestServeHTTP_RejectsDotSegments(t *testing.T) {
+	var paths []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	handler := NewHandler(&config.Config{
+		TargetMap: map[string]string{"/v1/*": server.URL},
+		Auth:      config.AuthConfig{Enabled: true},
+	})
+	t.Cleanup(handler.health.Stop)
+	handler.keys = newFakeAPIKeyStore(map[string]*db.APIKeyRecord{
+		"sk-chat": {ID: 1, Name: "chat", Enabled: true, AllowedPaths: []string{"/v1/chat/*"}},
+	})
+
+	for _, path := range []string{
+		"/v1/chat/../../files",
+		"/v1/chat/../embeddings",
+		"/v1/chat/./../embeddings",
+		"/v1/chat/%2e%2e/embeddings",
+	} {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, newAuthTestRequest(path, "sk-chat", `{}`))
+		require.Equal(t, http.StatusNotFound, resp.Code, path)
+	}
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, newAuthTestRequest("/v1/chat/completions", "sk-chat", `{}`))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []string{"/v1/chat/completions"}, paths)
+}
@@ -0,0 +1,304 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultHealthMaxFailures = 3
+	defaultHealthCooldown    = 30 * time.Second
+	defaultProbePath         = "/models"
+	defaultProbeTimeout      = 5 * time.Second
+)
+
+// upstreamHealth 单个后端 URL 的健康状态
+type upstreamHealth struct {
+	failures    int
+	ejected     bool
+	ejectedAt   time.Time
+	lastError   string
+	lastStatus  int
+	lastChecked time.Time
+}
+
+// UpstreamStatus 对外展示的后端健康状态
+type UpstreamStatus struct {
+	URL                 string     `json:"url"`
+	Healthy             bool       `json:"healthy"`
+	Ejected             bool       `json:"ejected"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	EjectedAt           *time.Time `json:"ejected_at,omitempty"`
+	LastStatus          int        `json:"last_status,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastChecked         *time.Time `json:"last_checked,omitempty"`
+}
+
+// HealthChecker 被动异常检测 + 可选主动探测。
+// 连续 maxFailures 次传输错误或 5xx 后摘除 URL，冷却期后允许请求再次试探，成功即恢复。
+type HealthChecker struct {
+	maxFailures int
+	cooldown    time.Duration
+
+	probeInterval time.Duration
+	probePath     string
+	probeClient   *http.Client
+
+	mu     sync.RWMutex
+	states map[string]*upstreamHealth
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	now      func() time.Time
+}
+
+// NewHealthChecker 根据配置创建健康检查器
+func NewHealthChecker(cfg config.HealthCheckConfig) *HealthChecker {
+	maxFailures := cfg.MaxFailures
+	if maxFailures == 0 {
+		maxFailures = defaultHealthMaxFailures
+	}
+	cooldown := time.Duration(cfg.Cooldown) * time.Second
+	if cooldown <= 0 {
+		cooldown = defaultHealthCooldown
+	}
+	probePath := cfg.Active.Path
+	if probePath == "" {
+		probePath = defaultProbePath
+	}
+	probeTimeout := time.Duration(cfg.Active.Timeout) * time.Second
+	if probeTimeout <= 0 {
+		probeTimeout = defaultProbeTimeout
+	}
+
+	return &HealthChecker{
+		maxFailures:   maxFailures,
+		cooldown:      cooldown,
+		probeInterval: time.Duration(cfg.Active.Interval) * time.Second,
+		probePath:     probePath,
+		probeClient: &http.Client{
+			Transport: &TransportWithProxyAutoDetected{},
+			Timeout:   probeTimeout,
+		},
+		states: make(map[string]*upstreamHealth),
+		stop:   make(chan struct{}),
+		now:    time.Now,
+	}
+}
+
+// Register 登记需要跟踪的后端 URL
+func (hc *HealthChecker) Register(urls ...string) {
+	if hc == nil {
+		return
+	}
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	for _, u := range urls {
+		if _, ok := hc.states[u]; !ok {
+			hc.states[u] = &upstreamHealth{}
+		}
+	}
+}
+
+// Retain 只保留 urls 中的后端状态，配置热加载后移除不再使用的 URL，主动探测与管理接口不再包含它们
+func (hc *HealthChecker) Retain(urls ...string) {
+	if hc == nil {
+		return
+	}
+	keep := make(map[string]struct{}, len(urls))
+	for _, u := range urls {
+		keep[u] = struct{}{}
+	}
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	for u := range hc.states {
+		if _, ok := keep[u]; !ok {
+			delete(hc.states, u)
+		}
+	}
+}
+
+// IsHealthy 判断 URL 是否可用；摘除的 URL 在冷却期结束后重新允许请求试探
+func (hc *HealthChecker) IsHealthy(url string) bool {
+	if hc == nil {
+		return true
+	}
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	state, ok := hc.states[url]
+	if !ok || !state.ejected {
+		return true
+	}
+	return hc.now().Sub(state.ejectedAt) >= hc.cooldown
+}
+
+// ObserveUpstream 被动检测：记录一次上游请求的结果
+func (hc *HealthChecker) ObserveUpstream(target string, statusCode int, err error, _ time.Duration) {
+	if hc == nil || target == "" || hc.maxFailures < 0 {
+		return
+	}
+	hc.record(target, statusCode, err, "passive")
+}
+
+func (hc *HealthChecker) record(target string, statusCode int, err error, source string) {
+	failed := err != nil || statusCode >= http.StatusInternalServerError
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	state, ok := hc.states[target]
+	if !ok {
+		state = &upstreamHealth{}
+		hc.states[target] = state
+	}
+	state.lastChecked = hc.now()
+	state.lastStatus = statusCode
+
+	if !failed {
+		state.failures = 0
+		state.lastError = ""
+		if state.ejected {
+			state.ejected = false
+			logger.Info("Upstream re-admitted",
+				zap.String("url", target),
+				zap.String("source", source))
+		}
+		return
+	}
+
+	state.failures++
+	if err != nil {
+		state.lastError = err.Error()
+	} else {
+		state.lastError = http.StatusText(statusCode)
+	}
+	maxFailures := hc.maxFailures
+	if maxFailures < 0 {
+		maxFailures = defaultHealthMaxFailures
+	}
+	if state.failures >= maxFailures {
+		if !state.ejected {
+			logger.Warn("Upstream ejected",
+				zap.String("url", target),
+				zap.String("source", source),
+				zap.Int("consecutiveFailures", state.failures),
+				zap.String("lastError", state.lastError),
+				zap.Duration("cooldown", hc.cooldown))
+		}
+		// 冷却期内的试探请求失败时重新计时
+		state.ejected = true
+		state.ejectedAt = hc.now()
+	}
+}
+
+// Snapshot 返回所有已跟踪 URL 的健康状态，按 URL 排序
+func (hc *HealthChecker) Snapshot() []UpstreamStatus {
+	if hc == nil {
+		return nil
+	}
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	now := hc.now()
+	result := make([]UpstreamStatus, 0, len(hc.states))
+	for u, state := range hc.states {
+		status := UpstreamStatus{
+			URL:                 u,
+			Healthy:             !state.ejected || now.Sub(state.ejectedAt) >= hc.cooldown,
+			Ejected:             state.ejected,
+			ConsecutiveFailures: state.failures,
+			LastStatus:          state.lastStatus,
+			LastError:           state.lastError,
+		}
+		if state.ejected {
+			ejectedAt := state.ejectedAt
+			status.EjectedAt = &ejectedAt
+		}
+		if !state.lastChecked.IsZero() {
+			lastChecked := state.lastChecked
+			status.LastChecked = &lastChecked
+		}
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].URL < result[j].URL })
+	return result
+}
+
+// StartActiveProbe 按配置的间隔主动探测所有已登记的 URL，未配置间隔时不启动
+func (hc *HealthChecker) StartActiveProbe() {
+	if hc == nil || hc.probeInterval <= 0 {
+		return
+	}
+	logger.Info("Active upstream health probe started",
+		zap.Duration("interval", hc.probeInterval),
+		zap.String("path", hc.probePath))
+
+	go func() {
+		ticker := time.NewTicker(hc.probeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hc.stop:
+				return
+			case <-ticker.C:
+				hc.probeAll()
+			}
+		}
+	}()
+}
+
+// Stop 停止主动探测
+func (hc *HealthChecker) Stop() {
+	if hc == nil {
+		return
+	}
+	hc.stopOnce.Do(func() { close(hc.stop) })
+}
+
+func (hc *HealthChecker) probeAll() {
+	hc.mu.RLock()
+	urls := make([]string, 0, len(hc.states))
+	for u := range hc.states {
+		urls = append(urls, u)
+	}
+	hc.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, u := range urls {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			statusCode, err := hc.probe(target)
+			hc.record(target, statusCode, err, "active")
+		}(u)
+	}
+	wg.Wait()
+}
+
+func (hc *HealthChecker) probe(target string) (int, error) {
+	probeURL, err := utils.GetTargetURLWithCache(strings.TrimRight(target, "/"), hc.probePath)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, probeURL.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("X-Request-ID", "health-probe")
+	resp, err := hc.probeClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode, nil
+}
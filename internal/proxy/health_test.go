@@ -0,0 +1,200 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-llm-server/internal/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHealthChecker(maxFailures, cooldownSeconds int) (*HealthChecker, *time.Time) {
+	now := time.Now()
+	hc := NewHealthChecker(config.HealthCheckConfig{MaxFailures: maxFailures, Cooldown: cooldownSeconds})
+	hc.now = func() time.Time { return now }
+	return hc, &now
+}
+
+func TestHealthChecker_PassiveEjectAndReadmit(t *testing.T) {
+	hc, now := newTestHealthChecker(2, 30)
+	target := "https://api1.example.com"
+	hc.Register(target)
+
+	hc.ObserveUpstream(target, http.StatusBadGateway, nil, time.Millisecond)
+	require.True(t, hc.IsHealthy(target))
+	hc.ObserveUpstream(target, 0, errors.New("connection refused"), time.Millisecond)
+	require.False(t, hc.IsHealthy(target))
+
+	status := hc.Snapshot()
+	require.Len(t, status, 1)
+	require.True(t, status[0].Ejected)
+	require.False(t, status[0].Healthy)
+	require.Equal(t, 2, status[0].ConsecutiveFailures)
+	require.Equal(t, "connection refused", status[0].LastError)
+
+	// 冷却期后允许试探，试探成功即恢复
+	*now = now.Add(31 * time.Second)
+	require.True(t, hc.IsHealthy(target))
+	hc.ObserveUpstream(target, http.StatusOK, nil, time.Millisecond)
+	require.True(t, hc.IsHealthy(target))
+	require.False(t, hc.Snapshot()[0].Ejected)
+	require.Equal(t, 0, hc.Snapshot()[0].ConsecutiveFailures)
+}
+
+func TestHealthChecker_FailedTrialRestartsCooldown(t *testing.T) {
+	hc, now := newTestHealthChecker(1, 10)
+	target := "https://api1.example.com"
+
+	hc.ObserveUpstream(target, http.StatusServiceUnavailable, nil, 0)
+	require.False(t, hc.IsHealthy(target))
+
+	*now = now.Add(11 * time.Second)
+	require.True(t, hc.IsHealthy(target))
+	hc.ObserveUpstream(target, http.StatusServiceUnavailable, nil, 0)
+	require.False(t, hc.IsHealthy(target))
+}
+
+func TestHealthChecker_NonServerErrorsResetFailures(t *testing.T) {
+	hc, _ := newTestHealthChecker(2, 30)
+	target := "https://api1.example.com"
+
+	hc.ObserveUpstream(target, http.StatusInternalServerError, nil, 0)
+	hc.ObserveUpstream(target, http.StatusTooManyRequests, nil, 0)
+	hc.ObserveUpstream(target, http.StatusInternalServerError, nil, 0)
+	require.True(t, hc.IsHealthy(target))
+}
+
+func TestHealthChecker_PassiveDisabled(t *testing.T) {
+	hc, _ := newTestHealthChecker(-1, 30)
+	target := "https://api1.example.com"
+	for i := 0; i < 10; i++ {
+		hc.ObserveUpstream(target, http.StatusBadGateway, nil, 0)
+	}
+	require.True(t, hc.IsHealthy(target))
+}
+
+func TestHealthChecker_NilSafe(t *testing.T) {
+	var hc *HealthChecker
+	require.True(t, hc.IsHealthy("https://api1.example.com"))
+	hc.ObserveUpstream("https://api1.example.com", http.StatusBadGateway, nil, 0)
+	hc.Register("https://api1.example.com")
+	hc.Retain("https://api1.example.com")
+	require.Nil(t, hc.Snapshot())
+	hc.StartActiveProbe()
+	hc.Stop()
+}
+
+func TestHealthChecker_Retain(t *testing.T) {
+	hc, _ := newTestHealthChecker(1, 30)
+	hc.Register("https://api1.example.com", "https://api2.example.com")
+	hc.ObserveUpstream("https://api2.example.com", http.StatusBadGateway, nil, time.Millisecond)
+
+	hc.Retain("https://api1.example.com")
+	status := hc.Snapshot()
+	require.Len(t, status, 1)
+	require.Equal(t, "https://api1.example.com", status[0].URL)
+	require.True(t, hc.IsHealthy("https://api2.example.com"))
+}
+
+func TestHealthChecker_ActiveProbe(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/models", r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	hc := NewHealthChecker(config.HealthCheckConfig{
+		MaxFailures: 1,
+		Active:      config.ActiveCheckConfig{Interval: 1, Path: "/models"},
+	})
+	hc.Register(healthy.URL+"/v1", broken.URL+"/v1")
+	hc.probeAll()
+
+	require.True(t, hc.IsHealthy(healthy.URL+"/v1"))
+	require.False(t, hc.IsHealthy(broken.URL+"/v1"))
+}
+
+func TestLoadBalancerManager_SkipsEjectedURLs(t *testing.T) {
+	hc, _ := newTestHealthChecker(1, 30)
+	lbm := NewLoadBalancerManager()
+	lbm.SetHealthChecker(hc)
+	lbm.AddLoadBalancer("test-model", []string{
+		"https://api1.example.com",
+		"https://api2.example.com",
+		"https://api3.example.com",
+	})
+
+	hc.ObserveUpstream("https://api2.example.com", http.StatusBadGateway, nil, 0)
+	for i := 0; i < 6; i++ {
+		url, ok := lbm.GetNextURL("test-model")
+		require.True(t, ok)
+		require.NotEqual(t, "https://api2.example.com", url)
+	}
+
+	// 全部摘除时回退到轮询结果，避免请求无处可去
+	hc.ObserveUpstream("https://api1.example.com", http.StatusBadGateway, nil, 0)
+	hc.ObserveUpstream("https://api3.example.com", http.StatusBadGateway, nil, 0)
+	url, ok := lbm.GetNextURL("test-model")
+	require.True(t, ok)
+	require.NotEmpty(t, url)
+}
+
+func TestTransport_ReportsToObservers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	hc, _ := newTestHealthChecker(1, 30)
+	transport := &TransportWithProxyAutoDetected{observers: []upstreamObserver{hc}}
+
+	ctx, route := withUpstreamRoute(context.Background())
+	route.baseURL = server.URL
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/chat/completions", nil)
+	require.NoError(t, err)
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	require.False(t, hc.IsHealthy(server.URL))
+}
+
+func TestServeAdmin_Upstreams(t *testing.T) {
+	hc, _ := newTestHealthChecker(1, 30)
+	hc.Register("https://api1.example.com")
+	handler := &Handler{
+		cfg:    &config.Config{Admin: config.AdminConfig{Token: "secret"}},
+		health: hc,
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/upstreams", nil)
+	resp := httptest.NewRecorder()
+	require.True(t, handler.serveAdmin(resp, req))
+	require.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/upstreams", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp = httptest.NewRecorder()
+	require.True(t, handler.serveAdmin(resp, req))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	var payload struct {
+		Upstreams []UpstreamStatus `json:"upstreams"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &payload))
+	require.Len(t, payload.Upstreams, 1)
+	require.True(t, payload.Upstreams[0].Healthy)
+
+	req = httptest.NewRequest(http.MethodGet, "/chat/completions", nil)
+	require.False(t, handler.serveAdmin(httptest.NewRecorder(), req))
+}
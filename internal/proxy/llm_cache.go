@@ -3,6 +3,7 @@ package proxy
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -31,6 +32,8 @@ type llmCacheMetadata struct {
 	stream      bool
 	startTime   time.Time
 	requestID   string
+	semantic    *semanticLookup // 开启语义缓存时随响应写入分组键与向量
+	release     func()          // 合并相同请求时由领头请求在写入缓存后调用
 }
 
 func (h *Handler) shouldUseLLMCache(r *http.Request) bool {
@@ -80,14 +83,16 @@ func (h *Handler) handleLLMCachePreProxy(w http.ResponseWriter, r *http.Request)
 			return false, nil
 		}
 	}
-	if streamBool {
-		return false, nil
+	includeUsage := false
+	if opts, ok := payload["stream_options"].(map[string]interface{}); ok {
+		includeUsage, _ = opts["include_usage"].(bool)
 	}
 
 	model, _ := payload["model"].(string)
 	if model == "" {
 		return false, nil
 	}
+	model = h.cfg.ResolveModel(model)
 
 	var temperature *float32
 	if v, ok := payload["temperature"]; ok {
@@ -116,7 +121,13 @@ func (h *Handler) handleLLMCachePreProxy(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	request := string(bodyBytes)
+	request, err := h.makeLLMCacheRequest(bodyBytes, model)
+	if err != nil {
+		logger.Warn("Failed to canonicalize request for LLM cache lookup",
+			zap.String("requestId", utils.GetRequestID(r)),
+			zap.Error(err))
+		return false, nil
+	}
 	rec, err := h.storage.GetLLM(r.Context(), request, model)
 	if err != nil {
 		logger.Warn("LLM cache lookup failed",
@@ -124,13 +135,40 @@ func (h *Handler) handleLLMCachePreProxy(w http.ResponseWriter, r *http.Request)
 			zap.String("model", model),
 			zap.Error(err))
 	} else if rec != nil && len(rec.Response) > 0 {
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("X-LLM-Cache", "HIT")
-		_, _ = w.Write(rec.Response)
-		logger.Info("Served response from LLM cache",
-			zap.String("requestId", utils.GetRequestID(r)),
-			zap.String("model", model))
-		return true, nil
+		if h.serveLLMCacheHit(w, r, rec, model, streamBool, includeUsage, "HIT") {
+			return true, nil
+		}
+	}
+
+	// 精确匹配未命中时再按语义相似度查找
+	var semantic *semanticLookup
+	if err == nil {
+		semantic = h.prepareSemanticLookup(r, payload, request, model)
+	}
+	if semantic != nil {
+		if rec, similarity := h.findSemanticMatch(r, model, semantic); rec != nil {
+			w.Header().Set(llmCacheSimilarityHeader, formatSimilarity(similarity))
+			if h.serveLLMCacheHit(w, r, rec, model, streamBool, includeUsage, semanticCacheHit) {
+				return true, nil
+			}
+			w.Header().Del(llmCacheSimilarityHeader)
+		}
+	}
+
+	// 非流式请求合并：相同请求正在访问上游时等待其写入缓存；流式请求需要尽快返回首个分片，不参与合并
+	var release func()
+	if !streamBool && err == nil {
+		var waited bool
+		release, waited = h.dedup.acquire(r.Context(), "llm:"+utils.MakeHash(request))
+		if waited {
+			if rec, err := h.storage.GetLLM(r.Context(), request, model); err == nil && rec != nil && len(rec.Response) > 0 {
+				if release != nil {
+					release()
+				}
+				markCoalesced(w)
+				return h.serveLLMCacheHit(w, r, rec, model, false, false, "HIT"), nil
+			}
+		}
 	}
 
 	return false, &llmCacheMetadata{
@@ -138,12 +176,53 @@ func (h *Handler) handleLLMCachePreProxy(w http.ResponseWriter, r *http.Request)
 		model:       model,
 		temperature: temperature,
 		maxTokens:   maxTokens,
-		stream:      false,
+		stream:      streamBool,
 		startTime:   time.Now(),
 		requestID:   utils.GetRequestID(r),
+		semantic:    semantic,
+		release:     release,
 	}
 }
 
+// serveLLMCacheHit 返回缓存的响应，流式请求按 SSE 回放；status 为 X-LLM-Cache 的取值。
+// 缓存内容无法回放为流时返回 false，请求继续转发到上游
+func (h *Handler) serveLLMCacheHit(w http.ResponseWriter, r *http.Request, rec *db.LLMRecord, model string, stream, includeUsage bool, status string) bool {
+	if stream {
+		if err := writeLLMCacheStream(w, rec.Response, includeUsage, status); err != nil {
+			logger.Warn("Failed to replay cached LLM response as stream",
+				zap.String("requestId", utils.GetRequestID(r)),
+				zap.String("model", model),
+				zap.Error(err))
+			return false
+		}
+		logger.Info("Served stream response from LLM cache",
+			zap.String("requestId", utils.GetRequestID(r)),
+			zap.String("model", model),
+			zap.String("cache", status))
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-LLM-Cache", status)
+	_, _ = w.Write(rec.Response)
+	logger.Info("Served response from LLM cache",
+		zap.String("requestId", utils.GetRequestID(r)),
+		zap.String("model", model),
+		zap.String("cache", status))
+	return true
+}
+
+// llmCacheTransportFields 只影响传输方式的字段，始终不参与缓存键计算，使流式与非流式请求共享同一条缓存
+var llmCacheTransportFields = []string{"stream", "stream_options"}
+
+// makeLLMCacheRequest 生成用于缓存查找与存储的规范化请求文本：解析别名、剔除非语义字段并按键排序
+func (h *Handler) makeLLMCacheRequest(bodyBytes []byte, model string) (string, error) {
+	ignoreFields, keyFields := h.cfg.LLMCacheKeyFields(model)
+	ignored := make([]string, 0, len(ignoreFields)+len(llmCacheTransportFields))
+	ignored = append(ignored, ignoreFields...)
+	ignored = append(ignored, llmCacheTransportFields...)
+	return utils.CanonicalizeLLMRequest(bodyBytes, model, ignored, keyFields)
+}
+
 func (h *Handler) handleLLMCachePostResponse(resp *http.Response, meta *llmCacheMetadata) error {
 	if resp.StatusCode != http.StatusOK || resp.Body == nil {
 		return nil
@@ -196,6 +275,17 @@ func (h *Handler) handleLLMCachePostResponse(resp *http.Response, meta *llmCache
 		return nil
 	}
 
+	h.storeLLMCacheRecord(resp.Request.Context(), meta, bodyToStore)
+	return nil
+}
+
+// storeLLMCacheRecord 解析 usage 并将完整的 chat completion 响应写入 LLM 缓存
+func (h *Handler) storeLLMCacheRecord(ctx context.Context, meta *llmCacheMetadata, bodyToStore []byte) {
+	if !h.life.beginWrite() {
+		return
+	}
+	defer h.life.endWrite()
+
 	var totalTokensPtr, promptTokensPtr, completionTokensPtr *int
 	var responsePayload struct {
 		Usage *struct {
@@ -253,18 +343,20 @@ func (h *Handler) handleLLMCachePostResponse(resp *http.Response, meta *llmCache
 		StartTime:        &startTime,
 		EndTime:          &endTime,
 	}
+	if meta.semantic != nil {
+		llmRecord.SemanticKey = meta.semantic.key
+		llmRecord.PromptEmbedding = meta.semantic.embedding
+	}
 
-	if err := h.storage.UpsertLLM(resp.Request.Context(), llmRecord); err != nil {
+	if err := h.storage.UpsertLLM(ctx, llmRecord); err != nil {
 		logger.Warn("Failed to store response in LLM cache",
 			zap.String("model", meta.model),
 			zap.Error(err))
 	} else {
-		resp.Header.Set("X-LLM-Cache", "MISS")
 		logger.Info("Stored response in LLM cache",
-			zap.String("model", meta.model))
+			zap.String("model", meta.model),
+			zap.Bool("stream", meta.stream))
 	}
-
-	return nil
 }
 
 // ensureJSONFormat 确保输入是有效的 JSON 格式，如果不是则尝试解析或包装
@@ -135,7 +135,7 @@ func TestHandleLLMCachePreProxy_Miss(t *testing.T) {
 	handled, meta := handler.handleLLMCachePreProxy(resp, req)
 	require.False(t, handled)
 	require.NotNil(t, meta)
-	require.Equal(t, body, lookedUpRequest)
+	require.JSONEq(t, `{"model":"gpt-4","temperature":0.7,"max_tokens":256}`, lookedUpRequest)
 	require.Equal(t, "gpt-4", meta.model)
 	require.NotNil(t, meta.temperature)
 	require.InDelta(t, 0.7, *meta.temperature, 0.001)
@@ -210,7 +210,9 @@ func TestHandleLLMCachePreProxy_StreamTrue(t *testing.T) {
 
 	handled, meta := handler.handleLLMCachePreProxy(resp, req)
 	require.False(t, handled)
-	require.Nil(t, meta)
+	require.NotNil(t, meta)
+	require.True(t, meta.stream)
+	require.JSONEq(t, `{"model":"gpt-4"}`, meta.prompt)
 }
 
 func TestHandleLLMCachePreProxy_EmptyBodyAndMissingModel(t *testing.T) {
@@ -420,3 +422,35 @@ func TestEnsureJSONFormat(t *testing.T) {
 	require.NoError(t, json.Unmarshal(raw, &val))
 	require.Equal(t, "plain-text", val)
 }
+
+func TestHandleLLMCachePreProxy_CanonicalKey(t *testing.T) {
+	var keys []string
+	handler := newLLMTestHandler(&fakeLLMCacheStorage{
+		getLLMFn: func(ctx context.Context, request, modelName string) (*db.LLMRecord, error) {
+			require.Equal(t, "gpt-4", modelName)
+			keys = append(keys, request)
+			return nil, nil
+		},
+	})
+	handler.cfg.ModelAlias = map[string]string{"my-gpt": "gpt-4"}
+	handler.cfg.Cache = config.CacheConfig{
+		Models: map[string]config.CacheModelConfig{
+			"gpt-4": {IgnoreFields: []string{"user", "seed"}},
+		},
+	}
+
+	for _, body := range []string{
+		`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"temperature":0.2}`,
+		`{ "temperature": 0.2, "messages": [{"content": "hi", "role": "user"}], "model": "my-gpt", "user": "u-1" }`,
+		`{"model":"gpt-4","seed":42,"messages":[{"role":"user","content":"hi"}],"temperature":0.2,"stream":true}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader(body))
+		handled, meta := handler.handleLLMCachePreProxy(httptest.NewRecorder(), req)
+		require.False(t, handled)
+		require.NotNil(t, meta)
+		require.Equal(t, "gpt-4", meta.model)
+		require.Equal(t, keys[0], meta.prompt)
+	}
+	require.Len(t, keys, 3)
+	require.Equal(t, `{"messages":[{"content":"hi","role":"user"}],"model":"gpt-4","temperature":0.2}`, keys[0])
+}
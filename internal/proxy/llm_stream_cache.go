@@ -0,0 +1,416 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// llmStreamChunk chat.completion.chunk 事件结构，仅包含组装缓存所需字段
+type llmStreamChunk struct {
+	ID                string                 `json:"id"`
+	Object            string                 `json:"object"`
+	Created           int64                  `json:"created"`
+	Model             string                 `json:"model"`
+	SystemFingerprint string                 `json:"system_fingerprint,omitempty"`
+	Choices           []llmStreamChunkChoice `json:"choices"`
+	Usage             json.RawMessage        `json:"usage,omitempty"`
+}
+
+type llmStreamChunkChoice struct {
+	Index        int            `json:"index"`
+	Delta        llmStreamDelta `json:"delta"`
+	FinishReason *string        `json:"finish_reason"`
+}
+
+type llmStreamDelta struct {
+	Role             string              `json:"role,omitempty"`
+	Content          *string             `json:"content,omitempty"`
+	ReasoningContent *string             `json:"reasoning_content,omitempty"`
+	ToolCalls        []llmStreamToolCall `json:"tool_calls,omitempty"`
+}
+
+type llmStreamToolCall struct {
+	Index    int                   `json:"index"`
+	ID       string                `json:"id,omitempty"`
+	Type     string                `json:"type,omitempty"`
+	Function llmStreamToolFunction `json:"function"`
+}
+
+type llmStreamToolFunction struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// llmCompletion 缓存中保存的 chat.completion 结构
+type llmCompletion struct {
+	ID                string                `json:"id"`
+	Object            string                `json:"object"`
+	Created           int64                 `json:"created"`
+	Model             string                `json:"model"`
+	SystemFingerprint string                `json:"system_fingerprint,omitempty"`
+	Choices           []llmCompletionChoice `json:"choices"`
+	Usage             json.RawMessage       `json:"usage,omitempty"`
+}
+
+type llmCompletionChoice struct {
+	Index        int                  `json:"index"`
+	Message      llmCompletionMessage `json:"message"`
+	FinishReason *string              `json:"finish_reason"`
+}
+
+type llmCompletionMessage struct {
+	Role             string              `json:"role"`
+	Content          *string             `json:"content"`
+	ReasoningContent *string             `json:"reasoning_content,omitempty"`
+	ToolCalls        []llmStreamToolCall `json:"tool_calls,omitempty"`
+}
+
+// isEventStream 判断响应是否为 SSE
+func isEventStream(resp *http.Response) bool {
+	return strings.HasPrefix(strings.ToLower(resp.Header.Get("Content-Type")), "text/event-stream")
+}
+
+// llmStreamCacheLimit 流式响应旁路保存的最大字节数，超出后停止保存且不写入缓存
+const llmStreamCacheLimit = 8 << 20
+
+// handleLLMStreamCachePostResponse 包装 SSE 响应体：边转发边旁路保存，流结束后组装为完整响应写入缓存
+func (h *Handler) handleLLMStreamCachePostResponse(resp *http.Response, meta *llmCacheMetadata) error {
+	if resp.StatusCode != http.StatusOK || resp.Body == nil || !isEventStream(resp) {
+		return nil
+	}
+
+	resp.Header.Set("X-LLM-Cache", "MISS")
+	ctx := resp.Request.Context()
+	resp.Body = &llmStreamCacheBody{
+		ReadCloser: resp.Body,
+		encoding:   resp.Header.Get("Content-Encoding"),
+		limit:      llmStreamCacheLimit,
+		onComplete: func(body []byte) {
+			h.storeLLMStreamResponse(ctx, meta, body)
+		},
+	}
+	return nil
+}
+
+// llmStreamCacheBody 透传读取的同时缓存原始字节，仅当读到 EOF 且未超出 limit 时触发回调
+type llmStreamCacheBody struct {
+	io.ReadCloser
+	buf        bytes.Buffer
+	encoding   string
+	limit      int
+	overflow   bool // 超出 limit 后丢弃已保存的字节，不再写入缓存
+	eof        bool
+	once       sync.Once
+	onComplete func(body []byte)
+}
+
+func (b *llmStreamCacheBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.overflow {
+		if b.buf.Len()+n > b.limit {
+			b.overflow = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *llmStreamCacheBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		if !b.eof {
+			return
+		}
+		if b.overflow {
+			logger.Warn("Stream response exceeds LLM cache limit, skipping cache", zap.Int("limit", b.limit))
+			return
+		}
+		body := b.buf.Bytes()
+		if strings.Contains(strings.ToLower(b.encoding), "gzip") {
+			gr, gzErr := gzip.NewReader(bytes.NewReader(body))
+			if gzErr != nil {
+				logger.Warn("Failed to decompress gzip stream for LLM cache", zap.Error(gzErr))
+				return
+			}
+			decompressed, gzErr := io.ReadAll(gr)
+			_ = gr.Close()
+			if gzErr != nil {
+				logger.Warn("Failed to copy decompressed stream for LLM cache", zap.Error(gzErr))
+				return
+			}
+			body = decompressed
+		} else if b.encoding != "" {
+			return
+		}
+		b.onComplete(body)
+	})
+	return err
+}
+
+// storeLLMStreamResponse 将 SSE 事件组装为 chat.completion 并写入缓存
+func (h *Handler) storeLLMStreamResponse(ctx context.Context, meta *llmCacheMetadata, body []byte) {
+	completion, err := assembleLLMStream(body)
+	if err != nil {
+		logger.Warn("Failed to assemble stream response for LLM cache",
+			zap.String("requestId", meta.requestID),
+			zap.String("model", meta.model),
+			zap.Error(err))
+		return
+	}
+
+	completionBytes, err := json.Marshal(completion)
+	if err != nil {
+		logger.Warn("Failed to marshal assembled stream response for LLM cache",
+			zap.String("requestId", meta.requestID),
+			zap.String("model", meta.model),
+			zap.Error(err))
+		return
+	}
+	if !utf8.Valid(completionBytes) {
+		logger.Warn("LLM stream response is not valid UTF-8, skipping cache",
+			zap.String("model", meta.model))
+		return
+	}
+
+	h.storeLLMCacheRecord(ctx, meta, completionBytes)
+}
+
+// assembleLLMStream 解析 SSE 文本，将增量合并成完整的 chat.completion。
+// 流未正常结束（缺少 [DONE] 且存在未结束的 choice）时返回错误，避免缓存被截断的响应。
+func assembleLLMStream(body []byte) (*llmCompletion, error) {
+	completion := &llmCompletion{Object: "chat.completion"}
+	choices := make(map[int]*llmCompletionChoice)
+	contents := make(map[int]*strings.Builder)
+	reasonings := make(map[int]*strings.Builder)
+	toolCalls := make(map[int]map[int]*llmStreamToolCall)
+	done := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+
+		var chunk llmStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("invalid stream chunk: %w", err)
+		}
+		if completion.ID == "" {
+			completion.ID = chunk.ID
+		}
+		if completion.Created == 0 {
+			completion.Created = chunk.Created
+		}
+		if completion.Model == "" {
+			completion.Model = chunk.Model
+		}
+		if chunk.SystemFingerprint != "" {
+			completion.SystemFingerprint = chunk.SystemFingerprint
+		}
+		if len(chunk.Usage) > 0 && string(chunk.Usage) != "null" {
+			completion.Usage = chunk.Usage
+		}
+
+		for _, c := range chunk.Choices {
+			choice, ok := choices[c.Index]
+			if !ok {
+				choice = &llmCompletionChoice{Index: c.Index, Message: llmCompletionMessage{Role: "assistant"}}
+				choices[c.Index] = choice
+				contents[c.Index] = &strings.Builder{}
+				reasonings[c.Index] = &strings.Builder{}
+				toolCalls[c.Index] = make(map[int]*llmStreamToolCall)
+			}
+			if c.Delta.Role != "" {
+				choice.Message.Role = c.Delta.Role
+			}
+			if c.Delta.Content != nil {
+				contents[c.Index].WriteString(*c.Delta.Content)
+			}
+			if c.Delta.ReasoningContent != nil {
+				reasonings[c.Index].WriteString(*c.Delta.ReasoningContent)
+			}
+			for _, tc := range c.Delta.ToolCalls {
+				call, ok := toolCalls[c.Index][tc.Index]
+				if !ok {
+					call = &llmStreamToolCall{Index: tc.Index}
+					toolCalls[c.Index][tc.Index] = call
+				}
+				if tc.ID != "" {
+					call.ID = tc.ID
+				}
+				if tc.Type != "" {
+					call.Type = tc.Type
+				}
+				call.Function.Name += tc.Function.Name
+				call.Function.Arguments += tc.Function.Arguments
+			}
+			if c.FinishReason != nil && *c.FinishReason != "" {
+				reason := *c.FinishReason
+				choice.FinishReason = &reason
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(choices) == 0 {
+		return nil, fmt.Errorf("stream contains no choices")
+	}
+
+	indexes := make([]int, 0, len(choices))
+	for idx := range choices {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+
+	for _, idx := range indexes {
+		choice := choices[idx]
+		if choice.FinishReason == nil && !done {
+			return nil, fmt.Errorf("stream ended before choice %d finished", idx)
+		}
+		content := contents[idx].String()
+		choice.Message.Content = &content
+		if reasonings[idx].Len() > 0 {
+			reasoning := reasonings[idx].String()
+			choice.Message.ReasoningContent = &reasoning
+		}
+		if calls := toolCalls[idx]; len(calls) > 0 {
+			callIndexes := make([]int, 0, len(calls))
+			for i := range calls {
+				callIndexes = append(callIndexes, i)
+			}
+			sort.Ints(callIndexes)
+			for _, i := range callIndexes {
+				choice.Message.ToolCalls = append(choice.Message.ToolCalls, *calls[i])
+			}
+		}
+		completion.Choices = append(completion.Choices, *choice)
+	}
+
+	return completion, nil
+}
+
+// writeLLMCacheStream 将缓存的 chat.completion 重放为 SSE：角色增量、内容增量、finish_reason、[DONE]，status 为 X-LLM-Cache 的取值
+func writeLLMCacheStream(w http.ResponseWriter, response []byte, includeUsage bool, status string) error {
+	var completion llmCompletion
+	if err := json.Unmarshal(response, &completion); err != nil {
+		return fmt.Errorf("cached response is not a chat completion: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return fmt.Errorf("cached response has no choices")
+	}
+
+	if completion.Created == 0 {
+		completion.Created = time.Now().Unix()
+	}
+
+	events := make([]llmStreamChunk, 0, len(completion.Choices)*3+1)
+	newChunk := func(choices []llmStreamChunkChoice) llmStreamChunk {
+		return llmStreamChunk{
+			ID:                completion.ID,
+			Object:            "chat.completion.chunk",
+			Created:           completion.Created,
+			Model:             completion.Model,
+			SystemFingerprint: completion.SystemFingerprint,
+			Choices:           choices,
+		}
+	}
+	for _, choice := range completion.Choices {
+		role := choice.Message.Role
+		if role == "" {
+			role = "assistant"
+		}
+		empty := ""
+		events = append(events, newChunk([]llmStreamChunkChoice{{
+			Index: choice.Index,
+			Delta: llmStreamDelta{Role: role, Content: &empty},
+		}}))
+		if choice.Message.ReasoningContent != nil && *choice.Message.ReasoningContent != "" {
+			events = append(events, newChunk([]llmStreamChunkChoice{{
+				Index: choice.Index,
+				Delta: llmStreamDelta{ReasoningContent: choice.Message.ReasoningContent},
+			}}))
+		}
+		if choice.Message.Content != nil && *choice.Message.Content != "" {
+			events = append(events, newChunk([]llmStreamChunkChoice{{
+				Index: choice.Index,
+				Delta: llmStreamDelta{Content: choice.Message.Content},
+			}}))
+		}
+		if len(choice.Message.ToolCalls) > 0 {
+			calls := make([]llmStreamToolCall, len(choice.Message.ToolCalls))
+			for i, call := range choice.Message.ToolCalls {
+				call.Index = i
+				calls[i] = call
+			}
+			events = append(events, newChunk([]llmStreamChunkChoice{{
+				Index: choice.Index,
+				Delta: llmStreamDelta{ToolCalls: calls},
+			}}))
+		}
+		finishReason := "stop"
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			finishReason = *choice.FinishReason
+		}
+		events = append(events, newChunk([]llmStreamChunkChoice{{
+			Index:        choice.Index,
+			FinishReason: &finishReason,
+		}}))
+	}
+	if includeUsage && len(completion.Usage) > 0 {
+		usageChunk := newChunk([]llmStreamChunkChoice{})
+		usageChunk.Usage = completion.Usage
+		events = append(events, usageChunk)
+	}
+
+	var buf bytes.Buffer
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		buf.WriteString("data: ")
+		buf.Write(data)
+		buf.WriteString("\n\n")
+	}
+	buf.WriteString("data: [DONE]\n\n")
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-LLM-Cache", status)
+	_, _ = w.Write(buf.Bytes())
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-llm-server/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testLLMStreamBody = `data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4","choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4","choices":[{"index":0,"delta":{"content":"Hel"},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4","choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":null}]}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","created":1700000000,"model":"gpt-4","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}
+
+data: [DONE]
+
+`
+
+func TestAssembleLLMStream(t *testing.T) {
+	completion, err := assembleLLMStream([]byte(testLLMStreamBody))
+	require.NoError(t, err)
+	require.Equal(t, "chatcmpl-1", completion.ID)
+	require.Equal(t, "chat.completion", completion.Object)
+	require.Equal(t, "gpt-4", completion.Model)
+	require.Len(t, completion.Choices, 1)
+	require.Equal(t, "assistant", completion.Choices[0].Message.Role)
+	require.Equal(t, "Hello", *completion.Choices[0].Message.Content)
+	require.Equal(t, "stop", *completion.Choices[0].FinishReason)
+	require.JSONEq(t, `{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}`, string(completion.Usage))
+}
+
+func TestAssembleLLMStream_ToolCalls(t *testing.T) {
+	body := `data: {"id":"c","model":"gpt-4","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}
+
+data: {"id":"c","model":"gpt-4","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}
+
+data: {"id":"c","model":"gpt-4","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}
+
+data: {"id":"c","model":"gpt-4","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}
+
+data: [DONE]
+`
+	completion, err := assembleLLMStream([]byte(body))
+	require.NoError(t, err)
+	require.Len(t, completion.Choices[0].Message.ToolCalls, 1)
+	call := completion.Choices[0].Message.ToolCalls[0]
+	require.Equal(t, "call_1", call.ID)
+	require.Equal(t, "get_weather", call.Function.Name)
+	require.Equal(t, `{"city":"Paris"}`, call.Function.Arguments)
+	require.Equal(t, "tool_calls", *completion.Choices[0].FinishReason)
+}
+
+func TestAssembleLLMStream_Truncated(t *testing.T) {
+	body := `data: {"id":"c","model":"gpt-4","choices":[{"index":0,"delta":{"content":"partial"}}]}
+`
+	_, err := assembleLLMStream([]byte(body))
+	require.Error(t, err)
+
+	_, err = assembleLLMStream([]byte("data: [DONE]\n"))
+	require.Error(t, err)
+}
+
+func TestHandleLLMStreamCachePostResponse_StoresOnEOF(t *testing.T) {
+	var stored *db.LLMRecord
+	handler := newLLMTestHandler(&fakeLLMCacheStorage{
+		upsertLLMFn: func(ctx context.Context, rec *db.LLMRecord) error {
+			stored = rec
+			return nil
+		},
+	})
+	meta := &llmCacheMetadata{
+		prompt:    `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`,
+		model:     "gpt-4",
+		stream:    true,
+		startTime: time.Now(),
+		requestID: "req-stream",
+	}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(testLLMStreamBody)),
+		Header:     make(http.Header),
+		Request:    httptest.NewRequest(http.MethodPost, "/chat/completions", nil),
+	}
+	resp.Header.Set("Content-Type", "text/event-stream; charset=utf-8")
+
+	require.NoError(t, handler.handleLLMStreamCachePostResponse(resp, meta))
+	require.Equal(t, "MISS", resp.Header.Get("X-LLM-Cache"))
+
+	forwarded, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, testLLMStreamBody, string(forwarded))
+	require.Nil(t, stored)
+	require.NoError(t, resp.Body.Close())
+
+	require.NotNil(t, stored)
+	require.Equal(t, "gpt-4", stored.ModelName)
+	require.NotNil(t, stored.TotalTokens)
+	require.Equal(t, 5, *stored.TotalTokens)
+
+	var completion llmCompletion
+	require.NoError(t, json.Unmarshal(stored.Response, &completion))
+	require.Equal(t, "Hello", *completion.Choices[0].Message.Content)
+}
+
+func TestHandleLLMStreamCachePostResponse_SkipsIncompleteRead(t *testing.T) {
+	upsertCalled := false
+	handler := newLLMTestHandler(&fakeLLMCacheStorage{
+		upsertLLMFn: func(ctx context.Context, rec *db.LLMRecord) error {
+			upsertCalled = true
+			return nil
+		},
+	})
+	meta := &llmCacheMetadata{prompt: `{"model":"gpt-4"}`, model: "gpt-4", stream: true}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(testLLMStreamBody)),
+		Header:     make(http.Header),
+		Request:    httptest.NewRequest(http.MethodPost, "/chat/completions", nil),
+	}
+	resp.Header.Set("Content-Type", "text/event-stream")
+
+	require.NoError(t, handler.handleLLMStreamCachePostResponse(resp, meta))
+	buf := make([]byte, 16)
+	_, err := resp.Body.Read(buf)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.False(t, upsertCalled)
+}
+
+func TestHandleLLMStreamCachePostResponse_SkipsOversizedStream(t *testing.T) {
+	upsertCalled := false
+	handler := newLLMTestHandler(&fakeLLMCacheStorage{
+		upsertLLMFn: func(ctx context.Context, rec *db.LLMRecord) error {
+			upsertCalled = true
+			return nil
+		},
+	})
+	meta := &llmCacheMetadata{prompt: `{"model":"gpt-4"}`, model: "gpt-4", stream: true}
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(testLLMStreamBody)),
+		Header:     make(http.Header),
+		Request:    httptest.NewRequest(http.MethodPost, "/chat/completions", nil),
+	}
+	resp.Header.Set("Content-Type", "text/event-stream")
+
+	require.NoError(t, handler.handleLLMStreamCachePostResponse(resp, meta))
+	body := resp.Body.(*llmStreamCacheBody)
+	body.limit = 64
+
+	// 超出上限后照常转发，但不再保存且不写入缓存
+	forwarded, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, testLLMStreamBody, string(forwarded))
+	require.Zero(t, body.buf.Len())
+	require.NoError(t, resp.Body.Close())
+	require.False(t, upsertCalled)
+}
+
+func TestHandleLLMStreamCachePostResponse_NonStreamResponse(t *testing.T) {
+	handler := newLLMTestHandler(&fakeLLMCacheStorage{})
+	meta := &llmCacheMetadata{prompt: `{"model":"gpt-4"}`, model: "gpt-4", stream: true}
+	body := io.NopCloser(strings.NewReader(`{"error":"x"}`))
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Body:       body,
+		Header:     make(http.Header),
+		Request:    httptest.NewRequest(http.MethodPost, "/chat/completions", nil),
+	}
+
+	require.NoError(t, handler.handleLLMStreamCachePostResponse(resp, meta))
+	require.Equal(t, body, resp.Body)
+	require.Empty(t, resp.Header.Get("X-LLM-Cache"))
+}
+
+func TestHandleLLMCachePreProxy_StreamHitReplaysSSE(t *testing.T) {
+	cached := &db.LLMRecord{Response: []byte(`{"id":"chatcmpl-9","object":"chat.completion","created":1700000000,"model":"gpt-4","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`)}
+	var lookedUp string
+	handler := newLLMTestHandler(&fakeLLMCacheStorage{
+		getLLMFn: func(ctx context.Context, request, modelName string) (*db.LLMRecord, error) {
+			lookedUp = request
+			return cached, nil
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/chat/completions",
+		strings.NewReader(`{"model":"gpt-4","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`))
+	resp := httptest.NewRecorder()
+
+	handled, meta := handler.handleLLMCachePreProxy(resp, req)
+	require.True(t, handled)
+	require.Nil(t, meta)
+	require.JSONEq(t, `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`, lookedUp)
+	require.Equal(t, "HIT", resp.Header().Get("X-LLM-Cache"))
+	require.Equal(t, "text/event-stream", resp.Header().Get("Content-Type"))
+
+	body := resp.Body.String()
+	require.True(t, strings.HasSuffix(body, "data: [DONE]\n\n"))
+
+	// 回放的 SSE 能够被重新组装为同样的结果
+	completion, err := assembleLLMStream([]byte(body))
+	require.NoError(t, err)
+	require.Equal(t, "chatcmpl-9", completion.ID)
+	require.Equal(t, "Hello", *completion.Choices[0].Message.Content)
+	require.Equal(t, "stop", *completion.Choices[0].FinishReason)
+	require.JSONEq(t, `{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}`, string(completion.Usage))
+}
+
+func TestHandleLLMCachePreProxy_StreamAndNonStreamShareKey(t *testing.T) {
+	var keys []string
+	handler := newLLMTestHandler(&fakeLLMCacheStorage{
+		getLLMFn: func(ctx context.Context, request, modelName string) (*db.LLMRecord, error) {
+			keys = append(keys, request)
+			return nil, nil
+		},
+	})
+
+	for _, body := range []string{
+		`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`,
+		`{"stream":true,"messages":[{"role":"user","content":"hi"}],"model":"gpt-4"}`,
+		`{"model":"gpt-4","stream":false,"messages":[{"role":"user","content":"hi"}]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader(body))
+		handled, meta := handler.handleLLMCachePreProxy(httptest.NewRecorder(), req)
+		require.False(t, handled)
+		require.NotNil(t, meta)
+	}
+	require.Len(t, keys, 3)
+	require.Equal(t, keys[0], keys[1])
+	require.Equal(t, keys[0], keys[2])
+}
+
+func TestWriteLLMCacheStream_InvalidCachedResponse(t *testing.T) {
+	resp := httptest.NewRecorder()
+	require.Error(t, writeLLMCacheStream(resp, []byte(`"plain"`), false, "HIT"))
+	require.Error(t, writeLLMCacheStream(resp, []byte(`{"choices":[]}`), false, "HIT"))
+	require.Empty(t, resp.Body.String())
+}
@@ -1,8 +1,12 @@
 package proxy
 
 import (
+	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
+
+	"go-llm-server/internal/config"
 )
 
 // LoadBalancer 负载均衡器接口
@@ -42,6 +46,17 @@ func (rr *RoundRobinLoadBalancer) GetNext() string {
 	return rr.urls[index]
 }
 
+// GetNextExcluding 按轮询顺序跳过被排除的 URL
+func (rr *RoundRobinLoadBalancer) GetNextExcluding(exclude func(string) bool) string {
+	for i := 0; i < len(rr.urls); i++ {
+		url := rr.GetNext()
+		if exclude == nil || !exclude(url) {
+			return url
+		}
+	}
+	return ""
+}
+
 // GetURLs 获取所有URL
 func (rr *RoundRobinLoadBalancer) GetURLs() []string {
 	rr.mu.RLock()
@@ -55,6 +70,9 @@ func (rr *RoundRobinLoadBalancer) GetURLs() []string {
 // LoadBalancerManager 负载均衡器管理器
 type LoadBalancerManager struct {
 	balancers map[string]LoadBalancer
+	routes    map[string]config.ModelRoute // 按路由配置创建的负载均衡器对应的配置
+	health    *HealthChecker
+	onSelect  func(key, url string) // 每次选中 URL 后回调，用于统计
 	mu        sync.RWMutex
 }
 
@@ -62,16 +80,92 @@ type LoadBalancerManager struct {
 func NewLoadBalancerManager() *LoadBalancerManager {
 	return &LoadBalancerManager{
 		balancers: make(map[string]LoadBalancer),
+		routes:    make(map[string]config.ModelRoute),
 	}
 }
 
 // AddLoadBalancer 添加负载均衡器
 func (lbm *LoadBalancerManager) AddLoadBalancer(key string, urls []string) {
+	lbm.SetLoadBalancer(key, NewRoundRobinLoadBalancer(urls))
+}
+
+// AddRouteLoadBalancer 按模型路由配置的策略和权重添加负载均衡器
+func (lbm *LoadBalancerManager) AddRouteLoadBalancer(key string, route config.ModelRoute) error {
+	balancer, err := NewLoadBalancer(route.Strategy, route.URLs, route.Weights)
+	if err != nil {
+		return err
+	}
+	lbm.SetLoadBalancer(key, balancer)
+
+	lbm.mu.Lock()
+	defer lbm.mu.Unlock()
+	lbm.routes[key] = route
+	return nil
+}
+
+// SetLoadBalancer 设置指定 key 的负载均衡器
+func (lbm *LoadBalancerManager) SetLoadBalancer(key string, balancer LoadBalancer) {
 	lbm.mu.Lock()
 	defer lbm.mu.Unlock()
 
-	balancer := NewRoundRobinLoadBalancer(urls)
 	lbm.balancers[key] = balancer
+	delete(lbm.routes, key)
+	lbm.health.Register(balancer.GetURLs()...)
+}
+
+// HasRoute 判断 key 的负载均衡器是否已按相同的路由配置创建
+func (lbm *LoadBalancerManager) HasRoute(key string, route config.ModelRoute) bool {
+	lbm.mu.RLock()
+	defer lbm.mu.RUnlock()
+
+	current, ok := lbm.routes[key]
+	return ok && current.Strategy == route.Strategy &&
+		slices.Equal(current.URLs, route.URLs) &&
+		slices.Equal(current.Weights, route.Weights)
+}
+
+// RetainLoadBalancers 移除 keep 返回 false 的负载均衡器
+func (lbm *LoadBalancerManager) RetainLoadBalancers(keep func(key string) bool) {
+	lbm.mu.Lock()
+	defer lbm.mu.Unlock()
+
+	for key := range lbm.balancers {
+		if !keep(key) {
+			delete(lbm.balancers, key)
+			delete(lbm.routes, key)
+		}
+	}
+}
+
+// URLs 返回所有负载均衡器的后端 URL
+func (lbm *LoadBalancerManager) URLs() []string {
+	lbm.mu.RLock()
+	defer lbm.mu.RUnlock()
+
+	var urls []string
+	for _, balancer := range lbm.balancers {
+		urls = append(urls, balancer.GetURLs()...)
+	}
+	return urls
+}
+
+// SetHealthChecker 设置健康检查器，GetNextURL 将跳过被摘除的 URL
+func (lbm *LoadBalancerManager) SetHealthChecker(health *HealthChecker) {
+	lbm.mu.Lock()
+	defer lbm.mu.Unlock()
+
+	lbm.health = health
+	for _, balancer := range lbm.balancers {
+		health.Register(balancer.GetURLs()...)
+	}
+}
+
+// SetSelectionObserver 设置选中 URL 后的回调
+func (lbm *LoadBalancerManager) SetSelectionObserver(fn func(key, url string)) {
+	lbm.mu.Lock()
+	defer lbm.mu.Unlock()
+
+	lbm.onSelect = fn
 }
 
 // GetLoadBalancer 获取负载均衡器
@@ -83,13 +177,90 @@ func (lbm *LoadBalancerManager) GetLoadBalancer(key string) (LoadBalancer, bool)
 	return balancer, exists
 }
 
-// GetNextURL 获取下一个URL
+// GetNextURL 获取下一个URL，跳过健康检查摘除的URL；全部不可用时仍返回轮询结果
 func (lbm *LoadBalancerManager) GetNextURL(key string) (string, bool) {
+	return lbm.GetNextURLExcluding(key, nil)
+}
+
+// GetNextURLExcluding 获取下一个不被 exclude 排除的URL，优先选择健康的URL；
+// 未排除的URL全部被摘除时仍返回其中之一
+func (lbm *LoadBalancerManager) GetNextURLExcluding(key string, exclude func(string) bool) (string, bool) {
 	balancer, exists := lbm.GetLoadBalancer(key)
 	if !exists {
 		return "", false
 	}
 
-	url := balancer.GetNext()
-	return url, url != ""
+	lbm.mu.RLock()
+	health := lbm.health
+	onSelect := lbm.onSelect
+	lbm.mu.RUnlock()
+
+	url, ok := lbm.selectURL(balancer, health, exclude)
+	if ok && onSelect != nil {
+		onSelect(key, url)
+	}
+	return url, ok
+}
+
+func (lbm *LoadBalancerManager) selectURL(balancer LoadBalancer, health *HealthChecker, exclude func(string) bool) (string, bool) {
+	if selective, ok := balancer.(selectiveLoadBalancer); ok {
+		url := selective.GetNextExcluding(func(u string) bool {
+			return (exclude != nil && exclude(u)) || !health.IsHealthy(u)
+		})
+		if url == "" && health != nil {
+			url = selective.GetNextExcluding(exclude)
+		}
+		return url, url != ""
+	}
+
+	var fallback string
+	for attempts := len(balancer.GetURLs()); attempts > 0; attempts-- {
+		candidate := balancer.GetNext()
+		if candidate == "" || (exclude != nil && exclude(candidate)) {
+			continue
+		}
+		if health.IsHealthy(candidate) {
+			return candidate, true
+		}
+		if fallback == "" {
+			fallback = candidate
+		}
+	}
+	return fallback, fallback != ""
+}
+
+// feedbackBalancers 返回所有接收传输层反馈的负载均衡器
+func (lbm *LoadBalancerManager) feedbackBalancers() []FeedbackLoadBalancer {
+	lbm.mu.RLock()
+	defer lbm.mu.RUnlock()
+
+	result := make([]FeedbackLoadBalancer, 0, len(lbm.balancers))
+	for _, balancer := range lbm.balancers {
+		if fb, ok := balancer.(FeedbackLoadBalancer); ok {
+			result = append(result, fb)
+		}
+	}
+	return result
+}
+
+// UpstreamStarted 传输层通知请求开始，转发给所有接收反馈的负载均衡器；
+// 同一 URL 可能出现在多个路由（如别名）中，各负载均衡器只处理自己的 URL
+func (lbm *LoadBalancerManager) UpstreamStarted(target string) {
+	for _, fb := range lbm.feedbackBalancers() {
+		fb.Begin(target)
+	}
+}
+
+// UpstreamFinished 传输层通知请求结束
+func (lbm *LoadBalancerManager) UpstreamFinished(target string) {
+	for _, fb := range lbm.feedbackBalancers() {
+		fb.End(target)
+	}
+}
+
+// ObserveUpstream 传输层反馈响应状态与首字节延迟
+func (lbm *LoadBalancerManager) ObserveUpstream(target string, statusCode int, err error, duration time.Duration) {
+	for _, fb := range lbm.feedbackBalancers() {
+		fb.Observe(target, statusCode, err, duration)
+	}
 }
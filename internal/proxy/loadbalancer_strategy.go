@@ -0,0 +1,312 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 负载均衡策略名称，对应 model_routes 中的 strategy 字段
+const (
+	StrategyRoundRobin       = "round_robin"
+	StrategyWeighted         = "weighted"
+	StrategyLeastConnections = "least_connections"
+	StrategyEWMALatency      = "ewma_latency"
+	StrategyRandomTwoChoices = "random_two_choices"
+)
+
+const (
+	// ewmaAlpha 新样本在 EWMA 中的权重
+	ewmaAlpha = 0.3
+	// ewmaFailurePenalty 失败请求按至少该延迟计入 EWMA，使故障节点分数迅速变差
+	ewmaFailurePenalty = 10 * time.Second
+)
+
+// FeedbackLoadBalancer 接收传输层反馈的负载均衡器
+type FeedbackLoadBalancer interface {
+	LoadBalancer
+	// Begin 请求即将发往 url
+	Begin(url string)
+	// End 发往 url 的请求结束（响应体关闭或请求失败）
+	End(url string)
+	// Observe 收到 url 的响应头或传输错误，latency 为首字节耗时
+	Observe(url string, statusCode int, err error, latency time.Duration)
+}
+
+// selectiveLoadBalancer 支持在选择时排除部分 URL 的负载均衡器
+type selectiveLoadBalancer interface {
+	// GetNextExcluding 返回不被 exclude 排除的下一个 URL，没有可选 URL 时返回空字符串
+	GetNextExcluding(exclude func(url string) bool) string
+}
+
+// NewLoadBalancer 按策略名称创建负载均衡器，weights 与 urls 一一对应，缺省为 1
+func NewLoadBalancer(strategy string, urls []string, weights []int) (LoadBalancer, error) {
+	switch strategy {
+	case "", StrategyRoundRobin:
+		return NewRoundRobinLoadBalancer(urls), nil
+	case StrategyWeighted:
+		return NewWeightedLoadBalancer(urls, weights), nil
+	case StrategyLeastConnections:
+		return NewLeastConnectionsLoadBalancer(urls, weights), nil
+	case StrategyEWMALatency:
+		return NewEWMALatencyLoadBalancer(urls, weights), nil
+	case StrategyRandomTwoChoices:
+		return NewRandomTwoChoicesLoadBalancer(urls, weights), nil
+	default:
+		return nil, fmt.Errorf("unknown load balancing strategy %q", strategy)
+	}
+}
+
+// endpoint 单个后端 URL 的权重与运行时统计
+type endpoint struct {
+	url      string
+	weight   int
+	inflight int64
+	ewma     float64 // 纳秒
+	sampled  bool
+	current  int // 平滑加权轮询的当前权重
+}
+
+func newEndpoints(urls []string, weights []int) []*endpoint {
+	endpoints := make([]*endpoint, len(urls))
+	for i, u := range urls {
+		weight := 1
+		if i < len(weights) && weights[i] > 0 {
+			weight = weights[i]
+		}
+		endpoints[i] = &endpoint{url: u, weight: weight}
+	}
+	return endpoints
+}
+
+// endpointSet 各策略共用的 URL 列表与反馈统计
+type endpointSet struct {
+	endpoints []*endpoint
+	index     map[string]*endpoint
+	rotation  uint64
+	mu        sync.Mutex
+}
+
+func newEndpointSet(urls []string, weights []int) endpointSet {
+	endpoints := newEndpoints(urls, weights)
+	index := make(map[string]*endpoint, len(endpoints))
+	for _, e := range endpoints {
+		index[e.url] = e
+	}
+	return endpointSet{endpoints: endpoints, index: index}
+}
+
+// GetURLs 获取所有URL
+func (s *endpointSet) GetURLs() []string {
+	result := make([]string, len(s.endpoints))
+	for i, e := range s.endpoints {
+		result[i] = e.url
+	}
+	return result
+}
+
+// Begin 记录进行中的请求
+func (s *endpointSet) Begin(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.index[url]; ok {
+		e.inflight++
+	}
+}
+
+// End 请求结束
+func (s *endpointSet) End(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.index[url]; ok && e.inflight > 0 {
+		e.inflight--
+	}
+}
+
+// Observe 更新延迟 EWMA，失败请求按惩罚延迟计入
+func (s *endpointSet) Observe(url string, statusCode int, err error, latency time.Duration) {
+	if err != nil || statusCode >= http.StatusInternalServerError || statusCode == http.StatusTooManyRequests {
+		if latency < ewmaFailurePenalty {
+			latency = ewmaFailurePenalty
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.index[url]
+	if !ok {
+		return
+	}
+	if !e.sampled {
+		e.ewma = float64(latency)
+		e.sampled = true
+		return
+	}
+	e.ewma = ewmaAlpha*float64(latency) + (1-ewmaAlpha)*e.ewma
+}
+
+// pickMin 返回分数最低的 URL，分数相同时从轮换起点开始取第一个，避免总是选中列表头部
+func (s *endpointSet) pickMin(exclude func(string) bool, score func(e *endpoint) float64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.endpoints)
+	if n == 0 {
+		return ""
+	}
+	start := int(s.rotation % uint64(n))
+	s.rotation++
+	var best *endpoint
+	var bestScore float64
+	for i := 0; i < n; i++ {
+		e := s.endpoints[(start+i)%n]
+		if exclude != nil && exclude(e.url) {
+			continue
+		}
+		if sc := score(e); best == nil || sc < bestScore {
+			best, bestScore = e, sc
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.url
+}
+
+// WeightedLoadBalancer 平滑加权轮询（与 nginx 相同的算法）
+type WeightedLoadBalancer struct {
+	endpointSet
+}
+
+// NewWeightedLoadBalancer 创建加权轮询负载均衡器
+func NewWeightedLoadBalancer(urls []string, weights []int) *WeightedLoadBalancer {
+	return &WeightedLoadBalancer{endpointSet: newEndpointSet(urls, weights)}
+}
+
+// GetNext 获取下一个URL
+func (w *WeightedLoadBalancer) GetNext() string {
+	return w.GetNextExcluding(nil)
+}
+
+// GetNextExcluding 只在未排除的 URL 之间按权重轮询
+func (w *WeightedLoadBalancer) GetNextExcluding(exclude func(string) bool) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var best *endpoint
+	total := 0
+	for _, e := range w.endpoints {
+		if exclude != nil && exclude(e.url) {
+			continue
+		}
+		e.current += e.weight
+		total += e.weight
+		if best == nil || e.current > best.current {
+			best = e
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	best.current -= total
+	return best.url
+}
+
+// LeastConnectionsLoadBalancer 选择进行中请求数与权重之比最小的 URL
+type LeastConnectionsLoadBalancer struct {
+	endpointSet
+}
+
+// NewLeastConnectionsLoadBalancer 创建最少连接负载均衡器
+func NewLeastConnectionsLoadBalancer(urls []string, weights []int) *LeastConnectionsLoadBalancer {
+	return &LeastConnectionsLoadBalancer{endpointSet: newEndpointSet(urls, weights)}
+}
+
+// GetNext 获取下一个URL
+func (l *LeastConnectionsLoadBalancer) GetNext() string {
+	return l.GetNextExcluding(nil)
+}
+
+// GetNextExcluding 在未排除的 URL 中选择负载最低者
+func (l *LeastConnectionsLoadBalancer) GetNextExcluding(exclude func(string) bool) string {
+	return l.pickMin(exclude, func(e *endpoint) float64 {
+		return float64(e.inflight) / float64(e.weight)
+	})
+}
+
+// EWMALatencyLoadBalancer 按首字节延迟的指数加权移动平均选择 URL，
+// 分数 = EWMA × (进行中请求数 + 1) / 权重；尚无样本的 URL 优先获得流量
+type EWMALatencyLoadBalancer struct {
+	endpointSet
+}
+
+// NewEWMALatencyLoadBalancer 创建延迟感知负载均衡器
+func NewEWMALatencyLoadBalancer(urls []string, weights []int) *EWMALatencyLoadBalancer {
+	return &EWMALatencyLoadBalancer{endpointSet: newEndpointSet(urls, weights)}
+}
+
+// GetNext 获取下一个URL
+func (l *EWMALatencyLoadBalancer) GetNext() string {
+	return l.GetNextExcluding(nil)
+}
+
+// GetNextExcluding 在未排除的 URL 中选择分数最低者
+func (l *EWMALatencyLoadBalancer) GetNextExcluding(exclude func(string) bool) string {
+	return l.pickMin(exclude, func(e *endpoint) float64 {
+		if !e.sampled {
+			return 0
+		}
+		return e.ewma * float64(e.inflight+1) / float64(e.weight)
+	})
+}
+
+// RandomTwoChoicesLoadBalancer 随机选取两个 URL，取进行中请求数与权重之比较小者
+type RandomTwoChoicesLoadBalancer struct {
+	endpointSet
+	intn func(n int) int
+}
+
+// NewRandomTwoChoicesLoadBalancer 创建 power-of-two-choices 负载均衡器
+func NewRandomTwoChoicesLoadBalancer(urls []string, weights []int) *RandomTwoChoicesLoadBalancer {
+	return &RandomTwoChoicesLoadBalancer{
+		endpointSet: newEndpointSet(urls, weights),
+		// 仅在持有 endpointSet 锁时调用，无需额外同步
+		intn: rand.New(rand.NewSource(time.Now().UnixNano())).Intn,
+	}
+}
+
+// GetNext 获取下一个URL
+func (r *RandomTwoChoicesLoadBalancer) GetNext() string {
+	return r.GetNextExcluding(nil)
+}
+
+// GetNextExcluding 在未排除的 URL 中随机比较两个
+func (r *RandomTwoChoicesLoadBalancer) GetNextExcluding(exclude func(string) bool) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	candidates := make([]*endpoint, 0, len(r.endpoints))
+	for _, e := range r.endpoints {
+		if exclude == nil || !exclude(e.url) {
+			candidates = append(candidates, e)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return ""
+	case 1:
+		return candidates[0].url
+	}
+
+	i := r.intn(len(candidates))
+	j := r.intn(len(candidates) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := candidates[i], candidates[j]
+	if float64(b.inflight)/float64(b.weight) < float64(a.inflight)/float64(a.weight) {
+		return b.url
+	}
+	return a.url
+}
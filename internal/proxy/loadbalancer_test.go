@@ -1,7 +1,13 @@
 package proxy
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"go-llm-server/internal/config"
 )
 
 func TestRoundRobinLoadBalancer(t *testing.T) {
@@ -63,3 +69,232 @@ func TestLoadBalancerWithEmptyURLs(t *testing.T) {
 		t.Errorf("Expected empty string, got %s", url)
 	}
 }
+
+func TestWeightedLoadBalancer(t *testing.T) {
+	lb := NewWeightedLoadBalancer([]string{"a", "b", "c"}, []int{5, 1, 1})
+
+	// 平滑加权轮询：权重 5:1:1 在 7 次内均匀穿插
+	expected := []string{"a", "a", "b", "a", "c", "a", "a"}
+	for i, expectedURL := range expected {
+		actual := lb.GetNext()
+		if actual != expectedURL {
+			t.Errorf("Expected %s, got %s at iteration %d", expectedURL, actual, i)
+		}
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 700; i++ {
+		counts[lb.GetNext()]++
+	}
+	if counts["a"] != 500 || counts["b"] != 100 || counts["c"] != 100 {
+		t.Errorf("Unexpected distribution: %v", counts)
+	}
+}
+
+func TestWeightedLoadBalancer_Excluding(t *testing.T) {
+	lb := NewWeightedLoadBalancer([]string{"a", "b", "c"}, []int{5, 1, 1})
+	for i := 0; i < 10; i++ {
+		if url := lb.GetNextExcluding(func(u string) bool { return u == "a" }); url == "a" {
+			t.Errorf("Expected excluded URL to be skipped at iteration %d", i)
+		}
+	}
+	if url := lb.GetNextExcluding(func(string) bool { return true }); url != "" {
+		t.Errorf("Expected empty string when all URLs are excluded, got %s", url)
+	}
+}
+
+func TestLeastConnectionsLoadBalancer(t *testing.T) {
+	lb := NewLeastConnectionsLoadBalancer([]string{"a", "b", "c"}, nil)
+
+	lb.Begin("a")
+	lb.Begin("a")
+	lb.Begin("b")
+	if url := lb.GetNext(); url != "c" {
+		t.Errorf("Expected c, got %s", url)
+	}
+
+	lb.Begin("c")
+	lb.Begin("c")
+	if url := lb.GetNext(); url != "b" {
+		t.Errorf("Expected b, got %s", url)
+	}
+
+	lb.End("a")
+	lb.End("a")
+	if url := lb.GetNext(); url != "a" {
+		t.Errorf("Expected a, got %s", url)
+	}
+
+	// 多余的 End 不会使计数变为负数
+	lb.End("a")
+	lb.Begin("a")
+	lb.Begin("b")
+	if url := lb.GetNext(); url != "a" {
+		t.Errorf("Expected a, got %s", url)
+	}
+}
+
+func TestLeastConnectionsLoadBalancer_Weights(t *testing.T) {
+	lb := NewLeastConnectionsLoadBalancer([]string{"big", "small"}, []int{4, 1})
+	for i := 0; i < 3; i++ {
+		lb.Begin("big")
+	}
+	lb.Begin("small")
+	// big: 3/4 < small: 1/1
+	if url := lb.GetNext(); url != "big" {
+		t.Errorf("Expected big, got %s", url)
+	}
+}
+
+func TestLeastConnectionsLoadBalancer_RotatesTies(t *testing.T) {
+	lb := NewLeastConnectionsLoadBalancer([]string{"a", "b", "c"}, nil)
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		seen[lb.GetNext()] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("Expected idle URLs to be rotated, got %v", seen)
+	}
+}
+
+func TestEWMALatencyLoadBalancer(t *testing.T) {
+	lb := NewEWMALatencyLoadBalancer([]string{"fast", "slow"}, nil)
+
+	lb.Observe("slow", http.StatusOK, nil, 800*time.Millisecond)
+	// 尚无样本的 URL 优先获得流量
+	if url := lb.GetNext(); url != "fast" {
+		t.Errorf("Expected unsampled URL fast, got %s", url)
+	}
+
+	lb.Observe("fast", http.StatusOK, nil, 100*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		if url := lb.GetNext(); url != "fast" {
+			t.Errorf("Expected fast, got %s at iteration %d", url, i)
+		}
+	}
+
+	// 失败按惩罚延迟计入
+	lb.Observe("fast", http.StatusBadGateway, nil, 10*time.Millisecond)
+	if url := lb.GetNext(); url != "slow" {
+		t.Errorf("Expected slow after fast failed, got %s", url)
+	}
+}
+
+func TestEWMALatencyLoadBalancer_InflightPenalty(t *testing.T) {
+	lb := NewEWMALatencyLoadBalancer([]string{"a", "b"}, nil)
+	lb.Observe("a", http.StatusOK, nil, 100*time.Millisecond)
+	lb.Observe("b", http.StatusOK, nil, 150*time.Millisecond)
+	lb.Begin("a")
+	// a: 100ms*2 > b: 150ms*1
+	if url := lb.GetNext(); url != "b" {
+		t.Errorf("Expected b, got %s", url)
+	}
+}
+
+func TestRandomTwoChoicesLoadBalancer(t *testing.T) {
+	lb := NewRandomTwoChoicesLoadBalancer([]string{"a", "b", "c"}, nil)
+	picks := []int{0, 1}
+	lb.intn = func(n int) int {
+		v := picks[0]
+		picks = picks[1:]
+		return v
+	}
+
+	lb.Begin("a")
+	// 抽中 a 与 c（第二次抽样跳过已选中的下标），选择负载较低的 c
+	if url := lb.GetNext(); url != "c" {
+		t.Errorf("Expected c, got %s", url)
+	}
+
+	if url := lb.GetNextExcluding(func(u string) bool { return u != "b" }); url != "b" {
+		t.Errorf("Expected the only remaining candidate b, got %s", url)
+	}
+}
+
+func TestRandomTwoChoicesLoadBalancer_Distribution(t *testing.T) {
+	lb := NewRandomTwoChoicesLoadBalancer([]string{"a", "b", "c"}, nil)
+	counts := map[string]int{}
+	for i := 0; i < 300; i++ {
+		url := lb.GetNext()
+		counts[url]++
+		lb.Begin(url)
+	}
+	// 请求未结束时，两选一会让各 URL 的进行中请求数保持接近
+	for url, count := range counts {
+		if count < 90 || count > 110 {
+			t.Errorf("Unbalanced count for %s: %d (%v)", url, count, counts)
+		}
+	}
+}
+
+func TestNewLoadBalancer(t *testing.T) {
+	urls := []string{"a", "b"}
+	for _, strategy := range []string{"", StrategyRoundRobin, StrategyWeighted, StrategyLeastConnections, StrategyEWMALatency, StrategyRandomTwoChoices} {
+		lb, err := NewLoadBalancer(strategy, urls, nil)
+		if err != nil {
+			t.Errorf("NewLoadBalancer(%q) error: %v", strategy, err)
+			continue
+		}
+		if got := lb.GetURLs(); len(got) != 2 {
+			t.Errorf("NewLoadBalancer(%q) URLs = %v", strategy, got)
+		}
+	}
+	if _, err := NewLoadBalancer("fastest", urls, nil); err == nil {
+		t.Error("Expected error for unknown strategy")
+	}
+}
+
+func TestLoadBalancerManager_Feedback(t *testing.T) {
+	lbm := NewLoadBalancerManager()
+	if err := lbm.AddRouteLoadBalancer("test-model", config.ModelRoute{
+		Strategy: StrategyLeastConnections,
+		URLs:     []string{"https://api1.example.com", "https://api2.example.com"},
+	}); err != nil {
+		t.Fatalf("AddRouteLoadBalancer error: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// 传输层在请求开始时计数，响应体关闭时结束
+	transport := &TransportWithProxyAutoDetected{observers: []upstreamObserver{lbm}}
+	ctx, route := withUpstreamRoute(context.Background())
+	route.baseURL = "https://api1.example.com"
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip error: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if url, _ := lbm.GetNextURL("test-model"); url != "https://api2.example.com" {
+			t.Errorf("Expected api2 while api1 is busy, got %s", url)
+		}
+	}
+
+	_ = resp.Body.Close()
+	_ = resp.Body.Close()
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		url, _ := lbm.GetNextURL("test-model")
+		seen[url] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("Expected both URLs after the request finished, got %v", seen)
+	}
+}
+
+func TestLoadBalancerManager_GetNextURLExcluding(t *testing.T) {
+	lbm := NewLoadBalancerManager()
+	lbm.AddLoadBalancer("test-model", []string{"a", "b"})
+	for i := 0; i < 4; i++ {
+		if url, ok := lbm.GetNextURLExcluding("test-model", func(u string) bool { return u == "a" }); !ok || url != "b" {
+			t.Errorf("Expected b, got %s", url)
+		}
+	}
+	if _, ok := lbm.GetNextURLExcluding("test-model", func(string) bool { return true }); ok {
+		t.Error("Expected no URL when all are excluded")
+	}
+}
@@ -0,0 +1,357 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// serveMessagesAPI 处理 Anthropic Messages API 请求：转换为 chat completions 请求后
+// 经完整的代理流程（鉴权、限流、缓存、负载均衡）转发到 chat_path，再将响应转换回 Messages 格式。
+// 返回 true 表示请求已处理；显式配置的代理路径优先
+func (h *Handler) serveMessagesAPI(w http.ResponseWriter, r *http.Request) bool {
+	if h.cfg == nil || h.cfg.MessagesAPI.Path == "" || r.URL.Path != h.cfg.MessagesAPI.Path {
+		return false
+	}
+	if _, ok := h.cfg.TargetMap[r.URL.Path]; ok {
+		return false
+	}
+	if r.Method != http.MethodPost {
+		writeAnthropicError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return true
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeAnthropicError(w, http.StatusBadRequest, "Failed to read request body")
+		return true
+	}
+	var req anthropicRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeAnthropicError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+		return true
+	}
+	chat, err := anthropicToChatRequest(&req)
+	if err != nil {
+		writeAnthropicError(w, http.StatusBadRequest, err.Error())
+		return true
+	}
+	chatBody, err := json.Marshal(chat)
+	if err != nil {
+		writeAnthropicError(w, http.StatusInternalServerError, "Failed to encode chat completions request")
+		return true
+	}
+
+	inner := r.Clone(r.Context())
+	inner.URL.Path = h.cfg.MessagesAPI.ChatPathOrDefault()
+	inner.URL.RawPath = ""
+	inner.Body = io.NopCloser(bytes.NewReader(chatBody))
+	inner.ContentLength = int64(len(chatBody))
+	inner.Header.Set("Content-Length", strconv.Itoa(len(chatBody)))
+	inner.Header.Set("Content-Type", "application/json")
+	// 响应需要解析转换，不接受压缩
+	inner.Header.Del("Accept-Encoding")
+	inner.Header.Del("Anthropic-Version")
+	inner.Header.Del("Anthropic-Beta")
+	// Anthropic SDK 使用 x-api-key 传递密钥，转换为鉴权与 OpenAI 兼容上游使用的 Bearer 令牌
+	if apiKey := inner.Header.Get("X-Api-Key"); apiKey != "" {
+		if inner.Header.Get("Authorization") == "" {
+			inner.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		inner.Header.Del("X-Api-Key")
+	}
+
+	requestID := utils.GetOrGenerateRequestID(inner)
+	mw := &frontendResponseWriter{
+		ResponseWriter: w,
+		newStream: func(out io.Writer) frontendStreamWriter {
+			return newAnthropicStreamWriter(out, req.Model)
+		},
+		onError: func(out http.ResponseWriter, status int, body []byte) {
+			writeAnthropicError(out, status, upstreamErrorMessage(status, body))
+		},
+		onSuccess: func(out http.ResponseWriter, body []byte) {
+			resp, err := chatToAnthropicResponse(body, req.Model)
+			if err != nil {
+				logger.Warn("messages-api: failed to translate chat completion",
+					zap.String("requestId", requestID),
+					zap.Error(err))
+				writeAnthropicError(out, http.StatusBadGateway, "Invalid response from upstream")
+				return
+			}
+			writeJSON(out, http.StatusOK, resp)
+		},
+	}
+	h.ServeHTTP(mw, inner)
+	mw.finish()
+	return true
+}
+
+// writeAnthropicError 以 Messages API 错误格式返回错误
+func writeAnthropicError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, anthropicError{
+		Type:  "error",
+		Error: anthropicErrorDetail{Type: anthropicErrorType(status), Message: message},
+	})
+}
+
+// anthropicStreamEvent Messages API 流式事件的 data，按事件类型使用不同字段
+type anthropicStreamEvent struct {
+	Type         string             `json:"type"`
+	Message      *anthropicResponse `json:"message,omitempty"`
+	Index        *int               `json:"index,omitempty"`
+	ContentBlock *anthropicBlock    `json:"content_block,omitempty"`
+	Delta        interface{}        `json:"delta,omitempty"`
+	Usage        *anthropicUsage    `json:"usage,omitempty"`
+}
+
+// anthropicBlock content_block_start 中的内容块，text 块需要输出空字符串
+type anthropicBlock struct {
+	Type  string          `json:"type"`
+	Text  *string         `json:"text,omitempty"`
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+type anthropicBlockDelta struct {
+	Type        string `json:"type"`
+	Text        string `json:"text,omitempty"`
+	PartialJSON string `json:"partial_json,omitempty"`
+}
+
+type anthropicMessageDelta struct {
+	StopReason   string  `json:"stop_reason"`
+	StopSequence *string `json:"stop_sequence"`
+}
+
+// anthropicStreamWriter 将 chat completions 的 SSE 流转换为 Messages API 流式事件：
+// message_start、每个内容块的 content_block_start/delta/stop、message_delta 与 message_stop
+type anthropicStreamWriter struct {
+	w     io.Writer
+	model string
+
+	pending  []byte
+	started  bool
+	finished bool
+
+	nextIndex  int    // 下一个内容块的序号
+	openType   string // 当前打开的内容块类型，为空表示没有打开的块
+	openTool   int    // 当前打开的 tool_use 块对应的上游 tool_calls 序号
+	openToolID string
+	sawTool    bool
+
+	stopReason string
+	usage      anthropicUsage
+}
+
+func newAnthropicStreamWriter(w io.Writer, model string) *anthropicStreamWriter {
+	return &anthropicStreamWriter{w: w, model: model}
+}
+
+// Write 接收任意切分的 SSE 数据，按完整的行处理
+func (s *anthropicStreamWriter) Write(p []byte) error {
+	s.pending = append(s.pending, p...)
+	for {
+		i := bytes.IndexByte(s.pending, '\n')
+		if i < 0 {
+			return nil
+		}
+		line := strings.TrimRight(string(s.pending[:i]), "\r")
+		s.pending = s.pending[i+1:]
+		if err := s.handleLine(line); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *anthropicStreamWriter) handleLine(line string) error {
+	if !strings.HasPrefix(line, "data:") || s.finished {
+		return nil
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "" {
+		return nil
+	}
+	if data == "[DONE]" {
+		return s.finish()
+	}
+
+	var chunk llmStreamChunk
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return nil
+	}
+	if len(chunk.Choices) == 0 && len(chunk.Usage) == 0 && strings.Contains(data, `"error"`) {
+		// 部分上游在流中途以 data 行返回错误
+		return s.fail(upstreamErrorMessage(http.StatusOK, []byte(data)))
+	}
+	return s.handleChunk(&chunk)
+}
+
+func (s *anthropicStreamWriter) handleChunk(chunk *llmStreamChunk) error {
+	if !s.started {
+		if err := s.start(chunk.ID); err != nil {
+			return err
+		}
+	}
+	if len(chunk.Usage) > 0 {
+		var usage llmUsage
+		if err := json.Unmarshal(chunk.Usage, &usage); err == nil {
+			s.usage = anthropicUsage{InputTokens: usage.PromptTokens, OutputTokens: usage.CompletionTokens}
+		}
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if content := choice.Delta.Content; content != nil && *content != "" {
+			if s.openType != "text" {
+				empty := ""
+				if err := s.openBlock(&anthropicBlock{Type: "text", Text: &empty}); err != nil {
+					return err
+				}
+			}
+			if err := s.emitDelta(anthropicBlockDelta{Type: "text_delta", Text: *content}); err != nil {
+				return err
+			}
+		}
+		for _, call := range choice.Delta.ToolCalls {
+			if s.openType != "tool_use" || s.openTool != call.Index || (call.ID != "" && call.ID != s.openToolID) {
+				block := &anthropicBlock{
+					Type:  "tool_use",
+					ID:    anthropicToolUseID(call.ID),
+					Name:  call.Function.Name,
+					Input: json.RawMessage("{}"),
+				}
+				if err := s.openBlock(block); err != nil {
+					return err
+				}
+				s.openTool, s.openToolID, s.sawTool = call.Index, call.ID, true
+			}
+			if call.Function.Arguments != "" {
+				if err := s.emitDelta(anthropicBlockDelta{Type: "input_json_delta", PartialJSON: call.Function.Arguments}); err != nil {
+					return err
+				}
+			}
+		}
+		if choice.FinishReason != nil {
+			s.stopReason = anthropicStopReason(choice.FinishReason, s.sawTool)
+		}
+	}
+	return nil
+}
+
+func (s *anthropicStreamWriter) start(id string) error {
+	s.started = true
+	return s.emit("message_start", anthropicStreamEvent{
+		Type: "message_start",
+		Message: &anthropicResponse{
+			ID:      anthropicMessageID(id),
+			Type:    "message",
+			Role:    "assistant",
+			Model:   s.model,
+			Content: []anthropicContentBlock{},
+		},
+	})
+}
+
+func (s *anthropicStreamWriter) openBlock(block *anthropicBlock) error {
+	if err := s.closeBlock(); err != nil {
+		return err
+	}
+	s.openType = block.Type
+	index := s.nextIndex
+	return s.emit("content_block_start", anthropicStreamEvent{Type: "content_block_start", Index: &index, ContentBlock: block})
+}
+
+func (s *anthropicStreamWriter) closeBlock() error {
+	if s.openType == "" {
+		return nil
+	}
+	s.openType = ""
+	index := s.nextIndex
+	s.nextIndex++
+	return s.emit("content_block_stop", anthropicStreamEvent{Type: "content_block_stop", Index: &index})
+}
+
+func (s *anthropicStreamWriter) emitDelta(delta anthropicBlockDelta) error {
+	index := s.nextIndex
+	return s.emit("content_block_delta", anthropicStreamEvent{Type: "content_block_delta", Index: &index, Delta: delta})
+}
+
+// finish 在收到 [DONE] 时结束消息
+func (s *anthropicStreamWriter) finish() error {
+	if s.finished {
+		return nil
+	}
+	if !s.started {
+		if err := s.start(""); err != nil {
+			return err
+		}
+	}
+	if err := s.closeBlock(); err != nil {
+		return err
+	}
+	s.finished = true
+	stopReason := s.stopReason
+	if stopReason == "" {
+		stopReason = anthropicStopReason(nil, s.sawTool)
+	}
+	if err := s.emit("message_delta", anthropicStreamEvent{
+		Type:  "message_delta",
+		Delta: anthropicMessageDelta{StopReason: stopReason},
+		Usage: &s.usage,
+	}); err != nil {
+		return err
+	}
+	return s.emit("message_stop", anthropicStreamEvent{Type: "message_stop"})
+}
+
+// fail 以 error 事件结束流
+func (s *anthropicStreamWriter) fail(message string) error {
+	s.finished = true
+	return s.emit("error", anthropicError{
+		Type:  "error",
+		Error: anthropicErrorDetail{Type: anthropicErrorType(http.StatusBadGateway), Message: message},
+	})
+}
+
+// Close 在上游响应结束后调用：未收到 [DONE] 但已收到 finish_reason 时正常结束，否则返回 error 事件
+func (s *anthropicStreamWriter) Close() {
+	if s.finished {
+		return
+	}
+	var err error
+	if s.stopReason != "" {
+		err = s.finish()
+	} else {
+		err = s.fail("upstream stream ended unexpectedly")
+	}
+	if err != nil {
+		logger.Debug("messages-api: failed to finish stream", zap.Error(err))
+	}
+}
+
+func (s *anthropicStreamWriter) emit(event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
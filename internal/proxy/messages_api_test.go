@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-llm-server/internal/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files under testdata")
+
+// checkGolden 比较输出与 golden 文件，-update 时重写 golden 文件
+func checkGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(path, got, 0o644))
+		return
+	}
+	want, err := os.ReadFile(path)
+	require.NoError(t, err, "run go test -update to create %s", path)
+	require.Equal(t, string(want), string(got))
+}
+
+// goldenCases 返回 testdata 下 dir 目录中以 suffix 结尾的用例名与输入
+func goldenCases(t *testing.T, dir, suffix string) map[string][]byte {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", dir, "*"+suffix))
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+	cases := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		cases[strings.TrimSuffix(path, suffix)] = data
+	}
+	return cases
+}
+
+func marshalGolden(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.MarshalIndent(v, "", "  ")
+	require.NoError(t, err)
+	return append(data, '\n')
+}
+
+func TestMessagesAPI_RequestGolden(t *testing.T) {
+	for name, input := range goldenCases(t, "messages", ".request.json") {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			var req anthropicRequest
+			require.NoError(t, json.Unmarshal(input, &req))
+			chat, err := anthropicToChatRequest(&req)
+			require.NoError(t, err)
+			checkGolden(t, name+".openai.json", marshalGolden(t, chat))
+		})
+	}
+}
+
+func TestMessagesAPI_ResponseGolden(t *testing.T) {
+	for name, input := range goldenCases(t, "messages", ".completion.json") {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			resp, err := chatToAnthropicResponse(input, "claude-sonnet-4")
+			require.NoError(t, err)
+			checkGolden(t, name+".message.json", marshalGolden(t, resp))
+		})
+	}
+}
+
+func TestMessagesAPI_StreamGolden(t *testing.T) {
+	for name, input := range goldenCases(t, "messages", ".stream.txt") {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			var out bytes.Buffer
+			stream := newAnthropicStreamWriter(&out, "claude-sonnet-4")
+			// 按任意位置切分输入，覆盖不完整行的缓冲
+			for len(input) > 0 {
+				n := min(7, len(input))
+				require.NoError(t, stream.Write(input[:n]))
+				input = input[n:]
+			}
+			stream.Close()
+			checkGolden(t, name+".events.txt", out.Bytes())
+		})
+	}
+}
+
+func TestAnthropicToChatRequest_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"missing model", `{"messages":[{"role":"user","content":"hi"}]}`, "model"},
+		{"no messages", `{"model":"m","messages":[]}`, "messages"},
+		{"bad role", `{"model":"m","messages":[{"role":"system","content":"hi"}]}`, `unsupported role "system"`},
+		{"unknown block", `{"model":"m","messages":[{"role":"user","content":[{"type":"document"}]}]}`, `unsupported content block type "document"`},
+		{"bad tool choice", `{"model":"m","messages":[{"role":"user","content":"hi"}],"tool_choice":{"type":"x"}}`, "tool_choice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req anthropicRequest
+			require.NoError(t, json.Unmarshal([]byte(tt.body), &req))
+			_, err := anthropicToChatRequest(&req)
+			require.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func newMessagesTestConfig(upstreamURL string) *config.Config {
+	return &config.Config{
+		TargetMap:   map[string]string{"/chat/completions": upstreamURL},
+		MessagesAPI: config.MessagesAPIConfig{Path: "/v1/messages"},
+	}
+}
+
+func TestMessagesAPI_ProxiesThroughChatCompletions(t *testing.T) {
+	var received map[string]interface{}
+	var auth string
+	handler := newUpstreamTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/chat/completions", r.URL.Path)
+		auth = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &received)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Hi there"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`))
+	}, newMessagesTestConfig)
+
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"claude-sonnet-4","max_tokens":16,"system":"Be brief.","messages":[{"role":"user","content":"Hello"}]}`))
+	req.Header.Set("x-api-key", "sk-test")
+	req.Header.Set("anthropic-version", "2023-06-01")
+	handler.ServeHTTP(resp, req)
+
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	require.Equal(t, "Bearer sk-test", auth)
+	require.Equal(t, "claude-sonnet-4", received["model"])
+	require.Len(t, received["messages"], 2)
+	require.JSONEq(t, `{"id":"msg_chatcmpl-1","type":"message","role":"assistant","model":"claude-sonnet-4",
+		"content":[{"type":"text","text":"Hi there"}],"stop_reason":"end_turn","stop_sequence":null,
+		"usage":{"input_tokens":3,"output_tokens":2}}`, resp.Body.String())
+}
+
+func TestMessagesAPI_Stream(t *testing.T) {
+	stream, err := os.ReadFile(filepath.Join("testdata", "messages", "text.stream.txt"))
+	require.NoError(t, err)
+	events, err := os.ReadFile(filepath.Join("testdata", "messages", "text.events.txt"))
+	require.NoError(t, err)
+
+	var received map[string]interface{}
+	handler := newUpstreamTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &received)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write(stream)
+	}, newMessagesTestConfig)
+
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages",
+		strings.NewReader(`{"model":"claude-sonnet-4","max_tokens":16,"stream":true,"messages":[{"role":"user","content":"Hello"}]}`))
+	handler.ServeHTTP(resp, req)
+
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, map[string]interface{}{"include_usage": true}, received["stream_options"])
+	require.Equal(t, "text/event-stream", resp.Header().Get("Content-Type"))
+	require.Equal(t, string(events), resp.Body.String())
+}
+
+func TestMessagesAPI_Errors(t *testing.T) {
+	handler := newUpstreamTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		writeOpenAIError(w, http.StatusTooManyRequests, "rate_limit_exceeded", "", "Slow down")
+	}, newMessagesTestConfig)
+
+	send := func(method, body string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, httptest.NewRequest(method, "/v1/messages", strings.NewReader(body)))
+		return resp
+	}
+
+	resp := send(http.MethodPost, `{"model":"claude-sonnet-4","messages":[{"role":"user","content":"Hello"}]}`)
+	require.Equal(t, http.StatusTooManyRequests, resp.Code)
+	require.JSONEq(t, `{"type":"error","error":{"type":"rate_limit_error","message":"Slow down"}}`, resp.Body.String())
+
+	resp = send(http.MethodPost, `{"model":"claude-sonnet-4","messages":[]}`)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	require.Contains(t, resp.Body.String(), `"invalid_request_error"`)
+
+	resp = send(http.MethodGet, "")
+	require.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+}
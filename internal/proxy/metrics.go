@@ -0,0 +1,228 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-llm-server/pkg/metrics"
+	cache "go-llm-server/pkg/redis"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const defaultMetricsPath = "/metrics"
+
+// proxyMetrics 代理、缓存与上游的 Prometheus 指标，方法均可在 nil 上安全调用
+type proxyMetrics struct {
+	registry *metrics.Registry
+
+	requests         *metrics.CounterVec
+	requestDuration  *metrics.HistogramVec
+	upstreamRequests *metrics.CounterVec
+	upstreamDuration *metrics.HistogramVec
+	cacheResults     *metrics.CounterVec
+	tokens           *metrics.CounterVec
+	lbSelections     *metrics.CounterVec
+	rateLimited      *metrics.CounterVec
+}
+
+func newProxyMetrics() *proxyMetrics {
+	reg := metrics.NewRegistry()
+	return &proxyMetrics{
+		registry: reg,
+		requests: reg.NewCounterVec("llm_proxy_requests_total",
+			"Requests handled by the proxy.", "path", "model", "upstream", "status"),
+		requestDuration: reg.NewHistogramVec("llm_proxy_request_duration_seconds",
+			"End-to-end request latency including streaming the response.", metrics.DefaultBuckets,
+			"path", "model", "upstream", "status"),
+		upstreamRequests: reg.NewCounterVec("llm_proxy_upstream_requests_total",
+			"Upstream attempts including retries and fallbacks.", "upstream", "status"),
+		upstreamDuration: reg.NewHistogramVec("llm_proxy_upstream_response_seconds",
+			"Time until upstream response headers arrive.", metrics.DefaultBuckets, "upstream"),
+		cacheResults: reg.NewCounterVec("llm_proxy_cache_requests_total",
+			"Cache lookups by X-LLM-Cache / X-Embedding-Cache result.", "cache", "result"),
+		tokens: reg.NewCounterVec("llm_proxy_tokens_total",
+			"Tokens reported in upstream usage blocks.", "model", "type"),
+		lbSelections: reg.NewCounterVec("llm_proxy_lb_selections_total",
+			"Load balancer URL selections.", "model", "upstream"),
+		rateLimited: reg.NewCounterVec("llm_proxy_rate_limited_total",
+			"Requests rejected by rate limits and quotas.", "limiter"),
+	}
+}
+
+// registerPoolStats 在采集时读取 Postgres 与 Redis 连接池状态
+func (m *proxyMetrics) registerPoolStats(pg *pgxpool.Pool, redisClient *cache.Redis) {
+	if m == nil || (pg == nil && redisClient == nil) {
+		return
+	}
+	m.registry.NewGaugeFunc("llm_proxy_pool_connections",
+		"Connection pool connections by state.", []string{"pool", "state"},
+		func(emit func(float64, ...string)) {
+			if pg != nil {
+				stat := pg.Stat()
+				emit(float64(stat.TotalConns()), "postgres", "total")
+				emit(float64(stat.IdleConns()), "postgres", "idle")
+				emit(float64(stat.AcquiredConns()), "postgres", "acquired")
+				emit(float64(stat.MaxConns()), "postgres", "max")
+			}
+			if redisClient != nil {
+				stat := redisClient.PoolStats()
+				emit(float64(stat.TotalConns), "redis", "total")
+				emit(float64(stat.IdleConns), "redis", "idle")
+			}
+		})
+	m.registry.NewCounterFunc("llm_proxy_pool_events_total",
+		"Connection pool events.", []string{"pool", "event"},
+		func(emit func(float64, ...string)) {
+			if pg != nil {
+				stat := pg.Stat()
+				emit(float64(stat.AcquireCount()), "postgres", "acquire")
+				emit(float64(stat.EmptyAcquireCount()), "postgres", "empty_acquire")
+				emit(float64(stat.CanceledAcquireCount()), "postgres", "canceled_acquire")
+			}
+			if redisClient != nil {
+				stat := redisClient.PoolStats()
+				emit(float64(stat.Hits), "redis", "hit")
+				emit(float64(stat.Misses), "redis", "miss")
+				emit(float64(stat.Timeouts), "redis", "timeout")
+			}
+		})
+}
+
+func (m *proxyMetrics) observeRequest(path, model, upstream string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(path, model, upstream, code).Inc()
+	m.requestDuration.WithLabelValues(path, model, upstream, code).Observe(duration.Seconds())
+}
+
+// ObserveUpstream 作为传输层观察者记录每次上游尝试
+func (m *proxyMetrics) ObserveUpstream(target string, statusCode int, err error, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	status := strconv.Itoa(statusCode)
+	if err != nil {
+		status = "error"
+	}
+	m.upstreamRequests.WithLabelValues(target, status).Inc()
+	m.upstreamDuration.WithLabelValues(target).Observe(duration.Seconds())
+}
+
+// observeCache 根据响应头记录缓存结果（HIT/MISS/PARTIAL/BYPASS）
+func (m *proxyMetrics) observeCache(header http.Header) {
+	if m == nil {
+		return
+	}
+	if result := header.Get("X-LLM-Cache"); result != "" {
+		m.cacheResults.WithLabelValues("llm", strings.ToLower(result)).Inc()
+	}
+	if result := header.Get("X-Embedding-Cache"); result != "" {
+		m.cacheResults.WithLabelValues("embedding", strings.ToLower(result)).Inc()
+	}
+}
+
+func (m *proxyMetrics) observeUsage(model string, usage *llmUsage) {
+	if m == nil {
+		return
+	}
+	m.tokens.WithLabelValues(model, "prompt").Add(float64(usage.PromptTokens))
+	m.tokens.WithLabelValues(model, "completion").Add(float64(usage.CompletionTokens))
+}
+
+func (m *proxyMetrics) observeSelection(model, upstream string) {
+	if m == nil {
+		return
+	}
+	m.lbSelections.WithLabelValues(model, upstream).Inc()
+}
+
+func (m *proxyMetrics) observeRateLimited(limiter string) {
+	if m == nil {
+		return
+	}
+	m.rateLimited.WithLabelValues(limiter).Inc()
+}
+
+// serveMetrics 处理 /metrics 请求，返回 true 表示请求已处理；显式配置的代理路径优先
+func (h *Handler) serveMetrics(w http.ResponseWriter, r *http.Request) bool {
+	if h.metrics == nil || r.URL.Path != h.metricsPath() {
+		return false
+	}
+	if _, ok := h.cfg.TargetMap[r.URL.Path]; ok {
+		return false
+	}
+	h.metrics.registry.Handler().ServeHTTP(w, r)
+	return true
+}
+
+func (h *Handler) metricsPath() string {
+	if h.cfg != nil && h.cfg.Metrics.Path != "" {
+		return h.cfg.Metrics.Path
+	}
+	return defaultMetricsPath
+}
+
+// metricsPathLabel 使用命中的 target_map 路径规则或模型列表路径作为标签值，避免任意路径导致标签基数膨胀
+func (h *Handler) metricsPathLabel(path string) string {
+	if _, ok := h.modelsAPIRequest(path); ok {
+		return h.cfg.ModelsAPI.Path
+	}
+	if _, ok := h.responsesAPIRequest(path); ok {
+		return h.cfg.ResponsesAPI.Path
+	}
+	if target, ok := h.router.Match(path); ok {
+		return target.Key
+	}
+	return "other"
+}
+
+// metricsModelLabel 只使用已配置路由或别名的模型作为标签值，返回别名解析后的模型名
+func (h *Handler) metricsModelLabel(model string) string {
+	if model == "" {
+		return ""
+	}
+	resolved := h.cfg.ResolveModel(model)
+	if _, ok := h.cfg.ModelRoutes[resolved]; ok {
+		return resolved
+	}
+	return "other"
+}
+
+// statusRecorder 记录写出的状态码，保留流式响应需要的 Flush
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// statusCode 返回写出的状态码，未写出任何内容时按 net/http 的行为视为 200
+func (w *statusRecorder) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-llm-server/internal/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func scrapeMetrics(t *testing.T, handler *Handler) string {
+	t.Helper()
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.True(t, strings.HasPrefix(resp.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+	return resp.Body.String()
+}
+
+func TestMetrics_ProxiedRequest(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`))
+	}))
+	defer upstream.Close()
+
+	handler := NewHandler(&config.Config{
+		TargetMap:   map[string]string{"/chat/completions": upstream.URL},
+		ModelRoutes: map[string]interface{}{"gpt-4": upstream.URL},
+		ModelAlias:  map[string]string{"my-gpt": "gpt-4"},
+		Metrics:     config.MetricsConfig{Enabled: true},
+	})
+	handler.InitLoadBalancers()
+	defer handler.health.Stop()
+
+	for _, model := range []string{"my-gpt", "unknown-model"} {
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/chat/completions",
+			strings.NewReader(`{"model":"`+model+`","messages":[{"role":"user","content":"hi"}]}`))
+		handler.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+		_, _ = io.ReadAll(resp.Body)
+	}
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	require.Equal(t, http.StatusNotFound, resp.Code)
+
+	body := scrapeMetrics(t, handler)
+	for _, line := range []string{
+		`llm_proxy_requests_total{path="/chat/completions",model="gpt-4",upstream="` + upstream.URL + `",status="200"} 1`,
+		`llm_proxy_requests_total{path="/chat/completions",model="other",upstream="",status="200"} 1`,
+		`llm_proxy_requests_total{path="other",model="",upstream="",status="404"} 1`,
+		`llm_proxy_request_duration_seconds_count{path="/chat/completions",model="gpt-4",upstream="` + upstream.URL + `",status="200"} 1`,
+		`llm_proxy_upstream_requests_total{upstream="` + upstream.URL + `",status="200"} 1`,
+		`llm_proxy_lb_selections_total{model="gpt-4",upstream="` + upstream.URL + `"} 1`,
+		`llm_proxy_tokens_total{model="gpt-4",type="prompt"} 3`,
+		`llm_proxy_tokens_total{model="gpt-4",type="completion"} 2`,
+		"# TYPE llm_proxy_request_duration_seconds histogram",
+	} {
+		require.Contains(t, body, line+"\n")
+	}
+}
+
+func TestMetrics_RateLimitedAndCache(t *testing.T) {
+	m := newProxyMetrics()
+	handler := &Handler{
+		cfg:     &config.Config{},
+		limiter: &fakeRateLimiter{result: RateLimitResult{Limit: 1}},
+		metrics: m,
+	}
+	require.False(t, handler.allowRequest(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/chat/completions", nil)))
+
+	m.observeCache(http.Header{"X-Llm-Cache": []string{"HIT"}})
+	m.observeCache(http.Header{"X-Embedding-Cache": []string{"PARTIAL"}})
+
+	body := scrapeMetrics(t, handler)
+	require.Contains(t, body, `llm_proxy_rate_limited_total{limiter="requests"} 1`+"\n")
+	require.Contains(t, body, `llm_proxy_cache_requests_total{cache="llm",result="hit"} 1`+"\n")
+	require.Contains(t, body, `llm_proxy_cache_requests_total{cache="embedding",result="partial"} 1`+"\n")
+}
+
+func TestMetrics_Disabled(t *testing.T) {
+	handler := newLLMTestHandler(nil)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusNotFound, resp.Code)
+
+	// nil 指标上的调用不会 panic
+	var m *proxyMetrics
+	m.observeRateLimited("requests")
+	m.ObserveUpstream("http://a", 200, nil, 0)
+}
+
+func TestStatusRecorder(t *testing.T) {
+	rec := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+	require.Equal(t, http.StatusOK, rec.statusCode())
+	rec.WriteHeader(http.StatusTeapot)
+	_, _ = rec.Write([]byte("x"))
+	require.Equal(t, http.StatusTeapot, rec.statusCode())
+	var _ http.Flusher = rec
+}
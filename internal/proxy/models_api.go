@@ -0,0 +1,356 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultModelsCacheTTL = 5 * time.Minute
+	defaultModelsTimeout  = 5 * time.Second
+	// defaultModelOwner 未配置也未从上游获取到 owned_by 时使用的值
+	defaultModelOwner = "system"
+)
+
+// modelObject OpenAI 格式的模型信息；provider、context_length 与 alias_for 是代理补充的字段
+type modelObject struct {
+	ID            string `json:"id"`
+	Object        string `json:"object"`
+	Created       int64  `json:"created"`
+	OwnedBy       string `json:"owned_by"`
+	Provider      string `json:"provider,omitempty"`
+	ContextLength int    `json:"context_length,omitempty"`
+	AliasFor      string `json:"alias_for,omitempty"`
+}
+
+type modelListResponse struct {
+	Object string        `json:"object"`
+	Data   []modelObject `json:"data"`
+}
+
+// modelSource 需要拉取 /models 的上游
+type modelSource struct {
+	baseURL     string
+	credentials config.UpstreamCredentials
+	// models 只采用这些模型的信息（补充 created、owned_by 等）；为 nil 时为默认上游，列出的模型全部可用
+	models map[string]bool
+	listed map[string]modelObject // 上次成功拉取的结果
+}
+
+// modelCatalog 由 model_routes 与 model_aliases 生成模型列表，按需拉取并缓存各上游的模型列表
+type modelCatalog struct {
+	cfg     *config.Config
+	sources []*modelSource
+	client  *http.Client
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu        sync.Mutex
+	fetchedAt time.Time
+	// refreshing 非 nil 表示正在拉取上游，拉取完成后关闭；同一时间只有一次拉取
+	refreshing chan struct{}
+}
+
+// newModelCatalog 未配置 models_api.path 时返回 nil
+func newModelCatalog(cfg *config.Config) *modelCatalog {
+	if cfg == nil || cfg.ModelsAPI.Path == "" {
+		return nil
+	}
+	c := &modelCatalog{cfg: cfg, ttl: defaultModelsCacheTTL, now: time.Now}
+	if cfg.ModelsAPI.CacheTTL > 0 {
+		c.ttl = time.Duration(cfg.ModelsAPI.CacheTTL) * time.Second
+	}
+	if cfg.ModelsAPI.Upstream {
+		c.sources = modelSources(cfg)
+		timeout := defaultModelsTimeout
+		if cfg.ModelsAPI.Timeout > 0 {
+			timeout = time.Duration(cfg.ModelsAPI.Timeout) * time.Second
+		}
+		c.client = &http.Client{Transport: &TransportWithProxyAutoDetected{}, Timeout: timeout}
+	}
+	return c
+}
+
+// modelSources 按 baseURL 合并需要拉取的上游：OpenAI 兼容的模型路由取第一个 URL，
+// 另加 chat_path 对应的默认上游。其他 provider 的模型列表接口格式不同，不拉取
+func modelSources(cfg *config.Config) []*modelSource {
+	byURL := make(map[string]*modelSource)
+	var sources []*modelSource
+	add := func(baseURL string, creds config.UpstreamCredentials) *modelSource {
+		source, ok := byURL[baseURL]
+		if !ok {
+			source = &modelSource{baseURL: baseURL, models: make(map[string]bool)}
+			byURL[baseURL] = source
+			sources = append(sources, source)
+		}
+		if !source.credentials.Configured() {
+			source.credentials = creds
+		}
+		return source
+	}
+
+	models := make([]string, 0, len(cfg.ModelRoutes))
+	for model := range cfg.ModelRoutes {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		route, ok := cfg.GetModelRoute(model)
+		if !ok || len(route.URLs) == 0 || (route.Provider != "" && route.Provider != config.ProviderOpenAI) {
+			continue
+		}
+		if source := add(route.URLs[0], route.Credentials); source.models != nil {
+			source.models[model] = true
+		}
+	}
+	router, _ := config.NewTargetRouter(cfg)
+	if target, ok := router.Match(cfg.ModelsAPI.ChatPathOrDefault()); ok {
+		add(target.URL, cfg.TargetAuth[target.Key]).models = nil
+	}
+	return sources
+}
+
+// list 返回按 ID 排序的全部模型
+func (c *modelCatalog) list(ctx context.Context) []modelObject {
+	upstream, routable := c.upstreamModels(ctx)
+
+	byID := make(map[string]modelObject)
+	for model := range c.cfg.ModelRoutes {
+		route, _ := c.cfg.GetModelRoute(model)
+		obj := modelObject{
+			ID:            model,
+			Object:        "model",
+			OwnedBy:       route.OwnedBy,
+			Provider:      route.Provider,
+			ContextLength: route.ContextLength,
+		}
+		if listed, ok := upstream[model]; ok {
+			obj.Created = listed.Created
+			if obj.OwnedBy == "" {
+				obj.OwnedBy = listed.OwnedBy
+			}
+			if obj.ContextLength == 0 {
+				obj.ContextLength = listed.ContextLength
+			}
+		}
+		byID[model] = obj
+	}
+	for _, listed := range routable {
+		if _, ok := byID[listed.ID]; !ok {
+			byID[listed.ID] = modelObject{
+				ID:            listed.ID,
+				Object:        "model",
+				Created:       listed.Created,
+				OwnedBy:       listed.OwnedBy,
+				ContextLength: listed.ContextLength,
+			}
+		}
+	}
+	for alias, target := range c.cfg.ModelAlias {
+		obj, ok := byID[target]
+		if !ok {
+			obj = modelObject{Object: "model"}
+		}
+		obj.ID = alias
+		obj.AliasFor = target
+		byID[alias] = obj
+	}
+
+	models := make([]modelObject, 0, len(byID))
+	for _, obj := range byID {
+		if obj.OwnedBy == "" {
+			obj.OwnedBy = defaultModelOwner
+		}
+		if obj.Provider == "" {
+			obj.Provider = config.ProviderOpenAI
+		}
+		models = append(models, obj)
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].ID < models[j].ID })
+	return models
+}
+
+// upstreamModels 返回各上游列出的模型信息，routable 为默认上游列出的模型。
+// 缓存过期后在后台重新拉取并先返回旧的结果，拉取失败的上游沿用上次的结果；
+// 只有首次拉取时等待结果
+func (c *modelCatalog) upstreamModels(ctx context.Context) (upstream map[string]modelObject, routable []modelObject) {
+	if len(c.sources) == 0 {
+		return nil, nil
+	}
+	c.mu.Lock()
+	loaded := !c.fetchedAt.IsZero()
+	if (!loaded || c.now().Sub(c.fetchedAt) >= c.ttl) && c.refreshing == nil {
+		c.refreshing = make(chan struct{})
+		// 不随客户端请求取消，避免一次中断的请求让缓存变空
+		go c.refresh(context.WithoutCancel(ctx), c.refreshing)
+	}
+	refreshing := c.refreshing
+	c.mu.Unlock()
+
+	if !loaded {
+		select {
+		case <-refreshing:
+		case <-ctx.Done():
+			return nil, nil
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	upstream = make(map[string]modelObject)
+	for _, source := range c.sources {
+		for id, obj := range source.listed {
+			if source.models == nil {
+				routable = append(routable, obj)
+			} else if !source.models[id] {
+				continue
+			}
+			upstream[id] = obj
+		}
+	}
+	return upstream, routable
+}
+
+// refresh 并发拉取各上游的模型列表，拉取期间不持有锁，完成后关闭 done
+func (c *modelCatalog) refresh(ctx context.Context, done chan struct{}) {
+	listed := make([]map[string]modelObject, len(c.sources))
+	var wg sync.WaitGroup
+	for i, source := range c.sources {
+		wg.Add(1)
+		go func(i int, source *modelSource) {
+			defer wg.Done()
+			models, err := c.fetch(ctx, source)
+			if err != nil {
+				logger.Warn("Failed to list upstream models",
+					zap.String("upstream", source.baseURL),
+					zap.Error(err))
+				return
+			}
+			listed[i] = models
+		}(i, source)
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	for i, source := range c.sources {
+		if listed[i] != nil {
+			source.listed = listed[i]
+		}
+	}
+	c.fetchedAt = c.now()
+	c.refreshing = nil
+	c.mu.Unlock()
+	close(done)
+}
+
+// fetch 请求上游的 /models，使用配置的第一个上游 key
+func (c *modelCatalog) fetch(ctx context.Context, source *modelSource) (map[string]modelObject, error) {
+	target, err := utils.GetTargetURLWithCache(source.baseURL, "/models")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Request-ID", "models-list")
+	if source.credentials.Configured() {
+		setUpstreamAuth(req.Header, source.credentials.AuthType, source.credentials.APIKeys[0])
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, upstreamErrorMessage(resp.StatusCode, body))
+	}
+	var list struct {
+		Data []modelObject `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("invalid model list: %w", err)
+	}
+	listed := make(map[string]modelObject, len(list.Data))
+	for _, obj := range list.Data {
+		if obj.ID != "" {
+			listed[obj.ID] = obj
+		}
+	}
+	return listed, nil
+}
+
+// modelsAPIRequest 判断路径是否为 <path> 或 <path>/{model}，返回其中的模型名；显式配置的代理路径优先
+func (h *Handler) modelsAPIRequest(path string) (id string, ok bool) {
+	if h.models == nil {
+		return "", false
+	}
+	if _, ok := h.cfg.TargetMap[path]; ok {
+		return "", false
+	}
+	if path == h.cfg.ModelsAPI.Path {
+		return "", true
+	}
+	// 模型名可能包含 /，如 Qwen/Qwen2.5-7B-Instruct
+	id, ok = strings.CutPrefix(path, strings.TrimSuffix(h.cfg.ModelsAPI.Path, "/")+"/")
+	return id, ok && id != ""
+}
+
+// serveModelsAPI 处理 GET <path> 与 GET <path>/{model}，返回客户端可以使用的模型。
+// 在全局限流之后处理，与代理请求一样计入指标与追踪。返回 true 表示请求已处理
+func (h *Handler) serveModelsAPI(w http.ResponseWriter, r *http.Request) bool {
+	id, ok := h.modelsAPIRequest(r.URL.Path)
+	if !ok {
+		return false
+	}
+	if r.Method != http.MethodGet {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "", "Method not allowed")
+		return true
+	}
+
+	r, ok = h.authenticate(w, r)
+	if !ok {
+		return true
+	}
+	models := h.models.list(r.Context())
+	if rec := apiKeyFromContext(r.Context()); rec != nil && len(rec.AllowedModels) > 0 {
+		allowed := models[:0]
+		for _, obj := range models {
+			if h.modelAllowed(rec.AllowedModels, obj.ID) {
+				allowed = append(allowed, obj)
+			}
+		}
+		models = allowed
+	}
+
+	if id == "" {
+		writeJSON(w, http.StatusOK, modelListResponse{Object: "list", Data: models})
+		return true
+	}
+	for _, obj := range models {
+		if obj.ID == id {
+			writeJSON(w, http.StatusOK, obj)
+			return true
+		}
+	}
+	writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "model_not_found",
+		fmt.Sprintf("The model '%s' does not exist or you do not have access to it.", id))
+	return true
+}
@@ -0,0 +1,218 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newModelsTestConfig(upstream string) *config.Config {
+	return &config.Config{
+		TargetMap: map[string]string{"/chat/completions": upstream + "/default"},
+		ModelRoutes: map[string]interface{}{
+			"gpt-4o": map[string]interface{}{
+				"urls":    []interface{}{upstream + "/openai"},
+				"api_key": "sk-openai",
+			},
+			"claude-sonnet-4": map[string]interface{}{
+				"urls":           []interface{}{"https://api.anthropic.com/v1"},
+				"provider":       "anthropic",
+				"owned_by":       "anthropic",
+				"context_length": 200000,
+			},
+		},
+		ModelAlias: map[string]string{"smart": "claude-sonnet-4"},
+		ModelsAPI:  config.ModelsAPIConfig{Path: "/v1/models"},
+	}
+}
+
+func listModels(t *testing.T, handler *Handler, key string) []modelObject {
+	t.Helper()
+	resp := sendAPIRequest(handler, http.MethodGet, "/v1/models", key, "")
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var list modelListResponse
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &list))
+	require.Equal(t, "list", list.Object)
+	return list.Data
+}
+
+func TestModelsAPI_FromConfig(t *testing.T) {
+	handler := &Handler{cfg: newModelsTestConfig("https://upstream.example.com")}
+	handler.models = newModelCatalog(handler.cfg)
+
+	require.Equal(t, []modelObject{
+		{ID: "claude-sonnet-4", Object: "model", OwnedBy: "anthropic", Provider: "anthropic", ContextLength: 200000},
+		{ID: "gpt-4o", Object: "model", OwnedBy: "system", Provider: "openai"},
+		{ID: "smart", Object: "model", OwnedBy: "anthropic", Provider: "anthropic", ContextLength: 200000, AliasFor: "claude-sonnet-4"},
+	}, listModels(t, handler, ""))
+
+	resp := sendAPIRequest(handler, http.MethodGet, "/v1/models/smart", "", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `{"id":"smart","object":"model","created":0,"owned_by":"anthropic","provider":"anthropic",
+		"context_length":200000,"alias_for":"claude-sonnet-4"}`, resp.Body.String())
+
+	resp = sendAPIRequest(handler, http.MethodGet, "/v1/models/gpt-5", "", "")
+	requireOpenAIError(t, resp, http.StatusNotFound, "model_not_found")
+	resp = sendAPIRequest(handler, http.MethodPost, "/v1/models", "", "")
+	require.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+}
+
+func TestModelsAPI_FiltersByAPIKey(t *testing.T) {
+	handler := &Handler{cfg: newModelsTestConfig("https://upstream.example.com")}
+	handler.cfg.Auth.Enabled = true
+	handler.models = newModelCatalog(handler.cfg)
+	handler.keys = newFakeAPIKeyStore(map[string]*db.APIKeyRecord{
+		"sk-all":    {ID: 1, Name: "all", Enabled: true},
+		"sk-claude": {ID: 2, Name: "claude", Enabled: true, AllowedModels: []string{"claude-sonnet-4"}},
+	})
+
+	require.Len(t, listModels(t, handler, "sk-all"), 3)
+	var ids []string
+	for _, obj := range listModels(t, handler, "sk-claude") {
+		ids = append(ids, obj.ID)
+	}
+	// 别名解析到允许的模型时同样可见
+	require.Equal(t, []string{"claude-sonnet-4", "smart"}, ids)
+
+	resp := sendAPIRequest(handler, http.MethodGet, "/v1/models/gpt-4o", "sk-claude", "")
+	requireOpenAIError(t, resp, http.StatusNotFound, "model_not_found")
+	resp = sendAPIRequest(handler, http.MethodGet, "/v1/models", "", "")
+	requireOpenAIError(t, resp, http.StatusUnauthorized, "invalid_api_key")
+}
+
+func TestModelsAPI_MergesUpstreamListings(t *testing.T) {
+	var calls atomic.Int32
+	var auth atomic.Value
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/openai/models":
+			auth.Store(r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"object":"list","data":[
+				{"id":"gpt-4o","object":"model","created":1715367049,"owned_by":"openai"},
+				{"id":"gpt-4o-mini","object":"model","created":1721172741,"owned_by":"openai"}]}`))
+		case "/default/models":
+			_, _ = w.Write([]byte(`{"object":"list","data":[
+				{"id":"qwen-plus","object":"model","created":1700000000,"owned_by":"qwen","context_length":131072}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := newModelsTestConfig(server.URL)
+	cfg.ModelsAPI.Upstream = true
+	handler := &Handler{cfg: cfg, models: newModelCatalog(cfg)}
+	now := time.Unix(1700000000, 0)
+	handler.models.now = func() time.Time { return now }
+
+	models := listModels(t, handler, "")
+	require.Equal(t, "Bearer sk-openai", auth.Load())
+	require.Equal(t, []modelObject{
+		{ID: "claude-sonnet-4", Object: "model", OwnedBy: "anthropic", Provider: "anthropic", ContextLength: 200000},
+		// 模型路由的上游只补充已配置模型的信息，gpt-4o-mini 不会转发到该上游，不列出
+		{ID: "gpt-4o", Object: "model", Created: 1715367049, OwnedBy: "openai", Provider: "openai"},
+		{ID: "qwen-plus", Object: "model", Created: 1700000000, OwnedBy: "qwen", Provider: "openai", ContextLength: 131072},
+		{ID: "smart", Object: "model", OwnedBy: "anthropic", Provider: "anthropic", ContextLength: 200000, AliasFor: "claude-sonnet-4"},
+	}, models)
+	require.Equal(t, int32(2), calls.Load())
+
+	// 缓存有效期内不再请求上游
+	listModels(t, handler, "")
+	require.Equal(t, int32(2), calls.Load())
+
+	// 过期后在后台重新拉取并先返回旧的结果，失败的上游沿用上次的结果
+	failing.Store(true)
+	now = now.Add(defaultModelsCacheTTL)
+	require.Equal(t, models, listModels(t, handler, ""))
+	require.Eventually(t, func() bool {
+		handler.models.mu.Lock()
+		defer handler.models.mu.Unlock()
+		return handler.models.refreshing == nil && calls.Load() == 4
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, models, listModels(t, handler, ""))
+}
+
+func TestModelsAPI_SlowUpstreamServesStaleList(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	var blocking atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if blocking.Load() {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"object":"list","data":[{"id":"qwen-plus","object":"model","owned_by":"qwen"}]}`))
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	cfg := &config.Config{
+		TargetMap: map[string]string{"/chat/completions": server.URL},
+		ModelsAPI: config.ModelsAPIConfig{Path: "/v1/models", Upstream: true},
+	}
+	handler := &Handler{cfg: cfg, models: newModelCatalog(cfg)}
+	var now atomic.Int64
+	now.Store(1700000000)
+	handler.models.now = func() time.Time { return time.Unix(now.Load(), 0) }
+
+	models := listModels(t, handler, "")
+	require.Len(t, models, 1)
+	require.Equal(t, int32(1), calls.Load())
+
+	// 上游变慢后，过期的缓存在后台刷新，并发请求立即返回旧的结果且只触发一次拉取
+	blocking.Store(true)
+	now.Add(int64(defaultModelsCacheTTL / time.Second))
+	bodies := make([]string, 5)
+	var wg sync.WaitGroup
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bodies[i] = sendAPIRequest(handler, http.MethodGet, "/v1/models", "", "").Body.String()
+		}(i)
+	}
+	wg.Wait()
+	for _, body := range bodies {
+		require.Contains(t, body, `"id":"qwen-plus"`)
+	}
+	require.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, 5*time.Millisecond)
+	require.Equal(t, models, listModels(t, handler, ""))
+	require.Equal(t, int32(2), calls.Load())
+}
+
+func TestModelsAPI_RateLimited(t *testing.T) {
+	cfg := newModelsTestConfig("https://upstream.example.com")
+	cfg.RateLimit = config.RateLimitConfig{Rate: 1, Burst: 1}
+	handler := &Handler{cfg: cfg, models: newModelCatalog(cfg), limiter: newRateLimiter(cfg, nil)}
+
+	require.Equal(t, http.StatusOK, sendAPIRequest(handler, http.MethodGet, "/v1/models", "", "").Code)
+	resp := sendAPIRequest(handler, http.MethodGet, "/v1/models", "", "")
+	requireOpenAIError(t, resp, http.StatusTooManyRequests, "rate_limit_exceeded")
+	require.Equal(t, "/v1/models", handler.metricsPathLabel("/v1/models/gpt-4o"))
+}
+
+func TestModelsAPI_TargetMapTakesPrecedence(t *testing.T) {
+	cfg := newModelsTestConfig("https://upstream.example.com")
+	cfg.TargetMap["/v1/models"] = "https://upstream.example.com"
+	handler := &Handler{cfg: cfg, models: newModelCatalog(cfg)}
+	require.False(t, handler.serveModelsAPI(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/models", nil)))
+	require.True(t, handler.serveModelsAPI(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/models/gpt-4o", nil)))
+	require.False(t, handler.serveModelsAPI(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/modelsx", nil)))
+}
@@ -0,0 +1,26 @@
+package proxy
+
+import (
+	"net/http"
+)
+
+// openAIError OpenAI 风格的错误响应体
+type openAIError struct {
+	Error openAIErrorDetail `json:"error"`
+}
+
+type openAIErrorDetail struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    string  `json:"code"`
+}
+
+// writeOpenAIError 以 OpenAI 兼容格式返回错误，便于 SDK 正确解析
+func writeOpenAIError(w http.ResponseWriter, status int, errType, code, message string) {
+	writeJSON(w, status, openAIError{Error: openAIErrorDetail{
+		Message: message,
+		Type:    errType,
+		Code:    code,
+	}})
+}
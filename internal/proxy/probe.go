@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+
+	// readyCheckTimeout 单个依赖探测的超时，需小于探针自身的超时
+	readyCheckTimeout = 2 * time.Second
+
+	checkStatusOK       = "ok"
+	checkStatusFail     = "fail"
+	checkStatusDisabled = "disabled"
+)
+
+// dependencyPinger 就绪检查探测的外部依赖（Postgres、Redis）
+type dependencyPinger interface {
+	Ping(ctx context.Context) error
+}
+
+// dependencyCheck 单项检查结果
+type dependencyCheck struct {
+	Status    string      `json:"status"`
+	LatencyMs *int64      `json:"latency_ms,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// modelBackends 模型路由的后端健康统计
+type modelBackends struct {
+	Healthy int `json:"healthy"`
+	Total   int `json:"total"`
+}
+
+// serveProbe 处理 /healthz 与 /readyz，返回 true 表示请求已处理；显式配置的代理路径优先
+func (h *Handler) serveProbe(w http.ResponseWriter, r *http.Request) bool {
+	if r.URL.Path != healthzPath && r.URL.Path != readyzPath {
+		return false
+	}
+	if h.cfg != nil {
+		if _, ok := h.cfg.TargetMap[r.URL.Path]; ok {
+			return false
+		}
+	}
+	if r.URL.Path == healthzPath {
+		writeJSON(w, http.StatusOK, map[string]string{"status": checkStatusOK})
+		return true
+	}
+
+	checks := h.readinessChecks(r.Context())
+	status, code := checkStatusOK, http.StatusOK
+	for _, check := range checks {
+		if check.Status == checkStatusFail {
+			status, code = checkStatusFail, http.StatusServiceUnavailable
+			break
+		}
+	}
+	writeJSON(w, code, map[string]interface{}{"status": status, "checks": checks})
+	return true
+}
+
+// readinessChecks 检查配置、存储连通性与每个模型路由的后端健康状态
+func (h *Handler) readinessChecks(ctx context.Context) map[string]dependencyCheck {
+	checks := make(map[string]dependencyCheck)
+	if h.ShuttingDown() {
+		checks["shutdown"] = dependencyCheck{Status: checkStatusFail, Error: "server is shutting down"}
+	}
+
+	if h.cfg == nil || len(h.cfg.TargetMap) == 0 {
+		checks["config"] = dependencyCheck{Status: checkStatusFail, Error: "no target_map configured"}
+		return checks
+	}
+	checks["config"] = dependencyCheck{Status: checkStatusOK, Details: map[string]int{
+		"targets":      len(h.cfg.TargetMap),
+		"model_routes": len(h.cfg.ModelRoutes),
+	}}
+
+	// 存储初始化失败时缓存已关闭，不影响就绪
+	for _, name := range []string{"postgres", "redis"} {
+		pinger, ok := h.dependencies[name]
+		if !ok {
+			checks[name] = dependencyCheck{Status: checkStatusDisabled}
+			continue
+		}
+		checks[name] = pingDependency(ctx, pinger)
+	}
+
+	checks["upstreams"] = h.upstreamCheck()
+	return checks
+}
+
+func pingDependency(ctx context.Context, pinger dependencyPinger) dependencyCheck {
+	ctx, cancel := context.WithTimeout(ctx, readyCheckTimeout)
+	defer cancel()
+	startTime := time.Now()
+	err := pinger.Ping(ctx)
+	latency := time.Since(startTime).Milliseconds()
+	if err != nil {
+		return dependencyCheck{Status: checkStatusFail, LatencyMs: &latency, Error: err.Error()}
+	}
+	return dependencyCheck{Status: checkStatusOK, LatencyMs: &latency}
+}
+
+// upstreamCheck 要求每个模型路由至少有一个健康的后端
+func (h *Handler) upstreamCheck() dependencyCheck {
+	models := make([]string, 0, len(h.cfg.ModelRoutes))
+	for model := range h.cfg.ModelRoutes {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	details := make(map[string]modelBackends, len(models))
+	var unavailable []string
+	for _, model := range models {
+		urls, _ := h.cfg.GetModelURLs(model)
+		backends := modelBackends{Total: len(urls)}
+		for _, u := range urls {
+			if h.health.IsHealthy(u) {
+				backends.Healthy++
+			}
+		}
+		details[model] = backends
+		if backends.Healthy == 0 {
+			unavailable = append(unavailable, model)
+		}
+	}
+
+	check := dependencyCheck{Status: checkStatusOK, Details: details}
+	if len(unavailable) > 0 {
+		check.Status = checkStatusFail
+		check.Error = "no healthy backend for: " + strings.Join(unavailable, ", ")
+	}
+	return check
+}
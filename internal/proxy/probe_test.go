@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-llm-server/internal/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakePinger struct{ err error }
+
+func (f *fakePinger) Ping(context.Context) error { return f.err }
+
+func newProbeTestHandler() *Handler {
+	cfg := &config.Config{
+		TargetMap: map[string]string{"/chat/completions": "https://api.example.com/v1"},
+		ModelRoutes: map[string]interface{}{
+			"gpt-4": map[string]interface{}{"urls": []interface{}{"https://a.example.com/v1", "https://b.example.com/v1"}},
+		},
+		HealthCheck: config.HealthCheckConfig{MaxFailures: 1},
+	}
+	health := NewHealthChecker(cfg.HealthCheck)
+	health.Register("https://a.example.com/v1", "https://b.example.com/v1")
+	return &Handler{
+		cfg:    cfg,
+		health: health,
+		life:   &lifecycle{},
+		dependencies: map[string]dependencyPinger{
+			"postgres": &fakePinger{},
+			"redis":    &fakePinger{},
+		},
+	}
+}
+
+func probe(t *testing.T, handler *Handler, path string) (int, map[string]interface{}) {
+	t.Helper()
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, path, nil))
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	return resp.Code, body
+}
+
+func TestProbe_Healthz(t *testing.T) {
+	handler := newProbeTestHandler()
+	handler.dependencies["postgres"] = &fakePinger{err: errors.New("connection refused")}
+
+	// 存活检查不依赖外部服务
+	code, body := probe(t, handler, "/healthz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "ok", body["status"])
+}
+
+func TestProbe_Readyz(t *testing.T) {
+	handler := newProbeTestHandler()
+
+	code, body := probe(t, handler, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "ok", body["status"])
+	checks := body["checks"].(map[string]interface{})
+	require.Equal(t, "ok", checks["config"].(map[string]interface{})["status"])
+	require.Equal(t, "ok", checks["postgres"].(map[string]interface{})["status"])
+	require.Contains(t, checks["redis"], "latency_ms")
+	require.Equal(t, map[string]interface{}{"healthy": float64(2), "total": float64(2)},
+		checks["upstreams"].(map[string]interface{})["details"].(map[string]interface{})["gpt-4"])
+
+	// Redis 不可达
+	handler.dependencies["redis"] = &fakePinger{err: errors.New("dial tcp: connection refused")}
+	code, body = probe(t, handler, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "fail", body["status"])
+	redis := body["checks"].(map[string]interface{})["redis"].(map[string]interface{})
+	require.Equal(t, "fail", redis["status"])
+	require.Equal(t, "dial tcp: connection refused", redis["error"])
+}
+
+func TestProbe_ReadyzUpstreams(t *testing.T) {
+	handler := newProbeTestHandler()
+	handler.dependencies = nil
+
+	// 一个后端被摘除时仍然就绪
+	handler.health.ObserveUpstream("https://a.example.com/v1", http.StatusBadGateway, nil, 0)
+	code, body := probe(t, handler, "/readyz")
+	require.Equal(t, http.StatusOK, code)
+	checks := body["checks"].(map[string]interface{})
+	require.Equal(t, "disabled", checks["postgres"].(map[string]interface{})["status"])
+
+	handler.health.ObserveUpstream("https://b.example.com/v1", http.StatusBadGateway, nil, 0)
+	code, body = probe(t, handler, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	upstreams := body["checks"].(map[string]interface{})["upstreams"].(map[string]interface{})
+	require.Equal(t, "no healthy backend for: gpt-4", upstreams["error"])
+}
+
+func TestProbe_ReadyzShuttingDown(t *testing.T) {
+	handler := newProbeTestHandler()
+	handler.BeginShutdown()
+
+	code, body := probe(t, handler, "/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "fail", body["checks"].(map[string]interface{})["shutdown"].(map[string]interface{})["status"])
+
+	// 退出期间进程仍然存活
+	code, _ = probe(t, handler, "/healthz")
+	require.Equal(t, http.StatusOK, code)
+}
+
+func TestProbe_TargetMapOverride(t *testing.T) {
+	handler := newProbeTestHandler()
+	handler.cfg.TargetMap["/healthz"] = "https://api.example.com"
+	require.False(t, handler.serveProbe(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil)))
+	require.True(t, handler.serveProbe(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/readyz", nil)))
+}
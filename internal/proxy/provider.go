@@ -0,0 +1,449 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// providerAdapter 在 OpenAI 格式与服务商原生接口之间转换上游请求和响应，
+// 客户端以及代理自身的缓存、用量统计始终只看到 OpenAI 格式
+type providerAdapter interface {
+	// rewriteRequest 改写 req 的地址、请求头与请求体，body 为客户端发来的 OpenAI 格式请求体
+	rewriteRequest(req *http.Request, body []byte, call *providerCall) error
+	// rewriteResponse 将上游响应（包括流式响应与错误响应）转换为 OpenAI 格式
+	rewriteResponse(resp *http.Response, call *providerCall) error
+}
+
+// providerAdapters 按 model_routes 的 provider 选择适配器，openai 与未配置时不做转换
+var providerAdapters = map[string]providerAdapter{
+	config.ProviderAnthropic: anthropicAdapter{},
+	config.ProviderGemini:    geminiAdapter{},
+	config.ProviderAzure:     azureAdapter{},
+}
+
+// 客户端请求的接口类型
+const (
+	providerEndpointChat       = "chat"
+	providerEndpointEmbeddings = "embeddings"
+)
+
+// providerCall 一次上游调用的转换参数
+type providerCall struct {
+	route        config.ModelRoute
+	model        string
+	baseURL      string
+	endpoint     string
+	stream       bool
+	includeUsage bool
+	created      int64
+}
+
+// providerTransport 为配置了非 OpenAI provider 的模型转换上游请求，位于凭证注入之内，
+// 重试与备用模型切换后按实际选中的模型和 baseURL 重新转换
+type providerTransport struct {
+	next   http.RoundTripper
+	routes map[string]config.ModelRoute
+	now    func() time.Time
+}
+
+// newProviderTransport 没有模型配置需要转换的 provider 时直接返回 next
+func newProviderTransport(next http.RoundTripper, cfg *config.Config) http.RoundTripper {
+	if cfg == nil {
+		return next
+	}
+	routes := make(map[string]config.ModelRoute)
+	for model := range cfg.ModelRoutes {
+		if route, ok := cfg.GetModelRoute(model); ok {
+			if _, ok := providerAdapters[route.Provider]; ok {
+				routes[model] = route
+			}
+		}
+	}
+	if len(routes) == 0 {
+		return next
+	}
+	return &providerTransport{next: next, routes: routes, now: time.Now}
+}
+
+func (t *providerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	route := upstreamRouteFromContext(r.Context())
+	if route == nil || route.baseURL == "" {
+		return t.next.RoundTrip(r)
+	}
+	modelRoute, ok := t.routes[route.model]
+	if !ok {
+		return t.next.RoundTrip(r)
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		_ = r.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to buffer request body for provider %s: %w", modelRoute.Provider, err)
+		}
+	}
+
+	call := &providerCall{
+		route:    modelRoute,
+		model:    route.model,
+		baseURL:  route.baseURL,
+		endpoint: providerEndpoint(route.path),
+		created:  t.now().Unix(),
+	}
+	var options struct {
+		Stream        bool               `json:"stream"`
+		StreamOptions *chatStreamOptions `json:"stream_options"`
+	}
+	if json.Unmarshal(body, &options) == nil {
+		call.stream = options.Stream
+		call.includeUsage = options.StreamOptions != nil && options.StreamOptions.IncludeUsage
+	}
+
+	req := r.Clone(r.Context())
+	setRequestBody(req, body)
+	if err := providerAdapters[modelRoute.Provider].rewriteRequest(req, body, call); err != nil {
+		logger.Warn("Failed to translate request for provider",
+			zap.String("requestId", utils.GetRequestID(r)),
+			zap.String("model", route.model),
+			zap.String("provider", modelRoute.Provider),
+			zap.Error(err))
+		return providerErrorResponse(r, http.StatusBadRequest, err.Error()), nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := providerAdapters[modelRoute.Provider].rewriteResponse(resp, call); err != nil {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("failed to translate %s response: %w", modelRoute.Provider, err)
+	}
+	return resp, nil
+}
+
+// providerEndpoint 由客户端请求路径判断接口类型，其他路径返回空字符串
+func providerEndpoint(path string) string {
+	switch {
+	case strings.HasSuffix(path, "/chat/completions"):
+		return providerEndpointChat
+	case strings.Contains(path, "embeddings"):
+		return providerEndpointEmbeddings
+	}
+	return ""
+}
+
+// setUpstreamURL 将请求发往 target，query 使用 rawQuery
+func setUpstreamURL(req *http.Request, target *url.URL, rawQuery string) {
+	u := *target
+	u.RawQuery = rawQuery
+	req.URL = &u
+	req.Host = u.Host
+}
+
+func setRequestBody(req *http.Request, body []byte) {
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+}
+
+// moveBearerToken 将 Authorization: Bearer 中的 key 移到服务商使用的请求头，
+// 上游凭证与客户端透传的 OpenAI 风格鉴权都能直接使用
+func moveBearerToken(req *http.Request, header string) {
+	token := bearerToken(req)
+	if token == "" {
+		return
+	}
+	if req.Header.Get(header) == "" {
+		req.Header.Set(header, token)
+	}
+	req.Header.Del("Authorization")
+}
+
+// readResponseBody 读取并关闭上游响应体
+func readResponseBody(resp *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	return body, err
+}
+
+// replaceResponseBody 替换转换后的响应体
+func replaceResponseBody(resp *http.Response, body []byte) {
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Del("Content-Encoding")
+}
+
+// rewriteProviderError 将 Anthropic（error.type）与 Gemini（error.status）的错误响应转换为 OpenAI 格式，
+// 无法解析的错误响应保持原样
+func rewriteProviderError(resp *http.Response) error {
+	body, err := readResponseBody(resp)
+	if err != nil {
+		return err
+	}
+	var payload struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) != nil || payload.Error.Message == "" {
+		replaceResponseBody(resp, body)
+		return nil
+	}
+	errType := payload.Error.Type
+	if errType == "" {
+		errType = strings.ToLower(payload.Error.Status)
+	}
+	if errType == "" {
+		errType = "upstream_error"
+	}
+	converted, err := json.Marshal(openAIError{Error: openAIErrorDetail{
+		Message: payload.Error.Message,
+		Type:    errType,
+		Code:    payload.Error.Status,
+	}})
+	if err != nil {
+		return err
+	}
+	resp.Header.Set("Content-Type", "application/json")
+	replaceResponseBody(resp, converted)
+	return nil
+}
+
+// providerErrorResponse 请求无法转换时直接返回的 OpenAI 格式错误响应
+func providerErrorResponse(r *http.Request, status int, message string) *http.Response {
+	body, _ := json.Marshal(openAIError{Error: openAIErrorDetail{
+		Message: message,
+		Type:    "invalid_request_error",
+	}})
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       r,
+	}
+}
+
+// sseEventTranslator 逐个转换上游 SSE 事件，返回写给客户端的 OpenAI 格式 SSE 数据
+type sseEventTranslator interface {
+	translateEvent(event, data string) []byte
+	// finish 在上游流结束时调用，返回收尾数据（如 data: [DONE]），重复调用返回 nil
+	finish() []byte
+}
+
+// translatedSSEBody 边读取上游 SSE 流边转换，保持流式响应的实时性
+type translatedSSEBody struct {
+	src        io.ReadCloser
+	reader     *bufio.Reader
+	translator sseEventTranslator
+	event      string
+	out        bytes.Buffer
+	eof        bool
+}
+
+// translateEventStream 替换响应体为转换后的 OpenAI 格式 SSE 流
+func translateEventStream(resp *http.Response, translator sseEventTranslator) {
+	resp.Body = &translatedSSEBody{src: resp.Body, reader: bufio.NewReader(resp.Body), translator: translator}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Set("Content-Type", "text/event-stream")
+}
+
+func (b *translatedSSEBody) Read(p []byte) (int, error) {
+	for b.out.Len() == 0 && !b.eof {
+		line, err := b.reader.ReadString('\n')
+		if line != "" {
+			b.handleLine(strings.TrimRight(line, "\r\n"))
+		}
+		if err == io.EOF {
+			b.out.Write(b.translator.finish())
+			b.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	if b.out.Len() == 0 {
+		return 0, io.EOF
+	}
+	return b.out.Read(p)
+}
+
+func (b *translatedSSEBody) handleLine(line string) {
+	switch {
+	case line == "":
+		b.event = ""
+	case strings.HasPrefix(line, "event:"):
+		b.event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+	case strings.HasPrefix(line, "data:"):
+		b.out.Write(b.translator.translateEvent(b.event, strings.TrimSpace(strings.TrimPrefix(line, "data:"))))
+	}
+}
+
+func (b *translatedSSEBody) Close() error {
+	return b.src.Close()
+}
+
+// chatChunkEvent 将 chat completions 流式分片编码为 SSE 数据
+func chatChunkEvent(chunk *llmStreamChunk) []byte {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return nil
+	}
+	return []byte("data: " + string(data) + "\n\n")
+}
+
+// chatStreamDone 流结束标记
+var chatStreamDone = []byte("data: [DONE]\n\n")
+
+// chatStreamState 服务商流式响应转换为 chat completions 分片时的公共状态
+type chatStreamState struct {
+	call  *providerCall
+	id    string
+	model string
+	usage *llmUsage
+	done  bool
+}
+
+// chunk 生成只包含一个 choice 的分片
+func (s *chatStreamState) chunk(delta llmStreamDelta, finishReason string) []byte {
+	choice := llmStreamChunkChoice{Delta: delta}
+	if finishReason != "" {
+		choice.FinishReason = &finishReason
+	}
+	return chatChunkEvent(&llmStreamChunk{
+		ID:      s.id,
+		Object:  "chat.completion.chunk",
+		Created: s.call.created,
+		Model:   s.model,
+		Choices: []llmStreamChunkChoice{choice},
+	})
+}
+
+// finish 客户端请求 include_usage 时先输出用量分片，再输出 [DONE]
+func (s *chatStreamState) finish() []byte {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	var out []byte
+	if s.call.includeUsage && s.usage != nil {
+		usage, _ := json.Marshal(s.usage)
+		out = chatChunkEvent(&llmStreamChunk{
+			ID:      s.id,
+			Object:  "chat.completion.chunk",
+			Created: s.call.created,
+			Model:   s.model,
+			Choices: []llmStreamChunkChoice{},
+			Usage:   usage,
+		})
+	}
+	return append(out, chatStreamDone...)
+}
+
+// chatCompletionResponse 组装非流式 chat completions 响应
+func chatCompletionResponse(id, model string, created int64, message llmCompletionMessage, finishReason string, usage *llmUsage) ([]byte, error) {
+	completion := llmCompletion{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   model,
+		Choices: []llmCompletionChoice{{Message: message, FinishReason: &finishReason}},
+	}
+	if usage != nil {
+		data, err := json.Marshal(usage)
+		if err != nil {
+			return nil, err
+		}
+		completion.Usage = data
+	}
+	return json.Marshal(completion)
+}
+
+// chatContentParts 将 chat 消息的 content（字符串或内容片段数组）统一为内容片段
+func chatContentParts(content interface{}) ([]chatContentPart, error) {
+	switch v := content.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		return []chatContentPart{{Type: "text", Text: v}}, nil
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	var parts []chatContentPart
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return nil, fmt.Errorf("invalid content: %w", err)
+	}
+	return parts, nil
+}
+
+// chatContentText 拼接 content 中的文本片段
+func chatContentText(content interface{}) (string, error) {
+	parts, err := chatContentParts(content)
+	if err != nil {
+		return "", err
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// parseDataURL 解析 data:<media type>;base64,<data> 形式的图片地址
+func parseDataURL(u string) (mediaType, data string, ok bool) {
+	rest, found := strings.CutPrefix(u, "data:")
+	if !found {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(rest, ",")
+	if !found {
+		return "", "", false
+	}
+	mediaType, found = strings.CutSuffix(meta, ";base64")
+	if !found {
+		return "", "", false
+	}
+	return mediaType, data, true
+}
+
+// chatToolName 解析 tool_choice 中 {"type":"function","function":{"name":...}} 指定的函数名
+func chatToolName(choice interface{}) string {
+	m, _ := choice.(map[string]interface{})
+	function, _ := m["function"].(map[string]interface{})
+	name, _ := function["name"].(string)
+	return name
+}
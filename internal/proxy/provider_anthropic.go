@@ -0,0 +1,386 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go-llm-server/internal/utils"
+)
+
+const (
+	defaultAnthropicVersion = "2023-06-01"
+	// defaultAnthropicMaxTokens Messages API 要求 max_tokens，客户端未指定时使用
+	defaultAnthropicMaxTokens = 4096
+)
+
+// anthropicAdapter 将 chat completions 请求转换为 Anthropic Messages API，是 Messages API 入口的反向转换
+type anthropicAdapter struct{}
+
+func (anthropicAdapter) rewriteRequest(req *http.Request, body []byte, call *providerCall) error {
+	if call.endpoint != providerEndpointChat {
+		return fmt.Errorf("provider anthropic only supports chat completions")
+	}
+	var chat chatCompletionRequest
+	if err := json.Unmarshal(body, &chat); err != nil {
+		return fmt.Errorf("invalid chat completions request: %w", err)
+	}
+	messages, err := chatToAnthropicRequest(&chat)
+	if err != nil {
+		return err
+	}
+	newBody, err := json.Marshal(messages)
+	if err != nil {
+		return err
+	}
+	target, err := utils.GetTargetURLWithCache(call.baseURL, "/messages")
+	if err != nil {
+		return err
+	}
+
+	setUpstreamURL(req, target, "")
+	setRequestBody(req, newBody)
+	version := call.route.APIVersion
+	if version == "" {
+		version = defaultAnthropicVersion
+	}
+	req.Header.Set("Anthropic-Version", version)
+	moveBearerToken(req, "X-Api-Key")
+	// 响应需要解析转换，由 Transport 透明解压
+	req.Header.Del("Accept-Encoding")
+	return nil
+}
+
+func (anthropicAdapter) rewriteResponse(resp *http.Response, call *providerCall) error {
+	if resp.StatusCode != http.StatusOK {
+		return rewriteProviderError(resp)
+	}
+	if call.stream && isEventStream(resp) {
+		translateEventStream(resp, &anthropicChunkTranslator{
+			chatStreamState: chatStreamState{call: call, model: call.model},
+			tools:           make(map[int]int),
+		})
+		return nil
+	}
+	body, err := readResponseBody(resp)
+	if err != nil {
+		return err
+	}
+	converted, err := anthropicToChatCompletion(body, call.created)
+	if err != nil {
+		return err
+	}
+	replaceResponseBody(resp, converted)
+	return nil
+}
+
+// chatToAnthropicRequest 将 chat completions 请求转换为 Messages API 请求：
+// system/developer 消息合并为 system，tool 消息转换为 user 消息中的 tool_result 块，相邻的同角色消息合并
+func chatToAnthropicRequest(chat *chatCompletionRequest) (*anthropicRequest, error) {
+	req := &anthropicRequest{
+		Model:         chat.Model,
+		MaxTokens:     defaultAnthropicMaxTokens,
+		Temperature:   chat.Temperature,
+		TopP:          chat.TopP,
+		StopSequences: chat.Stop,
+		Stream:        chat.Stream,
+	}
+	if chat.MaxTokens != nil {
+		req.MaxTokens = *chat.MaxTokens
+	} else if chat.MaxCompletionTokens != nil {
+		req.MaxTokens = *chat.MaxCompletionTokens
+	}
+	if chat.User != "" {
+		req.Metadata = &anthropicMetadata{UserID: chat.User}
+	}
+
+	var system []string
+	var turns []anthropicTurn
+	for i, msg := range chat.Messages {
+		var blocks []anthropicContentBlock
+		role := msg.Role
+		switch msg.Role {
+		case "system", "developer":
+			text, err := chatContentText(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages.%d: %w", i, err)
+			}
+			system = append(system, text)
+			continue
+		case "user":
+			parts, err := chatContentParts(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages.%d: %w", i, err)
+			}
+			for _, part := range parts {
+				switch part.Type {
+				case "text":
+					blocks = append(blocks, anthropicContentBlock{Type: "text", Text: part.Text})
+				case "image_url":
+					if part.ImageURL == nil {
+						return nil, fmt.Errorf("messages.%d: image_url is required", i)
+					}
+					blocks = append(blocks, anthropicContentBlock{Type: "image", Source: anthropicImageSourceFromURL(part.ImageURL.URL)})
+				default:
+					return nil, fmt.Errorf("messages.%d: unsupported content part type %q", i, part.Type)
+				}
+			}
+		case "assistant":
+			text, err := chatContentText(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages.%d: %w", i, err)
+			}
+			if text != "" {
+				blocks = append(blocks, anthropicContentBlock{Type: "text", Text: text})
+			}
+			for _, call := range msg.ToolCalls {
+				blocks = append(blocks, anthropicContentBlock{
+					Type:  "tool_use",
+					ID:    call.ID,
+					Name:  call.Function.Name,
+					Input: toolInput(call.Function.Arguments),
+				})
+			}
+		case "tool":
+			text, err := chatContentText(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages.%d: %w", i, err)
+			}
+			content, err := json.Marshal(text)
+			if err != nil {
+				return nil, err
+			}
+			role = "user"
+			blocks = append(blocks, anthropicContentBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: content})
+		default:
+			return nil, fmt.Errorf("messages.%d: unsupported role %q", i, msg.Role)
+		}
+		turns = appendAnthropicTurn(turns, role, blocks)
+	}
+
+	if len(system) > 0 {
+		data, err := json.Marshal(strings.Join(system, "\n"))
+		if err != nil {
+			return nil, err
+		}
+		req.System = data
+	}
+	for _, turn := range turns {
+		content, err := json.Marshal(turn.blocks)
+		if err != nil {
+			return nil, err
+		}
+		req.Messages = append(req.Messages, anthropicMessage{Role: turn.role, Content: content})
+	}
+
+	for _, tool := range chat.Tools {
+		schema := tool.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		req.Tools = append(req.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	switch choice := chat.ToolChoice.(type) {
+	case nil:
+	case string:
+		switch choice {
+		case "auto", "none":
+			req.ToolChoice = &anthropicToolChoice{Type: choice}
+		case "required":
+			req.ToolChoice = &anthropicToolChoice{Type: "any"}
+		default:
+			return nil, fmt.Errorf("tool_choice: unsupported value %q", choice)
+		}
+	default:
+		name := chatToolName(choice)
+		if name == "" {
+			return nil, fmt.Errorf("tool_choice: function name is required")
+		}
+		req.ToolChoice = &anthropicToolChoice{Type: "tool", Name: name}
+	}
+	if chat.ParallelToolCalls != nil && !*chat.ParallelToolCalls && len(req.Tools) > 0 {
+		if req.ToolChoice == nil {
+			req.ToolChoice = &anthropicToolChoice{Type: "auto"}
+		}
+		req.ToolChoice.DisableParallelToolUse = true
+	}
+	return req, nil
+}
+
+// anthropicTurn Messages API 要求 user 与 assistant 交替出现，相邻的同角色消息合并为一轮
+type anthropicTurn struct {
+	role   string
+	blocks []anthropicContentBlock
+}
+
+func appendAnthropicTurn(turns []anthropicTurn, role string, blocks []anthropicContentBlock) []anthropicTurn {
+	if len(blocks) == 0 {
+		return turns
+	}
+	if n := len(turns); n > 0 && turns[n-1].role == role {
+		turns[n-1].blocks = append(turns[n-1].blocks, blocks...)
+		return turns
+	}
+	return append(turns, anthropicTurn{role: role, blocks: blocks})
+}
+
+func anthropicImageSourceFromURL(u string) *anthropicImageSource {
+	if mediaType, data, ok := parseDataURL(u); ok {
+		return &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}
+	}
+	return &anthropicImageSource{Type: "url", URL: u}
+}
+
+// anthropicToChatCompletion 将 Messages API 响应转换为 chat completions 响应，thinking 块转换为 reasoning_content
+func anthropicToChatCompletion(body []byte, created int64) ([]byte, error) {
+	var msg anthropicResponse
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("invalid messages response: %w", err)
+	}
+
+	var text, thinking strings.Builder
+	message := llmCompletionMessage{Role: "assistant"}
+	for _, block := range msg.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "thinking":
+			thinking.WriteString(block.Thinking)
+		case "tool_use":
+			arguments := "{}"
+			if len(block.Input) > 0 {
+				arguments = string(block.Input)
+			}
+			message.ToolCalls = append(message.ToolCalls, llmStreamToolCall{
+				Index:    len(message.ToolCalls),
+				ID:       block.ID,
+				Type:     "function",
+				Function: llmStreamToolFunction{Name: block.Name, Arguments: arguments},
+			})
+		}
+	}
+	if text.Len() > 0 || len(message.ToolCalls) == 0 {
+		content := text.String()
+		message.Content = &content
+	}
+	if thinking.Len() > 0 {
+		reasoning := thinking.String()
+		message.ReasoningContent = &reasoning
+	}
+
+	stopReason := ""
+	if msg.StopReason != nil {
+		stopReason = *msg.StopReason
+	}
+	return chatCompletionResponse(msg.ID, msg.Model, created, message, chatFinishReason(stopReason), anthropicChatUsage(msg.Usage))
+}
+
+// chatFinishReason 将 stop_reason 映射为 finish_reason
+func chatFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	}
+	return "stop"
+}
+
+// anthropicChatUsage prompt_tokens 包含缓存读写的输入 token
+func anthropicChatUsage(usage anthropicUsage) *llmUsage {
+	prompt := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+	return &llmUsage{
+		PromptTokens:     prompt,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      prompt + usage.OutputTokens,
+	}
+}
+
+// anthropicChunkTranslator 将 Messages API 流式事件转换为 chat completions 分片
+type anthropicChunkTranslator struct {
+	chatStreamState
+	tools map[int]int // 内容块序号 -> tool_calls 序号
+}
+
+func (t *anthropicChunkTranslator) translateEvent(_, data string) []byte {
+	var event struct {
+		Type         string                 `json:"type"`
+		Message      *anthropicResponse     `json:"message"`
+		Index        int                    `json:"index"`
+		ContentBlock *anthropicContentBlock `json:"content_block"`
+		Delta        struct {
+			Type        string `json:"type"`
+			Text        string `json:"text"`
+			Thinking    string `json:"thinking"`
+			PartialJSON string `json:"partial_json"`
+			StopReason  string `json:"stop_reason"`
+		} `json:"delta"`
+		Usage *anthropicUsage       `json:"usage"`
+		Error *anthropicErrorDetail `json:"error"`
+	}
+	if json.Unmarshal([]byte(data), &event) != nil || t.done {
+		return nil
+	}
+
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			t.id = event.Message.ID
+			if event.Message.Model != "" {
+				t.model = event.Message.Model
+			}
+			t.usage = anthropicChatUsage(event.Message.Usage)
+		}
+		empty := ""
+		return t.chunk(llmStreamDelta{Role: "assistant", Content: &empty}, "")
+	case "content_block_start":
+		if event.ContentBlock == nil || event.ContentBlock.Type != "tool_use" {
+			return nil
+		}
+		index := len(t.tools)
+		t.tools[event.Index] = index
+		return t.chunk(llmStreamDelta{ToolCalls: []llmStreamToolCall{{
+			Index:    index,
+			ID:       event.ContentBlock.ID,
+			Type:     "function",
+			Function: llmStreamToolFunction{Name: event.ContentBlock.Name},
+		}}}, "")
+	case "content_block_delta":
+		switch event.Delta.Type {
+		case "text_delta":
+			return t.chunk(llmStreamDelta{Content: &event.Delta.Text}, "")
+		case "thinking_delta":
+			return t.chunk(llmStreamDelta{ReasoningContent: &event.Delta.Thinking}, "")
+		case "input_json_delta":
+			return t.chunk(llmStreamDelta{ToolCalls: []llmStreamToolCall{{
+				Index:    t.tools[event.Index],
+				Function: llmStreamToolFunction{Arguments: event.Delta.PartialJSON},
+			}}}, "")
+		}
+	case "message_delta":
+		if event.Usage != nil && t.usage != nil {
+			t.usage.CompletionTokens = event.Usage.OutputTokens
+			t.usage.TotalTokens = t.usage.PromptTokens + t.usage.CompletionTokens
+		}
+		return t.chunk(llmStreamDelta{}, chatFinishReason(event.Delta.StopReason))
+	case "message_stop":
+		return t.finish()
+	case "error":
+		// 与 OpenAI 一样在流中以 data 行返回错误
+		message := "upstream stream error"
+		if event.Error != nil {
+			message = event.Error.Message
+		}
+		errEvent, _ := json.Marshal(openAIError{Error: openAIErrorDetail{Message: message, Type: "upstream_error"}})
+		t.done = true
+		return append([]byte("data: "+string(errEvent)+"\n\n"), chatStreamDone...)
+	}
+	return nil
+}
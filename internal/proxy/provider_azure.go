@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go-llm-server/internal/utils"
+)
+
+const defaultAzureAPIVersion = "2024-10-21"
+
+// azureAdapter 将请求发往 Azure OpenAI 的部署地址，请求体与响应与 OpenAI 一致，
+// baseURL 形如 https://<resource>.openai.azure.com
+type azureAdapter struct{}
+
+func (azureAdapter) rewriteRequest(req *http.Request, _ []byte, call *providerCall) error {
+	var suffix string
+	switch call.endpoint {
+	case providerEndpointChat:
+		suffix = "/chat/completions"
+	case providerEndpointEmbeddings:
+		suffix = "/embeddings"
+	default:
+		return fmt.Errorf("provider azure only supports chat completions and embeddings")
+	}
+	deployment := call.route.Deployment
+	if deployment == "" {
+		deployment = call.model
+	}
+	target, err := utils.GetTargetURLWithCache(call.baseURL, "/openai/deployments/"+url.PathEscape(deployment)+suffix)
+	if err != nil {
+		return err
+	}
+	version := call.route.APIVersion
+	if version == "" {
+		version = defaultAzureAPIVersion
+	}
+	setUpstreamURL(req, target, url.Values{"api-version": {version}}.Encode())
+
+	// Microsoft Entra ID 的访问令牌（JWT）仍使用 Authorization，API key 改用 api-key 请求头
+	if token := bearerToken(req); token != "" && strings.Count(token, ".") != 2 {
+		moveBearerToken(req, "Api-Key")
+	}
+	return nil
+}
+
+func (azureAdapter) rewriteResponse(*http.Response, *providerCall) error {
+	return nil
+}
@@ -0,0 +1,492 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"go-llm-server/internal/utils"
+
+	"github.com/google/uuid"
+)
+
+// geminiAdapter 将 chat completions 请求转换为 Gemini API 的 generateContent / streamGenerateContent，
+// baseURL 形如 https://generativelanguage.googleapis.com/v1beta
+type geminiAdapter struct{}
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FileData         *geminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	ID       string          `json:"id,omitempty"`
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type geminiGenerationConfig struct {
+	MaxOutputTokens *int     `json:"maxOutputTokens,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig geminiFunctionCallingConfig `json:"functionCallingConfig"`
+}
+
+type geminiFunctionCallingConfig struct {
+	Mode                 string   `json:"mode"` // AUTO、ANY、NONE
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type geminiResponse struct {
+	Candidates     []geminiCandidate     `json:"candidates"`
+	PromptFeedback *geminiPromptFeedback `json:"promptFeedback,omitempty"`
+	UsageMetadata  *geminiUsage          `json:"usageMetadata,omitempty"`
+	ModelVersion   string                `json:"modelVersion,omitempty"`
+	ResponseID     string                `json:"responseId,omitempty"`
+}
+
+type geminiCandidate struct {
+	Content      geminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+}
+
+type geminiPromptFeedback struct {
+	BlockReason string `json:"blockReason,omitempty"`
+}
+
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+func (geminiAdapter) rewriteRequest(req *http.Request, body []byte, call *providerCall) error {
+	if call.endpoint != providerEndpointChat {
+		return fmt.Errorf("provider gemini only supports chat completions")
+	}
+	var chat chatCompletionRequest
+	if err := json.Unmarshal(body, &chat); err != nil {
+		return fmt.Errorf("invalid chat completions request: %w", err)
+	}
+	generate, err := chatToGeminiRequest(&chat)
+	if err != nil {
+		return err
+	}
+	newBody, err := json.Marshal(generate)
+	if err != nil {
+		return err
+	}
+
+	method, query := ":generateContent", ""
+	if chat.Stream {
+		method, query = ":streamGenerateContent", "alt=sse"
+	}
+	target, err := utils.GetTargetURLWithCache(call.baseURL, "/models/"+chat.Model+method)
+	if err != nil {
+		return err
+	}
+	setUpstreamURL(req, target, query)
+	setRequestBody(req, newBody)
+	moveBearerToken(req, "X-Goog-Api-Key")
+	req.Header.Del("Accept-Encoding")
+	return nil
+}
+
+func (geminiAdapter) rewriteResponse(resp *http.Response, call *providerCall) error {
+	if resp.StatusCode != http.StatusOK {
+		return rewriteProviderError(resp)
+	}
+	if call.stream && isEventStream(resp) {
+		translateEventStream(resp, &geminiChunkTranslator{chatStreamState: chatStreamState{call: call, model: call.model}})
+		return nil
+	}
+	body, err := readResponseBody(resp)
+	if err != nil {
+		return err
+	}
+	converted, err := geminiToChatCompletion(body, call)
+	if err != nil {
+		return err
+	}
+	replaceResponseBody(resp, converted)
+	return nil
+}
+
+// chatToGeminiRequest 将 chat completions 请求转换为 generateContent 请求：
+// system/developer 消息转换为 systemInstruction，tool 消息按 tool_call_id 找到函数名后转换为 functionResponse
+func chatToGeminiRequest(chat *chatCompletionRequest) (*geminiRequest, error) {
+	req := &geminiRequest{Contents: []geminiContent{}}
+	toolNames := make(map[string]string) // tool_call_id -> 函数名
+	for i, msg := range chat.Messages {
+		var parts []geminiPart
+		role := "user"
+		switch msg.Role {
+		case "system", "developer":
+			text, err := chatContentText(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages.%d: %w", i, err)
+			}
+			if req.SystemInstruction == nil {
+				req.SystemInstruction = &geminiContent{}
+			}
+			req.SystemInstruction.Parts = append(req.SystemInstruction.Parts, geminiPart{Text: text})
+			continue
+		case "user":
+			contentParts, err := chatContentParts(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages.%d: %w", i, err)
+			}
+			for _, part := range contentParts {
+				switch part.Type {
+				case "text":
+					parts = append(parts, geminiPart{Text: part.Text})
+				case "image_url":
+					if part.ImageURL == nil {
+						return nil, fmt.Errorf("messages.%d: image_url is required", i)
+					}
+					parts = append(parts, geminiImagePart(part.ImageURL.URL))
+				default:
+					return nil, fmt.Errorf("messages.%d: unsupported content part type %q", i, part.Type)
+				}
+			}
+		case "assistant":
+			role = "model"
+			text, err := chatContentText(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages.%d: %w", i, err)
+			}
+			if text != "" {
+				parts = append(parts, geminiPart{Text: text})
+			}
+			for _, call := range msg.ToolCalls {
+				toolNames[call.ID] = call.Function.Name
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{
+					Name: call.Function.Name,
+					Args: toolInput(call.Function.Arguments),
+				}})
+			}
+		case "tool":
+			name, ok := toolNames[msg.ToolCallID]
+			if !ok {
+				return nil, fmt.Errorf("messages.%d: tool_call_id %q does not match any previous tool call", i, msg.ToolCallID)
+			}
+			text, err := chatContentText(msg.Content)
+			if err != nil {
+				return nil, fmt.Errorf("messages.%d: %w", i, err)
+			}
+			parts = append(parts, geminiPart{FunctionResponse: &geminiFunctionResponse{Name: name, Response: geminiToolResponse(text)}})
+		default:
+			return nil, fmt.Errorf("messages.%d: unsupported role %q", i, msg.Role)
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		// 相邻的同角色消息（如多个工具结果）合并为一轮
+		if n := len(req.Contents); n > 0 && req.Contents[n-1].Role == role {
+			req.Contents[n-1].Parts = append(req.Contents[n-1].Parts, parts...)
+		} else {
+			req.Contents = append(req.Contents, geminiContent{Role: role, Parts: parts})
+		}
+	}
+
+	maxTokens := chat.MaxTokens
+	if maxTokens == nil {
+		maxTokens = chat.MaxCompletionTokens
+	}
+	if maxTokens != nil || chat.Temperature != nil || chat.TopP != nil || len(chat.Stop) > 0 {
+		req.GenerationConfig = &geminiGenerationConfig{
+			MaxOutputTokens: maxTokens,
+			Temperature:     chat.Temperature,
+			TopP:            chat.TopP,
+			StopSequences:   chat.Stop,
+		}
+	}
+
+	if len(chat.Tools) > 0 {
+		declarations := make([]geminiFunctionDeclaration, 0, len(chat.Tools))
+		for _, tool := range chat.Tools {
+			declarations = append(declarations, geminiFunctionDeclaration{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  geminiSchema(tool.Function.Parameters),
+			})
+		}
+		req.Tools = []geminiTool{{FunctionDeclarations: declarations}}
+	}
+	switch choice := chat.ToolChoice.(type) {
+	case nil:
+	case string:
+		modes := map[string]string{"auto": "AUTO", "required": "ANY", "none": "NONE"}
+		mode, ok := modes[choice]
+		if !ok {
+			return nil, fmt.Errorf("tool_choice: unsupported value %q", choice)
+		}
+		req.ToolConfig = &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{Mode: mode}}
+	default:
+		name := chatToolName(choice)
+		if name == "" {
+			return nil, fmt.Errorf("tool_choice: function name is required")
+		}
+		req.ToolConfig = &geminiToolConfig{FunctionCallingConfig: geminiFunctionCallingConfig{
+			Mode:                 "ANY",
+			AllowedFunctionNames: []string{name},
+		}}
+	}
+	return req, nil
+}
+
+// geminiImagePart data URL 转换为 inlineData，其他地址转换为 fileData，MIME 类型按扩展名推断
+func geminiImagePart(u string) geminiPart {
+	if mediaType, data, ok := parseDataURL(u); ok {
+		return geminiPart{InlineData: &geminiBlob{MimeType: mediaType, Data: data}}
+	}
+	mimeType := mime.TypeByExtension(path.Ext(strings.SplitN(u, "?", 2)[0]))
+	if mimeType == "" {
+		mimeType = "image/jpeg"
+	}
+	return geminiPart{FileData: &geminiFileData{MimeType: mimeType, FileURI: u}}
+}
+
+// geminiToolResponse functionResponse.response 必须是 JSON 对象，其他内容包装为 {"content": ...}
+func geminiToolResponse(text string) json.RawMessage {
+	trimmed := strings.TrimSpace(text)
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	data, _ := json.Marshal(map[string]string{"content": text})
+	return data
+}
+
+// geminiSchema 去掉 Gemini 不支持的 JSON Schema 字段；没有参数的函数不传 parameters
+func geminiSchema(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return nil
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return raw
+	}
+	if properties, ok := schema["properties"].(map[string]interface{}); ok && len(properties) == 0 {
+		return nil
+	}
+	stripUnsupportedSchemaFields(schema)
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return raw
+	}
+	return data
+}
+
+func stripUnsupportedSchemaFields(v interface{}) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		delete(node, "$schema")
+		delete(node, "additionalProperties")
+		for _, child := range node {
+			stripUnsupportedSchemaFields(child)
+		}
+	case []interface{}:
+		for _, child := range node {
+			stripUnsupportedSchemaFields(child)
+		}
+	}
+}
+
+// geminiToChatCompletion 将 generateContent 响应转换为 chat completions 响应
+func geminiToChatCompletion(body []byte, call *providerCall) ([]byte, error) {
+	var resp geminiResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("invalid generateContent response: %w", err)
+	}
+
+	var text, thought strings.Builder
+	message := llmCompletionMessage{Role: "assistant"}
+	finishReason := "stop"
+	if len(resp.Candidates) > 0 {
+		candidate := resp.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				message.ToolCalls = append(message.ToolCalls, geminiToolCall(resp.ResponseID, len(message.ToolCalls), part.FunctionCall))
+			case part.Thought:
+				thought.WriteString(part.Text)
+			default:
+				text.WriteString(part.Text)
+			}
+		}
+		finishReason = geminiFinishReason(candidate.FinishReason, len(message.ToolCalls) > 0)
+	} else if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+		finishReason = "content_filter"
+	}
+	if text.Len() > 0 || len(message.ToolCalls) == 0 {
+		content := text.String()
+		message.Content = &content
+	}
+	if thought.Len() > 0 {
+		reasoning := thought.String()
+		message.ReasoningContent = &reasoning
+	}
+
+	model := resp.ModelVersion
+	if model == "" {
+		model = call.model
+	}
+	return chatCompletionResponse(geminiCompletionID(resp.ResponseID), model, call.created, message, finishReason, geminiChatUsage(resp.UsageMetadata))
+}
+
+// geminiToolCall Gemini 通常不返回函数调用 ID，按响应 ID 与序号生成
+func geminiToolCall(responseID string, index int, call *geminiFunctionCall) llmStreamToolCall {
+	id := call.ID
+	if id == "" {
+		id = fmt.Sprintf("call_%s_%d", responseID, index)
+	}
+	arguments := "{}"
+	if len(call.Args) > 0 {
+		arguments = string(call.Args)
+	}
+	return llmStreamToolCall{
+		Index:    index,
+		ID:       id,
+		Type:     "function",
+		Function: llmStreamToolFunction{Name: call.Name, Arguments: arguments},
+	}
+}
+
+func geminiCompletionID(responseID string) string {
+	if responseID == "" {
+		responseID = strings.ReplaceAll(uuid.NewString(), "-", "")
+	}
+	return "chatcmpl-" + responseID
+}
+
+// geminiFinishReason 将 finishReason 映射为 finish_reason
+func geminiFinishReason(reason string, hasToolCalls bool) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	}
+	if hasToolCalls {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// geminiChatUsage completion_tokens 包含思考消耗的 token
+func geminiChatUsage(usage *geminiUsage) *llmUsage {
+	if usage == nil {
+		return nil
+	}
+	completion := usage.CandidatesTokenCount + usage.ThoughtsTokenCount
+	total := usage.TotalTokenCount
+	if total == 0 {
+		total = usage.PromptTokenCount + completion
+	}
+	return &llmUsage{PromptTokens: usage.PromptTokenCount, CompletionTokens: completion, TotalTokens: total}
+}
+
+// geminiChunkTranslator 将 streamGenerateContent（alt=sse）的每个响应转换为 chat completions 分片
+type geminiChunkTranslator struct {
+	chatStreamState
+	started   bool
+	toolCalls int
+}
+
+func (t *geminiChunkTranslator) translateEvent(_, data string) []byte {
+	var resp geminiResponse
+	if json.Unmarshal([]byte(data), &resp) != nil || t.done {
+		return nil
+	}
+
+	var out []byte
+	if !t.started {
+		t.started = true
+		t.id = geminiCompletionID(resp.ResponseID)
+		if resp.ModelVersion != "" {
+			t.model = resp.ModelVersion
+		}
+		empty := ""
+		out = append(out, t.chunk(llmStreamDelta{Role: "assistant", Content: &empty}, "")...)
+	}
+	if usage := geminiChatUsage(resp.UsageMetadata); usage != nil {
+		t.usage = usage
+	}
+	if len(resp.Candidates) == 0 {
+		if resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+			out = append(out, t.chunk(llmStreamDelta{}, "content_filter")...)
+		}
+		return out
+	}
+
+	candidate := resp.Candidates[0]
+	for _, part := range candidate.Content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			call := geminiToolCall(resp.ResponseID, t.toolCalls, part.FunctionCall)
+			t.toolCalls++
+			out = append(out, t.chunk(llmStreamDelta{ToolCalls: []llmStreamToolCall{call}}, "")...)
+		case part.Thought:
+			text := part.Text
+			out = append(out, t.chunk(llmStreamDelta{ReasoningContent: &text}, "")...)
+		case part.Text != "":
+			text := part.Text
+			out = append(out, t.chunk(llmStreamDelta{Content: &text}, "")...)
+		}
+	}
+	if candidate.FinishReason != "" {
+		out = append(out, t.chunk(llmStreamDelta{}, geminiFinishReason(candidate.FinishReason, t.toolCalls > 0))...)
+	}
+	return out
+}
@@ -0,0 +1,238 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go-llm-server/internal/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newProviderTestCall 固定 created，保证 golden 输出稳定
+func newProviderTestCall() *providerCall {
+	return &providerCall{model: "test-model", created: 1700000000, stream: true, includeUsage: true}
+}
+
+var createdPattern = regexp.MustCompile(`"created":\d+`)
+
+// replaceCreated 将真实请求中的 created 替换为 golden 使用的固定值
+func replaceCreated(s string) string {
+	return createdPattern.ReplaceAllString(s, `"created":1700000000`)
+}
+
+func indentGolden(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	require.NoError(t, json.Indent(&out, data, "", "  "))
+	return append(out.Bytes(), '\n')
+}
+
+func TestProvider_RequestGolden(t *testing.T) {
+	convert := map[string]func(*chatCompletionRequest) (interface{}, error){
+		config.ProviderAnthropic: func(chat *chatCompletionRequest) (interface{}, error) { return chatToAnthropicRequest(chat) },
+		config.ProviderGemini:    func(chat *chatCompletionRequest) (interface{}, error) { return chatToGeminiRequest(chat) },
+	}
+	for provider, fn := range convert {
+		for name, input := range goldenCases(t, filepath.Join("providers", "requests"), ".json") {
+			t.Run(provider+"/"+filepath.Base(name), func(t *testing.T) {
+				var chat chatCompletionRequest
+				require.NoError(t, json.Unmarshal(input, &chat))
+				got, err := fn(&chat)
+				require.NoError(t, err)
+				checkGolden(t, filepath.Join("testdata", "providers", provider, filepath.Base(name)+".request.json"), marshalGolden(t, got))
+			})
+		}
+	}
+}
+
+func TestProvider_ResponseGolden(t *testing.T) {
+	convert := map[string]func([]byte) ([]byte, error){
+		config.ProviderAnthropic: func(body []byte) ([]byte, error) { return anthropicToChatCompletion(body, 1700000000) },
+		config.ProviderGemini:    func(body []byte) ([]byte, error) { return geminiToChatCompletion(body, newProviderTestCall()) },
+	}
+	for provider, fn := range convert {
+		for name, input := range goldenCases(t, filepath.Join("providers", provider), ".response.json") {
+			t.Run(provider+"/"+filepath.Base(name), func(t *testing.T) {
+				got, err := fn(input)
+				require.NoError(t, err)
+				checkGolden(t, name+".chat.json", indentGolden(t, got))
+			})
+		}
+	}
+}
+
+func TestProvider_StreamGolden(t *testing.T) {
+	translators := map[string]func() sseEventTranslator{
+		config.ProviderAnthropic: func() sseEventTranslator {
+			return &anthropicChunkTranslator{chatStreamState: chatStreamState{call: newProviderTestCall(), model: "test-model"}, tools: make(map[int]int)}
+		},
+		config.ProviderGemini: func() sseEventTranslator {
+			return &geminiChunkTranslator{chatStreamState: chatStreamState{call: newProviderTestCall(), model: "test-model"}}
+		},
+	}
+	for provider, newTranslator := range translators {
+		for name, input := range goldenCases(t, filepath.Join("providers", provider), ".stream.txt") {
+			t.Run(provider+"/"+filepath.Base(name), func(t *testing.T) {
+				resp := &http.Response{Header: http.Header{"Content-Type": {"text/event-stream"}}, Body: io.NopCloser(bytes.NewReader(input))}
+				translateEventStream(resp, newTranslator())
+				got, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				checkGolden(t, name+".chunks.txt", got)
+			})
+		}
+	}
+}
+
+// newProviderTestConfig 客户端始终请求 /chat/completions，由 model_routes 将 test-model 路由到上游的 /v1，
+// route 指定 provider 等路由参数
+func newProviderTestConfig(route map[string]interface{}) func(upstreamURL string) *config.Config {
+	return func(upstreamURL string) *config.Config {
+		route["urls"] = []interface{}{upstreamURL + "/v1"}
+		return &config.Config{
+			TargetMap:   map[string]string{"/chat/completions": upstreamURL, "/embeddings": upstreamURL},
+			ModelRoutes: map[string]interface{}{"test-model": route},
+		}
+	}
+}
+
+func TestProvider_Anthropic(t *testing.T) {
+	var received *http.Request
+	var body map[string]interface{}
+	handler := newUpstreamTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		data, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4","content":[{"type":"text","text":"Hi"}],"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":1}}`))
+	}, newProviderTestConfig(map[string]interface{}{"provider": "anthropic"}))
+
+	resp := sendAPIRequest(handler, http.MethodPost, "/chat/completions", "sk-client",
+		`{"model":"test-model","messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hello"}]}`)
+
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	require.Equal(t, "/v1/messages", received.URL.Path)
+	require.Equal(t, defaultAnthropicVersion, received.Header.Get("Anthropic-Version"))
+	require.Equal(t, "sk-client", received.Header.Get("X-Api-Key"))
+	require.Empty(t, received.Header.Get("Authorization"))
+	require.Equal(t, "Be brief.", body["system"])
+	require.EqualValues(t, defaultAnthropicMaxTokens, body["max_tokens"])
+
+	var completion llmCompletion
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &completion))
+	require.Equal(t, "chat.completion", completion.Object)
+	require.Equal(t, "Hi", *completion.Choices[0].Message.Content)
+	require.Equal(t, "stop", *completion.Choices[0].FinishReason)
+	require.JSONEq(t, `{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}`, string(completion.Usage))
+}
+
+func TestProvider_AnthropicStreamAndErrors(t *testing.T) {
+	stream, err := os.ReadFile(filepath.Join("testdata", "providers", "anthropic", "tool_use.stream.txt"))
+	require.NoError(t, err)
+	chunks, err := os.ReadFile(filepath.Join("testdata", "providers", "anthropic", "tool_use.chunks.txt"))
+	require.NoError(t, err)
+
+	status := http.StatusOK
+	handler := newUpstreamTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "2024-01-01", r.Header.Get("Anthropic-Version"))
+		if status != http.StatusOK {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens: too large"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write(stream)
+	}, newProviderTestConfig(map[string]interface{}{"provider": "anthropic", "api_version": "2024-01-01"}))
+
+	resp := sendAPIRequest(handler, http.MethodPost, "/chat/completions", "sk-client",
+		`{"model":"test-model","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"Weather?"}]}`)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "text/event-stream", resp.Header().Get("Content-Type"))
+	// golden 使用固定的 created，比较前统一替换
+	require.Equal(t, string(chunks), replaceCreated(resp.Body.String()))
+
+	status = http.StatusBadRequest
+	resp = sendAPIRequest(handler, http.MethodPost, "/chat/completions", "sk-client", `{"model":"test-model","messages":[{"role":"user","content":"Hi"}]}`)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	require.JSONEq(t, `{"error":{"message":"max_tokens: too large","type":"invalid_request_error","param":null,"code":""}}`, resp.Body.String())
+
+	// Messages API 没有 embeddings 接口，请求在转发前被拒绝
+	resp = sendAPIRequest(handler, http.MethodPost, "/embeddings", "sk-client", `{"model":"test-model","input":"hi"}`)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	require.Contains(t, resp.Body.String(), "provider anthropic only supports chat completions")
+}
+
+func TestProvider_Gemini(t *testing.T) {
+	stream, err := os.ReadFile(filepath.Join("testdata", "providers", "gemini", "text.stream.txt"))
+	require.NoError(t, err)
+
+	var received []*http.Request
+	handler := newUpstreamTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r)
+		if r.URL.Query().Get("alt") == "sse" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write(stream)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hi"}]},"finishReason":"MAX_TOKENS"}],"usageMetadata":{"promptTokenCount":2,"candidatesTokenCount":1,"totalTokenCount":3},"responseId":"r1"}`))
+	}, newProviderTestConfig(map[string]interface{}{"provider": "gemini"}))
+
+	resp := sendAPIRequest(handler, http.MethodPost, "/chat/completions", "sk-client", `{"model":"test-model","messages":[{"role":"user","content":"Hello"}]}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	require.Equal(t, "/v1/models/test-model:generateContent", received[0].URL.Path)
+	require.Equal(t, "sk-client", received[0].Header.Get("X-Goog-Api-Key"))
+	require.Empty(t, received[0].Header.Get("Authorization"))
+	var completion llmCompletion
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &completion))
+	require.Equal(t, "chatcmpl-r1", completion.ID)
+	require.Equal(t, "length", *completion.Choices[0].FinishReason)
+
+	resp = sendAPIRequest(handler, http.MethodPost, "/chat/completions", "sk-client", `{"model":"test-model","stream":true,"messages":[{"role":"user","content":"Hello"}]}`)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "/v1/models/test-model:streamGenerateContent", received[1].URL.Path)
+	require.Contains(t, resp.Body.String(), `"content":", world!"`)
+	require.NotContains(t, resp.Body.String(), `"usage"`)
+	require.True(t, strings.HasSuffix(resp.Body.String(), "data: [DONE]\n\n"))
+}
+
+func TestProvider_Azure(t *testing.T) {
+	var received []*http.Request
+	handler := newUpstreamTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","choices":[]}`))
+	}, newProviderTestConfig(map[string]interface{}{"provider": "azure", "deployment": "gpt4o-prod", "api_version": "2025-01-01-preview"}))
+
+	resp := sendAPIRequest(handler, http.MethodPost, "/chat/completions", "sk-client", `{"model":"test-model","messages":[{"role":"user","content":"Hello"}]}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	require.JSONEq(t, `{"id":"chatcmpl-1","object":"chat.completion","choices":[]}`, resp.Body.String())
+
+	resp = sendAPIRequest(handler, http.MethodPost, "/embeddings", "sk-client", `{"model":"test-model","input":"hi"}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	require.Len(t, received, 2)
+	require.Equal(t, "/v1/openai/deployments/gpt4o-prod/chat/completions", received[0].URL.Path)
+	require.Equal(t, "/v1/openai/deployments/gpt4o-prod/embeddings", received[1].URL.Path)
+	for _, r := range received {
+		require.Equal(t, "2025-01-01-preview", r.URL.Query().Get("api-version"))
+		require.Equal(t, "sk-client", r.Header.Get("Api-Key"))
+		require.Empty(t, r.Header.Get("Authorization"))
+	}
+}
+
+func TestNewProviderTransport_SkipsOpenAIRoutes(t *testing.T) {
+	cfg := &config.Config{ModelRoutes: map[string]interface{}{
+		"gpt-4":  "https://api.openai.com/v1",
+		"gpt-4o": map[string]interface{}{"urls": []interface{}{"https://api.openai.com/v1"}, "provider": "openai"},
+	}}
+	require.Same(t, http.DefaultTransport, newProviderTransport(http.DefaultTransport, cfg))
+}
@@ -0,0 +1,249 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/logger"
+	cache "go-llm-server/pkg/redis"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+const defaultRateLimitIdleTTL = 10 * time.Minute
+
+var errUnexpectedScriptResult = errors.New("unexpected rate limit script result")
+
+// RateLimitResult 一次限流判断的结果，用于生成 X-RateLimit-* 响应头
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int           // 令牌桶容量（burst）
+	Remaining  int           // 本次请求之后剩余的可用请求数
+	RetryAfter time.Duration // 被拒绝时距离下一次可用的时间
+	ResetAfter time.Duration // 令牌桶恢复满额所需的时间
+}
+
+// RateLimiter 按 key 限流的接口，进程内与 Redis 实现可互换
+type RateLimiter interface {
+	Allow(ctx context.Context, key string) (RateLimitResult, error)
+}
+
+// newRateLimiter 按配置创建请求限流器；未配置限流时返回 nil，Redis 不可用时退回进程内实现
+func newRateLimiter(cfg *config.Config, redisClient *cache.Redis) RateLimiter {
+	if cfg == nil || !cfg.HasRateLimit() {
+		return nil
+	}
+	rl := cfg.RateLimit
+	switch rl.Backend {
+	case config.RateLimitBackendRedis:
+		if redisClient != nil {
+			return newRedisRateLimiter(redisClient, rl.Rate, rl.Burst)
+		}
+		logger.Warn("Redis unavailable, falling back to in-memory rate limiting")
+	case "", config.RateLimitBackendMemory:
+	default:
+		logger.Warn("Unknown rate limit backend, using in-memory rate limiting", zap.String("backend", rl.Backend))
+	}
+	return newLocalRateLimiter(rl.Rate, rl.Burst, time.Duration(rl.IdleTTL)*time.Second)
+}
+
+// ---------------- 进程内实现 ----------------
+
+type localLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// localRateLimiter 每个 key 一个令牌桶，空闲超过 idleTTL 的条目被回收，避免 map 无限增长
+type localRateLimiter struct {
+	limit   rate.Limit
+	burst   int
+	idleTTL time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*localLimiterEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newLocalRateLimiter(ratePerSecond, burst int, idleTTL time.Duration) *localRateLimiter {
+	if idleTTL <= 0 {
+		idleTTL = defaultRateLimitIdleTTL
+	}
+	// 回收前令牌桶必须已经恢复满额，否则回收会让客户端提前获得额度
+	if refill := time.Duration(float64(burst) / float64(ratePerSecond) * float64(time.Second)); idleTTL < refill {
+		idleTTL = refill
+	}
+	return &localRateLimiter{
+		limit:     rate.Limit(ratePerSecond),
+		burst:     burst,
+		idleTTL:   idleTTL,
+		entries:   make(map[string]*localLimiterEntry),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (l *localRateLimiter) Allow(_ context.Context, key string) (RateLimitResult, error) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) >= l.idleTTL {
+		l.sweep(now)
+	}
+	entry, ok := l.entries[key]
+	if !ok {
+		entry = &localLimiterEntry{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.entries[key] = entry
+	}
+	entry.lastSeen = now
+
+	result := RateLimitResult{Limit: l.burst}
+	reservation := entry.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		result.RetryAfter = delay
+	} else {
+		result.Allowed = true
+	}
+	tokens := entry.limiter.TokensAt(now)
+	result.Remaining = int(math.Max(0, math.Floor(tokens)))
+	result.ResetAfter = time.Duration((float64(l.burst) - tokens) / float64(l.limit) * float64(time.Second))
+	return result, nil
+}
+
+// sweep 删除空闲超过 idleTTL 的条目，调用方需持有锁
+func (l *localRateLimiter) sweep(now time.Time) {
+	for key, entry := range l.entries {
+		if now.Sub(entry.lastSeen) >= l.idleTTL {
+			delete(l.entries, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// size 当前跟踪的 key 数量
+func (l *localRateLimiter) size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+// ---------------- Redis 实现 ----------------
+
+// gcraScript GCRA（通用信元速率算法）：key 中保存理论到达时间（TAT，毫秒），使用 Redis 服务端时间避免副本间时钟偏差。
+// 返回 {是否允许, 剩余请求数, 重试等待毫秒, 恢复满额毫秒}
+var gcraScript = cache.NewScript(`
+local emission = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + tonumber(t[2]) / 1000
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if not tat or tat < now then
+  tat = now
+end
+local new_tat = tat + emission
+local allow_at = new_tat - emission * burst
+if allow_at > now then
+  return {0, 0, math.ceil(allow_at - now), math.ceil(tat - now)}
+end
+redis.call("SET", KEYS[1], string.format("%.3f", new_tat), "PX", math.ceil(new_tat - now))
+return {1, math.floor((now - allow_at) / emission), 0, math.ceil(new_tat - now)}
+`)
+
+// scriptRunner 执行返回整数数组的 Lua 脚本，由 pkg/redis.Redis 实现
+type scriptRunner interface {
+	RunInt64s(ctx context.Context, script *cache.Script, keys []string, args ...interface{}) ([]int64, error)
+}
+
+// redisRateLimiter 基于 GCRA 的分布式限流，所有副本共享同一额度
+type redisRateLimiter struct {
+	client   scriptRunner
+	emission float64 // 两次请求之间的理论间隔（毫秒）
+	burst    int
+}
+
+func newRedisRateLimiter(client scriptRunner, ratePerSecond, burst int) *redisRateLimiter {
+	return &redisRateLimiter{
+		client:   client,
+		emission: 1000 / float64(ratePerSecond),
+		burst:    burst,
+	}
+}
+
+func (l *redisRateLimiter) Allow(ctx context.Context, key string) (RateLimitResult, error) {
+	vals, err := l.client.RunInt64s(ctx, gcraScript, []string{"ratelimit:requests:" + key},
+		strconv.FormatFloat(l.emission, 'f', -1, 64), l.burst)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	if len(vals) != 4 {
+		return RateLimitResult{}, errUnexpectedScriptResult
+	}
+	return RateLimitResult{
+		Allowed:    vals[0] == 1,
+		Limit:      l.burst,
+		Remaining:  int(vals[1]),
+		RetryAfter: time.Duration(vals[2]) * time.Millisecond,
+		ResetAfter: time.Duration(vals[3]) * time.Millisecond,
+	}, nil
+}
+
+// ---------------- HTTP ----------------
+
+// allowRequest 按客户端地址限流并写出 X-RateLimit-* 响应头；被拒绝时已写出 429 并返回 false。
+// 限流后端出错时放行
+func (h *Handler) allowRequest(w http.ResponseWriter, r *http.Request) bool {
+	if h.limiter == nil {
+		return true
+	}
+	requestId := utils.GetRequestID(r)
+	clientIP := clientAddr(r)
+	result, err := h.limiter.Allow(r.Context(), clientIP)
+	if err != nil {
+		logger.Warn("Rate limiter unavailable, allowing request",
+			zap.String("requestId", requestId), zap.String("clientIp", clientIP), zap.Error(err))
+		return true
+	}
+
+	header := w.Header()
+	header.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+	if result.Allowed {
+		return true
+	}
+
+	header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+	h.metrics.observeRateLimited("requests")
+	logger.Warn("Rate limit exceeded", zap.String("clientIp", clientIP), zap.String("requestId", requestId))
+	writeOpenAIError(w, http.StatusTooManyRequests, "requests", "rate_limit_exceeded",
+		"Too many requests, please retry later.")
+	return false
+}
+
+// clientAddr 客户端 IP，去掉 RemoteAddr 中的端口，使同一客户端的不同连接共享额度
+func clientAddr(r *http.Request) string {
+	ip := utils.GetClientIP(r)
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		return host
+	}
+	return ip
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"go-llm-server/internal/config"
+	cache "go-llm-server/pkg/redis"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeScriptRunner struct {
+	vals []int64
+	err  error
+	keys []string
+}
+
+func (f *fakeScriptRunner) RunInt64s(_ context.Context, _ *cache.Script, keys []string, _ ...interface{}) ([]int64, error) {
+	f.keys = append(f.keys, keys...)
+	return f.vals, f.err
+}
+
+type fakeRateLimiter struct {
+	result RateLimitResult
+	err    error
+}
+
+func (f *fakeRateLimiter) Allow(context.Context, string) (RateLimitResult, error) {
+	return f.result, f.err
+}
+
+func TestLocalRateLimiter_Allow(t *testing.T) {
+	limiter := newLocalRateLimiter(1, 2, 0)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	result, err := limiter.Allow(ctx, "10.0.0.1")
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+	require.Equal(t, 2, result.Limit)
+	require.Equal(t, 1, result.Remaining)
+	require.Equal(t, time.Second, result.ResetAfter)
+
+	result, _ = limiter.Allow(ctx, "10.0.0.1")
+	require.True(t, result.Allowed)
+	require.Equal(t, 0, result.Remaining)
+
+	result, _ = limiter.Allow(ctx, "10.0.0.1")
+	require.False(t, result.Allowed)
+	require.Equal(t, time.Second, result.RetryAfter)
+	require.Equal(t, 2*time.Second, result.ResetAfter)
+
+	// 不同 key 独立计数
+	result, _ = limiter.Allow(ctx, "10.0.0.2")
+	require.True(t, result.Allowed)
+
+	now = now.Add(time.Second)
+	result, _ = limiter.Allow(ctx, "10.0.0.1")
+	require.True(t, result.Allowed)
+}
+
+func TestLocalRateLimiter_EvictsIdleEntries(t *testing.T) {
+	limiter := newLocalRateLimiter(10, 10, time.Minute)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, _ = limiter.Allow(ctx, "a")
+	_, _ = limiter.Allow(ctx, "b")
+	require.Equal(t, 2, limiter.size())
+
+	now = now.Add(30 * time.Second)
+	_, _ = limiter.Allow(ctx, "b")
+	now = now.Add(45 * time.Second)
+	_, _ = limiter.Allow(ctx, "c")
+	require.Equal(t, 2, limiter.size(), "a is idle for more than a minute and should be evicted")
+
+	// 空闲回收时间不短于令牌桶恢复满额的时间
+	require.Equal(t, 100*time.Second, newLocalRateLimiter(1, 100, time.Second).idleTTL)
+}
+
+func TestRedisRateLimiter_Allow(t *testing.T) {
+	runner := &fakeScriptRunner{vals: []int64{1, 4, 0, 200}}
+	limiter := newRedisRateLimiter(runner, 5, 5)
+	require.Equal(t, float64(200), limiter.emission)
+
+	result, err := limiter.Allow(context.Background(), "10.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, RateLimitResult{Allowed: true, Limit: 5, Remaining: 4, ResetAfter: 200 * time.Millisecond}, result)
+	require.Equal(t, []string{"ratelimit:requests:10.0.0.1"}, runner.keys)
+
+	runner.vals = []int64{0, 0, 150, 1000}
+	result, err = limiter.Allow(context.Background(), "10.0.0.1")
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.Equal(t, 150*time.Millisecond, result.RetryAfter)
+
+	runner.vals = []int64{1}
+	_, err = limiter.Allow(context.Background(), "10.0.0.1")
+	require.ErrorIs(t, err, errUnexpectedScriptResult)
+
+	runner.err = errors.New("connection refused")
+	_, err = limiter.Allow(context.Background(), "10.0.0.1")
+	require.Error(t, err)
+}
+
+// TestRedisRateLimiter_GCRA 需要真实的 Redis，未配置 REDIS_ADDR 或无法连接时跳过
+func TestRedisRateLimiter_GCRA(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("skipping redis rate limiter test: REDIS_ADDR not set")
+	}
+	client, err := cache.NewRedis(&cache.Config{Addr: addr, Password: os.Getenv("REDIS_PASSWORD")})
+	if err != nil {
+		t.Skipf("skipping redis rate limiter test: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	key := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	defer client.Del(ctx, "ratelimit:requests:"+key)
+
+	limiter := newRedisRateLimiter(client, 1, 3)
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Allow(ctx, key)
+		require.NoError(t, err)
+		require.True(t, result.Allowed)
+		require.Equal(t, 2-i, result.Remaining)
+	}
+	result, err := limiter.Allow(ctx, key)
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.Greater(t, result.RetryAfter, time.Duration(0))
+	require.LessOrEqual(t, result.RetryAfter, time.Second)
+}
+
+func TestAllowRequest_Headers(t *testing.T) {
+	limiter := &fakeRateLimiter{result: RateLimitResult{Allowed: true, Limit: 10, Remaining: 7, ResetAfter: 1500 * time.Millisecond}}
+	handler := &Handler{cfg: &config.Config{}, limiter: limiter}
+
+	resp := httptest.NewRecorder()
+	require.True(t, handler.allowRequest(resp, httptest.NewRequest(http.MethodPost, "/chat/completions", nil)))
+	require.Equal(t, "10", resp.Header().Get("X-RateLimit-Limit"))
+	require.Equal(t, "7", resp.Header().Get("X-RateLimit-Remaining"))
+	require.Equal(t, "2", resp.Header().Get("X-RateLimit-Reset"))
+	require.Empty(t, resp.Header().Get("Retry-After"))
+
+	limiter.result = RateLimitResult{Limit: 10, RetryAfter: 300 * time.Millisecond, ResetAfter: 10 * time.Second}
+	resp = httptest.NewRecorder()
+	require.False(t, handler.allowRequest(resp, httptest.NewRequest(http.MethodPost, "/chat/completions", nil)))
+	requireOpenAIError(t, resp, http.StatusTooManyRequests, "rate_limit_exceeded")
+	require.Equal(t, "1", resp.Header().Get("Retry-After"))
+	require.Equal(t, "0", resp.Header().Get("X-RateLimit-Remaining"))
+
+	// 限流后端不可用时放行且不写响应头
+	limiter.err = errors.New("redis down")
+	resp = httptest.NewRecorder()
+	require.True(t, handler.allowRequest(resp, httptest.NewRequest(http.MethodPost, "/chat/completions", nil)))
+	require.Empty(t, resp.Header().Get("X-RateLimit-Limit"))
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	require.Nil(t, newRateLimiter(nil, nil))
+	require.Nil(t, newRateLimiter(&config.Config{}, nil))
+
+	cfg := &config.Config{RateLimit: config.RateLimitConfig{Rate: 5, Burst: 10}}
+	require.IsType(t, &localRateLimiter{}, newRateLimiter(cfg, nil))
+
+	// Redis 不可用时退回进程内实现
+	cfg.RateLimit.Backend = config.RateLimitBackendRedis
+	require.IsType(t, &localRateLimiter{}, newRateLimiter(cfg, nil))
+}
+
+func TestClientAddr(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:54321"
+	require.Equal(t, "10.0.0.1", clientAddr(req))
+
+	req.Header.Set("X-Real-IP", "192.168.1.9")
+	require.Equal(t, "192.168.1.9", clientAddr(req))
+}
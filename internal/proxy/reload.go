@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// restartRequiredSections 启动时初始化的组件使用的配置，修改后需要重启才能生效
+var restartRequiredSections = []string{
+	"port", "proxy_url", "database", "redis", "cache.sweep_interval",
+	"health_check", "metrics", "tracing", "shutdown", "reload",
+}
+
+// ReloadableHandler 支持配置热加载的处理器。每个请求使用接收时的 Handler 处理到结束，
+// 重新加载只影响之后到达的请求
+type ReloadableHandler struct {
+	current atomic.Pointer[Handler]
+	mu      sync.Mutex // 串行化重新加载
+}
+
+// NewReloadableHandler 包装已初始化的 Handler
+func NewReloadableHandler(h *Handler) *ReloadableHandler {
+	rh := &ReloadableHandler{}
+	rh.current.Store(h)
+	return rh
+}
+
+// Current 返回当前生效的 Handler
+func (rh *ReloadableHandler) Current() *Handler {
+	return rh.current.Load()
+}
+
+// ServeHTTP 交给当前生效的 Handler 处理
+func (rh *ReloadableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rh.Current().ServeHTTP(w, r)
+}
+
+// Reload 校验新配置并原子替换路由、别名、负载均衡器与限流配置。
+// 校验失败时保留旧配置，并记录错误与配置差异
+func (rh *ReloadableHandler) Reload(cfg *config.Config) error {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	current := rh.Current()
+	changes := config.Diff(current.cfg, cfg)
+	if err := cfg.Validate(); err != nil {
+		logger.Error("Rejected invalid config, keeping current config",
+			zap.Error(err),
+			zap.Strings("changes", changes))
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if len(changes) == 0 {
+		logger.Info("Config unchanged, skipping reload")
+		return nil
+	}
+	if ignored := restartRequired(changes); len(ignored) > 0 {
+		logger.Warn("Config changes require a restart to take effect", zap.Strings("changes", ignored))
+	}
+
+	next := current.withConfig(cfg)
+	next.syncLoadBalancers()
+	rh.current.Store(next)
+	logger.Info("Config reloaded", zap.Strings("changes", changes))
+	return nil
+}
+
+// ReloadFromFile 重新读取配置文件并加载
+func (rh *ReloadableHandler) ReloadFromFile(path string) error {
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		logger.Error("Failed to load config, keeping current config", zap.String("file", path), zap.Error(err))
+		return err
+	}
+	return rh.Reload(cfg)
+}
+
+// WatchConfig 在后台每隔 interval 检查配置文件内容，变化时重新加载；返回停止检查的函数。
+// 文件的当前内容在返回前读取，之后的修改都会被检测到
+func (rh *ReloadableHandler) WatchConfig(path string, interval time.Duration) (stop func()) {
+	last, _ := fileDigest(path)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			digest, err := fileDigest(path)
+			if err != nil {
+				logger.Warn("Failed to read config file", zap.String("file", path), zap.Error(err))
+				continue
+			}
+			if bytes.Equal(digest, last) {
+				continue
+			}
+			// 无论加载成功与否都记录本次内容，避免对同一份无效配置重复报错
+			last = digest
+			logger.Info("Config file changed, reloading", zap.String("file", path))
+			_ = rh.ReloadFromFile(path)
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+func fileDigest(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// restartRequired 返回需要重启才能生效的变化项
+func restartRequired(changes []string) []string {
+	var result []string
+	for _, change := range changes {
+		name, _, _ := strings.Cut(change, ":")
+		for _, section := range restartRequiredSections {
+			if name == section || strings.HasPrefix(name, section+".") {
+				result = append(result, change)
+				break
+			}
+		}
+	}
+	return result
+}
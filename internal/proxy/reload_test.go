@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newNamedUpstream(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"upstream":"` + name + `"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newReloadTestConfig(a, b string) *config.Config {
+	return &config.Config{
+		TargetMap: map[string]string{"/chat/completions": a},
+		ModelRoutes: map[string]interface{}{
+			"gpt-4":  map[string]interface{}{"urls": []interface{}{a, b}},
+			"claude": a,
+		},
+	}
+}
+
+func sendModelRequest(t *testing.T, handler http.Handler, model string) (int, string) {
+	t.Helper()
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader(`{"model":"`+model+`"}`))
+	handler.ServeHTTP(resp, req)
+	return resp.Code, resp.Body.String()
+}
+
+func TestReloadableHandler_Reload(t *testing.T) {
+	a, b := newNamedUpstream(t, "a"), newNamedUpstream(t, "b")
+	handler := NewHandler(newReloadTestConfig(a.URL, b.URL))
+	handler.InitLoadBalancers()
+	defer handler.health.Stop()
+	reloadable := NewReloadableHandler(handler)
+
+	_, body := sendModelRequest(t, reloadable, "gpt-4")
+	require.Contains(t, body, `"a"`)
+	balancer, _ := handler.lbManager.GetLoadBalancer("gpt-4")
+
+	updated := newReloadTestConfig(a.URL, b.URL)
+	updated.ModelRoutes["claude"] = b.URL
+	updated.ModelAlias = map[string]string{"my-claude": "claude"}
+	require.NoError(t, reloadable.Reload(updated))
+	require.NotSame(t, handler, reloadable.Current())
+	require.Same(t, updated, reloadable.Current().cfg)
+
+	// 未变化的路由保留负载均衡器及其轮询位置
+	current, _ := handler.lbManager.GetLoadBalancer("gpt-4")
+	require.Same(t, balancer, current)
+	_, body = sendModelRequest(t, reloadable, "gpt-4")
+	require.Contains(t, body, `"b"`)
+
+	_, body = sendModelRequest(t, reloadable, "claude")
+	require.Contains(t, body, `"b"`)
+	_, body = sendModelRequest(t, reloadable, "my-claude")
+	require.Contains(t, body, `"b"`)
+
+	// 删除的模型同时移除负载均衡器
+	removed := newReloadTestConfig(a.URL, b.URL)
+	delete(removed.ModelRoutes, "claude")
+	require.NoError(t, reloadable.Reload(removed))
+	_, ok := handler.lbManager.GetLoadBalancer("claude")
+	require.False(t, ok)
+	_, ok = handler.lbManager.GetLoadBalancer("my-claude")
+	require.False(t, ok)
+
+	// 不再使用的 URL 从健康检查中移除
+	c := newNamedUpstream(t, "c")
+	added := newReloadTestConfig(a.URL, b.URL)
+	added.ModelRoutes["claude"] = c.URL
+	require.NoError(t, reloadable.Reload(added))
+	require.Contains(t, upstreamURLs(handler.health), c.URL)
+	require.NoError(t, reloadable.Reload(newReloadTestConfig(a.URL, b.URL)))
+	require.NotContains(t, upstreamURLs(handler.health), c.URL)
+	require.Contains(t, upstreamURLs(handler.health), b.URL)
+}
+
+func upstreamURLs(hc *HealthChecker) []string {
+	var urls []string
+	for _, status := range hc.Snapshot() {
+		urls = append(urls, status.URL)
+	}
+	return urls
+}
+
+func TestReloadableHandler_RejectInvalidConfig(t *testing.T) {
+	a, b := newNamedUpstream(t, "a"), newNamedUpstream(t, "b")
+	handler := NewHandler(newReloadTestConfig(a.URL, b.URL))
+	handler.InitLoadBalancers()
+	defer handler.health.Stop()
+	reloadable := NewReloadableHandler(handler)
+
+	invalid := newReloadTestConfig(a.URL, b.URL)
+	invalid.ModelRoutes["claude"] = b.URL
+	invalid.ModelAlias = map[string]string{"my-gpt": "gpt-5"}
+	err := reloadable.Reload(invalid)
+	require.ErrorContains(t, err, "model_aliases.my-gpt")
+
+	// 保留旧配置与负载均衡器
+	require.Same(t, handler, reloadable.Current())
+	_, body := sendModelRequest(t, reloadable, "claude")
+	require.Contains(t, body, `"a"`)
+}
+
+func TestReloadableHandler_InFlightRequest(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = w.Write([]byte(`{"upstream":"slow"}`))
+	}))
+	defer slow.Close()
+	a, b := newNamedUpstream(t, "a"), newNamedUpstream(t, "b")
+
+	cfg := newReloadTestConfig(a.URL, b.URL)
+	cfg.TargetMap["/slow"] = slow.URL
+	handler := NewHandler(cfg)
+	handler.InitLoadBalancers()
+	defer handler.health.Stop()
+	reloadable := NewReloadableHandler(handler)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		resp := httptest.NewRecorder()
+		reloadable.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		done <- resp
+	}()
+	<-started
+
+	require.NoError(t, reloadable.Reload(newReloadTestConfig(a.URL, b.URL)))
+	code, _ := sendPathRequest(reloadable, "/slow")
+	require.Equal(t, http.StatusNotFound, code)
+
+	// 进行中的请求继续使用旧配置完成
+	close(release)
+	resp := <-done
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Contains(t, resp.Body.String(), `"slow"`)
+}
+
+func sendPathRequest(handler http.Handler, path string) (int, string) {
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, path, nil))
+	return resp.Code, resp.Body.String()
+}
+
+func TestReloadableHandler_WatchConfig(t *testing.T) {
+	a, b := newNamedUpstream(t, "a"), newNamedUpstream(t, "b")
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig := func(claude string) {
+		data := "target_map:\n  /chat/completions: " + a.URL + "\n" +
+			"model_routes:\n  claude: " + claude + "\n"
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+	}
+	writeConfig(a.URL)
+	cfg, err := config.LoadConfig(path)
+	require.NoError(t, err)
+	handler := NewHandler(cfg)
+	handler.InitLoadBalancers()
+	defer handler.health.Stop()
+	reloadable := NewReloadableHandler(handler)
+
+	stop := reloadable.WatchConfig(path, 10*time.Millisecond)
+	defer stop()
+
+	writeConfig(b.URL)
+	require.Eventually(t, func() bool {
+		_, body := sendModelRequest(t, reloadable, "claude")
+		return strings.Contains(body, `"b"`)
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+// ttlRecordingStorage 与 storage.Storage 一样按当前配置计算 LLM 缓存的 expire_at
+type ttlRecordingStorage struct {
+	fakeLLMCacheStorage
+	mu      sync.Mutex
+	cfg     *config.Config
+	written []int64
+}
+
+func (s *ttlRecordingStorage) SetConfig(cfg *config.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg = cfg
+}
+
+func (s *ttlRecordingStorage) UpsertLLM(_ context.Context, rec *db.LLMRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec.ExpireAt == nil {
+		expireAt := db.ExpireAtFromTTL(time.Now(), s.cfg.CacheTTL(rec.ModelName))
+		rec.ExpireAt = &expireAt
+	}
+	s.written = append(s.written, *rec.ExpireAt)
+	return nil
+}
+
+func (s *ttlRecordingStorage) lastExpireAt() (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.written) == 0 {
+		return 0, false
+	}
+	return s.written[len(s.written)-1], true
+}
+
+func TestReloadableHandler_ReloadCacheTTL(t *testing.T) {
+	a, b := newNamedUpstream(t, "a"), newNamedUpstream(t, "b")
+	cfg := newReloadTestConfig(a.URL, b.URL)
+	cfg.Cache.TTL = 60
+	storage := &ttlRecordingStorage{cfg: cfg}
+	handler := NewHandler(cfg)
+	handler.storage = storage
+	handler.InitLoadBalancers()
+	defer handler.health.Stop()
+	reloadable := NewReloadableHandler(handler)
+
+	expireAfter := func(content string, ttl time.Duration) {
+		t.Helper()
+		before := time.Now()
+		resp := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/chat/completions",
+			strings.NewReader(`{"model":"gpt-4","messages":[{"role":"user","content":"`+content+`"}]}`))
+		reloadable.ServeHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+		expireAt, ok := storage.lastExpireAt()
+		require.True(t, ok)
+		require.InDelta(t, before.Add(ttl).UnixMilli(), expireAt, 1000)
+	}
+	expireAfter("first", time.Minute)
+
+	updated := newReloadTestConfig(a.URL, b.URL)
+	updated.Cache.TTL = 3600
+	// 校验要求开启缓存时配置数据库与 Redis，连接参数在重新加载时不生效
+	updated.Database = config.DatabaseConfig{Host: "localhost", User: "llm", DBName: "llm"}
+	updated.Redis = config.RedisConfig{Addr: "localhost:6379"}
+	require.NoError(t, reloadable.Reload(updated))
+	expireAfter("second", time.Hour)
+}
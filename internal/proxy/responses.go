@@ -0,0 +1,585 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// OpenAI Responses API 与 Chat Completions 之间的格式转换
+
+// responsesRequest Responses API 请求体中支持的字段
+type responsesRequest struct {
+	Model              string            `json:"model"`
+	Input              json.RawMessage   `json:"input"` // 字符串或输入项数组
+	Instructions       string            `json:"instructions,omitempty"`
+	PreviousResponseID string            `json:"previous_response_id,omitempty"`
+	Store              *bool             `json:"store,omitempty"` // 默认 true
+	Stream             bool              `json:"stream,omitempty"`
+	MaxOutputTokens    *int              `json:"max_output_tokens,omitempty"`
+	Temperature        *float64          `json:"temperature,omitempty"`
+	TopP               *float64          `json:"top_p,omitempty"`
+	Tools              []responsesTool   `json:"tools,omitempty"`
+	ToolChoice         json.RawMessage   `json:"tool_choice,omitempty"`
+	ParallelToolCalls  *bool             `json:"parallel_tool_calls,omitempty"`
+	Text               *responsesText    `json:"text,omitempty"`
+	User               string            `json:"user,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+}
+
+// responsesInputItem 输入项，按 Type 使用不同字段；省略 Type 的输入项是消息
+type responsesInputItem struct {
+	Type string `json:"type,omitempty"` // message、function_call、function_call_output、reasoning
+
+	// message，content 为字符串或内容片段数组
+	Role    string          `json:"role,omitempty"`
+	Content json.RawMessage `json:"content,omitempty"`
+
+	// function_call 与 function_call_output
+	CallID    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Output    json.RawMessage `json:"output,omitempty"` // 字符串或内容片段数组
+}
+
+// responsesContentPart 消息内容片段
+type responsesContentPart struct {
+	Type     string `json:"type"` // input_text、output_text、refusal、input_image
+	Text     string `json:"text,omitempty"`
+	Refusal  string `json:"refusal,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+type responsesTool struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+	Strict      *bool           `json:"strict,omitempty"`
+}
+
+type responsesText struct {
+	Format *responsesTextFormat `json:"format,omitempty"`
+}
+
+type responsesTextFormat struct {
+	Type        string          `json:"type"` // text、json_object、json_schema
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	Strict      *bool           `json:"strict,omitempty"`
+}
+
+// responsesObject Responses API 响应对象，非流式响应、流式事件与存储共用
+type responsesObject struct {
+	ID                 string               `json:"id"`
+	Object             string               `json:"object"`
+	CreatedAt          int64                `json:"created_at"`
+	Status             string               `json:"status"` // in_progress、completed、incomplete、failed
+	Error              *responsesError      `json:"error"`
+	IncompleteDetails  *responsesIncomplete `json:"incomplete_details"`
+	Instructions       *string              `json:"instructions"`
+	MaxOutputTokens    *int                 `json:"max_output_tokens"`
+	Model              string               `json:"model"`
+	Output             []interface{}        `json:"output"` // responsesMessageItem 或 responsesFunctionCallItem
+	ParallelToolCalls  bool                 `json:"parallel_tool_calls"`
+	PreviousResponseID *string              `json:"previous_response_id"`
+	Store              bool                 `json:"store"`
+	Temperature        *float64             `json:"temperature"`
+	Text               responsesText        `json:"text"`
+	ToolChoice         json.RawMessage      `json:"tool_choice"`
+	Tools              []responsesTool      `json:"tools"`
+	TopP               *float64             `json:"top_p"`
+	Usage              *responsesUsage      `json:"usage"`
+	Metadata           map[string]string    `json:"metadata"`
+}
+
+type responsesError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type responsesIncomplete struct {
+	Reason string `json:"reason"` // max_output_tokens、content_filter
+}
+
+type responsesMessageItem struct {
+	Type    string                `json:"type"`
+	ID      string                `json:"id"`
+	Status  string                `json:"status"`
+	Role    string                `json:"role"`
+	Content []responsesOutputText `json:"content"`
+}
+
+type responsesOutputText struct {
+	Type        string            `json:"type"`
+	Text        string            `json:"text"`
+	Annotations []json.RawMessage `json:"annotations"`
+}
+
+type responsesFunctionCallItem struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Status    string `json:"status"`
+}
+
+type responsesUsage struct {
+	InputTokens         int                    `json:"input_tokens"`
+	InputTokensDetails  responsesInputDetails  `json:"input_tokens_details"`
+	OutputTokens        int                    `json:"output_tokens"`
+	OutputTokensDetails responsesOutputDetails `json:"output_tokens_details"`
+	TotalTokens         int                    `json:"total_tokens"`
+}
+
+type responsesInputDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type responsesOutputDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// responsesToChatRequest 将 Responses API 请求转换为 Chat Completions 请求。history 为 previous_response_id
+// 对应的对话历史；返回的 conversation 为历史加上本次输入（不含 instructions，与 OpenAI 一样不沿用到下一轮）
+func responsesToChatRequest(req *responsesRequest, history []chatMessage) (*chatCompletionRequest, []chatMessage, error) {
+	if req.Model == "" {
+		return nil, nil, fmt.Errorf("model: field required")
+	}
+	input, err := responsesInputToChat(req.Input)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(input) == 0 {
+		return nil, nil, fmt.Errorf("input: field required")
+	}
+	conversation := append(append([]chatMessage{}, history...), input...)
+
+	chat := &chatCompletionRequest{
+		Model:             req.Model,
+		MaxTokens:         req.MaxOutputTokens,
+		Temperature:       req.Temperature,
+		TopP:              req.TopP,
+		Stream:            req.Stream,
+		ParallelToolCalls: req.ParallelToolCalls,
+		User:              req.User,
+	}
+	if req.Instructions != "" {
+		chat.Messages = append(chat.Messages, chatMessage{Role: "system", Content: req.Instructions})
+	}
+	chat.Messages = append(chat.Messages, conversation...)
+	if req.Stream {
+		// response.completed 需要用量
+		chat.StreamOptions = &chatStreamOptions{IncludeUsage: true}
+	}
+
+	for i, tool := range req.Tools {
+		if tool.Type != "function" {
+			return nil, nil, fmt.Errorf("tools.%d: unsupported tool type %q", i, tool.Type)
+		}
+		chat.Tools = append(chat.Tools, chatTool{
+			Type: "function",
+			Function: chatFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	if chat.ToolChoice, err = responsesToolChoice(req.ToolChoice); err != nil {
+		return nil, nil, err
+	}
+	if req.Text != nil && req.Text.Format != nil {
+		if chat.ResponseFormat, err = responsesResponseFormat(req.Text.Format); err != nil {
+			return nil, nil, err
+		}
+	}
+	return chat, conversation, nil
+}
+
+// responsesInputToChat 转换 input：字符串视为一条用户消息；function_call 合并到前一条 assistant 消息，
+// function_call_output 转换为 tool 消息，reasoning 没有对应字段，直接丢弃
+func responsesInputToChat(raw json.RawMessage) ([]chatMessage, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, fmt.Errorf("input: %w", err)
+		}
+		return []chatMessage{{Role: "user", Content: text}}, nil
+	}
+	var items []responsesInputItem
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("input: %w", err)
+	}
+
+	var messages []chatMessage
+	for i, item := range items {
+		switch item.Type {
+		case "", "message":
+			msg, err := responsesMessageToChat(item)
+			if err != nil {
+				return nil, fmt.Errorf("input.%d: %w", i, err)
+			}
+			messages = append(messages, msg)
+		case "function_call":
+			call := chatToolCall{
+				ID:       item.CallID,
+				Type:     "function",
+				Function: llmStreamToolFunction{Name: item.Name, Arguments: item.Arguments},
+			}
+			if last := len(messages) - 1; last >= 0 && messages[last].Role == "assistant" {
+				messages[last].ToolCalls = append(messages[last].ToolCalls, call)
+			} else {
+				messages = append(messages, chatMessage{Role: "assistant", ToolCalls: []chatToolCall{call}})
+			}
+		case "function_call_output":
+			output, err := functionCallOutputText(item.Output)
+			if err != nil {
+				return nil, fmt.Errorf("input.%d.output: %w", i, err)
+			}
+			messages = append(messages, chatMessage{Role: "tool", ToolCallID: item.CallID, Content: output})
+		case "reasoning":
+		default:
+			return nil, fmt.Errorf("input.%d: unsupported item type %q", i, item.Type)
+		}
+	}
+	return messages, nil
+}
+
+// responsesMessageToChat developer 消息转换为 system，兼容不支持 developer 角色的上游
+func responsesMessageToChat(item responsesInputItem) (chatMessage, error) {
+	role := item.Role
+	switch role {
+	case "user", "system", "assistant":
+	case "developer":
+		role = "system"
+	default:
+		return chatMessage{}, fmt.Errorf("unsupported role %q", item.Role)
+	}
+
+	parts, err := parseResponsesContent(item.Content)
+	if err != nil {
+		return chatMessage{}, fmt.Errorf("content: %w", err)
+	}
+	var chatParts []chatContentPart
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text":
+			chatParts = append(chatParts, chatContentPart{Type: "text", Text: part.Text})
+		case "refusal":
+			chatParts = append(chatParts, chatContentPart{Type: "text", Text: part.Refusal})
+		case "input_image":
+			if part.ImageURL == "" {
+				return chatMessage{}, fmt.Errorf("input_image: image_url required")
+			}
+			chatParts = append(chatParts, chatContentPart{Type: "image_url", ImageURL: &chatImageURL{URL: part.ImageURL}})
+		default:
+			return chatMessage{}, fmt.Errorf("unsupported content type %q", part.Type)
+		}
+	}
+
+	msg := chatMessage{Role: role}
+	hasImage := false
+	texts := make([]string, 0, len(chatParts))
+	for _, part := range chatParts {
+		hasImage = hasImage || part.Type == "image_url"
+		texts = append(texts, part.Text)
+	}
+	if hasImage {
+		msg.Content = chatParts
+	} else {
+		msg.Content = strings.Join(texts, "")
+	}
+	return msg, nil
+}
+
+// parseResponsesContent 解析字符串或内容片段数组形式的 content
+func parseResponsesContent(raw json.RawMessage) ([]responsesContentPart, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		return []responsesContentPart{{Type: "input_text", Text: text}}, nil
+	}
+	var parts []responsesContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+// functionCallOutputText 拼接 function_call_output 的文本内容
+func functionCallOutputText(raw json.RawMessage) (string, error) {
+	parts, err := parseResponsesContent(raw)
+	if err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	for _, part := range parts {
+		text.WriteString(part.Text)
+	}
+	return text.String(), nil
+}
+
+// responsesToolChoice 转换 tool_choice：字符串原样使用，{"type":"function","name":...} 转换为 chat 格式
+func responsesToolChoice(raw json.RawMessage) (interface{}, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+	var mode string
+	if err := json.Unmarshal(raw, &mode); err == nil {
+		switch mode {
+		case "auto", "none", "required":
+			return mode, nil
+		}
+		return nil, fmt.Errorf("tool_choice: unsupported value %q", mode)
+	}
+	var choice struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(raw, &choice); err != nil || choice.Type != "function" || choice.Name == "" {
+		return nil, fmt.Errorf("tool_choice: only function tools are supported")
+	}
+	return map[string]interface{}{
+		"type":     "function",
+		"function": map[string]string{"name": choice.Name},
+	}, nil
+}
+
+// responsesResponseFormat 将 text.format 转换为 chat 的 response_format
+func responsesResponseFormat(format *responsesTextFormat) (interface{}, error) {
+	switch format.Type {
+	case "", "text":
+		return nil, nil
+	case "json_object":
+		return map[string]string{"type": "json_object"}, nil
+	case "json_schema":
+		schema := map[string]interface{}{"name": format.Name}
+		if format.Description != "" {
+			schema["description"] = format.Description
+		}
+		if len(format.Schema) > 0 {
+			schema["schema"] = format.Schema
+		}
+		if format.Strict != nil {
+			schema["strict"] = *format.Strict
+		}
+		return map[string]interface{}{"type": "json_schema", "json_schema": schema}, nil
+	}
+	return nil, fmt.Errorf("text.format: unsupported type %q", format.Type)
+}
+
+// responsesBuilder 累积 chat completions 的输出（非流式响应或流式分片），生成响应对象与 assistant 消息
+type responsesBuilder struct {
+	req       *responsesRequest
+	id        string
+	createdAt int64
+	store     bool
+
+	items        []*responsesItemState
+	finishReason string
+	usage        *llmUsage
+}
+
+// responsesItemState 一个输出项：文本消息或函数调用
+type responsesItemState struct {
+	id   string
+	text strings.Builder
+	call *chatToolCall
+}
+
+func newResponsesBuilder(req *responsesRequest, createdAt int64, store bool) *responsesBuilder {
+	return &responsesBuilder{req: req, id: responsesID("resp_"), createdAt: createdAt, store: store}
+}
+
+// responsesID 生成带前缀的随机 ID
+func responsesID(prefix string) string {
+	return prefix + strings.ReplaceAll(uuid.NewString(), "-", "")
+}
+
+// addText 追加文本，最后一个输出项不是消息时新建消息
+func (b *responsesBuilder) addText(text string) (item *responsesItemState, opened bool) {
+	if last := b.lastItem(); last != nil && last.call == nil {
+		last.text.WriteString(text)
+		return last, false
+	}
+	item = &responsesItemState{id: responsesID("msg_")}
+	item.text.WriteString(text)
+	b.items = append(b.items, item)
+	return item, true
+}
+
+// addToolCall 新建函数调用输出项，上游未返回调用 ID 时生成一个
+func (b *responsesBuilder) addToolCall(id, name, arguments string) *responsesItemState {
+	if id == "" {
+		id = responsesID("call_")
+	}
+	item := &responsesItemState{
+		id:   responsesID("fc_"),
+		call: &chatToolCall{ID: id, Type: "function", Function: llmStreamToolFunction{Name: name, Arguments: arguments}},
+	}
+	b.items = append(b.items, item)
+	return item
+}
+
+func (b *responsesBuilder) lastItem() *responsesItemState {
+	if len(b.items) == 0 {
+		return nil
+	}
+	return b.items[len(b.items)-1]
+}
+
+// addCompletion 读取非流式 chat completions 响应
+func (b *responsesBuilder) addCompletion(body []byte) error {
+	var completion llmCompletion
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return fmt.Errorf("invalid chat completion: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return fmt.Errorf("chat completion has no choices")
+	}
+	choice := completion.Choices[0]
+	if content := choice.Message.Content; content != nil && *content != "" {
+		b.addText(*content)
+	}
+	for _, call := range choice.Message.ToolCalls {
+		b.addToolCall(call.ID, call.Function.Name, call.Function.Arguments)
+	}
+	if choice.FinishReason != nil {
+		b.finishReason = *choice.FinishReason
+	}
+	if usage, ok := extractUsage(body); ok {
+		b.usage = usage
+	}
+	return nil
+}
+
+// itemJSON 输出项，status 为 in_progress 时为流式事件中尚未完成的输出项
+func (item *responsesItemState) itemJSON(status string) interface{} {
+	if item.call != nil {
+		return responsesFunctionCallItem{
+			Type:      "function_call",
+			ID:        item.id,
+			CallID:    item.call.ID,
+			Name:      item.call.Function.Name,
+			Arguments: item.call.Function.Arguments,
+			Status:    status,
+		}
+	}
+	content := []responsesOutputText{}
+	if status != "in_progress" {
+		content = append(content, responsesOutputPart(item.text.String()))
+	}
+	return responsesMessageItem{Type: "message", ID: item.id, Status: status, Role: "assistant", Content: content}
+}
+
+func responsesOutputPart(text string) responsesOutputText {
+	return responsesOutputText{Type: "output_text", Text: text, Annotations: []json.RawMessage{}}
+}
+
+// response 生成响应对象；status 为空时按 finish_reason 判断 completed 或 incomplete
+func (b *responsesBuilder) response(status string, failure *responsesError) *responsesObject {
+	resp := &responsesObject{
+		ID:                b.id,
+		Object:            "response",
+		CreatedAt:         b.createdAt,
+		Status:            status,
+		Error:             failure,
+		MaxOutputTokens:   b.req.MaxOutputTokens,
+		Model:             b.req.Model,
+		Output:            []interface{}{},
+		ParallelToolCalls: b.req.ParallelToolCalls == nil || *b.req.ParallelToolCalls,
+		Store:             b.store,
+		Temperature:       b.req.Temperature,
+		Text:              responsesText{Format: &responsesTextFormat{Type: "text"}},
+		ToolChoice:        b.req.ToolChoice,
+		Tools:             b.req.Tools,
+		TopP:              b.req.TopP,
+		Metadata:          b.req.Metadata,
+	}
+	if b.req.Instructions != "" {
+		resp.Instructions = &b.req.Instructions
+	}
+	if b.req.PreviousResponseID != "" {
+		resp.PreviousResponseID = &b.req.PreviousResponseID
+	}
+	if b.req.Text != nil && b.req.Text.Format != nil {
+		resp.Text = *b.req.Text
+	}
+	if len(resp.ToolChoice) == 0 {
+		resp.ToolChoice = json.RawMessage(`"auto"`)
+	}
+	if resp.Tools == nil {
+		resp.Tools = []responsesTool{}
+	}
+	if resp.Metadata == nil {
+		resp.Metadata = map[string]string{}
+	}
+	if status == "" {
+		resp.Status = "completed"
+		switch b.finishReason {
+		case "length":
+			resp.Status = "incomplete"
+			resp.IncompleteDetails = &responsesIncomplete{Reason: "max_output_tokens"}
+		case "content_filter":
+			resp.Status = "incomplete"
+			resp.IncompleteDetails = &responsesIncomplete{Reason: "content_filter"}
+		}
+	}
+	if resp.Status == "in_progress" {
+		return resp
+	}
+	for _, item := range b.items {
+		resp.Output = append(resp.Output, item.itemJSON(itemStatus(resp.Status)))
+	}
+	if b.usage != nil {
+		resp.Usage = &responsesUsage{
+			InputTokens:  b.usage.PromptTokens,
+			OutputTokens: b.usage.CompletionTokens,
+			TotalTokens:  b.usage.TotalTokens,
+		}
+	}
+	return resp
+}
+
+// itemStatus 输出项的状态：响应未完整结束时输出项为 incomplete
+func itemStatus(responseStatus string) string {
+	if responseStatus == "completed" {
+		return "completed"
+	}
+	return "incomplete"
+}
+
+// assistantMessage 本次输出对应的 chat assistant 消息，追加到对话历史
+func (b *responsesBuilder) assistantMessage() chatMessage {
+	var text strings.Builder
+	var toolCalls []chatToolCall
+	for _, item := range b.items {
+		if item.call != nil {
+			toolCalls = append(toolCalls, *item.call)
+		} else {
+			text.WriteString(item.text.String())
+		}
+	}
+	msg := chatMessage{Role: "assistant", ToolCalls: toolCalls}
+	if text.Len() > 0 || len(toolCalls) == 0 {
+		msg.Content = text.String()
+	}
+	return msg
+}
@@ -0,0 +1,532 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/db"
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// responseStoreTimeout 保存和读取响应的超时时间
+const responseStoreTimeout = 5 * time.Second
+
+// responseStore Responses API 保存响应与对话历史的存储，由 *storage.Storage 实现
+type responseStore interface {
+	SaveResponse(ctx context.Context, rec *db.ResponseRecord) error
+	GetResponse(ctx context.Context, responseID string) (*db.ResponseRecord, error)
+	DeleteResponse(ctx context.Context, responseID string) (bool, error)
+}
+
+// serveResponsesAPI 处理 OpenAI Responses API 请求：
+//
+//	POST   <path>       转换为 chat completions 请求后经完整的代理流程转发到 chat_path，响应转换回 Responses 格式
+//	GET    <path>/{id}  查询保存的响应
+//	DELETE <path>/{id}  删除保存的响应
+//
+// 在 ServeHTTP 的限流、指标与追踪之后处理，读取或写入保存的响应前先鉴权。
+// 返回 true 表示请求已处理；显式配置的代理路径优先
+func (h *Handler) serveResponsesAPI(w http.ResponseWriter, r *http.Request) bool {
+	id, ok := h.responsesAPIRequest(r.URL.Path)
+	if !ok {
+		return false
+	}
+	if id == "" {
+		if r.Method != http.MethodPost {
+			writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "", "Method not allowed")
+			return true
+		}
+		h.createResponse(w, r)
+		return true
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodDelete:
+		h.serveStoredResponse(w, r, id)
+	default:
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "", "Method not allowed")
+	}
+	return true
+}
+
+// responsesAPIRequest 判断路径是否为 Responses API 接口，返回路径中的响应 ID（创建响应时为空）
+func (h *Handler) responsesAPIRequest(path string) (string, bool) {
+	if h.cfg == nil || h.cfg.ResponsesAPI.Path == "" {
+		return "", false
+	}
+	if _, ok := h.cfg.TargetMap[path]; ok {
+		return "", false
+	}
+	if path == h.cfg.ResponsesAPI.Path {
+		return "", true
+	}
+	id, ok := strings.CutPrefix(path, strings.TrimSuffix(h.cfg.ResponsesAPI.Path, "/")+"/")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+	return id, true
+}
+
+func (h *Handler) createResponse(w http.ResponseWriter, r *http.Request) {
+	requestID := utils.GetRequestID(r)
+	r, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "", "Failed to read request body")
+		return
+	}
+	var req responsesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "", "Invalid JSON body: "+err.Error())
+		return
+	}
+
+	store := req.Store == nil || *req.Store
+	if store && h.responses == nil {
+		logger.Warn("responses-api: response storage unavailable, response will not be stored",
+			zap.String("requestId", requestID))
+		store = false
+	}
+	owner := h.responseOwner(r)
+
+	var history []chatMessage
+	if req.PreviousResponseID != "" {
+		previous, ok := h.loadResponse(w, r, req.PreviousResponseID, owner)
+		if !ok {
+			return
+		}
+		if err := json.Unmarshal(previous.Messages, &history); err != nil {
+			logger.Error("responses-api: invalid stored conversation",
+				zap.String("requestId", requestID),
+				zap.String("responseId", previous.ResponseID),
+				zap.Error(err))
+			writeOpenAIError(w, http.StatusInternalServerError, "server_error", "", "Failed to load previous response")
+			return
+		}
+	}
+
+	chat, conversation, err := responsesToChatRequest(&req, history)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "", err.Error())
+		return
+	}
+	chatBody, err := json.Marshal(chat)
+	if err != nil {
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "", "Failed to encode chat completions request")
+		return
+	}
+
+	inner := r.Clone(r.Context())
+	inner.URL.Path = h.cfg.ResponsesAPI.ChatPathOrDefault()
+	inner.URL.RawPath = ""
+	inner.Body = io.NopCloser(bytes.NewReader(chatBody))
+	inner.ContentLength = int64(len(chatBody))
+	inner.Header.Set("Content-Length", strconv.Itoa(len(chatBody)))
+	inner.Header.Set("Content-Type", "application/json")
+	// 响应需要解析转换，不接受压缩
+	inner.Header.Del("Accept-Encoding")
+
+	builder := newResponsesBuilder(&req, time.Now().Unix(), store)
+	var save func(resp *responsesObject) // 保存最终响应，未开启 store 时为 nil
+	if store {
+		// 在返回最终响应之前保存，客户端收到响应后立即续接也能找到
+		save = func(resp *responsesObject) {
+			h.saveResponse(r.Context(), requestID, owner, &req, conversation, builder, resp)
+		}
+	}
+	rw := &frontendResponseWriter{
+		ResponseWriter: w,
+		newStream: func(out io.Writer) frontendStreamWriter {
+			return newResponsesStreamWriter(out, builder, save)
+		},
+		onError: func(out http.ResponseWriter, status int, body []byte) {
+			// 错误响应已是 OpenAI 格式（上游或代理自身返回），原样写出
+			if out.Header().Get("Content-Type") == "" {
+				out.Header().Set("Content-Type", "application/json")
+			}
+			out.WriteHeader(status)
+			_, _ = out.Write(body)
+		},
+		onSuccess: func(out http.ResponseWriter, body []byte) {
+			if err := builder.addCompletion(body); err != nil {
+				logger.Warn("responses-api: failed to translate chat completion",
+					zap.String("requestId", requestID),
+					zap.Error(err))
+				writeOpenAIError(out, http.StatusBadGateway, "server_error", "", "Invalid response from upstream")
+				return
+			}
+			resp := builder.response("", nil)
+			if save != nil {
+				save(resp)
+			}
+			writeJSON(out, http.StatusOK, resp)
+		},
+	}
+	h.forward(rw, inner)
+	rw.finish()
+}
+
+// responseOwner 开启鉴权时返回已认证的虚拟 API Key，保存的响应只能由同一个 key 读取与续接
+func (h *Handler) responseOwner(r *http.Request) int {
+	if rec := apiKeyFromContext(r.Context()); rec != nil {
+		return rec.ID
+	}
+	return 0
+}
+
+// loadResponse 读取属于 owner 的响应，不存在、已过期或属于其他 key 时返回 404
+func (h *Handler) loadResponse(w http.ResponseWriter, r *http.Request, id string, owner int) (*db.ResponseRecord, bool) {
+	if h.responses == nil {
+		writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", "service_unavailable", "Response storage is unavailable.")
+		return nil, false
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), responseStoreTimeout)
+	defer cancel()
+	rec, err := h.responses.GetResponse(ctx, id)
+	if err != nil {
+		logger.Error("responses-api: failed to load response",
+			zap.String("requestId", utils.GetRequestID(r)),
+			zap.String("responseId", id),
+			zap.Error(err))
+		writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", "service_unavailable", "Response storage is unavailable.")
+		return nil, false
+	}
+	if rec == nil || rec.APIKeyID != owner {
+		writeOpenAIError(w, http.StatusNotFound, "invalid_request_error", "not_found",
+			fmt.Sprintf("Response with id '%s' not found.", id))
+		return nil, false
+	}
+	return rec, true
+}
+
+// serveStoredResponse 查询或删除保存的响应，开启鉴权时需要与创建时相同的虚拟 API Key
+func (h *Handler) serveStoredResponse(w http.ResponseWriter, r *http.Request, id string) {
+	r, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	rec, ok := h.loadResponse(w, r, id, h.responseOwner(r))
+	if !ok {
+		return
+	}
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(rec.Response)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), responseStoreTimeout)
+	defer cancel()
+	if _, err := h.responses.DeleteResponse(ctx, id); err != nil {
+		logger.Error("responses-api: failed to delete response",
+			zap.String("requestId", utils.GetRequestID(r)),
+			zap.String("responseId", id),
+			zap.Error(err))
+		writeOpenAIError(w, http.StatusServiceUnavailable, "server_error", "service_unavailable", "Response storage is unavailable.")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "object": "response", "deleted": true})
+}
+
+// saveResponse 保存响应与截至本响应的对话历史；保存失败只记录日志，响应仍正常返回
+func (h *Handler) saveResponse(ctx context.Context, requestID string, owner int, req *responsesRequest, conversation []chatMessage, builder *responsesBuilder, resp *responsesObject) {
+	messages, err := json.Marshal(append(conversation, builder.assistantMessage()))
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	rec := &db.ResponseRecord{
+		ResponseID:         resp.ID,
+		PreviousResponseID: req.PreviousResponseID,
+		RequestID:          requestID,
+		APIKeyID:           owner,
+		ModelName:          req.Model,
+		Messages:           messages,
+		Response:           data,
+	}
+	if resp.Usage != nil {
+		rec.PromptTokens = &resp.Usage.InputTokens
+		rec.CompletionTokens = &resp.Usage.OutputTokens
+		rec.TotalTokens = &resp.Usage.TotalTokens
+	}
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), responseStoreTimeout)
+	defer cancel()
+	if err := h.responses.SaveResponse(saveCtx, rec); err != nil {
+		logger.Warn("responses-api: failed to store response",
+			zap.String("requestId", requestID),
+			zap.String("responseId", resp.ID),
+			zap.Error(err))
+	}
+}
+
+// responsesStreamEvent Responses API 流式事件的 data，按事件类型使用不同字段
+type responsesStreamEvent struct {
+	Type           string               `json:"type"`
+	SequenceNumber int                  `json:"sequence_number"`
+	Response       *responsesObject     `json:"response,omitempty"`
+	OutputIndex    *int                 `json:"output_index,omitempty"`
+	ItemID         string               `json:"item_id,omitempty"`
+	ContentIndex   *int                 `json:"content_index,omitempty"`
+	Item           interface{}          `json:"item,omitempty"`
+	Part           *responsesOutputText `json:"part,omitempty"`
+	Delta          string               `json:"delta,omitempty"`
+	Text           *string              `json:"text,omitempty"`
+	Arguments      *string              `json:"arguments,omitempty"`
+}
+
+// responsesStreamWriter 将 chat completions 的 SSE 流转换为 Responses API 流式事件：
+// response.created、每个输出项的 added/delta/done 事件与 response.completed
+type responsesStreamWriter struct {
+	w       io.Writer
+	builder *responsesBuilder
+	save    func(resp *responsesObject)
+
+	pending  []byte
+	started  bool
+	finished bool
+	sequence int
+
+	open     *responsesItemState // 当前打开的输出项
+	openTool int                 // 当前打开的函数调用对应的上游 tool_calls 序号
+}
+
+func newResponsesStreamWriter(w io.Writer, builder *responsesBuilder, save func(resp *responsesObject)) *responsesStreamWriter {
+	return &responsesStreamWriter{w: w, builder: builder, save: save}
+}
+
+// Write 接收任意切分的 SSE 数据，按完整的行处理
+func (s *responsesStreamWriter) Write(p []byte) error {
+	s.pending = append(s.pending, p...)
+	for {
+		i := bytes.IndexByte(s.pending, '\n')
+		if i < 0 {
+			return nil
+		}
+		line := strings.TrimRight(string(s.pending[:i]), "\r")
+		s.pending = s.pending[i+1:]
+		if err := s.handleLine(line); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *responsesStreamWriter) handleLine(line string) error {
+	if !strings.HasPrefix(line, "data:") || s.finished {
+		return nil
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "" {
+		return nil
+	}
+	if data == "[DONE]" {
+		return s.finish()
+	}
+
+	var chunk llmStreamChunk
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return nil
+	}
+	if len(chunk.Choices) == 0 && len(chunk.Usage) == 0 && strings.Contains(data, `"error"`) {
+		// 部分上游在流中途以 data 行返回错误
+		return s.fail(upstreamErrorMessage(http.StatusOK, []byte(data)))
+	}
+	return s.handleChunk(&chunk)
+}
+
+func (s *responsesStreamWriter) handleChunk(chunk *llmStreamChunk) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	if len(chunk.Usage) > 0 {
+		var usage llmUsage
+		if err := json.Unmarshal(chunk.Usage, &usage); err == nil {
+			s.builder.usage = &usage
+		}
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if content := choice.Delta.Content; content != nil && *content != "" {
+			if err := s.addText(*content); err != nil {
+				return err
+			}
+		}
+		for _, call := range choice.Delta.ToolCalls {
+			if err := s.addToolCall(call); err != nil {
+				return err
+			}
+		}
+		if choice.FinishReason != nil {
+			s.builder.finishReason = *choice.FinishReason
+		}
+	}
+	return nil
+}
+
+func (s *responsesStreamWriter) start() error {
+	s.started = true
+	resp := s.builder.response("in_progress", nil)
+	if err := s.emit(responsesStreamEvent{Type: "response.created", Response: resp}); err != nil {
+		return err
+	}
+	return s.emit(responsesStreamEvent{Type: "response.in_progress", Response: resp})
+}
+
+func (s *responsesStreamWriter) addText(text string) error {
+	if s.open != nil && s.open.call != nil {
+		if err := s.closeItem(); err != nil {
+			return err
+		}
+	}
+	item, opened := s.builder.addText(text)
+	index := len(s.builder.items) - 1
+	zero := 0
+	if opened {
+		s.open = item
+		if err := s.emit(responsesStreamEvent{Type: "response.output_item.added", OutputIndex: &index, Item: item.itemJSON("in_progress")}); err != nil {
+			return err
+		}
+		part := responsesOutputPart("")
+		if err := s.emit(responsesStreamEvent{Type: "response.content_part.added", ItemID: item.id, OutputIndex: &index, ContentIndex: &zero, Part: &part}); err != nil {
+			return err
+		}
+	}
+	return s.emit(responsesStreamEvent{Type: "response.output_text.delta", ItemID: item.id, OutputIndex: &index, ContentIndex: &zero, Delta: text})
+}
+
+func (s *responsesStreamWriter) addToolCall(call llmStreamToolCall) error {
+	if s.open == nil || s.open.call == nil || s.openTool != call.Index || (call.ID != "" && call.ID != s.open.call.ID) {
+		if err := s.closeItem(); err != nil {
+			return err
+		}
+		s.open = s.builder.addToolCall(call.ID, call.Function.Name, "")
+		s.openTool = call.Index
+		index := len(s.builder.items) - 1
+		if err := s.emit(responsesStreamEvent{Type: "response.output_item.added", OutputIndex: &index, Item: s.open.itemJSON("in_progress")}); err != nil {
+			return err
+		}
+	}
+	if call.Function.Arguments == "" {
+		return nil
+	}
+	s.open.call.Function.Arguments += call.Function.Arguments
+	index := len(s.builder.items) - 1
+	return s.emit(responsesStreamEvent{
+		Type:        "response.function_call_arguments.delta",
+		ItemID:      s.open.id,
+		OutputIndex: &index,
+		Delta:       call.Function.Arguments,
+	})
+}
+
+// closeItem 结束当前打开的输出项
+func (s *responsesStreamWriter) closeItem() error {
+	item := s.open
+	if item == nil {
+		return nil
+	}
+	s.open = nil
+	index := len(s.builder.items) - 1
+	if item.call != nil {
+		arguments := item.call.Function.Arguments
+		if err := s.emit(responsesStreamEvent{Type: "response.function_call_arguments.done", ItemID: item.id, OutputIndex: &index, Arguments: &arguments}); err != nil {
+			return err
+		}
+	} else {
+		zero := 0
+		text := item.text.String()
+		part := responsesOutputPart(text)
+		if err := s.emit(responsesStreamEvent{Type: "response.output_text.done", ItemID: item.id, OutputIndex: &index, ContentIndex: &zero, Text: &text}); err != nil {
+			return err
+		}
+		if err := s.emit(responsesStreamEvent{Type: "response.content_part.done", ItemID: item.id, OutputIndex: &index, ContentIndex: &zero, Part: &part}); err != nil {
+			return err
+		}
+	}
+	return s.emit(responsesStreamEvent{Type: "response.output_item.done", OutputIndex: &index, Item: item.itemJSON("completed")})
+}
+
+// finish 在收到 [DONE] 时以 response.completed（或 response.incomplete）结束
+func (s *responsesStreamWriter) finish() error {
+	if s.finished {
+		return nil
+	}
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	if err := s.closeItem(); err != nil {
+		return err
+	}
+	s.finished = true
+	resp := s.builder.response("", nil)
+	if s.save != nil {
+		s.save(resp)
+	}
+	return s.emit(responsesStreamEvent{Type: "response." + resp.Status, Response: resp})
+}
+
+// fail 以 response.failed 结束流，失败的响应不保存
+func (s *responsesStreamWriter) fail(message string) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	s.finished = true
+	resp := s.builder.response("failed", &responsesError{Code: "server_error", Message: message})
+	return s.emit(responsesStreamEvent{Type: "response.failed", Response: resp})
+}
+
+// Close 在上游响应结束后调用：未收到 [DONE] 但已收到 finish_reason 时正常结束，否则以 response.failed 结束
+func (s *responsesStreamWriter) Close() {
+	if s.finished {
+		return
+	}
+	var err error
+	if s.builder.finishReason != "" {
+		err = s.finish()
+	} else {
+		err = s.fail("upstream stream ended unexpectedly")
+	}
+	if err != nil {
+		logger.Debug("responses-api: failed to finish stream", zap.Error(err))
+	}
+}
+
+func (s *responsesStreamWriter) emit(event responsesStreamEvent) error {
+	event.SequenceNumber = s.sequence
+	s.sequence++
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+		return err
+	}
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
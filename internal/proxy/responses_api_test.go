@@ -0,0 +1,309 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeResponseStore struct {
+	mu    sync.Mutex
+	saved map[string]*db.ResponseRecord
+	loads int
+}
+
+func newFakeResponseStore() *fakeResponseStore {
+	return &fakeResponseStore{saved: make(map[string]*db.ResponseRecord)}
+}
+
+func (f *fakeResponseStore) SaveResponse(_ context.Context, rec *db.ResponseRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.saved[rec.ResponseID] = rec
+	return nil
+}
+
+func (f *fakeResponseStore) GetResponse(_ context.Context, responseID string) (*db.ResponseRecord, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.loads++
+	return f.saved[responseID], nil
+}
+
+func (f *fakeResponseStore) DeleteResponse(_ context.Context, responseID string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.saved[responseID]
+	delete(f.saved, responseID)
+	return ok, nil
+}
+
+var responsesIDPattern = regexp.MustCompile(`"(resp|msg|fc)_[0-9a-f]{32}"`)
+
+// replaceResponsesIDs 将随机生成的 ID 替换为固定值，便于与 golden 文件比较
+func replaceResponsesIDs(data []byte) []byte {
+	return responsesIDPattern.ReplaceAll(data, []byte(`"${1}_test"`))
+}
+
+func TestResponsesAPI_RequestGolden(t *testing.T) {
+	for name, input := range goldenCases(t, "responses", ".request.json") {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			var req responsesRequest
+			require.NoError(t, json.Unmarshal(input, &req))
+			chat, _, err := responsesToChatRequest(&req, nil)
+			require.NoError(t, err)
+			checkGolden(t, name+".chat.json", marshalGolden(t, chat))
+		})
+	}
+}
+
+func TestResponsesAPI_StreamGolden(t *testing.T) {
+	for name, input := range goldenCases(t, "responses", ".stream.txt") {
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			var out bytes.Buffer
+			req := &responsesRequest{Model: "gpt-4o", Stream: true}
+			stream := newResponsesStreamWriter(&out, newResponsesBuilder(req, 1700000000, false), nil)
+			// 按任意位置切分输入，覆盖不完整行的缓冲
+			for len(input) > 0 {
+				n := min(7, len(input))
+				require.NoError(t, stream.Write(input[:n]))
+				input = input[n:]
+			}
+			stream.Close()
+			checkGolden(t, name+".events.txt", replaceResponsesIDs(out.Bytes()))
+		})
+	}
+}
+
+func TestResponsesToChatRequest_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"missing model", `{"input":"hi"}`, "model"},
+		{"no input", `{"model":"m"}`, "input"},
+		{"bad item", `{"model":"m","input":[{"type":"file_search_call"}]}`, `unsupported item type "file_search_call"`},
+		{"hosted tool", `{"model":"m","input":"hi","tools":[{"type":"web_search"}]}`, `unsupported tool type "web_search"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req responsesRequest
+			require.NoError(t, json.Unmarshal([]byte(tt.body), &req))
+			_, _, err := responsesToChatRequest(&req, nil)
+			require.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func newResponsesTestConfig(upstreamURL string) *config.Config {
+	return &config.Config{
+		TargetMap:    map[string]string{"/chat/completions": upstreamURL},
+		ResponsesAPI: config.ResponsesAPIConfig{Path: "/v1/responses"},
+	}
+}
+
+func TestResponsesAPI_PreviousResponseID(t *testing.T) {
+	store := newFakeResponseStore()
+	var received []map[string]interface{}
+	handler := newUpstreamTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/chat/completions", r.URL.Path)
+		body, _ := io.ReadAll(r.Body)
+		var chat map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &chat))
+		received = append(received, chat)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"Paris."},"finish_reason":"stop"}],"usage":{"prompt_tokens":12,"completion_tokens":2,"total_tokens":14}}`))
+	}, newResponsesTestConfig)
+	handler.responses = store
+
+	resp := sendAPIRequest(handler, http.MethodPost, "/v1/responses", "",
+		`{"model":"gpt-4o","instructions":"Be brief.","input":"Capital of France?"}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var first responsesObject
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &first))
+	require.Equal(t, "completed", first.Status)
+	require.True(t, first.Store)
+	require.Equal(t, 14, first.Usage.TotalTokens)
+	require.JSONEq(t, `[{"type":"message","id":"msg_test","status":"completed","role":"assistant",
+		"content":[{"type":"output_text","text":"Paris.","annotations":[]}]}]`,
+		string(replaceResponsesIDs(mustMarshal(t, first.Output))))
+
+	rec := store.saved[first.ID]
+	require.NotNil(t, rec)
+	require.Equal(t, "gpt-4o", rec.ModelName)
+	require.Equal(t, 14, *rec.TotalTokens)
+	// instructions 不随对话保存
+	require.JSONEq(t, `[{"role":"user","content":"Capital of France?"},{"role":"assistant","content":"Paris."}]`, string(rec.Messages))
+
+	resp = sendAPIRequest(handler, http.MethodPost, "/v1/responses", "",
+		`{"model":"gpt-4o","previous_response_id":"`+first.ID+`","input":"And Germany?","store":false}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var second responsesObject
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &second))
+	require.False(t, second.Store)
+	require.Equal(t, first.ID, *second.PreviousResponseID)
+	require.Nil(t, store.saved[second.ID])
+
+	require.Len(t, received, 2)
+	require.Len(t, received[0]["messages"], 2)
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"role": "user", "content": "Capital of France?"},
+		map[string]interface{}{"role": "assistant", "content": "Paris."},
+		map[string]interface{}{"role": "user", "content": "And Germany?"},
+	}, received[1]["messages"])
+
+	resp = sendAPIRequest(handler, http.MethodPost, "/v1/responses", "",
+		`{"model":"gpt-4o","previous_response_id":"resp_missing","input":"hi"}`)
+	requireOpenAIError(t, resp, http.StatusNotFound, "not_found")
+}
+
+func TestResponsesAPI_Stream(t *testing.T) {
+	stream, err := os.ReadFile(filepath.Join("testdata", "responses", "text.stream.txt"))
+	require.NoError(t, err)
+
+	store := newFakeResponseStore()
+	handler := newUpstreamTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		require.Contains(t, string(body), `"stream_options":{"include_usage":true}`)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write(stream)
+	}, newResponsesTestConfig)
+	handler.responses = store
+
+	resp := sendAPIRequest(handler, http.MethodPost, "/v1/responses", "",
+		`{"model":"gpt-4o","input":"Capital of France?","stream":true}`)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "text/event-stream", resp.Header().Get("Content-Type"))
+	body := resp.Body.String()
+	require.True(t, strings.HasPrefix(body, "event: response.created\n"), body)
+	require.Contains(t, body, "event: response.output_text.delta\n")
+	require.Contains(t, body, "event: response.completed\n")
+
+	require.Len(t, store.saved, 1)
+	for _, rec := range store.saved {
+		require.JSONEq(t, `[{"role":"user","content":"Capital of France?"},{"role":"assistant","content":"Paris."}]`, string(rec.Messages))
+		require.Contains(t, string(rec.Response), `"status":"completed"`)
+	}
+}
+
+func TestResponsesAPI_GetAndDelete(t *testing.T) {
+	store := newFakeResponseStore()
+	handler := newUpstreamTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}, newResponsesTestConfig)
+	handler.responses = store
+	keys := newFakeAPIKeyStore(map[string]*db.APIKeyRecord{
+		"sk-a": {ID: 1, Name: "a", Enabled: true},
+		"sk-b": {ID: 2, Name: "b", Enabled: true},
+	})
+	handler.cfg.Auth.Enabled = true
+	handler.keys = keys
+
+	resp := sendAPIRequest(handler, http.MethodPost, "/v1/responses", "sk-a", `{"model":"gpt-4o","input":"hi"}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	var created responsesObject
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+	require.Equal(t, 1, store.saved[created.ID].APIKeyID)
+
+	// 其他 key 无法读取、删除或续接
+	resp = sendAPIRequest(handler, http.MethodGet, "/v1/responses/"+created.ID, "sk-b", "")
+	requireOpenAIError(t, resp, http.StatusNotFound, "not_found")
+	resp = sendAPIRequest(handler, http.MethodDelete, "/v1/responses/"+created.ID, "sk-b", "")
+	requireOpenAIError(t, resp, http.StatusNotFound, "not_found")
+	resp = sendAPIRequest(handler, http.MethodPost, "/v1/responses", "sk-b",
+		`{"model":"gpt-4o","previous_response_id":"`+created.ID+`","input":"hi"}`)
+	requireOpenAIError(t, resp, http.StatusNotFound, "not_found")
+	resp = sendAPIRequest(handler, http.MethodGet, "/v1/responses/"+created.ID, "", "")
+	require.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = sendAPIRequest(handler, http.MethodGet, "/v1/responses/"+created.ID, "sk-a", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, string(mustMarshal(t, created)), resp.Body.String())
+
+	resp = sendAPIRequest(handler, http.MethodDelete, "/v1/responses/"+created.ID, "sk-a", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.JSONEq(t, `{"id":"`+created.ID+`","object":"response","deleted":true}`, resp.Body.String())
+	require.Empty(t, store.saved)
+
+	resp = sendAPIRequest(handler, http.MethodPut, "/v1/responses/"+created.ID, "sk-a", "")
+	require.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+}
+
+func TestResponsesAPI_RateLimitAndAuthBeforeStorage(t *testing.T) {
+	store := newFakeResponseStore()
+	handler := newUpstreamTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}, newResponsesTestConfig)
+	handler.responses = store
+	handler.cfg.Auth.Enabled = true
+	handler.keys = newFakeAPIKeyStore(map[string]*db.APIKeyRecord{
+		"sk-a": {ID: 1, Name: "a", Enabled: true, RPMLimit: 1},
+	})
+
+	// 无效的 key 在读取保存的响应之前被拒绝
+	resp := sendAPIRequest(handler, http.MethodGet, "/v1/responses/resp_1", "sk-unknown", "")
+	requireOpenAIError(t, resp, http.StatusUnauthorized, "invalid_api_key")
+	resp = sendAPIRequest(handler, http.MethodPost, "/v1/responses", "sk-unknown",
+		`{"model":"gpt-4o","previous_response_id":"resp_1","input":"hi"}`)
+	requireOpenAIError(t, resp, http.StatusUnauthorized, "invalid_api_key")
+	require.Zero(t, store.loads)
+
+	// 内部的 chat completions 请求不重复计入 Key 的请求数
+	resp = sendAPIRequest(handler, http.MethodPost, "/v1/responses", "sk-a", `{"model":"gpt-4o","input":"hi"}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+	// 与其他接口共享客户端限流
+	handler.cfg.Auth.Enabled = false
+	handler.cfg.RateLimit = config.RateLimitConfig{Rate: 1, Burst: 1}
+	handler.limiter = newRateLimiter(handler.cfg, nil)
+	resp = sendAPIRequest(handler, http.MethodGet, "/v1/responses/resp_1", "", "")
+	requireOpenAIError(t, resp, http.StatusNotFound, "not_found")
+	resp = sendAPIRequest(handler, http.MethodGet, "/v1/responses/resp_1", "", "")
+	requireOpenAIError(t, resp, http.StatusTooManyRequests, "rate_limit_exceeded")
+	require.Equal(t, 1, store.loads)
+	require.Equal(t, "/v1/responses", handler.metricsPathLabel("/v1/responses/resp_1"))
+}
+
+func TestResponsesAPI_Errors(t *testing.T) {
+	handler := newUpstreamTestHandler(t, func(w http.ResponseWriter, r *http.Request) {
+		writeOpenAIError(w, http.StatusTooManyRequests, "rate_limit_exceeded", "rate_limit_exceeded", "Slow down")
+	}, newResponsesTestConfig)
+
+	// 上游错误原样返回，未配置存储时不保存
+	resp := sendAPIRequest(handler, http.MethodPost, "/v1/responses", "", `{"model":"gpt-4o","input":"hi"}`)
+	requireOpenAIError(t, resp, http.StatusTooManyRequests, "rate_limit_exceeded")
+
+	resp = sendAPIRequest(handler, http.MethodPost, "/v1/responses", "", `{"model":"gpt-4o"}`)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	require.Contains(t, resp.Body.String(), `"invalid_request_error"`)
+
+	resp = sendAPIRequest(handler, http.MethodPost, "/v1/responses", "",
+		`{"model":"gpt-4o","previous_response_id":"resp_1","input":"hi"}`)
+	requireOpenAIError(t, resp, http.StatusServiceUnavailable, "service_unavailable")
+
+	resp = sendAPIRequest(handler, http.MethodGet, "/v1/responses", "", "")
+	require.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// defaultRetryStatusCodes 默认触发重试的上游状态码
+var defaultRetryStatusCodes = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable}
+
+// errAttemptTimeout 单次尝试在超时前未收到响应头
+var errAttemptTimeout = errors.New("upstream attempt timed out before first byte")
+
+// retryTransport 在同一模型路由的负载均衡器内切换 URL 重试。
+// 重试只发生在 RoundTrip 内部、响应交给 ReverseProxy 之前，因此不会在已向客户端写出数据后重试。
+type retryTransport struct {
+	next           http.RoundTripper
+	lbManager      *LoadBalancerManager
+	maxAttempts    int
+	budget         time.Duration
+	attemptTimeout time.Duration
+	statusCodes    map[int]bool
+}
+
+// newRetryTransport 根据配置包装传输层，未开启重试时直接返回 next
+func newRetryTransport(next http.RoundTripper, lbManager *LoadBalancerManager, cfg config.RetryConfig) http.RoundTripper {
+	if cfg.MaxAttempts <= 1 {
+		return next
+	}
+	codes := cfg.StatusCodes
+	if len(codes) == 0 {
+		codes = defaultRetryStatusCodes
+	}
+	statusCodes := make(map[int]bool, len(codes))
+	for _, code := range codes {
+		statusCodes[code] = true
+	}
+	return &retryTransport{
+		next:           next,
+		lbManager:      lbManager,
+		maxAttempts:    cfg.MaxAttempts,
+		budget:         time.Duration(cfg.Budget) * time.Second,
+		attemptTimeout: time.Duration(cfg.AttemptTimeout) * time.Second,
+		statusCodes:    statusCodes,
+	}
+}
+
+func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	route := upstreamRouteFromContext(r.Context())
+	if route == nil || route.model == "" || route.baseURL == "" {
+		// 非模型路由的请求不重试
+		return t.next.RoundTrip(r)
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		_ = r.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to buffer request body for retry: %w", err)
+		}
+	}
+
+	requestId := utils.GetRequestID(r)
+	startTime := time.Now()
+	tried := make(map[string]bool, t.maxAttempts)
+	target := r.URL
+
+	for attempt := 1; ; attempt++ {
+		route.attempts = attempt
+		tried[route.baseURL] = true
+
+		resp, err := t.attempt(r, target, body)
+		reason := t.retryReason(resp, err)
+		if reason == "" || r.Context().Err() != nil {
+			return resp, err
+		}
+		if attempt >= t.maxAttempts {
+			logger.Warn("Upstream retries exhausted",
+				zap.String("requestId", requestId),
+				zap.String("model", route.model),
+				zap.Int("attempts", attempt),
+				zap.String("reason", reason))
+			return resp, err
+		}
+		if t.budget > 0 && time.Since(startTime) >= t.budget {
+			logger.Warn("Upstream retry budget exceeded",
+				zap.String("requestId", requestId),
+				zap.String("model", route.model),
+				zap.Int("attempts", attempt),
+				zap.Duration("elapsed", time.Since(startTime)))
+			return resp, err
+		}
+
+		nextBase, ok := t.nextBaseURL(route.model, tried)
+		if !ok {
+			return resp, err
+		}
+		nextTarget, urlErr := utils.GetTargetURLWithCache(nextBase, route.path)
+		if urlErr != nil {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			_ = resp.Body.Close()
+		}
+
+		logger.Warn("Retrying upstream request",
+			zap.String("requestId", requestId),
+			zap.String("model", route.model),
+			zap.String("failedTarget", route.baseURL),
+			zap.String("nextTarget", nextBase),
+			zap.Int("attempt", attempt+1),
+			zap.String("reason", reason))
+		route.baseURL = nextBase
+		target = nextTarget
+	}
+}
+
+// attempt 发起一次请求；配置了单次超时时，超时只作用于等待响应头阶段
+func (t *retryTransport) attempt(r *http.Request, target *url.URL, body []byte) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(r.Context())
+	var timer *time.Timer
+	if t.attemptTimeout > 0 {
+		timer = time.AfterFunc(t.attemptTimeout, cancel)
+	}
+
+	req := r.Clone(ctx)
+	u := *target
+	u.RawQuery = r.URL.RawQuery
+	req.URL = &u
+	req.Host = u.Host
+	if body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if timer != nil && !timer.Stop() {
+		// 计时器已触发：本次尝试的 context 已取消，即使拿到响应也无法继续读取
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		cancel()
+		return nil, errAttemptTimeout
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// retryReason 返回需要重试的原因，空字符串表示无需重试
+func (t *retryTransport) retryReason(resp *http.Response, err error) string {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return ""
+		}
+		return err.Error()
+	}
+	if resp != nil && t.statusCodes[resp.StatusCode] {
+		return fmt.Sprintf("status %d", resp.StatusCode)
+	}
+	return ""
+}
+
+// nextBaseURL 按负载均衡策略选取尚未尝试过的 URL；全部尝试过后按策略结果继续
+func (t *retryTransport) nextBaseURL(model string, tried map[string]bool) (string, bool) {
+	if next, ok := t.lbManager.GetNextURLExcluding(model, func(u string) bool { return tried[u] }); ok {
+		return next, true
+	}
+	return t.lbManager.GetNextURL(model)
+}
+
+// cancelOnCloseBody 响应体关闭时释放单次尝试的 context
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
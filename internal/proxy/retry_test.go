@@ -0,0 +1,197 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-llm-server/internal/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newRetryTestRequest(t *testing.T, baseURL, body string) (*http.Request, *upstreamRoute) {
+	ctx, route := withUpstreamRoute(context.Background())
+	route.model = "test-model"
+	route.baseURL = baseURL
+	route.path = "/chat/completions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/chat/completions?trace=1", strings.NewReader(body))
+	require.NoError(t, err)
+	return req, route
+}
+
+func newRetryTestTransport(urls []string, cfg config.RetryConfig) http.RoundTripper {
+	lbm := NewLoadBalancerManager()
+	lbm.AddLoadBalancer("test-model", urls)
+	// 消耗首个轮询结果，模拟策略已选中 urls[0]
+	lbm.GetNextURL("test-model")
+	return newRetryTransport(http.DefaultTransport, lbm, cfg)
+}
+
+func TestRetryTransport_FailoverOnStatus(t *testing.T) {
+	var failing, healthy int32
+	var bodies []string
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failing, 1)
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&healthy, 1)
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		require.Equal(t, "/chat/completions", r.URL.Path)
+		require.Equal(t, "trace=1", r.URL.RawQuery)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer good.Close()
+
+	transport := newRetryTestTransport([]string{bad.URL, good.URL}, config.RetryConfig{MaxAttempts: 3})
+	req, route := newRetryTestRequest(t, bad.URL, `{"model":"test-model"}`)
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "ok", string(data))
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&failing))
+	require.Equal(t, int32(1), atomic.LoadInt32(&healthy))
+	require.Equal(t, []string{`{"model":"test-model"}`, `{"model":"test-model"}`}, bodies)
+	require.Equal(t, good.URL, route.baseURL)
+	require.Equal(t, 2, route.attempts)
+}
+
+func TestRetryTransport_FailoverOnConnectionError(t *testing.T) {
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer good.Close()
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closedURL := closed.URL
+	closed.Close()
+
+	transport := newRetryTestTransport([]string{closedURL, good.URL}, config.RetryConfig{MaxAttempts: 2})
+	req, route := newRetryTestRequest(t, closedURL, `{}`)
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, good.URL, route.baseURL)
+}
+
+func TestRetryTransport_MaxAttempts(t *testing.T) {
+	var calls int32
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer bad.Close()
+
+	transport := newRetryTestTransport([]string{bad.URL}, config.RetryConfig{MaxAttempts: 3})
+	req, route := newRetryTestRequest(t, bad.URL, `{}`)
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	require.Equal(t, 3, route.attempts)
+}
+
+func TestRetryTransport_NonRetryableStatus(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	transport := newRetryTestTransport([]string{server.URL}, config.RetryConfig{MaxAttempts: 3})
+	req, _ := newRetryTestRequest(t, server.URL, `{}`)
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestRetryTransport_Budget(t *testing.T) {
+	var calls int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(1100 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer slow.Close()
+
+	transport := newRetryTestTransport([]string{slow.URL}, config.RetryConfig{MaxAttempts: 5, Budget: 1})
+	req, _ := newRetryTestRequest(t, slow.URL, `{}`)
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestRetryTransport_AttemptTimeout(t *testing.T) {
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer hanging.Close()
+	defer close(release)
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer good.Close()
+
+	transport := newRetryTestTransport([]string{hanging.URL, good.URL}, config.RetryConfig{MaxAttempts: 2, AttemptTimeout: 1})
+	req, route := newRetryTestRequest(t, hanging.URL, `{}`)
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, good.URL, route.baseURL)
+}
+
+func TestRetryTransport_SkipsNonModelRoutes(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	transport := newRetryTestTransport([]string{server.URL}, config.RetryConfig{MaxAttempts: 3})
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/models", nil)
+	require.NoError(t, err)
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestNewRetryTransport_Disabled(t *testing.T) {
+	next := http.DefaultTransport
+	require.Equal(t, next, newRetryTransport(next, NewLoadBalancerManager(), config.RetryConfig{}))
+	require.Equal(t, next, newRetryTransport(next, NewLoadBalancerManager(), config.RetryConfig{MaxAttempts: 1}))
+}
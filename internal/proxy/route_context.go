@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"context"
+)
+
+// upstreamRouteContextKey 请求上下文中记录上游路由选择结果的 key
+type upstreamRouteContextKey struct{}
+
+// upstreamRoute 记录本次请求实际选中的模型与后端 URL，由策略写入、传输层读取
+type upstreamRoute struct {
+	requestedModel string // 别名解析后客户端请求的模型
+	model          string // 当前实际路由的模型，切换备用模型后与 requestedModel 不同
+	baseURL        string
+	path           string // 转发到上游的路径（target_map 改写后），用于重试时在新的 baseURL 上重建目标地址
+	target         string // 命中的 target_map 路径规则，用于查找目标服务 URL 与凭证
+	attempts       int
+}
+
+// servedByFallback 请求是否已切换到备用模型
+func (r *upstreamRoute) servedByFallback() bool {
+	return r != nil && r.requestedModel != "" && r.model != r.requestedModel
+}
+
+func withUpstreamRoute(ctx context.Context) (context.Context, *upstreamRoute) {
+	route := &upstreamRoute{}
+	return context.WithValue(ctx, upstreamRouteContextKey{}, route), route
+}
+
+func upstreamRouteFromContext(ctx context.Context) *upstreamRoute {
+	route, _ := ctx.Value(upstreamRouteContextKey{}).(*upstreamRoute)
+	return route
+}
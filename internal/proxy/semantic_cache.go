@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/db"
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// semanticCacheHit 语义缓存命中时 X-LLM-Cache 的取值
+	semanticCacheHit = "SEMANTIC-HIT"
+	// llmCacheSimilarityHeader 语义缓存命中时返回的余弦相似度
+	llmCacheSimilarityHeader = "X-LLM-Cache-Similarity"
+	// semanticEmbeddingTimeout 计算 embedding 的超时时间，超时后按未命中处理
+	semanticEmbeddingTimeout = 30 * time.Second
+)
+
+// semanticCacheStore 语义缓存需要的相似度检索，由 *storage.Storage 实现
+type semanticCacheStore interface {
+	FindSimilarLLM(ctx context.Context, q db.SimilarityQuery) (*db.LLMRecord, float64, error)
+}
+
+// semanticLookup 一次请求的语义缓存参数，未命中时随响应一起写入缓存
+type semanticLookup struct {
+	config    config.SemanticCacheConfig
+	key       string
+	embedding []float64
+}
+
+// prepareSemanticLookup 为开启语义缓存的模型计算分组键与最后一条用户消息的 embedding；
+// 未开启、请求不适用或 embedding 失败时返回 nil，请求按精确缓存处理
+func (h *Handler) prepareSemanticLookup(r *http.Request, payload map[string]interface{}, request, model string) *semanticLookup {
+	semanticCfg, ok := h.cfg.SemanticCache(model)
+	if !ok {
+		return nil
+	}
+	if _, ok := h.storage.(semanticCacheStore); !ok {
+		return nil
+	}
+	text, ok := lastUserMessageText(payload)
+	if !ok {
+		return nil
+	}
+
+	key, err := semanticCacheKey(request, semanticCfg.EmbeddingModel)
+	if err != nil {
+		logger.Warn("semantic-cache: failed to build semantic key",
+			zap.String("requestId", utils.GetRequestID(r)),
+			zap.String("model", model),
+			zap.Error(err))
+		return nil
+	}
+	embedding, err := h.embedPrompt(r, semanticCfg, text)
+	if err != nil {
+		logger.Warn("semantic-cache: failed to embed prompt",
+			zap.String("requestId", utils.GetRequestID(r)),
+			zap.String("model", model),
+			zap.String("embeddingModel", semanticCfg.EmbeddingModel),
+			zap.Error(err))
+		return nil
+	}
+	return &semanticLookup{config: semanticCfg, key: key, embedding: embedding}
+}
+
+// findSemanticMatch 查找相似度达到阈值的缓存响应，查找失败按未命中处理
+func (h *Handler) findSemanticMatch(r *http.Request, model string, lookup *semanticLookup) (*db.LLMRecord, float64) {
+	store, ok := h.storage.(semanticCacheStore)
+	if !ok || lookup == nil {
+		return nil, 0
+	}
+	rec, similarity, err := store.FindSimilarLLM(r.Context(), db.SimilarityQuery{
+		ModelName:   model,
+		SemanticKey: lookup.key,
+		Embedding:   lookup.embedding,
+		Threshold:   lookup.config.Threshold,
+		Candidates:  lookup.config.MaxCandidates,
+	})
+	if err != nil {
+		logger.Warn("semantic-cache: lookup failed",
+			zap.String("requestId", utils.GetRequestID(r)),
+			zap.String("model", model),
+			zap.Error(err))
+		return nil, 0
+	}
+	if rec == nil || len(rec.Response) == 0 {
+		return nil, 0
+	}
+	return rec, similarity
+}
+
+// lastUserMessageText 提取最后一条消息的文本，要求其为 user 消息且只包含文本内容
+func lastUserMessageText(payload map[string]interface{}) (string, bool) {
+	messages, _ := payload["messages"].([]interface{})
+	if len(messages) == 0 {
+		return "", false
+	}
+	last, _ := messages[len(messages)-1].(map[string]interface{})
+	if role, _ := last["role"].(string); role != "user" {
+		return "", false
+	}
+
+	switch content := last["content"].(type) {
+	case string:
+		return content, content != ""
+	case []interface{}:
+		texts := make([]string, 0, len(content))
+		for _, part := range content {
+			partMap, _ := part.(map[string]interface{})
+			if partType, _ := partMap["type"].(string); partType != "text" {
+				// 图片、音频等内容无法只凭文本判断相似
+				return "", false
+			}
+			text, _ := partMap["text"].(string)
+			texts = append(texts, text)
+		}
+		text := strings.Join(texts, "\n")
+		return text, text != ""
+	}
+	return "", false
+}
+
+// semanticCacheKey 由规范化请求去掉最后一条消息后的内容与 embedding 模型计算分组键，
+// 只有分组键相同的条目才比较相似度，保证 system prompt、历史消息、tools 与参数完全一致
+func semanticCacheKey(request, embeddingModel string) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(request))
+	decoder.UseNumber()
+	var payload map[string]interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return "", err
+	}
+	if messages, ok := payload["messages"].([]interface{}); ok && len(messages) > 0 {
+		payload["messages"] = messages[:len(messages)-1]
+	}
+	rest, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return utils.MakeHash(embeddingModel + "\n" + string(rest)), nil
+}
+
+// embedPrompt 通过已配置的 embedding 路由计算 text 的向量，
+// 与客户端直接调用 embedding 接口一样经过 embedding 缓存、负载均衡与重试
+func (h *Handler) embedPrompt(r *http.Request, semanticCfg config.SemanticCacheConfig, text string) ([]float64, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model": semanticCfg.EmbeddingModel,
+		"input": text,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 与客户端请求一样按 target_map 规则查找目标服务并改写路径
+	target, ok := h.router.Match(semanticCfg.EmbeddingPath)
+	if !ok {
+		return nil, fmt.Errorf("embedding path %q has no target_map entry", semanticCfg.EmbeddingPath)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), semanticEmbeddingTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.Path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", utils.GetRequestID(r))
+	// 未配置上游凭证时与客户端请求一样透传客户端的认证头（开启鉴权时已在鉴权后移除）
+	for _, header := range clientAuthHeaders {
+		if value := r.Header.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+
+	resp := newBufferedResponseWriter()
+	if h.shouldUseEmbeddingCache(req) {
+		handled, meta := h.handleEmbeddingCachePreProxy(resp, req)
+		if handled {
+			return parseEmbeddingResponse(resp)
+		}
+		if meta != nil {
+			if meta.release != nil {
+				defer meta.release()
+			}
+			req = req.WithContext(context.WithValue(req.Context(), embeddingCacheContextKey, meta))
+		}
+	}
+	proxyCtx, route := withUpstreamRoute(req.Context())
+	route.path = target.Path
+	route.target = target.Key
+	h.proxy.ServeHTTP(resp, req.WithContext(proxyCtx))
+	return parseEmbeddingResponse(resp)
+}
+
+func parseEmbeddingResponse(resp *bufferedResponseWriter) ([]float64, error) {
+	if resp.status != http.StatusOK {
+		return nil, fmt.Errorf("embedding request failed with status %d: %s", resp.status, truncateForLog(resp.body.String()))
+	}
+	var payload embeddingAPIResponse
+	if err := json.Unmarshal(resp.body.Bytes(), &payload); err != nil {
+		return nil, fmt.Errorf("invalid embedding response: %w", err)
+	}
+	if len(payload.Data) == 0 || len(payload.Data[0].Embedding) == 0 {
+		return nil, errors.New("embedding response has no data")
+	}
+	return payload.Data[0].Embedding, nil
+}
+
+// truncateForLog 截断上游错误响应，避免日志过长
+func truncateForLog(s string) string {
+	const limit = 256
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit] + "..."
+}
+
+// bufferedResponseWriter 在内存中接收内部请求的响应
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponseWriter() *bufferedResponseWriter {
+	return &bufferedResponseWriter{header: make(http.Header)}
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+// formatSimilarity 相似度响应头的取值
+func formatSimilarity(similarity float64) string {
+	return strconv.FormatFloat(similarity, 'f', 4, 64)
+}
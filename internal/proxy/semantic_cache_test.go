@@ -0,0 +1,219 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSemanticStorage 记录写入的 LLM 缓存，并按真实的余弦相似度做语义检索
+type fakeSemanticStorage struct {
+	fakeLLMCacheStorage
+	stored     []*db.LLMRecord
+	embeddings []*db.EmbeddingRecord
+	queries    []db.SimilarityQuery
+}
+
+func (f *fakeSemanticStorage) UpsertEmbedding(_ context.Context, rec *db.EmbeddingRecord) error {
+	f.embeddings = append(f.embeddings, rec)
+	return nil
+}
+
+func (f *fakeSemanticStorage) UpsertLLM(_ context.Context, rec *db.LLMRecord) error {
+	f.stored = append(f.stored, rec)
+	return nil
+}
+
+func (f *fakeSemanticStorage) FindSimilarLLM(_ context.Context, q db.SimilarityQuery) (*db.LLMRecord, float64, error) {
+	f.queries = append(f.queries, q)
+	var best *db.LLMRecord
+	bestSimilarity := -1.0
+	for _, rec := range f.stored {
+		if rec.ModelName != q.ModelName || rec.SemanticKey != q.SemanticKey {
+			continue
+		}
+		if similarity := db.CosineSimilarity(q.Embedding, rec.PromptEmbedding); similarity > bestSimilarity {
+			best, bestSimilarity = rec, similarity
+		}
+	}
+	if best == nil || bestSimilarity < q.Threshold {
+		return nil, bestSimilarity, nil
+	}
+	return best, bestSimilarity, nil
+}
+
+var semanticTestVectors = map[string][]float64{
+	"How do I reset my password?":   {1, 0, 0.1},
+	"how can i reset my password":   {1, 0, 0.15},
+	"What is the weather tomorrow?": {0, 1, 0},
+}
+
+// newSemanticUpstream 同时提供 chat 与 embedding 接口，chat 调用次数记录在 chatCalls 中
+func newSemanticUpstream(chatCalls *int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/embeddings") {
+			var payload struct {
+				Input string `json:"input"`
+			}
+			_ = json.Unmarshal(body, &payload)
+			vector, ok := semanticTestVectors[payload.Input]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":{"message":"unexpected input"}}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(embeddingAPIResponse{
+				Object: "list",
+				Data:   []embeddingResponseDatum{{Object: "embedding", Embedding: vector}},
+				Usage:  &embeddingUsage{PromptTokens: 5, TotalTokens: 5},
+			})
+			return
+		}
+		n := atomic.AddInt32(chatCalls, 1)
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-` + string(rune('0'+n)) + `","object":"chat.completion","model":"gpt-4","choices":[{"index":0,"message":{"role":"assistant","content":"answer"},"finish_reason":"stop"}]}`))
+	}
+}
+
+func newSemanticTestConfig(upstreamURL string) *config.Config {
+	return &config.Config{
+		TargetMap: map[string]string{"/chat/completions": upstreamURL, "/embeddings": upstreamURL},
+		Cache: config.CacheConfig{Models: map[string]config.CacheModelConfig{
+			"gpt-4": {Semantic: &config.SemanticCacheConfig{EmbeddingModel: "text-embedding-3-small", Threshold: 0.99}},
+		}},
+	}
+}
+
+func sendChat(t *testing.T, handler http.Handler, messages string) *httptest.ResponseRecorder {
+	t.Helper()
+	resp := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/chat/completions",
+		strings.NewReader(`{"model":"gpt-4","messages":[`+messages+`]}`))
+	handler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	return resp
+}
+
+func TestSemanticCache_ServesParaphrase(t *testing.T) {
+	var chatCalls int32
+	storage := &fakeSemanticStorage{}
+	handler := newUpstreamTestHandler(t, newSemanticUpstream(&chatCalls), newSemanticTestConfig)
+	handler.storage = storage
+	system := `{"role":"system","content":"You are a support bot."},`
+
+	resp := sendChat(t, handler, system+`{"role":"user","content":"How do I reset my password?"}`)
+	require.Equal(t, "MISS", resp.Header().Get("X-LLM-Cache"))
+	require.Len(t, storage.stored, 1)
+	require.Equal(t, []float64{1, 0, 0.1}, storage.stored[0].PromptEmbedding)
+	require.NotEmpty(t, storage.stored[0].SemanticKey)
+	// embedding 走 embedding 缓存，结果同样被缓存
+	require.Len(t, storage.embeddings, 1)
+	require.Equal(t, "text-embedding-3-small", storage.embeddings[0].ModelName)
+
+	resp = sendChat(t, handler, system+`{"role":"user","content":"how can i reset my password"}`)
+	require.Equal(t, semanticCacheHit, resp.Header().Get("X-LLM-Cache"))
+	require.Equal(t, "0.9988", resp.Header().Get(llmCacheSimilarityHeader))
+	require.Contains(t, resp.Body.String(), "chatcmpl-1")
+	require.Equal(t, int32(1), atomic.LoadInt32(&chatCalls))
+	require.Equal(t, 0.99, storage.queries[1].Threshold)
+	require.Equal(t, config.DefaultSemanticMaxCandidates, storage.queries[1].Candidates)
+
+	// 相似度不足
+	resp = sendChat(t, handler, system+`{"role":"user","content":"What is the weather tomorrow?"}`)
+	require.Equal(t, "MISS", resp.Header().Get("X-LLM-Cache"))
+	require.Empty(t, resp.Header().Get(llmCacheSimilarityHeader))
+
+	// system prompt 不同时不比较相似度
+	resp = sendChat(t, handler, `{"role":"system","content":"You are a pirate."},{"role":"user","content":"how can i reset my password"}`)
+	require.Equal(t, "MISS", resp.Header().Get("X-LLM-Cache"))
+	require.Equal(t, int32(3), atomic.LoadInt32(&chatCalls))
+}
+
+func TestSemanticCache_EmbeddingFailureFallsBackToExactCache(t *testing.T) {
+	var chatCalls int32
+	storage := &fakeSemanticStorage{}
+	handler := newUpstreamTestHandler(t, newSemanticUpstream(&chatCalls), newSemanticTestConfig)
+	handler.storage = storage
+
+	// 上游 embedding 接口返回 400
+	resp := sendChat(t, handler, `{"role":"user","content":"not in the vector table"}`)
+	require.Equal(t, "MISS", resp.Header().Get("X-LLM-Cache"))
+	require.Len(t, storage.stored, 1)
+	require.Empty(t, storage.stored[0].SemanticKey)
+	require.Nil(t, storage.stored[0].PromptEmbedding)
+	require.Empty(t, storage.queries)
+}
+
+func TestSemanticCache_EmbeddingPathMatchesPrefixRule(t *testing.T) {
+	var chatCalls int32
+	storage := &fakeSemanticStorage{}
+	handler := newUpstreamTestHandler(t, newSemanticUpstream(&chatCalls), func(upstreamURL string) *config.Config {
+		return &config.Config{
+			TargetMap:     map[string]string{"/chat/completions": upstreamURL, "/openai/*": upstreamURL + "/v1"},
+			TargetRewrite: map[string]config.PathRewrite{"/openai/*": {StripPrefix: "/openai"}},
+			Cache: config.CacheConfig{Models: map[string]config.CacheModelConfig{
+				"gpt-4": {Semantic: &config.SemanticCacheConfig{
+					EmbeddingModel: "text-embedding-3-small",
+					EmbeddingPath:  "/openai/embeddings",
+					Threshold:      0.99,
+				}},
+			}},
+		}
+	})
+	handler.storage = storage
+
+	sendChat(t, handler, `{"role":"user","content":"How do I reset my password?"}`)
+	require.Len(t, storage.stored, 1)
+	require.Equal(t, []float64{1, 0, 0.1}, storage.stored[0].PromptEmbedding)
+}
+
+func TestLastUserMessageText(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages string
+		want     string
+		ok       bool
+	}{
+		{"string content", `[{"role":"user","content":"hi"}]`, "hi", true},
+		{"text parts", `[{"role":"user","content":[{"type":"text","text":"a"},{"type":"text","text":"b"}]}]`, "a\nb", true},
+		{"image part", `[{"role":"user","content":[{"type":"text","text":"a"},{"type":"image_url","image_url":{"url":"x"}}]}]`, "", false},
+		{"last is tool result", `[{"role":"user","content":"hi"},{"role":"tool","content":"42"}]`, "", false},
+		{"empty content", `[{"role":"user","content":""}]`, "", false},
+		{"no messages", `[]`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(`{"messages":`+tt.messages+`}`), &payload))
+			got, ok := lastUserMessageText(payload)
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSemanticCacheKey(t *testing.T) {
+	key := func(request, embeddingModel string) string {
+		k, err := semanticCacheKey(request, embeddingModel)
+		require.NoError(t, err)
+		return k
+	}
+	base := key(`{"messages":[{"role":"system","content":"s"},{"role":"user","content":"a"}],"model":"gpt-4","temperature":0.5}`, "emb")
+
+	require.Equal(t, base, key(`{"messages":[{"role":"system","content":"s"},{"role":"user","content":"b"}],"model":"gpt-4","temperature":0.5}`, "emb"))
+	require.NotEqual(t, base, key(`{"messages":[{"role":"system","content":"t"},{"role":"user","content":"a"}],"model":"gpt-4","temperature":0.5}`, "emb"))
+	require.NotEqual(t, base, key(`{"messages":[{"role":"system","content":"s"},{"role":"user","content":"a"}],"model":"gpt-4","temperature":0.7}`, "emb"))
+	require.NotEqual(t, base, key(`{"messages":[{"role":"system","content":"s"},{"role":"user","content":"a"}],"model":"gpt-4","temperature":0.5,"tools":[]}`, "emb"))
+	require.NotEqual(t, base, key(`{"messages":[{"role":"system","content":"s"},{"role":"user","content":"a"}],"model":"gpt-4","temperature":0.5}`, "other"))
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// pendingWrites 跟踪进行中的缓存写入，关闭存储前等待它们完成；关闭后不再接受新的写入
+type pendingWrites struct {
+	mu     sync.Mutex
+	count  int
+	closed bool
+	idle   chan struct{} // count 归零时关闭，由 wait 创建
+}
+
+// begin 登记一次缓存写入，存储已关闭时返回 false，调用方应跳过写入
+func (p *pendingWrites) begin() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	p.count++
+	return true
+}
+
+func (p *pendingWrites) end() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.count--
+	if p.count == 0 && p.idle != nil {
+		close(p.idle)
+		p.idle = nil
+	}
+}
+
+// close 拒绝新的写入并等待进行中的写入完成，ctx 到期时返回其错误
+func (p *pendingWrites) close(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	if p.count == 0 {
+		p.mu.Unlock()
+		return nil
+	}
+	if p.idle == nil {
+		p.idle = make(chan struct{})
+	}
+	idle := p.idle
+	p.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// lifecycle 进程级的退出状态，配置热加载产生的各代 Handler 共享同一个实例；
+// 为 nil 时（测试中直接构造的 Handler）不跟踪写入，也不会进入退出状态
+type lifecycle struct {
+	shuttingDown atomic.Bool
+	cacheWrites  pendingWrites
+}
+
+// beginWrite 登记一次缓存写入，返回 false 时调用方应跳过写入
+func (l *lifecycle) beginWrite() bool {
+	if l == nil {
+		return true
+	}
+	return l.cacheWrites.begin()
+}
+
+func (l *lifecycle) endWrite() {
+	if l != nil {
+		l.cacheWrites.end()
+	}
+}
+
+// BeginShutdown 进入退出流程，此后就绪检查返回不可用，已有请求照常处理
+func (h *Handler) BeginShutdown() {
+	if h.life != nil {
+		h.life.shuttingDown.Store(true)
+	}
+}
+
+// ShuttingDown 是否已进入退出流程
+func (h *Handler) ShuttingDown() bool {
+	return h.life != nil && h.life.shuttingDown.Load()
+}
+
+// Close 在 HTTP server 停止后释放资源：等待缓存写入完成、停止健康检查、导出剩余的 span，
+// 最后关闭 Postgres 与 Redis 连接。ctx 到期时不再等待缓存写入，但仍会关闭所有资源。
+func (h *Handler) Close(ctx context.Context) {
+	h.BeginShutdown()
+	if h.life != nil {
+		if err := h.life.cacheWrites.close(ctx); err != nil {
+			logger.Warn("Timed out waiting for pending cache writes", zap.Error(err))
+		}
+	}
+	if h.health != nil {
+		h.health.Stop()
+	}
+	if err := h.tracer.Shutdown(ctx); err != nil {
+		logger.Warn("Failed to flush pending spans", zap.Error(err))
+	}
+	if closer, ok := h.storage.(interface{ Close() }); ok {
+		closer.Close()
+	}
+}
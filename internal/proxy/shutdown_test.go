@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-llm-server/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+type closableStorage struct {
+	fakeLLMCacheStorage
+	closed bool
+}
+
+func (s *closableStorage) Close() { s.closed = true }
+
+func TestPendingWrites_Close(t *testing.T) {
+	var writes pendingWrites
+	require.True(t, writes.begin())
+
+	closed := make(chan error, 1)
+	go func() { closed <- writes.close(context.Background()) }()
+
+	// close 等待进行中的写入完成，并拒绝新的写入
+	require.Eventually(t, func() bool {
+		writes.mu.Lock()
+		defer writes.mu.Unlock()
+		return writes.closed
+	}, time.Second, time.Millisecond)
+	require.False(t, writes.begin())
+	select {
+	case <-closed:
+		t.Fatal("close returned before the pending write finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+	writes.end()
+	require.NoError(t, <-closed)
+}
+
+func TestPendingWrites_CloseTimeout(t *testing.T) {
+	var writes pendingWrites
+	require.True(t, writes.begin())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, writes.close(ctx), context.DeadlineExceeded)
+	writes.end()
+}
+
+func TestHandler_Close(t *testing.T) {
+	var upserts int
+	storage := &closableStorage{fakeLLMCacheStorage: fakeLLMCacheStorage{
+		upsertLLMFn: func(context.Context, *db.LLMRecord) error {
+			upserts++
+			return nil
+		},
+	}}
+	handler := newLLMTestHandler(storage)
+	handler.health = NewHealthChecker(handler.cfg.HealthCheck)
+	handler.life = &lifecycle{}
+	meta := &llmCacheMetadata{model: "gpt-4", prompt: `{"model":"gpt-4"}`}
+
+	handler.storeLLMCacheRecord(context.Background(), meta, []byte(`{"choices":[]}`))
+	require.Equal(t, 1, upserts)
+	require.False(t, handler.ShuttingDown())
+
+	handler.Close(context.Background())
+	require.True(t, handler.ShuttingDown())
+	require.True(t, storage.closed)
+
+	// 存储关闭后不再写入缓存
+	handler.storeLLMCacheRecord(context.Background(), meta, []byte(`{"choices":[]}`))
+	require.Equal(t, 1, upserts)
+}
@@ -92,12 +92,8 @@ func (s *ModelSpecifyStrategy) extractModelFromRequest(request *http.Request) (s
 
 	// When alias resolves differently, update payload to use canonical model
 	if resolvedModel != chatReq.Model {
-		var payload map[string]interface{}
-		if err := json.Unmarshal(bodyBytes, &payload); err == nil {
-			payload["model"] = resolvedModel
-			if newBody, err := json.Marshal(payload); err == nil {
-				bodyBytes = newBody
-			}
+		if newBody, err := rewriteRequestModel(bodyBytes, resolvedModel); err == nil {
+			bodyBytes = newBody
 		}
 	}
 
@@ -113,6 +109,12 @@ func (s *ModelSpecifyStrategy) extractModelFromRequest(request *http.Request) (s
 
 func (s *ModelSpecifyStrategy) getLoadBalancedURL(model, fallbackURL string, request *http.Request) string {
 	if modelTarget, exists := s.lbManager.GetNextURL(model); exists {
+		if route := upstreamRouteFromContext(request.Context()); route != nil {
+			route.requestedModel = model
+			route.model = model
+			route.baseURL = modelTarget
+			route.path = request.URL.Path
+		}
 		logger.Info("Using load-balanced model route",
 			zap.String("requestId", utils.GetRequestID(request)),
 			zap.String("model", model),
@@ -126,6 +128,78 @@ func (s *ModelSpecifyStrategy) getLoadBalancedURL(model, fallbackURL string, req
 	return fallbackURL
 }
 
+// rewriteRequestModel 将请求体中的 model 字段替换为指定模型
+func rewriteRequestModel(body []byte, model string) ([]byte, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	payload["model"] = model
+	return json.Marshal(payload)
+}
+
+// fallbackModels 返回模型配置的备用模型，去掉模型自身和重复项
+func (s *ModelSpecifyStrategy) fallbackModels(model string) []string {
+	if s == nil || s.cfg == nil {
+		return nil
+	}
+	configured := s.cfg.ModelFallbacks(model)
+	if len(configured) == 0 {
+		return nil
+	}
+	seen := map[string]bool{model: true}
+	result := make([]string, 0, len(configured))
+	for _, fallback := range configured {
+		resolved := s.resolveModelName(fallback)
+		if resolved == "" || seen[resolved] {
+			continue
+		}
+		seen[resolved] = true
+		result = append(result, resolved)
+	}
+	return result
+}
+
+// routeFallback 将请求切换到备用模型：与别名解析一样重写请求体中的 model，
+// 并从备用模型的负载均衡器中选取 URL。备用模型未配置路由时返回 false
+func (s *ModelSpecifyStrategy) routeFallback(request *http.Request, body []byte, model string) (*http.Request, bool) {
+	route := upstreamRouteFromContext(request.Context())
+	if route == nil {
+		return nil, false
+	}
+	baseURL, ok := s.lbManager.GetNextURL(model)
+	if !ok {
+		logger.Warn("Fallback model has no route configured",
+			zap.String("requestId", utils.GetRequestID(request)),
+			zap.String("model", model))
+		return nil, false
+	}
+	target, err := utils.GetTargetURLWithCache(baseURL, route.path)
+	if err != nil {
+		return nil, false
+	}
+	newBody, err := rewriteRequestModel(body, model)
+	if err != nil {
+		return nil, false
+	}
+
+	route.model = model
+	route.baseURL = baseURL
+
+	fallbackRequest := request.Clone(request.Context())
+	u := *target
+	u.RawQuery = request.URL.RawQuery
+	fallbackRequest.URL = &u
+	fallbackRequest.Host = u.Host
+	fallbackRequest.Body = io.NopCloser(bytes.NewReader(newBody))
+	fallbackRequest.ContentLength = int64(len(newBody))
+	fallbackRequest.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(newBody)), nil
+	}
+	fallbackRequest.Header.Set("Content-Length", strconv.Itoa(len(newBody)))
+	return fallbackRequest, true
+}
+
 // DefaultStrategy 默认路由策略
 type DefaultStrategy struct {
 }
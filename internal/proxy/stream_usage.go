@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// streamUsageContextKey 请求上下文中标记代理替客户端开启了 stream_options.include_usage
+type streamUsageContextKey struct{}
+
+// requestStreamUsage 流式 chat completions 只有开启 stream_options.include_usage 时上游才在最后返回 usage。
+// 需要按用量统计而客户端未开启时代为开启，返回给客户端前再去掉用量分片（见 stripStreamUsage）
+func (h *Handler) requestStreamUsage(r *http.Request) *http.Request {
+	if !h.needsStreamUsage(r) || r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		return r
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return r
+	}
+	bodyBytes, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	if err != nil {
+		return r
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+		return r
+	}
+	var stream bool
+	if err := json.Unmarshal(payload["stream"], &stream); err != nil || !stream {
+		return r
+	}
+	options := make(map[string]json.RawMessage)
+	if raw, ok := payload["stream_options"]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &options); err != nil {
+			return r
+		}
+	}
+	var includeUsage bool
+	if raw, ok := options["include_usage"]; ok {
+		if err := json.Unmarshal(raw, &includeUsage); err != nil || includeUsage {
+			return r
+		}
+	}
+	options["include_usage"] = json.RawMessage("true")
+	if payload["stream_options"], err = json.Marshal(options); err != nil {
+		return r
+	}
+	if bodyBytes, err = json.Marshal(payload); err != nil {
+		return r
+	}
+
+	r = r.WithContext(context.WithValue(r.Context(), streamUsageContextKey{}, true))
+	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	r.ContentLength = int64(len(bodyBytes))
+	r.Header.Del("Content-Length")
+	return r
+}
+
+// needsStreamUsage 虚拟 API Key 设置了每日 token 配额，或请求预占了 token 限流计数时需要响应中的 usage
+func (h *Handler) needsStreamUsage(r *http.Request) bool {
+	if tokenReservationFromContext(r.Context()) != nil {
+		return true
+	}
+	rec := apiKeyFromContext(r.Context())
+	return h.keys != nil && rec != nil && rec.TokensPerDay > 0
+}
+
+// stripStreamUsage 代理替客户端开启 include_usage 时，从返回给客户端的流中去掉用量分片。
+// 压缩的流无法逐行过滤，原样返回
+func stripStreamUsage(resp *http.Response) {
+	if resp == nil || resp.Request == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+	if injected, _ := resp.Request.Context().Value(streamUsageContextKey{}).(bool); !injected {
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/event-stream" {
+		return
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return
+	}
+	resp.Body = &streamUsageFilter{ReadCloser: resp.Body, reader: bufio.NewReader(resp.Body)}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+}
+
+// streamUsageFilter 逐行转发 SSE，丢弃 choices 为空且带 usage 的分片及其后的空行
+type streamUsageFilter struct {
+	io.ReadCloser
+	reader    *bufio.Reader
+	pending   []byte
+	dropBlank bool
+	err       error
+}
+
+func (f *streamUsageFilter) Read(p []byte) (int, error) {
+	for len(f.pending) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		line, err := f.reader.ReadBytes('\n')
+		f.err = err
+		if isStreamUsageChunk(line) {
+			f.dropBlank = true
+			continue
+		}
+		if f.dropBlank && len(bytes.TrimSpace(line)) == 0 && len(line) > 0 {
+			f.dropBlank = false
+			continue
+		}
+		f.dropBlank = false
+		f.pending = line
+	}
+	n := copy(p, f.pending)
+	f.pending = f.pending[n:]
+	return n, nil
+}
+
+func isStreamUsageChunk(line []byte) bool {
+	data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok || !bytes.Contains(data, []byte(`"usage"`)) {
+		return false
+	}
+	var chunk struct {
+		Choices []json.RawMessage `json:"choices"`
+		Usage   *llmUsage         `json:"usage"`
+	}
+	if err := json.Unmarshal(bytes.TrimSpace(data), &chunk); err != nil {
+		return false
+	}
+	return chunk.Usage != nil && len(chunk.Choices) == 0
+}
@@ -0,0 +1,215 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+const tokenLimitWindow = time.Minute
+
+// counterStore Redis 共享计数器，由 storage.Storage 实现
+type counterStore interface {
+	IncrCounter(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	GetCounter(ctx context.Context, key string) (int64, error)
+}
+
+// tokenReservationContextKey 请求上下文中保存转发前预占的 token 数
+type tokenReservationContextKey struct{}
+
+// tokenReservation 转发前按估算值预占的计数，响应返回后按 usage 修正
+type tokenReservation struct {
+	counters []string // 本次请求预占的计数器 key（客户端、模型）
+	estimate int64
+	once     sync.Once
+}
+
+func tokenReservationFromContext(ctx context.Context) *tokenReservation {
+	res, _ := ctx.Value(tokenReservationContextKey{}).(*tokenReservation)
+	return res
+}
+
+// checkTokenLimit 估算 prompt token 数并在客户端和模型的每分钟计数中预占，
+// 超出限制时写出 429 并返回 false。计数存储不可用时放行
+func (h *Handler) checkTokenLimit(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if h.cfg == nil || !h.cfg.TokenLimit.Enabled() || h.counters == nil {
+		return r, true
+	}
+	requestId := utils.GetRequestID(r)
+	model, estimate, ok := estimateRequestTokens(r)
+	if !ok {
+		return r, true
+	}
+
+	now := time.Now()
+	window := now.Truncate(tokenLimitWindow)
+	client := tokenLimitClient(r)
+
+	type limitedCounter struct {
+		key   string
+		scope string
+		limit int
+	}
+	var limits []limitedCounter
+	if limit := h.cfg.ClientTPM(client); limit > 0 {
+		limits = append(limits, limitedCounter{tokenLimitCounter("client", client, window), "client", limit})
+	}
+	if limit := h.cfg.ModelTPM(model); model != "" && limit > 0 {
+		limits = append(limits, limitedCounter{tokenLimitCounter("model", h.cfg.ResolveModel(model), window), "model", limit})
+	}
+	if len(limits) == 0 {
+		return r, true
+	}
+
+	res := &tokenReservation{estimate: estimate}
+	for _, l := range limits {
+		used, err := h.counters.IncrCounter(r.Context(), l.key, estimate, 2*tokenLimitWindow)
+		if err != nil {
+			logger.Warn("Failed to count tokens, allowing request",
+				zap.String("requestId", requestId), zap.Error(err))
+			continue
+		}
+		res.counters = append(res.counters, l.key)
+		if used <= int64(l.limit) {
+			continue
+		}
+
+		h.releaseTokenReservation(res)
+		h.metrics.observeRateLimited("tokens")
+		retryAfter := int(window.Add(tokenLimitWindow).Sub(now).Seconds()) + 1
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		logger.Warn("Token rate limit exceeded",
+			zap.String("requestId", requestId),
+			zap.String("scope", l.scope),
+			zap.String("client", client),
+			zap.String("model", model),
+			zap.Int64("estimatedTokens", estimate),
+			zap.Int("tpmLimit", l.limit))
+		writeOpenAIError(w, http.StatusTooManyRequests, "tokens", "rate_limit_exceeded",
+			fmt.Sprintf("Rate limit reached for %s: %d tokens per minute. Requested about %d tokens.", l.scope, l.limit, estimate))
+		return r, false
+	}
+	if len(res.counters) == 0 {
+		return r, true
+	}
+	return r.WithContext(context.WithValue(r.Context(), tokenReservationContextKey{}, res)), true
+}
+
+// reconcileTokenUsage 用响应中的实际用量修正预占值
+func (h *Handler) reconcileTokenUsage(res *tokenReservation, usage *llmUsage) {
+	res.once.Do(func() {
+		h.adjustTokenCounters(res, int64(usage.total())-res.estimate)
+	})
+}
+
+// releaseTokenReservation 上游未成功处理请求时退还预占值
+func (h *Handler) releaseTokenReservation(res *tokenReservation) {
+	if res == nil {
+		return
+	}
+	res.once.Do(func() {
+		h.adjustTokenCounters(res, -res.estimate)
+	})
+}
+
+func (h *Handler) adjustTokenCounters(res *tokenReservation, delta int64) {
+	if delta == 0 || h.counters == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, key := range res.counters {
+		if _, err := h.counters.IncrCounter(ctx, key, delta, 2*tokenLimitWindow); err != nil {
+			logger.Warn("Failed to reconcile token usage", zap.String("counter", key), zap.Error(err))
+		}
+	}
+}
+
+// tokenLimitClient 客户端标识：已认证时使用虚拟 API Key 名称，否则使用客户端 IP
+func tokenLimitClient(r *http.Request) string {
+	if rec := apiKeyFromContext(r.Context()); rec != nil {
+		return rec.Name
+	}
+	return clientAddr(r)
+}
+
+func tokenLimitCounter(scope, name string, window time.Time) string {
+	return fmt.Sprintf("ratelimit:tokens:%s:%s:%d", scope, name, window.Unix())
+}
+
+// estimateRequestTokens 读取请求体（读取后还原）中的 model 并估算 prompt token 数，非 JSON 请求体返回 false
+func estimateRequestTokens(r *http.Request) (string, int64, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return "", 0, false
+	}
+	bodyBytes, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	if err != nil {
+		return "", 0, false
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+		return "", 0, false
+	}
+	model, _ := payload["model"].(string)
+
+	var tokens int64
+	if messages, ok := payload["messages"].([]interface{}); ok {
+		for _, m := range messages {
+			msg, _ := m.(map[string]interface{})
+			// 每条消息的角色与分隔符约占 4 个 token
+			tokens += 4 + estimateValueTokens(msg["content"])
+		}
+	}
+	tokens += estimateValueTokens(payload["input"])
+	tokens += estimateValueTokens(payload["prompt"])
+	if tokens == 0 {
+		tokens = estimateTextTokens(string(bodyBytes))
+	}
+	return model, tokens, true
+}
+
+// estimateValueTokens 估算字符串、字符串数组或 [{type:text,text:...}] 形式内容的 token 数
+func estimateValueTokens(v interface{}) int64 {
+	switch value := v.(type) {
+	case string:
+		return estimateTextTokens(value)
+	case []interface{}:
+		var tokens int64
+		for _, item := range value {
+			if part, ok := item.(map[string]interface{}); ok {
+				tokens += estimateValueTokens(part["text"])
+			} else {
+				tokens += estimateValueTokens(item)
+			}
+		}
+		return tokens
+	}
+	return 0
+}
+
+// estimateTextTokens 不依赖分词器的粗略估算：ASCII 约 4 个字符一个 token，其他字符（如中文）约一个字符一个 token
+func estimateTextTokens(text string) int64 {
+	var ascii, other int64
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
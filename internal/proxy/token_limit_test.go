@@ -0,0 +1,200 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/pkg/db"
+
+	"github.com/stretchr/testify/require"
+)
+
+type failingCounterStore struct{}
+
+func (failingCounterStore) IncrCounter(context.Context, string, int64, time.Duration) (int64, error) {
+	return 0, errors.New("redis down")
+}
+
+func (failingCounterStore) GetCounter(context.Context, string) (int64, error) {
+	return 0, errors.New("redis down")
+}
+
+func newTokenLimitTestHandler(limits config.TokenLimitConfig) (*Handler, *fakeAPIKeyStore) {
+	store := newFakeAPIKeyStore(nil)
+	return &Handler{
+		cfg: &config.Config{
+			ModelAlias: map[string]string{"my-gpt": "gpt-4"},
+			TokenLimit: limits,
+		},
+		counters: store,
+	}, store
+}
+
+func newTokenLimitTestRequest(model, content string) *http.Request {
+	body := `{"model":"` + model + `","messages":[{"role":"user","content":"` + content + `"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader(body))
+	req.RemoteAddr = "10.0.0.1:12345"
+	return req
+}
+
+func TestEstimateTextTokens(t *testing.T) {
+	require.Equal(t, int64(0), estimateTextTokens(""))
+	require.Equal(t, int64(1), estimateTextTokens("abc"))
+	require.Equal(t, int64(3), estimateTextTokens("hello world"))
+	require.Equal(t, int64(4), estimateTextTokens("你好世界"))
+}
+
+func TestEstimateRequestTokens(t *testing.T) {
+	body := `{"model":"gpt-4","messages":[{"role":"system","content":"abcdefgh"},{"role":"user","content":[{"type":"text","text":"你好"},{"type":"image_url","image_url":{"url":"x"}}]}]}`
+	req := httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader(body))
+	model, tokens, ok := estimateRequestTokens(req)
+	require.True(t, ok)
+	require.Equal(t, "gpt-4", model)
+	require.Equal(t, int64(4+2+4+2), tokens)
+
+	// 请求体被还原
+	restored, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	require.Equal(t, body, string(restored))
+
+	req = httptest.NewRequest(http.MethodPost, "/embeddings", strings.NewReader(`{"model":"embedding-2","input":["abcd","efgh"]}`))
+	model, tokens, ok = estimateRequestTokens(req)
+	require.True(t, ok)
+	require.Equal(t, "embedding-2", model)
+	require.Equal(t, int64(2), tokens)
+
+	_, _, ok = estimateRequestTokens(httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader("not json")))
+	require.False(t, ok)
+}
+
+func TestCheckTokenLimit_Client(t *testing.T) {
+	handler, store := newTokenLimitTestHandler(config.TokenLimitConfig{ClientTPM: 20})
+	content := strings.Repeat("a", 40) // 4 + 10 tokens
+
+	_, ok := handler.checkTokenLimit(httptest.NewRecorder(), newTokenLimitTestRequest("gpt-4", content))
+	require.True(t, ok)
+
+	resp := httptest.NewRecorder()
+	_, ok = handler.checkTokenLimit(resp, newTokenLimitTestRequest("gpt-4", content))
+	require.False(t, ok)
+	requireOpenAIError(t, resp, http.StatusTooManyRequests, "rate_limit_exceeded")
+	require.NotEmpty(t, resp.Header().Get("Retry-After"))
+
+	// 被拒绝的请求不占用额度
+	counter := tokenLimitCounter("client", "10.0.0.1", time.Now().Truncate(tokenLimitWindow))
+	require.Equal(t, int64(14), store.counters[counter])
+}
+
+func TestCheckTokenLimit_ModelSharedAcrossClients(t *testing.T) {
+	handler, _ := newTokenLimitTestHandler(config.TokenLimitConfig{Models: map[string]int{"gpt-4": 20}})
+
+	req := newTokenLimitTestRequest("my-gpt", strings.Repeat("a", 40))
+	_, ok := handler.checkTokenLimit(httptest.NewRecorder(), req)
+	require.True(t, ok)
+
+	req = newTokenLimitTestRequest("gpt-4", strings.Repeat("a", 40))
+	req.RemoteAddr = "10.0.0.2:12345"
+	resp := httptest.NewRecorder()
+	_, ok = handler.checkTokenLimit(resp, req)
+	require.False(t, ok)
+	requireOpenAIError(t, resp, http.StatusTooManyRequests, "rate_limit_exceeded")
+
+	// 未配置限制的模型不受影响
+	_, ok = handler.checkTokenLimit(httptest.NewRecorder(), newTokenLimitTestRequest("qwen", strings.Repeat("a", 400)))
+	require.True(t, ok)
+}
+
+func TestCheckTokenLimit_ClientIdentityFromAPIKey(t *testing.T) {
+	handler, store := newTokenLimitTestHandler(config.TokenLimitConfig{
+		ClientTPM: 10,
+		Clients:   map[string]int{"team-a": 1000},
+	})
+	req := newTokenLimitTestRequest("gpt-4", strings.Repeat("a", 100))
+	req = req.WithContext(context.WithValue(req.Context(), apiKeyContextKey{}, &db.APIKeyRecord{ID: 1, Name: "team-a"}))
+
+	_, ok := handler.checkTokenLimit(httptest.NewRecorder(), req)
+	require.True(t, ok)
+	counter := tokenLimitCounter("client", "team-a", time.Now().Truncate(tokenLimitWindow))
+	require.Equal(t, int64(29), store.counters[counter])
+}
+
+func TestRecordUsage_ReconcilesTokenReservation(t *testing.T) {
+	handler, store := newTokenLimitTestHandler(config.TokenLimitConfig{ClientTPM: 1000})
+	counter := tokenLimitCounter("client", "10.0.0.1", time.Now().Truncate(tokenLimitWindow))
+
+	req, ok := handler.checkTokenLimit(httptest.NewRecorder(), newTokenLimitTestRequest("gpt-4", strings.Repeat("a", 40)))
+	require.True(t, ok)
+	require.Equal(t, int64(14), store.counters[counter])
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(testLLMStreamBody)),
+		Request:    req,
+	}
+	handler.recordUsage(resp)
+	_, _ = io.ReadAll(resp.Body)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, int64(5), store.counters[counter])
+
+	// 上游失败时退还预占值
+	req, ok = handler.checkTokenLimit(httptest.NewRecorder(), newTokenLimitTestRequest("gpt-4", strings.Repeat("a", 40)))
+	require.True(t, ok)
+	require.Equal(t, int64(19), store.counters[counter])
+	handler.recordUsage(&http.Response{StatusCode: http.StatusBadGateway, Body: http.NoBody, Request: req})
+	require.Equal(t, int64(5), store.counters[counter])
+
+	// 退还只生效一次
+	handler.releaseTokenReservation(tokenReservationFromContext(req.Context()))
+	require.Equal(t, int64(5), store.counters[counter])
+}
+
+func TestServeHTTP_ReconcilesStreamWithoutUsage(t *testing.T) {
+	var received map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, testLLMStreamBody)
+	}))
+	defer upstream.Close()
+
+	handler, store := newTokenLimitTestHandler(config.TokenLimitConfig{ClientTPM: 1000})
+	handler.cfg.TargetMap = map[string]string{"/chat/completions": upstream.URL}
+	handler.lbManager = NewLoadBalancerManager()
+	handler.configure(handler.cfg, nil)
+	counter := tokenLimitCounter("client", "10.0.0.1", time.Now().Truncate(tokenLimitWindow))
+
+	req := httptest.NewRequest(http.MethodPost, "/chat/completions",
+		strings.NewReader(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"`+strings.Repeat("a", 40)+`"}]}`))
+	req.RemoteAddr = "10.0.0.1:12345"
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	// 预占的估算值按上游返回的实际用量（包括 completion）修正，客户端收到的流中不含用量分片
+	require.Equal(t, map[string]interface{}{"include_usage": true}, received["stream_options"])
+	require.Equal(t, int64(5), store.counters[counter])
+	require.NotContains(t, resp.Body.String(), `"usage"`)
+}
+
+func TestCheckTokenLimit_FailOpen(t *testing.T) {
+	handler := &Handler{
+		cfg:      &config.Config{TokenLimit: config.TokenLimitConfig{ClientTPM: 1}},
+		counters: failingCounterStore{},
+	}
+	req, ok := handler.checkTokenLimit(httptest.NewRecorder(), newTokenLimitTestRequest("gpt-4", strings.Repeat("a", 400)))
+	require.True(t, ok)
+	require.Nil(t, tokenReservationFromContext(req.Context()))
+
+	handler = &Handler{cfg: &config.Config{}}
+	_, ok = handler.checkTokenLimit(httptest.NewRecorder(), newTokenLimitTestRequest("gpt-4", strings.Repeat("a", 400)))
+	require.True(t, ok)
+}
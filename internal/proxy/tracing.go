@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/internal/utils"
+	"go-llm-server/pkg/logger"
+	"go-llm-server/pkg/tracing"
+
+	"go.uber.org/zap"
+)
+
+// newTracer 按配置创建 tracer，未启用或 collector 地址无效时返回 nil（不追踪）
+func newTracer(cfg *config.Config) *tracing.Tracer {
+	if cfg == nil || !cfg.Tracing.Enabled {
+		return nil
+	}
+	exporter, err := tracing.NewOTLPExporter(tracing.OTLPConfig{
+		Endpoint:    cfg.Tracing.Endpoint,
+		ServiceName: cfg.Tracing.ServiceName,
+		Headers:     cfg.Tracing.Headers,
+		Timeout:     time.Duration(cfg.Tracing.Timeout) * time.Second,
+	})
+	if err != nil {
+		logger.Warn("Failed to initialize tracing exporter, tracing disabled", zap.Error(err))
+		return nil
+	}
+	return tracing.NewTracer(exporter, tracing.Options{SampleRatio: cfg.Tracing.SampleRatio})
+}
+
+// startRequestSpan 为客户端请求创建根 span，请求头带 traceparent 时延续调用方的 trace
+func (h *Handler) startRequestSpan(r *http.Request) (*http.Request, *tracing.Span) {
+	if h.tracer == nil {
+		return r, nil
+	}
+	ctx := r.Context()
+	if parent, ok := tracing.Extract(r.Header); ok {
+		ctx = tracing.ContextWithRemoteParent(ctx, parent)
+	}
+	ctx, span := h.tracer.Start(ctx, "proxy.request", tracing.SpanKindServer)
+	span.SetAttributes(
+		tracing.Attribute{Key: "http.request.method", Value: r.Method},
+		tracing.Attribute{Key: "url.path", Value: r.URL.Path},
+		tracing.Attribute{Key: "request.id", Value: utils.GetRequestID(r)},
+	)
+	return r.WithContext(ctx), span
+}
+
+// endRequestSpan 记录路由结果、缓存结果与状态码后结束根 span
+func endRequestSpan(span *tracing.Span, route *upstreamRoute, header http.Header, status int) {
+	if span == nil {
+		return
+	}
+	span.SetAttribute("http.response.status_code", status)
+	if route != nil {
+		if route.requestedModel != "" {
+			span.SetAttribute("llm.model", route.requestedModel)
+		}
+		if route.servedByFallback() {
+			span.SetAttribute("llm.served_model", route.model)
+		}
+		if route.baseURL != "" {
+			span.SetAttribute("upstream.base_url", route.baseURL)
+		}
+		if route.attempts > 0 {
+			span.SetAttribute("upstream.attempts", route.attempts)
+		}
+	}
+	if result := header.Get("X-LLM-Cache"); result != "" {
+		span.SetAttribute("cache.llm", result)
+	}
+	if result := header.Get("X-Embedding-Cache"); result != "" {
+		span.SetAttribute("cache.embedding", result)
+	}
+	if status >= http.StatusInternalServerError {
+		span.SetError(http.StatusText(status))
+	}
+	span.End()
+}
+
+// startRouteSpan 为策略选择上游 URL 创建 span
+func startRouteSpan(request *http.Request) *tracing.Span {
+	_, span := tracing.Start(request.Context(), "proxy.route", tracing.SpanKindInternal)
+	span.SetAttribute("url.path", request.URL.Path)
+	return span
+}
+
+// endRouteSpan 记录选中的模型和后端后结束策略 span
+func endRouteSpan(span *tracing.Span, request *http.Request, err error) {
+	if span == nil {
+		return
+	}
+	if route := upstreamRouteFromContext(request.Context()); route != nil {
+		if route.model != "" {
+			span.SetAttribute("llm.model", route.model)
+		}
+		if route.baseURL != "" {
+			span.SetAttribute("upstream.base_url", route.baseURL)
+		}
+	}
+	span.RecordError(err)
+	span.End()
+}
+
+// startUpstreamSpan 为一次上游请求（含每次重试）创建 span，向上游注入 traceparent 并记录首字节时间。
+// 返回的请求只用于发送，响应的 Request 需要还原为原始请求。
+func startUpstreamSpan(r *http.Request) (*http.Request, *tracing.Span) {
+	ctx, span := tracing.Start(r.Context(), "upstream.request", tracing.SpanKindClient)
+	if span == nil {
+		return r, nil
+	}
+	span.SetAttributes(
+		tracing.Attribute{Key: "http.request.method", Value: r.Method},
+		tracing.Attribute{Key: "server.address", Value: r.URL.Host},
+		tracing.Attribute{Key: "url.path", Value: r.URL.Path},
+	)
+	if route := upstreamRouteFromContext(r.Context()); route != nil && route.attempts > 0 {
+		span.SetAttribute("upstream.attempt", route.attempts)
+	}
+
+	startTime := time.Now()
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			span.SetAttribute("http.ttfb_ms", time.Since(startTime).Milliseconds())
+			span.AddEvent("first_byte")
+		},
+	})
+	out := r.WithContext(ctx)
+	out.Header = r.Header.Clone()
+	out.Header.Set(tracing.TraceparentHeader, span.Context().Traceparent())
+	return out, span
+}
+
+// finishUpstreamSpan 出错时立即结束 span，否则在响应体关闭时结束，使流式响应的耗时计入 span
+func finishUpstreamSpan(span *tracing.Span, original *http.Request, response *http.Response, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.End()
+		return
+	}
+	response.Request = original
+	span.SetAttribute("http.response.status_code", response.StatusCode)
+	if response.StatusCode >= http.StatusInternalServerError {
+		span.SetError(http.StatusText(response.StatusCode))
+	}
+	response.Body = &onCloseBody{ReadCloser: response.Body, onClose: span.End}
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-llm-server/internal/config"
+	"go-llm-server/pkg/tracing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracing_ProxiedRequest(t *testing.T) {
+	var upstreamTraceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceparent = r.Header.Get("traceparent")
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	handler := NewHandler(&config.Config{
+		TargetMap:   map[string]string{"/chat/completions": upstream.URL},
+		ModelRoutes: map[string]interface{}{"gpt-4": upstream.URL},
+	})
+	handler.InitLoadBalancers()
+	defer handler.health.Stop()
+	exporter := tracing.NewInMemoryExporter()
+	handler.tracer = tracing.NewTracer(exporter, tracing.Options{})
+	defer handler.tracer.Shutdown(context.Background())
+
+	const incoming = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest(http.MethodPost, "/chat/completions", strings.NewReader(`{"model":"gpt-4","messages":[]}`))
+	req.Header.Set("traceparent", incoming)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.NoError(t, handler.tracer.Flush(context.Background()))
+
+	spans := map[string]tracing.SpanData{}
+	for _, span := range exporter.Spans() {
+		spans[span.Name] = span
+	}
+	require.Len(t, spans, 3)
+	root, route, call := spans["proxy.request"], spans["proxy.route"], spans["upstream.request"]
+
+	remote, _ := tracing.ParseTraceparent(incoming)
+	require.Equal(t, remote.TraceID, root.SpanContext.TraceID)
+	require.Equal(t, remote.SpanID, root.Parent)
+	require.Equal(t, 200, root.Attr("http.response.status_code"))
+	require.Equal(t, "gpt-4", root.Attr("llm.model"))
+	require.Equal(t, upstream.URL, root.Attr("upstream.base_url"))
+
+	require.Equal(t, root.SpanContext.SpanID, route.Parent)
+	require.Equal(t, upstream.URL, route.Attr("upstream.base_url"))
+
+	// 上游收到的是 upstream.request span 而不是客户端传入的 traceparent
+	require.Equal(t, root.SpanContext.SpanID, call.Parent)
+	require.Equal(t, call.SpanContext.Traceparent(), upstreamTraceparent)
+	require.Equal(t, 200, call.Attr("http.response.status_code"))
+	require.NotNil(t, call.Attr("http.ttfb_ms"))
+	require.Len(t, call.Events, 1)
+	require.Equal(t, "first_byte", call.Events[0].Name)
+}
+
+func TestTracing_UpstreamError(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	upstream.Close()
+
+	handler := NewHandler(&config.Config{TargetMap: map[string]string{"/v1/search": upstream.URL}})
+	exporter := tracing.NewInMemoryExporter()
+	handler.tracer = tracing.NewTracer(exporter, tracing.Options{})
+	defer handler.tracer.Shutdown(context.Background())
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/v1/search", strings.NewReader(`{}`)))
+	require.Equal(t, http.StatusBadGateway, resp.Code)
+	require.NoError(t, handler.tracer.Flush(context.Background()))
+
+	spans := map[string]tracing.SpanData{}
+	for _, span := range exporter.Spans() {
+		spans[span.Name] = span
+	}
+	require.True(t, spans["upstream.request"].Error)
+	require.True(t, spans["proxy.request"].Error)
+	require.Equal(t, 502, spans["proxy.request"].Attr("http.response.status_code"))
+	require.True(t, spans["proxy.request"].SpanContext.TraceID.IsValid())
+	require.False(t, spans["proxy.request"].Parent.IsValid())
+}
+
+func TestNewTracer(t *testing.T) {
+	require.Nil(t, newTracer(nil))
+	require.Nil(t, newTracer(&config.Config{Tracing: config.TracingConfig{Enabled: true}}))
+
+	tracer := newTracer(&config.Config{Tracing: config.TracingConfig{Enabled: true, Endpoint: "http://127.0.0.1:4318/v1/traces"}})
+	require.NotNil(t, tracer)
+	require.NoError(t, tracer.Shutdown(context.Background()))
+}
@@ -4,8 +4,10 @@ import (
 	"go-llm-server/internal/config"
 	"go-llm-server/internal/utils"
 	"go-llm-server/pkg/logger"
+	"io"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -29,17 +31,88 @@ var (
 	}
 )
 
+// upstreamObserver 接收每次上游请求的结果反馈（健康检查、负载均衡等）
+type upstreamObserver interface {
+	ObserveUpstream(target string, statusCode int, err error, duration time.Duration)
+}
+
+// upstreamInflightObserver 额外跟踪进行中的上游请求，请求在响应体关闭或出错时结束
+type upstreamInflightObserver interface {
+	UpstreamStarted(target string)
+	UpstreamFinished(target string)
+}
+
 type TransportWithProxyAutoDetected struct {
+	observers []upstreamObserver
 }
 
 func (t *TransportWithProxyAutoDetected) RoundTrip(r *http.Request) (*http.Response, error) {
+	if len(t.observers) == 0 {
+		return t.roundTrip(r)
+	}
+	route := upstreamRouteFromContext(r.Context())
+	if route == nil || route.baseURL == "" {
+		return t.roundTrip(r)
+	}
+	target := route.baseURL
+
+	var inflight []upstreamInflightObserver
+	for _, observer := range t.observers {
+		if tracker, ok := observer.(upstreamInflightObserver); ok {
+			inflight = append(inflight, tracker)
+			tracker.UpstreamStarted(target)
+		}
+	}
+	finish := func() {
+		for _, tracker := range inflight {
+			tracker.UpstreamFinished(target)
+		}
+	}
+
+	startTime := time.Now()
+	response, err := t.roundTrip(r)
+	duration := time.Since(startTime)
+	statusCode := 0
+	if response != nil {
+		statusCode = response.StatusCode
+	}
+	for _, observer := range t.observers {
+		observer.ObserveUpstream(target, statusCode, err, duration)
+	}
+
+	if len(inflight) > 0 {
+		if err != nil || response.StatusCode == http.StatusSwitchingProtocols {
+			finish()
+		} else {
+			response.Body = &onCloseBody{ReadCloser: response.Body, onClose: finish}
+		}
+	}
+	return response, err
+}
+
+// onCloseBody 响应体第一次关闭时执行回调
+type onCloseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	onClose func()
+}
+
+func (b *onCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.onClose)
+	return err
+}
+
+func (t *TransportWithProxyAutoDetected) roundTrip(r *http.Request) (*http.Response, error) {
 	startTime := time.Now()
 	useProxy := utils.ShouldUseProxy(r.URL.Hostname())
 	trans := directTransport
 	if useProxy {
 		trans = proxyTransport
 	}
-	response, err := trans.RoundTrip(r)
+	traced, span := startUpstreamSpan(r)
+	response, err := trans.RoundTrip(traced)
+	finishUpstreamSpan(span, r, response, err)
 	duration := time.Since(startTime)
 	requestId := utils.GetRequestID(r)
 	if err != nil {
@@ -0,0 +1,225 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// llmUsage chat completion / embeddings 响应中的 usage 字段
+type llmUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// total 返回总 token 数，部分上游只返回 prompt/completion
+func (u *llmUsage) total() int {
+	if u.TotalTokens > 0 {
+		return u.TotalTokens
+	}
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// extractUsage 从非流式 JSON 或 SSE 响应体中解析 usage；流式响应取最后一个带 usage 的事件
+func extractUsage(body []byte) (*llmUsage, bool) {
+	var payload struct {
+		Usage *llmUsage `json:"usage"`
+	}
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &payload); err == nil && payload.Usage != nil {
+			return payload.Usage, true
+		}
+		return nil, false
+	}
+
+	var usage *llmUsage
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" || !strings.Contains(data, `"usage"`) {
+			continue
+		}
+		payload.Usage = nil
+		if err := json.Unmarshal([]byte(data), &payload); err == nil && payload.Usage != nil {
+			usage = payload.Usage
+		}
+	}
+	return usage, usage != nil
+}
+
+// decodeResponseBody 按 Content-Encoding 解压响应体，仅支持 gzip，其他编码原样返回
+func decodeResponseBody(body []byte, encoding string) ([]byte, error) {
+	if !strings.Contains(strings.ToLower(encoding), "gzip") {
+		return body, nil
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+	return io.ReadAll(gr)
+}
+
+// usageCaptureLimit 解析 usage 时最多保留的响应体字节数。超出时只保留末尾部分：
+// 流式响应的 usage 在最后的事件中，非流式响应的 usage 字段通常也在末尾
+const usageCaptureLimit = 1 << 20
+
+// recordUsage 响应读取完成后将 usage 分发给虚拟 API Key 配额、token 限流与指标；
+// 上游未成功处理时立即退还 token 限流的预占值
+func (h *Handler) recordUsage(resp *http.Response) {
+	if resp == nil || resp.Request == nil {
+		return
+	}
+	reservation := tokenReservationFromContext(resp.Request.Context())
+	if resp.StatusCode != http.StatusOK {
+		h.releaseTokenReservation(reservation)
+		return
+	}
+	if !hasUsage(resp) {
+		return
+	}
+
+	var handlers []func(*llmUsage)
+	if handler := h.apiKeyUsageHandler(resp); handler != nil {
+		handlers = append(handlers, handler)
+	}
+	if reservation != nil {
+		handlers = append(handlers, func(usage *llmUsage) {
+			h.reconcileTokenUsage(reservation, usage)
+		})
+	}
+	if h.metrics != nil {
+		model := ""
+		if route := upstreamRouteFromContext(resp.Request.Context()); route != nil {
+			model = h.metricsModelLabel(route.model)
+		}
+		handlers = append(handlers, func(usage *llmUsage) {
+			h.metrics.observeUsage(model, usage)
+		})
+	}
+	if len(handlers) == 0 {
+		return
+	}
+	captureUsage(resp, func(usage *llmUsage) {
+		for _, handler := range handlers {
+			handler(usage)
+		}
+	})
+}
+
+// hasUsage 只有 chat completions、completions 与 embeddings 的 JSON 或 SSE 响应带 usage，
+// 其他路径（文件下载、音频等）的响应体不缓存
+func hasUsage(resp *http.Response) bool {
+	path := resp.Request.URL.Path
+	if route := upstreamRouteFromContext(resp.Request.Context()); route != nil && route.path != "" {
+		path = route.path
+	}
+	if !strings.HasSuffix(path, "/completions") && !strings.HasSuffix(path, "/embeddings") {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "application/json" || mediaType == "text/event-stream"
+}
+
+// captureUsage 在响应体被完整读取并关闭后解析 usage 并回调；未读到 EOF 或没有 usage 时不回调
+func captureUsage(resp *http.Response, onUsage func(*llmUsage)) {
+	if resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	resp.Body = &usageCaptureBody{
+		ReadCloser: resp.Body,
+		stream:     mediaType == "text/event-stream",
+		encoding:   resp.Header.Get("Content-Encoding"),
+		onUsage:    onUsage,
+	}
+}
+
+type usageCaptureBody struct {
+	io.ReadCloser
+	buf       []byte
+	truncated bool // buf 只保留了响应体末尾的 usageCaptureLimit 字节
+	eof       bool
+	stream    bool
+	encoding  string
+	onUsage   func(*llmUsage)
+	once      sync.Once
+}
+
+func (b *usageCaptureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.buf = append(b.buf, p[:n]...)
+		// 超出两倍上限时才丢弃前面的部分，避免每次读取都移动数据
+		if len(b.buf) > 2*usageCaptureLimit {
+			b.buf = append(b.buf[:0], b.buf[len(b.buf)-usageCaptureLimit:]...)
+			b.truncated = true
+		}
+	}
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *usageCaptureBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		if !b.eof {
+			return
+		}
+		var usage *llmUsage
+		var ok bool
+		if b.truncated {
+			usage, ok = extractTailUsage(b.buf, b.stream, b.encoding)
+		} else if body, decodeErr := decodeResponseBody(b.buf, b.encoding); decodeErr == nil {
+			usage, ok = extractUsage(body)
+		}
+		if ok {
+			b.onUsage(usage)
+		}
+	})
+	b.buf = nil
+	return err
+}
+
+// extractTailUsage 从被截断的响应体末尾解析 usage：SSE 去掉不完整的首行后按事件解析，
+// JSON 解析最后一个 "usage" 字段。压缩的响应无法从中间解压，不解析
+func extractTailUsage(tail []byte, stream bool, encoding string) (*llmUsage, bool) {
+	if encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return nil, false
+	}
+	if stream {
+		if i := bytes.IndexByte(tail, '\n'); i >= 0 {
+			return extractUsage(tail[i+1:])
+		}
+		return nil, false
+	}
+	i := bytes.LastIndex(tail, []byte(`"usage"`))
+	if i < 0 {
+		return nil, false
+	}
+	rest := bytes.TrimLeft(tail[i+len(`"usage"`):], " \t\r\n")
+	rest, found := bytes.CutPrefix(rest, []byte(":"))
+	if !found {
+		return nil, false
+	}
+	var usage *llmUsage
+	if err := json.NewDecoder(bytes.NewReader(rest)).Decode(&usage); err != nil {
+		return nil, false
+	}
+	return usage, usage != nil
+}
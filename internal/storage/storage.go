@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go-llm-server/internal/config"
@@ -11,15 +13,27 @@ import (
 	"go-llm-server/pkg/db"
 	"go-llm-server/pkg/logger"
 	cache "go-llm-server/pkg/redis"
+	"go-llm-server/pkg/tracing"
 
 	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 )
 
+// defaultRedisTTL caps how long an entry lives in Redis; Postgres remains the source of truth.
+const defaultRedisTTL = time.Hour
+
+// defaultSweepBatchSize is used when cache.sweep_batch_size is not configured.
+const defaultSweepBatchSize = 1000
+
 // Storage composes Postgres and Redis for read-through/write-through caching.
 type Storage struct {
 	DB    *db.Postgres
 	Cache *cache.Redis
+
+	cfg         atomic.Pointer[config.Config]
+	stopSweeper chan struct{}
+	stopOnce    sync.Once
+	sweeperDone chan struct{}
 }
 
 // NewStorage initializes Postgres and Redis from app config and returns a Storage.
@@ -45,7 +59,25 @@ func NewStorage(cfg *config.Config) (*Storage, error) {
 		return nil, err
 	}
 
-	return &Storage{DB: pg, Cache: r}, nil
+	s := &Storage{DB: pg, Cache: r}
+	s.cfg.Store(cfg)
+	if cfg.Cache.SweepInterval > 0 {
+		s.StartExpireSweeper(time.Duration(cfg.Cache.SweepInterval)*time.Second, cfg.Cache.SweepBatchSize)
+	}
+	return s, nil
+}
+
+// SetConfig replaces the config used for cache, response and API key TTLs, so that a
+// config reload takes effect without reconnecting. Connection settings are not reapplied.
+func (s *Storage) SetConfig(cfg *config.Config) {
+	if s == nil || cfg == nil {
+		return
+	}
+	s.cfg.Store(cfg)
+}
+
+func (s *Storage) config() *config.Config {
+	return s.cfg.Load()
 }
 
 // Close releases underlying resources.
@@ -53,6 +85,7 @@ func (s *Storage) Close() {
 	if s == nil {
 		return
 	}
+	s.stopExpireSweeper()
 	if s.Cache != nil {
 		_ = s.Cache.Close()
 	}
@@ -73,18 +106,22 @@ func (s *Storage) GetEmbedding(ctx context.Context, inputText, modelName string,
 	key := "embedding:" + hash
 
 	var rec db.EmbeddingRecord
+	span := startGetSpan(ctx, "redis.get", "redis", key)
 	found, err := s.Cache.Get(ctx, key, &rec)
+	endGetSpan(span, found, err)
 	if err != nil {
 		// Log error but continue to Postgres - Redis failure shouldn't break the flow
 		logger.Warn("Redis Get failed, falling back to Postgres",
 			zap.String("key", key),
 			zap.String("model", modelName),
 			zap.Error(err))
-	} else if found {
+	} else if found && !db.IsExpired(rec.ExpireAt, time.Now()) {
 		return &rec, nil
 	}
 
+	span = startGetSpan(ctx, "postgres.get", "postgresql", "embedding_cache")
 	pgRec, err := s.DB.GetEmbedding(ctx, inputText, modelName, dimensions)
+	endGetSpan(span, err == nil, ignoreNoRows(err))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
@@ -95,8 +132,8 @@ func (s *Storage) GetEmbedding(ctx context.Context, inputText, modelName string,
 			zap.Error(err))
 		return nil, err
 	}
-	if pgRec != nil {
-		if err := s.Cache.Set(ctx, key, pgRec, time.Hour); err != nil {
+	if ttl := redisTTL(pgRec.ExpireAt, time.Now()); ttl > 0 {
+		if err := s.Cache.Set(ctx, key, pgRec, ttl); err != nil {
 			// Log cache backfill failure but don't fail the request
 			logger.Warn("Failed to backfill Redis cache for embedding",
 				zap.String("key", key),
@@ -120,9 +157,18 @@ func (s *Storage) UpsertEmbedding(ctx context.Context, rec *db.EmbeddingRecord)
 		return fmt.Errorf("embedding record missing required fields")
 	}
 
+	_, span := tracing.Start(ctx, "cache.write", tracing.SpanKindInternal)
+	span.SetAttributes(tracing.Attribute{Key: "cache.type", Value: "embedding"}, tracing.Attribute{Key: "llm.model", Value: rec.ModelName})
+	defer span.End()
+
 	rec.InputHash = utils.MakeEmbeddingCacheKey(rec.InputText, rec.ModelName, rec.Dimensions)
+	if rec.ExpireAt == nil {
+		expireAt := db.ExpireAtFromTTL(time.Now(), s.config().CacheTTL(rec.ModelName))
+		rec.ExpireAt = &expireAt
+	}
 
 	if err := s.DB.UpsertEmbedding(ctx, rec); err != nil {
+		span.RecordError(err)
 		logger.Error("Failed to upsert embedding to Postgres",
 			zap.String("model", rec.ModelName),
 			zap.Int("embedding_size", len(rec.Embedding)),
@@ -131,7 +177,11 @@ func (s *Storage) UpsertEmbedding(ctx context.Context, rec *db.EmbeddingRecord)
 	}
 
 	key := "embedding:" + rec.InputHash
-	if err := s.Cache.Set(ctx, key, rec, time.Hour); err != nil {
+	ttl := redisTTL(rec.ExpireAt, time.Now())
+	if ttl <= 0 {
+		return nil
+	}
+	if err := s.Cache.Set(ctx, key, rec, ttl); err != nil {
 		// Log cache update failure but don't fail the request since DB write succeeded
 		logger.Warn("Failed to update Redis cache for embedding after DB write",
 			zap.String("key", key),
@@ -153,18 +203,22 @@ func (s *Storage) GetLLM(ctx context.Context, request, modelName string) (*db.LL
 	key := "llm:" + hash
 
 	var rec db.LLMRecord
+	span := startGetSpan(ctx, "redis.get", "redis", key)
 	found, err := s.Cache.Get(ctx, key, &rec)
+	endGetSpan(span, found, err)
 	if err != nil {
 		// Log error but continue to Postgres - Redis failure shouldn't break the flow
 		logger.Warn("Redis Get failed, falling back to Postgres",
 			zap.String("key", key),
 			zap.String("model", modelName),
 			zap.Error(err))
-	} else if found {
+	} else if found && !db.IsExpired(rec.ExpireAt, time.Now()) {
 		return &rec, nil
 	}
 
+	span = startGetSpan(ctx, "postgres.get", "postgresql", "llm_cache")
 	pgRec, err := s.DB.GetLLM(ctx, request)
+	endGetSpan(span, err == nil, ignoreNoRows(err))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
@@ -175,8 +229,8 @@ func (s *Storage) GetLLM(ctx context.Context, request, modelName string) (*db.LL
 			zap.Error(err))
 		return nil, err
 	}
-	if pgRec != nil {
-		if err := s.Cache.Set(ctx, key, pgRec, time.Hour); err != nil {
+	if ttl := redisTTL(pgRec.ExpireAt, time.Now()); ttl > 0 {
+		if err := s.Cache.Set(ctx, key, pgRec, ttl); err != nil {
 			// Log cache backfill failure but don't fail the request
 			logger.Warn("Failed to backfill Redis cache for LLM",
 				zap.String("key", key),
@@ -195,8 +249,17 @@ func (s *Storage) UpsertLLM(ctx context.Context, rec *db.LLMRecord) error {
 	if rec == nil {
 		return fmt.Errorf("LLMRecord cannot be nil")
 	}
+	_, span := tracing.Start(ctx, "cache.write", tracing.SpanKindInternal)
+	span.SetAttributes(tracing.Attribute{Key: "cache.type", Value: "llm"}, tracing.Attribute{Key: "llm.model", Value: rec.ModelName})
+	defer span.End()
+
+	if rec.ExpireAt == nil {
+		expireAt := db.ExpireAtFromTTL(time.Now(), s.config().CacheTTL(rec.ModelName))
+		rec.ExpireAt = &expireAt
+	}
 
 	if err := s.DB.UpsertLLM(ctx, rec); err != nil {
+		span.RecordError(err)
 		logger.Error("Failed to upsert LLM response to Postgres",
 			zap.String("model", rec.ModelName),
 			zap.Error(err))
@@ -212,7 +275,11 @@ func (s *Storage) UpsertLLM(ctx context.Context, rec *db.LLMRecord) error {
 	}
 	key := "llm:" + hash
 
-	if err := s.Cache.Set(ctx, key, rec, time.Hour); err != nil {
+	ttl := redisTTL(rec.ExpireAt, time.Now())
+	if ttl <= 0 {
+		return nil
+	}
+	if err := s.Cache.Set(ctx, key, rec, ttl); err != nil {
 		// Log cache update failure but don't fail the request since DB write succeeded
 		logger.Warn("Failed to update Redis cache for LLM after DB write",
 			zap.String("key", key),
@@ -221,3 +288,385 @@ func (s *Storage) UpsertLLM(ctx context.Context, rec *db.LLMRecord) error {
 	}
 	return nil
 }
+
+// FindSimilarLLM looks up a semantically similar LLM response in Postgres. Vectors are not
+// cached in Redis, so this always queries the database. It returns nil when nothing reaches the threshold.
+func (s *Storage) FindSimilarLLM(ctx context.Context, q db.SimilarityQuery) (*db.LLMRecord, float64, error) {
+	if s == nil || s.DB == nil {
+		return nil, 0, fmt.Errorf("storage not initialized")
+	}
+	span := startGetSpan(ctx, "postgres.similarity", "postgresql", "llm_cache")
+	rec, similarity, err := s.DB.FindSimilarLLM(ctx, q)
+	endGetSpan(span, rec != nil, err)
+	if err != nil {
+		logger.Error("Failed to find similar LLM response in Postgres",
+			zap.String("model", q.ModelName),
+			zap.Error(err))
+		return nil, 0, err
+	}
+	return rec, similarity, nil
+}
+
+// redisTTL aligns the Redis TTL with the remaining lifetime of the row, capped at defaultRedisTTL.
+// A zero result means the record is already expired and must not be cached.
+func redisTTL(expireAt *int64, now time.Time) time.Duration {
+	if expireAt == nil || *expireAt < 0 {
+		return defaultRedisTTL
+	}
+	remaining := time.UnixMilli(*expireAt).Sub(now)
+	if remaining <= 0 {
+		return 0
+	}
+	if remaining < defaultRedisTTL {
+		return remaining
+	}
+	return defaultRedisTTL
+}
+
+// ---------------- Responses ----------------
+
+// SaveResponse stores a Responses API response in Postgres. Responses are read back at most a few
+// times through previous_response_id, so they are not cached in Redis.
+func (s *Storage) SaveResponse(ctx context.Context, rec *db.ResponseRecord) error {
+	if s == nil || s.DB == nil {
+		return fmt.Errorf("storage not initialized")
+	}
+	if rec == nil {
+		return fmt.Errorf("response record cannot be nil")
+	}
+	if rec.ExpireAt == nil {
+		expireAt := db.ExpireAtFromTTL(time.Now(), time.Duration(s.config().ResponsesAPI.TTL)*time.Second)
+		rec.ExpireAt = &expireAt
+	}
+	if err := s.DB.InsertResponse(ctx, rec); err != nil {
+		logger.Error("Failed to save response to Postgres",
+			zap.String("responseId", rec.ResponseID),
+			zap.String("model", rec.ModelName),
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// GetResponse returns the unexpired response with the given ID, nil when absent.
+func (s *Storage) GetResponse(ctx context.Context, responseID string) (*db.ResponseRecord, error) {
+	if s == nil || s.DB == nil {
+		return nil, fmt.Errorf("storage not initialized")
+	}
+	span := startGetSpan(ctx, "postgres.get", "postgresql", "llm_responses")
+	rec, err := s.DB.GetResponse(ctx, responseID)
+	endGetSpan(span, err == nil, ignoreNoRows(err))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return rec, err
+}
+
+// DeleteResponse deletes the response with the given ID and reports whether it existed.
+func (s *Storage) DeleteResponse(ctx context.Context, responseID string) (bool, error) {
+	if s == nil || s.DB == nil {
+		return false, fmt.Errorf("storage not initialized")
+	}
+	return s.DB.DeleteResponse(ctx, responseID)
+}
+
+// ---------------- API keys ----------------
+
+// defaultAPIKeyCacheTTL is used when auth.cache_ttl is not configured.
+const defaultAPIKeyCacheTTL = time.Minute
+
+// GetAPIKey looks up a virtual API key by its plaintext value. Lookups, including misses,
+// are cached in Redis for auth.cache_ttl so that disabling a key takes effect within that window.
+// It returns nil without error when the key does not exist.
+func (s *Storage) GetAPIKey(ctx context.Context, key string) (*db.APIKeyRecord, error) {
+	if s == nil || s.DB == nil || s.Cache == nil {
+		return nil, fmt.Errorf("storage not initialized")
+	}
+
+	hash := utils.MakeHash(key)
+	cacheKey := "apikey:" + hash
+
+	var rec db.APIKeyRecord
+	span := startGetSpan(ctx, "redis.get", "redis", cacheKey)
+	found, err := s.Cache.Get(ctx, cacheKey, &rec)
+	endGetSpan(span, found, err)
+	if err != nil {
+		logger.Warn("Redis Get failed, falling back to Postgres",
+			zap.String("key", cacheKey),
+			zap.Error(err))
+	} else if found {
+		if rec.ID == 0 {
+			return nil, nil
+		}
+		return &rec, nil
+	}
+
+	span = startGetSpan(ctx, "postgres.get", "postgresql", "api_keys")
+	pgRec, err := s.DB.GetAPIKey(ctx, hash)
+	endGetSpan(span, pgRec != nil, ignoreNoRows(err))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		logger.Error("Failed to get API key from Postgres",
+			zap.String("key", cacheKey),
+			zap.Error(err))
+		return nil, err
+	}
+	if pgRec == nil {
+		// 缓存空记录，避免无效 key 反复查询 Postgres
+		pgRec = &db.APIKeyRecord{KeyHash: hash}
+	}
+	if err := s.Cache.Set(ctx, cacheKey, pgRec, s.apiKeyCacheTTL()); err != nil {
+		logger.Warn("Failed to backfill Redis cache for API key",
+			zap.String("key", cacheKey),
+			zap.Error(err))
+	}
+	if pgRec.ID == 0 {
+		return nil, nil
+	}
+	return pgRec, nil
+}
+
+func (s *Storage) apiKeyCacheTTL() time.Duration {
+	if cfg := s.config(); cfg != nil && cfg.Auth.CacheTTL > 0 {
+		return time.Duration(cfg.Auth.CacheTTL) * time.Second
+	}
+	return defaultAPIKeyCacheTTL
+}
+
+// IncrCounter atomically adds delta to a shared Redis counter whose TTL starts when it is created.
+func (s *Storage) IncrCounter(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	if s == nil || s.Cache == nil {
+		return 0, fmt.Errorf("storage not initialized")
+	}
+	return s.Cache.IncrBy(ctx, key, delta, ttl)
+}
+
+// GetCounter returns the current value of a shared Redis counter, 0 when absent.
+func (s *Storage) GetCounter(ctx context.Context, key string) (int64, error) {
+	if s == nil || s.Cache == nil {
+		return 0, fmt.Errorf("storage not initialized")
+	}
+	return s.Cache.GetInt(ctx, key)
+}
+
+// ---------------- Admin ----------------
+
+// redisDeleteBatchSize bounds the number of keys removed by a single DEL.
+const redisDeleteBatchSize = 500
+
+// SearchEmbeddings lists embedding cache entries from Postgres, the source of truth, with the total number of matches.
+func (s *Storage) SearchEmbeddings(ctx context.Context, q db.CacheQuery) ([]db.EmbeddingRecord, int, error) {
+	if s == nil || s.DB == nil {
+		return nil, 0, fmt.Errorf("storage not initialized")
+	}
+	records, err := s.DB.ListEmbeddings(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := s.DB.CountEmbeddings(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+// SearchLLMs lists LLM cache entries from Postgres, the source of truth, with the total number of matches.
+func (s *Storage) SearchLLMs(ctx context.Context, q db.CacheQuery) ([]db.LLMRecord, int, error) {
+	if s == nil || s.DB == nil {
+		return nil, 0, fmt.Errorf("storage not initialized")
+	}
+	records, err := s.DB.ListLLMs(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := s.DB.CountLLMs(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+// GetEmbeddingByHash returns the embedding entry with the given input hash, nil when absent.
+func (s *Storage) GetEmbeddingByHash(ctx context.Context, hash string) (*db.EmbeddingRecord, error) {
+	if s == nil || s.DB == nil {
+		return nil, fmt.Errorf("storage not initialized")
+	}
+	rec, err := s.DB.GetEmbeddingByHash(ctx, hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return rec, err
+}
+
+// GetLLMByHash returns the LLM entry with the given request hash, nil when absent.
+func (s *Storage) GetLLMByHash(ctx context.Context, hash string) (*db.LLMRecord, error) {
+	if s == nil || s.DB == nil {
+		return nil, fmt.Errorf("storage not initialized")
+	}
+	rec, err := s.DB.GetLLMByHash(ctx, hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return rec, err
+}
+
+// DeleteEmbeddings deletes matching embedding entries from Postgres and then their Redis copies,
+// returning the number of rows deleted. The count is valid even when purging Redis fails.
+func (s *Storage) DeleteEmbeddings(ctx context.Context, q db.CacheQuery) (int, error) {
+	if s == nil || s.DB == nil || s.Cache == nil {
+		return 0, fmt.Errorf("storage not initialized")
+	}
+	hashes, err := s.DB.DeleteEmbeddings(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	return len(hashes), s.purgeRedis(ctx, "embedding:", hashes)
+}
+
+// DeleteLLMs deletes matching LLM entries from Postgres and then their Redis copies,
+// returning the number of rows deleted. The count is valid even when purging Redis fails.
+func (s *Storage) DeleteLLMs(ctx context.Context, q db.CacheQuery) (int, error) {
+	if s == nil || s.DB == nil || s.Cache == nil {
+		return 0, fmt.Errorf("storage not initialized")
+	}
+	hashes, err := s.DB.DeleteLLMs(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	return len(hashes), s.purgeRedis(ctx, "llm:", hashes)
+}
+
+// purgeRedis removes the Redis copies of deleted rows so they stop being served before their TTL.
+func (s *Storage) purgeRedis(ctx context.Context, prefix string, hashes []string) error {
+	keys := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		keys = append(keys, prefix+hash)
+	}
+	for start := 0; start < len(keys); start += redisDeleteBatchSize {
+		end := min(start+redisDeleteBatchSize, len(keys))
+		if err := s.Cache.Del(ctx, keys[start:end]...); err != nil {
+			logger.Error("Failed to purge Redis cache entries",
+				zap.String("prefix", prefix),
+				zap.Int("keys", len(keys)),
+				zap.Error(err))
+			return fmt.Errorf("purge redis: %w", err)
+		}
+	}
+	return nil
+}
+
+// ---------------- Tracing ----------------
+
+// startGetSpan starts a client span for a single cache backend lookup. It is a no-op
+// when ctx is not part of a traced request.
+func startGetSpan(ctx context.Context, name, system, target string) *tracing.Span {
+	_, span := tracing.Start(ctx, name, tracing.SpanKindClient)
+	span.SetAttributes(tracing.Attribute{Key: "db.system", Value: system}, tracing.Attribute{Key: "db.target", Value: target})
+	return span
+}
+
+func endGetSpan(span *tracing.Span, hit bool, err error) {
+	span.SetAttribute("cache.hit", hit)
+	span.RecordError(err)
+	span.End()
+}
+
+// ignoreNoRows treats a missing row as a miss rather than a failed lookup.
+func ignoreNoRows(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+// ---------------- Expiration sweeper ----------------
+
+// StartExpireSweeper periodically deletes expired rows from Postgres in batches until Close is called.
+// Redis entries need no sweeping because their TTL never outlives the row.
+func (s *Storage) StartExpireSweeper(interval time.Duration, batchSize int) {
+	if s == nil || s.DB == nil || interval <= 0 || s.stopSweeper != nil {
+		return
+	}
+	if batchSize <= 0 {
+		batchSize = defaultSweepBatchSize
+	}
+	s.stopSweeper = make(chan struct{})
+	s.sweeperDone = make(chan struct{})
+
+	go func() {
+		defer close(s.sweeperDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stopSweeper:
+				return
+			case <-ticker.C:
+				s.SweepExpired(context.Background(), batchSize)
+			}
+		}
+	}()
+	logger.Info("Cache expire sweeper started",
+		zap.Duration("interval", interval),
+		zap.Int("batchSize", batchSize))
+}
+
+func (s *Storage) stopExpireSweeper() {
+	if s.stopSweeper == nil {
+		return
+	}
+	s.stopOnce.Do(func() {
+		close(s.stopSweeper)
+		<-s.sweeperDone
+	})
+}
+
+// SweepExpired deletes all currently expired rows, including stored Responses API responses,
+// batchSize rows per statement, and returns the cache totals.
+func (s *Storage) SweepExpired(ctx context.Context, batchSize int) (embeddings, llms int64) {
+	if s == nil || s.DB == nil {
+		return 0, 0
+	}
+	if batchSize <= 0 {
+		batchSize = defaultSweepBatchSize
+	}
+	now := time.Now()
+	embeddings = sweepInBatches(ctx, "embedding_cache", batchSize, func(ctx context.Context) (int64, error) {
+		return s.DB.DeleteExpiredEmbeddings(ctx, now, batchSize)
+	})
+	llms = sweepInBatches(ctx, "llm_cache", batchSize, func(ctx context.Context) (int64, error) {
+		return s.DB.DeleteExpiredLLMs(ctx, now, batchSize)
+	})
+	responses := sweepInBatches(ctx, "llm_responses", batchSize, func(ctx context.Context) (int64, error) {
+		return s.DB.DeleteExpiredResponses(ctx, now, batchSize)
+	})
+	if embeddings > 0 || llms > 0 || responses > 0 {
+		logger.Info("Swept expired cache entries",
+			zap.Int64("embeddings", embeddings),
+			zap.Int64("llms", llms),
+			zap.Int64("responses", responses))
+	}
+	return embeddings, llms
+}
+
+func sweepInBatches(ctx context.Context, table string, batchSize int, deleteBatch func(ctx context.Context) (int64, error)) int64 {
+	var total int64
+	for {
+		if ctx.Err() != nil {
+			return total
+		}
+		batchCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		deleted, err := deleteBatch(batchCtx)
+		cancel()
+		if err != nil {
+			logger.Warn("Failed to sweep expired cache entries",
+				zap.String("table", table),
+				zap.Error(err))
+			return total
+		}
+		total += deleted
+		if deleted < int64(batchSize) {
+			return total
+		}
+	}
+}
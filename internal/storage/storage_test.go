@@ -334,3 +334,78 @@ func TestStorage_Close(t *testing.T) {
 	// Ensure Close is safe to call multiple times
 	s.Close()
 }
+
+func TestRedisTTL(t *testing.T) {
+	now := time.Now()
+	never := db.NeverExpire
+	soon := now.Add(10 * time.Minute).UnixMilli()
+	later := now.Add(48 * time.Hour).UnixMilli()
+	past := now.Add(-time.Second).UnixMilli()
+
+	assert.Equal(t, defaultRedisTTL, redisTTL(nil, now))
+	assert.Equal(t, defaultRedisTTL, redisTTL(&never, now))
+	assert.Equal(t, defaultRedisTTL, redisTTL(&later, now))
+	assert.InDelta(t, float64(10*time.Minute), float64(redisTTL(&soon, now)), float64(time.Millisecond))
+	assert.Equal(t, time.Duration(0), redisTTL(&past, now))
+}
+
+func TestStorage_LLMExpiration(t *testing.T) {
+	s := setupTestStorage(t)
+	defer s.Close()
+
+	ctx := context.Background()
+	request := json.RawMessage(`{"model":"gpt-4","messages":[{"role":"user","content":"test_storage_llm_expiration"}]}`)
+	expired := time.Now().Add(-time.Minute).UnixMilli()
+	require.NoError(t, s.UpsertLLM(ctx, &db.LLMRecord{
+		Request:   request,
+		ModelName: "gpt-4",
+		Response:  json.RawMessage(`{"ok":true}`),
+		ExpireAt:  &expired,
+	}))
+
+	// Expired rows are neither cached in Redis nor returned from Postgres
+	rec, err := s.GetLLM(ctx, string(request), "gpt-4")
+	require.NoError(t, err)
+	assert.Nil(t, rec)
+
+	_, llms := s.SweepExpired(ctx, 10)
+	assert.GreaterOrEqual(t, llms, int64(1))
+}
+
+func TestStorage_EmbeddingTTLFromConfig(t *testing.T) {
+	s := setupTestStorage(t)
+	defer s.Close()
+	ttl := 120
+	s.config().Cache.Models = map[string]config.CacheModelConfig{"ttl-embedding-model": {TTL: &ttl}}
+
+	ctx := context.Background()
+	rec := newStorageEmbeddingRecord("test_storage_embedding_ttl", "ttl-embedding-model", []float64{0.1, 0.2})
+	before := time.Now()
+	require.NoError(t, s.UpsertEmbedding(ctx, rec))
+	require.NotNil(t, rec.ExpireAt)
+	assert.InDelta(t, before.Add(2*time.Minute).UnixMilli(), *rec.ExpireAt, 1000)
+
+	key := "embedding:" + rec.InputHash
+	rdb := newRawRedis()
+	defer rdb.Close()
+	redisTTL, err := rdb.TTL(ctx, key).Result()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, redisTTL, 2*time.Minute)
+	assert.Greater(t, redisTTL, time.Minute)
+}
+
+func TestStorage_SetConfigUpdatesTTL(t *testing.T) {
+	s := setupTestStorage(t)
+	defer s.Close()
+
+	ctx := context.Background()
+	next := *s.config()
+	next.Cache.TTL = 3600
+	s.SetConfig(&next)
+
+	rec := newStorageEmbeddingRecord("test_storage_set_config_ttl", "set-config-model", []float64{0.1, 0.2})
+	before := time.Now()
+	require.NoError(t, s.UpsertEmbedding(ctx, rec))
+	require.NotNil(t, rec.ExpireAt)
+	assert.InDelta(t, before.Add(time.Hour).UnixMilli(), *rec.ExpireAt, 1000)
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -16,8 +17,15 @@ import (
 	gocache "github.com/patrickmn/go-cache"
 )
 
+const (
+	// urlCacheTTL 缓存条目的有效期。前缀与正则路由下请求路径由客户端决定，条目需要过期回收
+	urlCacheTTL = 10 * time.Minute
+	// urlCacheMaxEntries 缓存条目上限，达到上限后新的 URL 不再缓存，直到过期条目被清理
+	urlCacheMaxEntries = 10000
+)
+
 // Global URL cache
-var urlCache = gocache.New(gocache.NoExpiration, gocache.NoExpiration)
+var urlCache = gocache.New(urlCacheTTL, urlCacheTTL)
 
 // GetTargetURLWithCache builds URL with caching
 func GetTargetURLWithCache(baseURL, path string) (*url.URL, error) {
@@ -36,7 +44,9 @@ func GetTargetURLWithCache(baseURL, path string) (*url.URL, error) {
 		resultURL.Path = "/" + resultURL.Path
 	}
 
-	urlCache.Set(cacheKey, resultURL, gocache.NoExpiration)
+	if urlCache.ItemCount() < urlCacheMaxEntries {
+		urlCache.Set(cacheKey, resultURL, gocache.DefaultExpiration)
+	}
 	return resultURL, nil
 }
 
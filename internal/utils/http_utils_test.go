@@ -338,6 +338,26 @@ func TestURLCacheConcurrency(t *testing.T) {
 	}
 }
 
+// TestURLCacheBounded test that the URL cache stops growing at its entry limit
+func TestURLCacheBounded(t *testing.T) {
+	urlCache.Flush()
+	defer urlCache.Flush()
+	baseURL := "https://api.example.com"
+	for i := 0; i < urlCacheMaxEntries+100; i++ {
+		path := fmt.Sprintf("/v1/files/file-%d", i)
+		result, err := GetTargetURLWithCache(baseURL, path)
+		if err != nil {
+			t.Fatalf("URL build failed: %v", err)
+		}
+		if expected := baseURL + path; result.String() != expected {
+			t.Fatalf("expected %s, got %s", expected, result.String())
+		}
+	}
+	if itemCount := urlCache.ItemCount(); itemCount != urlCacheMaxEntries {
+		t.Errorf("expected %d cache items, got %d", urlCacheMaxEntries, itemCount)
+	}
+}
+
 // TestURLCachePerformance test URL cache performance
 func TestURLCachePerformance(t *testing.T) {
 	urlCache.Flush()
@@ -1,9 +1,12 @@
 package utils
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 func MakeHash(s string) string {
@@ -20,3 +23,50 @@ func MakeEmbeddingCacheKey(inputText, modelName string, dimensions *int) string
 	}
 	return MakeHash(key)
 }
+
+// CanonicalizeLLMRequest builds the canonical form of a chat request used as the LLM cache key.
+// Keys are sorted recursively, whitespace is removed and numbers keep their original literal.
+// ignoreFields are dropped from the top level; when keyFields is non-empty only those fields are kept.
+// A non-empty model overrides the request's model field so aliases share entries with their target.
+func CanonicalizeLLMRequest(body []byte, model string, ignoreFields, keyFields []string) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var payload map[string]interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return "", fmt.Errorf("failed to decode request: %w", err)
+	}
+	if payload == nil {
+		return "", fmt.Errorf("request must be a JSON object")
+	}
+
+	if len(keyFields) > 0 {
+		kept := make(map[string]interface{}, len(keyFields)+1)
+		for _, field := range keyFields {
+			if v, ok := payload[field]; ok {
+				kept[field] = v
+			}
+		}
+		if v, ok := payload["model"]; ok {
+			kept["model"] = v
+		}
+		payload = kept
+	}
+	for _, field := range ignoreFields {
+		if field != "model" {
+			delete(payload, field)
+		}
+	}
+	if model != "" {
+		payload["model"] = model
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	// encoding/json 对 map 的键按字典序输出，嵌套对象同样有序
+	if err := encoder.Encode(payload); err != nil {
+		return "", fmt.Errorf("failed to encode request: %w", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
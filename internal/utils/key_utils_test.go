@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"testing"
+)
+
+// TestCanonicalizeLLMRequest test canonical request generation for LLM cache keys
+func TestCanonicalizeLLMRequest(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		model        string
+		ignoreFields []string
+		keyFields    []string
+		expected     string
+		expectError  bool
+	}{
+		{
+			name:     "Sorted keys and compact output",
+			body:     `{ "temperature": 0.7, "model": "gpt-4", "messages": [ {"role": "user", "content": "hi"} ] }`,
+			expected: `{"messages":[{"content":"hi","role":"user"}],"model":"gpt-4","temperature":0.7}`,
+		},
+		{
+			name:         "Ignored fields dropped",
+			body:         `{"model":"gpt-4","user":"u-1","metadata":{"a":1},"stream":true,"messages":[]}`,
+			ignoreFields: []string{"user", "metadata", "stream"},
+			expected:     `{"messages":[],"model":"gpt-4"}`,
+		},
+		{
+			name:     "Model overridden by resolved name",
+			body:     `{"model":"my-gpt","messages":[]}`,
+			model:    "gpt-4",
+			expected: `{"messages":[],"model":"gpt-4"}`,
+		},
+		{
+			name:      "Key fields keep model",
+			body:      `{"model":"gpt-4","messages":[],"temperature":1,"seed":7}`,
+			keyFields: []string{"messages"},
+			expected:  `{"messages":[],"model":"gpt-4"}`,
+		},
+		{
+			name:         "Model cannot be ignored",
+			body:         `{"model":"gpt-4"}`,
+			ignoreFields: []string{"model"},
+			expected:     `{"model":"gpt-4"}`,
+		},
+		{
+			name:     "Large integers keep precision",
+			body:     `{"model":"gpt-4","seed":12345678901234567890}`,
+			expected: `{"model":"gpt-4","seed":12345678901234567890}`,
+		},
+		{
+			name:     "HTML characters are not escaped",
+			body:     `{"model":"gpt-4","messages":[{"content":"<b>&</b>"}]}`,
+			expected: `{"messages":[{"content":"<b>&</b>"}],"model":"gpt-4"}`,
+		},
+		{
+			name:        "Invalid JSON",
+			body:        `{invalid`,
+			expectError: true,
+		},
+		{
+			name:        "Non-object JSON",
+			body:        `null`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := CanonicalizeLLMRequest([]byte(tt.body), tt.model, tt.ignoreFields, tt.keyFields)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestCanonicalizeLLMRequest_Equivalent test that semantically equal requests share one key
+func TestCanonicalizeLLMRequest_Equivalent(t *testing.T) {
+	a, err := CanonicalizeLLMRequest([]byte(`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"user":"a"}`), "", []string{"user"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := CanonicalizeLLMRequest([]byte("{\n  \"user\": \"b\",\n  \"messages\": [{\"content\": \"hi\", \"role\": \"user\"}],\n  \"model\": \"gpt-4\"\n}"), "", []string{"user"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if MakeHash(a) != MakeHash(b) {
+		t.Errorf("expected equal hashes, got %s and %s", a, b)
+	}
+}
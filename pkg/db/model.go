@@ -42,6 +42,42 @@ type LLMRecord struct {
 	CreatedAt        time.Time       `json:"created_at"`
 	UpdatedAt        time.Time       `json:"updated_at"`
 	ExpireAt         *int64          `json:"expire_at,omitempty"` // Unix 时间戳（毫秒），-1 表示永不过期
+	// Semantic cache: entries are comparable only when SemanticKey (the request without its last
+	// user message, plus the embedding model) matches; PromptEmbedding embeds that last message.
+	SemanticKey     string    `json:"semantic_key,omitempty"`
+	PromptEmbedding []float64 `json:"-"`
+}
+
+// APIKeyRecord represents a virtual API key issued to a client
+type APIKeyRecord struct {
+	ID            int       `json:"id"`
+	KeyHash       string    `json:"key_hash"` // SHA-256 of the plaintext key, hex encoded
+	Name          string    `json:"name"`
+	AllowedModels []string  `json:"allowed_models"` // empty means all models
+	AllowedPaths  []string  `json:"allowed_paths"`  // empty means all paths; a trailing * matches a prefix
+	RPMLimit      int       `json:"rpm_limit"`      // requests per minute, 0 means unlimited
+	TokensPerDay  int64     `json:"tokens_per_day"` // 0 means unlimited
+	Enabled       bool      `json:"enabled"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ResponseRecord represents a stored Responses API response together with the conversation
+// history needed to continue it through previous_response_id
+type ResponseRecord struct {
+	ID                 int             `json:"id"`
+	ResponseID         string          `json:"response_id"` // resp_... returned to the client
+	PreviousResponseID string          `json:"previous_response_id,omitempty"`
+	RequestID          string          `json:"request_id"`
+	APIKeyID           int             `json:"api_key_id,omitempty"` // owning virtual API key, 0 when auth is disabled
+	ModelName          string          `json:"model_name"`
+	Messages           json.RawMessage `json:"messages"` // chat messages of the whole conversation, including this response's output
+	Response           json.RawMessage `json:"response"` // Responses API response object
+	TotalTokens        *int            `json:"total_tokens,omitempty"`
+	PromptTokens       *int            `json:"prompt_tokens,omitempty"`
+	CompletionTokens   *int            `json:"completion_tokens,omitempty"`
+	CreatedAt          time.Time       `json:"created_at"`
+	ExpireAt           *int64          `json:"expire_at,omitempty"` // Unix 时间戳（毫秒），-1 表示永不过期
 }
 
 const ddl = `
@@ -90,4 +126,37 @@ CREATE TABLE IF NOT EXISTS llm_cache (
     expire_at BIGINT DEFAULT -1,           -- Unix 时间戳（毫秒），-1 表示永不过期
     UNIQUE(request_hash, model_name)       -- 保证唯一
 );
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    key_hash CHAR(64) NOT NULL UNIQUE,          -- 明文 key 的 SHA-256（hex）
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    allowed_models TEXT[] NOT NULL DEFAULT '{}', -- 为空表示不限制
+    allowed_paths TEXT[] NOT NULL DEFAULT '{}',  -- 为空表示不限制，末尾 * 表示前缀匹配
+    rpm_limit INT NOT NULL DEFAULT 0,           -- 每分钟请求数，0 表示不限制
+    tokens_per_day BIGINT NOT NULL DEFAULT 0,   -- 每日 token 数，0 表示不限制
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS llm_responses (
+    id SERIAL PRIMARY KEY,
+    response_id VARCHAR(64) NOT NULL UNIQUE,   -- 返回给客户端的 resp_ ID
+    previous_response_id VARCHAR(64),          -- 续接的上一个响应
+    request_id VARCHAR(255),                   -- 请求 ID
+    api_key_id INT NOT NULL DEFAULT 0,         -- 所属虚拟 API Key，0 表示未开启鉴权
+    model_name VARCHAR(128) NOT NULL,
+    messages JSONB NOT NULL,                   -- 截至本响应的完整对话历史（chat 消息格式）
+    response JSONB NOT NULL,                   -- Responses API 响应对象
+    total_tokens INT,
+    prompt_tokens INT,
+    completion_tokens INT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    expire_at BIGINT DEFAULT -1                -- Unix 时间戳（毫秒），-1 表示永不过期
+);
+CREATE INDEX IF NOT EXISTS llm_responses_expire_at_idx ON llm_responses (expire_at) WHERE expire_at >= 0;
+CREATE INDEX IF NOT EXISTS embedding_cache_expire_at_idx ON embedding_cache (expire_at) WHERE expire_at >= 0;
+CREATE INDEX IF NOT EXISTS llm_cache_expire_at_idx ON llm_cache (expire_at) WHERE expire_at >= 0;
+ALTER TABLE llm_cache ADD COLUMN IF NOT EXISTS semantic_key CHAR(64);                 -- 语义缓存分组键，为空表示未开启
+ALTER TABLE llm_cache ADD COLUMN IF NOT EXISTS prompt_embedding DOUBLE PRECISION[];   -- 最后一条用户消息的 embedding
+CREATE INDEX IF NOT EXISTS llm_cache_semantic_key_idx ON llm_cache (model_name, semantic_key, updated_at DESC) WHERE semantic_key IS NOT NULL;
 `
@@ -42,10 +42,10 @@ const (
 			updated_at = NOW()`
 
 	sqlUpsertLLM = `
-		INSERT INTO llm_cache (request_hash, request_id, request, model_name, temperature, max_tokens, response, total_tokens, prompt_tokens, completion_tokens, start_time, end_time)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		INSERT INTO llm_cache (request_hash, request_id, request, model_name, temperature, max_tokens, response, total_tokens, prompt_tokens, completion_tokens, start_time, end_time, expire_at, semantic_key, prompt_embedding)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NULLIF($14, ''), $15)
 		ON CONFLICT (request_hash, model_name)
-		DO UPDATE SET request_id = EXCLUDED.request_id, response = EXCLUDED.response, total_tokens = EXCLUDED.total_tokens, prompt_tokens = EXCLUDED.prompt_tokens, completion_tokens = EXCLUDED.completion_tokens, start_time = EXCLUDED.start_time, end_time = EXCLUDED.end_time, updated_at = NOW()`
+		DO UPDATE SET request_id = EXCLUDED.request_id, response = EXCLUDED.response, total_tokens = EXCLUDED.total_tokens, prompt_tokens = EXCLUDED.prompt_tokens, completion_tokens = EXCLUDED.completion_tokens, start_time = EXCLUDED.start_time, end_time = EXCLUDED.end_time, expire_at = EXCLUDED.expire_at, semantic_key = EXCLUDED.semantic_key, prompt_embedding = EXCLUDED.prompt_embedding, updated_at = NOW()`
 
 	sqlGetEmbedding = `
 		SELECT
@@ -64,44 +64,62 @@ const (
 			updated_at,
 			expire_at
 		FROM embedding_cache
-		WHERE input_hash = $1 AND model_name = $2`
+		WHERE input_hash = $1 AND model_name = $2
+		  AND (expire_at IS NULL OR expire_at < 0 OR expire_at > $3)`
 
 	sqlGetLLM = `
 		SELECT id, request_hash, request_id, request, model_name, temperature, max_tokens, response, total_tokens, prompt_tokens, completion_tokens, start_time, end_time, created_at, updated_at, expire_at
 		FROM llm_cache
-		WHERE request_hash = $1`
+		WHERE request_hash = $1
+		  AND (expire_at IS NULL OR expire_at < 0 OR expire_at > $2)`
+
+	sqlGetAPIKey = `
+		SELECT id, key_hash, name, allowed_models, allowed_paths, rpm_limit, tokens_per_day, enabled, created_at, updated_at
+		FROM api_keys
+		WHERE key_hash = $1`
+
+	sqlUpsertAPIKey = `
+		INSERT INTO api_keys (key_hash, name, allowed_models, allowed_paths, rpm_limit, tokens_per_day, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (key_hash)
+		DO UPDATE SET name = EXCLUDED.name, allowed_models = EXCLUDED.allowed_models, allowed_paths = EXCLUDED.allowed_paths, rpm_limit = EXCLUDED.rpm_limit, tokens_per_day = EXCLUDED.tokens_per_day, enabled = EXCLUDED.enabled, updated_at = NOW()
+		RETURNING id`
+
+	sqlDeleteExpiredEmbeddings = `
+		DELETE FROM embedding_cache
+		WHERE id IN (
+			SELECT id FROM embedding_cache
+			WHERE expire_at >= 0 AND expire_at <= $1
+			LIMIT $2
+		)`
+
+	sqlDeleteExpiredLLMs = `
+		DELETE FROM llm_cache
+		WHERE id IN (
+			SELECT id FROM llm_cache
+			WHERE expire_at >= 0 AND expire_at <= $1
+			LIMIT $2
+		)`
+)
 
-	sqlListEmbeddings = `
-		SELECT
-			id,
-			input_hash,
-			input_text,
-			model_name,
-			dimensions,
-			request_id,
-			token_count,
-			embedding,
-			start_time,
-			end_time,
-			duration_ms,
-			created_at,
-			updated_at,
-			expire_at
-		FROM embedding_cache
-		WHERE model_name = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3`
+// NeverExpire expire_at 取该值表示永不过期
+const NeverExpire int64 = -1
 
-	sqlListLLMs = `
-		SELECT id, request_hash, request_id, request, model_name, temperature, max_tokens, response, total_tokens, prompt_tokens, completion_tokens, start_time, end_time, created_at, updated_at, expire_at
-		FROM llm_cache
-		WHERE model_name = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3`
+// ExpireAtFromTTL 根据存活时间计算 expire_at（Unix 毫秒），ttl <= 0 返回 NeverExpire
+func ExpireAtFromTTL(now time.Time, ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return NeverExpire
+	}
+	return now.Add(ttl).UnixMilli()
+}
 
-	sqlCountEmbeddings = `SELECT COUNT(*) FROM embedding_cache WHERE model_name = $1`
-	sqlCountLLMs       = `SELECT COUNT(*) FROM llm_cache WHERE model_name = $1`
-)
+// IsExpired 判断 expire_at 在 now 时是否已过期
+func IsExpired(expireAt *int64, now time.Time) bool {
+	if expireAt == nil || *expireAt < 0 {
+		return false
+	}
+	return *expireAt <= now.UnixMilli()
+}
 
 // schemaMigrationLockID synchronizes schema creation across processes via pg_advisory_lock.
 const schemaMigrationLockID int64 = 0x676f6c6c6d // "gollm" in hex
@@ -109,6 +127,8 @@ const schemaMigrationLockID int64 = 0x676f6c6c6d // "gollm" in hex
 // Postgres wraps a pgx connection pool
 type Postgres struct {
 	Pool *pgxpool.Pool
+	// vector reports whether the pgvector extension is installed; semantic lookups then rank in SQL.
+	vector bool
 }
 
 // NewPostgres creates a new pgx pool using DatabaseConfig
@@ -165,10 +185,16 @@ func NewPostgres(cfg config.DatabaseConfig) (*Postgres, error) {
 		pool.Close()
 		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
+	pg.vector = pg.detectVector(ctx)
 
 	return pg, nil
 }
 
+// Ping verifies that a connection to the database can be acquired and used.
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.Pool.Ping(ctx)
+}
+
 // Close closes the pool
 func (p *Postgres) Close() {
 	if p != nil && p.Pool != nil {
@@ -226,7 +252,7 @@ func (p *Postgres) UpsertEmbedding(ctx context.Context, rec *EmbeddingRecord) er
 		rec.InputHash = utils.MakeEmbeddingCacheKey(rec.InputText, rec.ModelName, rec.Dimensions)
 	}
 	if rec.ExpireAt == nil {
-		defaultExpire := int64(-1)
+		defaultExpire := NeverExpire
 		rec.ExpireAt = &defaultExpire
 	}
 
@@ -254,8 +280,12 @@ func (p *Postgres) UpsertLLM(ctx context.Context, rec *LLMRecord) error {
 	requestStr := string(rec.Request)
 	hash := utils.MakeHash(requestStr)
 	rec.RequestHash = hash
+	if rec.ExpireAt == nil {
+		defaultExpire := NeverExpire
+		rec.ExpireAt = &defaultExpire
+	}
 
-	_, err := p.Pool.Exec(ctx, sqlUpsertLLM, hash, rec.RequestID, rec.Request, rec.ModelName, rec.Temperature, rec.MaxTokens, rec.Response, rec.TotalTokens, rec.PromptTokens, rec.CompletionTokens, rec.StartTime, rec.EndTime)
+	_, err := p.Pool.Exec(ctx, sqlUpsertLLM, hash, rec.RequestID, rec.Request, rec.ModelName, rec.Temperature, rec.MaxTokens, rec.Response, rec.TotalTokens, rec.PromptTokens, rec.CompletionTokens, rec.StartTime, rec.EndTime, rec.ExpireAt, rec.SemanticKey, rec.PromptEmbedding)
 	if err != nil {
 		return err
 	}
@@ -265,125 +295,121 @@ func (p *Postgres) UpsertLLM(ctx context.Context, rec *LLMRecord) error {
 // GetEmbedding retrieves an embedding record by input, model and optional dimensions
 func (p *Postgres) GetEmbedding(ctx context.Context, inputText, modelName string, dimensions *int) (*EmbeddingRecord, error) {
 	hash := utils.MakeEmbeddingCacheKey(inputText, modelName, dimensions)
-
-	var record EmbeddingRecord
-	err := p.Pool.QueryRow(ctx, sqlGetEmbedding, hash, modelName).Scan(
-		&record.ID,
-		&record.InputHash,
-		&record.InputText,
-		&record.ModelName,
-		&record.Dimensions,
-		&record.RequestID,
-		&record.TokenCount,
-		&record.Embedding,
-		&record.StartTime,
-		&record.EndTime,
-		&record.DurationMs,
-		&record.CreatedAt,
-		&record.UpdatedAt,
-		&record.ExpireAt,
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &record, nil
+	return scanEmbedding(p.Pool.QueryRow(ctx, sqlGetEmbedding, hash, modelName, time.Now().UnixMilli()))
 }
 
 // GetLLM retrieves an LLM record by prompt and parameters
 func (p *Postgres) GetLLM(ctx context.Context, request string) (*LLMRecord, error) {
 	hash := utils.MakeHash(request)
-
-	var record LLMRecord
-	err := p.Pool.QueryRow(ctx, sqlGetLLM, hash).Scan(
-		&record.ID, &record.RequestHash, &record.RequestID, &record.Request, &record.ModelName,
-		&record.Temperature, &record.MaxTokens, &record.Response, &record.TotalTokens,
-		&record.PromptTokens, &record.CompletionTokens,
-		&record.StartTime, &record.EndTime,
-		&record.CreatedAt, &record.UpdatedAt, &record.ExpireAt,
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &record, nil
+	return scanLLM(p.Pool.QueryRow(ctx, sqlGetLLM, hash, time.Now().UnixMilli()))
 }
 
-// ListEmbeddings retrieves embedding records with pagination
-func (p *Postgres) ListEmbeddings(ctx context.Context, modelName string, limit, offset int) ([]EmbeddingRecord, error) {
-	rows, err := p.Pool.Query(ctx, sqlListEmbeddings, modelName, limit, offset)
+// ListEmbeddings returns the embedding records matching q, newest first.
+// Expired records are included so that they can be inspected and purged.
+func (p *Postgres) ListEmbeddings(ctx context.Context, q CacheQuery) ([]EmbeddingRecord, error) {
+	where, args := q.where("input_hash")
+	page, args := q.page(args)
+	rows, err := p.Pool.Query(ctx, "SELECT "+embeddingColumns+" FROM embedding_cache"+where+page, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var records []EmbeddingRecord
+	records := []EmbeddingRecord{}
 	for rows.Next() {
-		var record EmbeddingRecord
-		err := rows.Scan(
-			&record.ID,
-			&record.InputHash,
-			&record.InputText,
-			&record.ModelName,
-			&record.Dimensions,
-			&record.RequestID,
-			&record.TokenCount,
-			&record.Embedding,
-			&record.StartTime,
-			&record.EndTime,
-			&record.DurationMs,
-			&record.CreatedAt,
-			&record.UpdatedAt,
-			&record.ExpireAt,
-		)
+		record, err := scanEmbedding(rows)
 		if err != nil {
 			return nil, err
 		}
-		records = append(records, record)
+		records = append(records, *record)
 	}
-
 	return records, rows.Err()
 }
 
-// ListLLMs retrieves LLM records with pagination
-func (p *Postgres) ListLLMs(ctx context.Context, modelName string, limit, offset int) ([]LLMRecord, error) {
-	rows, err := p.Pool.Query(ctx, sqlListLLMs, modelName, limit, offset)
+// ListLLMs returns the LLM records matching q, newest first.
+// Expired records are included so that they can be inspected and purged.
+func (p *Postgres) ListLLMs(ctx context.Context, q CacheQuery) ([]LLMRecord, error) {
+	where, args := q.where("request_hash")
+	page, args := q.page(args)
+	rows, err := p.Pool.Query(ctx, "SELECT "+llmColumns+" FROM llm_cache"+where+page, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var records []LLMRecord
+	records := []LLMRecord{}
 	for rows.Next() {
-		var record LLMRecord
-		err := rows.Scan(
-			&record.ID, &record.RequestHash, &record.RequestID, &record.Request, &record.ModelName,
-			&record.Temperature, &record.MaxTokens, &record.Response, &record.TotalTokens,
-			&record.PromptTokens, &record.CompletionTokens,
-			&record.StartTime, &record.EndTime,
-			&record.CreatedAt, &record.UpdatedAt, &record.ExpireAt,
-		)
+		record, err := scanLLM(rows)
 		if err != nil {
 			return nil, err
 		}
-		records = append(records, record)
+		records = append(records, *record)
 	}
-
 	return records, rows.Err()
 }
 
-// CountEmbeddings returns the total count of embedding records for a model
-func (p *Postgres) CountEmbeddings(ctx context.Context, modelName string) (int, error) {
+// CountEmbeddings returns the number of embedding records matching q; Limit and Offset are ignored
+func (p *Postgres) CountEmbeddings(ctx context.Context, q CacheQuery) (int, error) {
+	where, args := q.where("input_hash")
 	var count int
-	err := p.Pool.QueryRow(ctx, sqlCountEmbeddings, modelName).Scan(&count)
+	err := p.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM embedding_cache"+where, args...).Scan(&count)
 	return count, err
 }
 
-// CountLLMs returns the total count of LLM records for a model
-func (p *Postgres) CountLLMs(ctx context.Context, modelName string) (int, error) {
+// CountLLMs returns the number of LLM records matching q; Limit and Offset are ignored
+func (p *Postgres) CountLLMs(ctx context.Context, q CacheQuery) (int, error) {
+	where, args := q.where("request_hash")
 	var count int
-	err := p.Pool.QueryRow(ctx, sqlCountLLMs, modelName).Scan(&count)
+	err := p.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM llm_cache"+where, args...).Scan(&count)
 	return count, err
 }
+
+// DeleteExpiredEmbeddings deletes at most limit expired embedding records and returns the number deleted
+func (p *Postgres) DeleteExpiredEmbeddings(ctx context.Context, now time.Time, limit int) (int64, error) {
+	tag, err := p.Pool.Exec(ctx, sqlDeleteExpiredEmbeddings, now.UnixMilli(), limit)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// DeleteExpiredLLMs deletes at most limit expired LLM records and returns the number deleted
+func (p *Postgres) DeleteExpiredLLMs(ctx context.Context, now time.Time, limit int) (int64, error) {
+	tag, err := p.Pool.Exec(ctx, sqlDeleteExpiredLLMs, now.UnixMilli(), limit)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// GetAPIKey retrieves a virtual API key by the SHA-256 hash of its plaintext
+func (p *Postgres) GetAPIKey(ctx context.Context, keyHash string) (*APIKeyRecord, error) {
+	var record APIKeyRecord
+	err := p.Pool.QueryRow(ctx, sqlGetAPIKey, keyHash).Scan(
+		&record.ID, &record.KeyHash, &record.Name, &record.AllowedModels, &record.AllowedPaths,
+		&record.RPMLimit, &record.TokensPerDay, &record.Enabled, &record.CreatedAt, &record.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// UpsertAPIKey creates or updates a virtual API key identified by KeyHash
+func (p *Postgres) UpsertAPIKey(ctx context.Context, rec *APIKeyRecord) error {
+	if rec == nil {
+		return fmt.Errorf("api key record cannot be nil")
+	}
+	if rec.KeyHash == "" {
+		return fmt.Errorf("api key record missing key hash")
+	}
+	if rec.AllowedModels == nil {
+		rec.AllowedModels = []string{}
+	}
+	if rec.AllowedPaths == nil {
+		rec.AllowedPaths = []string{}
+	}
+	return p.Pool.QueryRow(ctx, sqlUpsertAPIKey,
+		rec.KeyHash, rec.Name, rec.AllowedModels, rec.AllowedPaths, rec.RPMLimit, rec.TokensPerDay, rec.Enabled,
+	).Scan(&rec.ID)
+}
@@ -3,9 +3,11 @@ package db
 import (
 	"context"
 	"fmt"
+	"math"
 	"os"
 	"strconv"
 	"testing"
+	"time"
 
 	"go-llm-server/internal/config"
 	"go-llm-server/internal/utils"
@@ -444,7 +446,7 @@ func TestEmbeddingHashConsistency(t *testing.T) {
 	}
 
 	// Verify only one record exists (due to unique constraint)
-	count, err := pg.CountEmbeddings(ctx, modelName)
+	count, err := pg.CountEmbeddings(ctx, CacheQuery{ModelName: modelName})
 	if err != nil {
 		t.Fatalf("Count should succeed: %v", err)
 	}
@@ -627,3 +629,300 @@ func BenchmarkGetEmbedding(b *testing.B) {
 		b.Logf("Warning: failed to cleanup benchmark data: %v", err)
 	}
 }
+
+// TestExpireAtFromTTL tests expire_at calculation and expiry checks
+func TestExpireAtFromTTL(t *testing.T) {
+	now := time.Now()
+	if got := ExpireAtFromTTL(now, 0); got != NeverExpire {
+		t.Errorf("expected NeverExpire for zero ttl, got %d", got)
+	}
+	expireAt := ExpireAtFromTTL(now, time.Minute)
+	if expireAt != now.Add(time.Minute).UnixMilli() {
+		t.Errorf("unexpected expire_at %d", expireAt)
+	}
+	if IsExpired(&expireAt, now) {
+		t.Error("record should not be expired yet")
+	}
+	if !IsExpired(&expireAt, now.Add(2*time.Minute)) {
+		t.Error("record should be expired")
+	}
+	never := NeverExpire
+	if IsExpired(&never, now.Add(time.Hour*24*365)) || IsExpired(nil, now) {
+		t.Error("records without expiry should never expire")
+	}
+}
+
+// TestGetEmbeddingSkipsExpired tests that expired rows are filtered and swept
+func TestGetEmbeddingSkipsExpired(t *testing.T) {
+	pg := setupTestDB(t)
+	defer pg.Close()
+	defer cleanupTestDB(t, pg)
+
+	ctx := context.Background()
+	rec := newTestEmbeddingRecord("test_expired_embedding", "test-model", []float64{0.1, 0.2})
+	expired := time.Now().Add(-time.Minute).UnixMilli()
+	rec.ExpireAt = &expired
+	if err := pg.UpsertEmbedding(ctx, rec); err != nil {
+		t.Fatalf("UpsertEmbedding failed: %v", err)
+	}
+
+	if _, err := pg.GetEmbedding(ctx, rec.InputText, rec.ModelName, nil); err == nil {
+		t.Error("expected no rows for expired embedding")
+	}
+
+	deleted, err := pg.DeleteExpiredEmbeddings(ctx, time.Now(), 100)
+	if err != nil {
+		t.Fatalf("DeleteExpiredEmbeddings failed: %v", err)
+	}
+	if deleted < 1 {
+		t.Errorf("expected at least one expired embedding to be deleted, got %d", deleted)
+	}
+}
+
+// TestUpsertAndGetAPIKey tests virtual API key persistence
+func TestUpsertAndGetAPIKey(t *testing.T) {
+	pg := setupTestDB(t)
+	defer pg.Close()
+
+	ctx := context.Background()
+	keyHash := utils.MakeHash(fmt.Sprintf("test_key_%d", time.Now().UnixNano()))
+	defer func() {
+		if _, err := pg.Pool.Exec(ctx, "DELETE FROM api_keys WHERE key_hash = $1", keyHash); err != nil {
+			t.Logf("Warning: failed to cleanup api key: %v", err)
+		}
+	}()
+
+	rec := &APIKeyRecord{
+		KeyHash:       keyHash,
+		Name:          "test",
+		AllowedModels: []string{"gpt-4"},
+		RPMLimit:      60,
+		TokensPerDay:  100000,
+		Enabled:       true,
+	}
+	if err := pg.UpsertAPIKey(ctx, rec); err != nil {
+		t.Fatalf("UpsertAPIKey failed: %v", err)
+	}
+	if rec.ID == 0 {
+		t.Error("expected ID to be set after upsert")
+	}
+
+	got, err := pg.GetAPIKey(ctx, keyHash)
+	if err != nil {
+		t.Fatalf("GetAPIKey failed: %v", err)
+	}
+	if got.Name != "test" || got.RPMLimit != 60 || got.TokensPerDay != 100000 || !got.Enabled {
+		t.Errorf("unexpected api key record: %+v", got)
+	}
+	if len(got.AllowedModels) != 1 || got.AllowedModels[0] != "gpt-4" || len(got.AllowedPaths) != 0 {
+		t.Errorf("unexpected allowlists: models=%v paths=%v", got.AllowedModels, got.AllowedPaths)
+	}
+
+	rec.Enabled = false
+	if err := pg.UpsertAPIKey(ctx, rec); err != nil {
+		t.Fatalf("UpsertAPIKey update failed: %v", err)
+	}
+	got, err = pg.GetAPIKey(ctx, keyHash)
+	if err != nil {
+		t.Fatalf("GetAPIKey failed: %v", err)
+	}
+	if got.Enabled {
+		t.Error("expected key to be disabled after update")
+	}
+}
+
+func TestInsertGetAndDeleteResponse(t *testing.T) {
+	pg := setupTestDB(t)
+	defer pg.Close()
+
+	ctx := context.Background()
+	responseID := fmt.Sprintf("resp_test_%d", time.Now().UnixNano())
+	defer func() {
+		if _, err := pg.Pool.Exec(ctx, "DELETE FROM llm_responses WHERE response_id = $1", responseID); err != nil {
+			t.Logf("Warning: failed to cleanup response: %v", err)
+		}
+	}()
+
+	total := 12
+	rec := &ResponseRecord{
+		ResponseID:  responseID,
+		RequestID:   "req-1",
+		APIKeyID:    7,
+		ModelName:   "gpt-4",
+		Messages:    []byte(`[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"}]`),
+		Response:    []byte(`{"id":"` + responseID + `","object":"response"}`),
+		TotalTokens: &total,
+	}
+	if err := pg.InsertResponse(ctx, rec); err != nil {
+		t.Fatalf("InsertResponse failed: %v", err)
+	}
+	if rec.ID == 0 || rec.CreatedAt.IsZero() {
+		t.Errorf("expected ID and created_at to be set, got %+v", rec)
+	}
+
+	got, err := pg.GetResponse(ctx, responseID)
+	if err != nil {
+		t.Fatalf("GetResponse failed: %v", err)
+	}
+	if got.APIKeyID != 7 || got.PreviousResponseID != "" || got.TotalTokens == nil || *got.TotalTokens != 12 {
+		t.Errorf("unexpected response record: %+v", got)
+	}
+	if *got.ExpireAt != NeverExpire {
+		t.Errorf("ExpireAt = %d, expected %d", *got.ExpireAt, NeverExpire)
+	}
+
+	deleted, err := pg.DeleteResponse(ctx, responseID)
+	if err != nil || !deleted {
+		t.Fatalf("DeleteResponse = %v, %v, expected true", deleted, err)
+	}
+	if deleted, _ := pg.DeleteResponse(ctx, responseID); deleted {
+		t.Error("expected second delete to report a missing response")
+	}
+}
+
+func TestCacheQueryWhere(t *testing.T) {
+	where, args := CacheQuery{}.where("request_hash")
+	if where != "" || len(args) != 0 {
+		t.Errorf("expected empty clause, got %q %v", where, args)
+	}
+
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	q := CacheQuery{Hash: "abc", ModelName: "gpt-4", Since: since, Limit: 10, Offset: 5}
+	where, args = q.where("request_hash")
+	if want := " WHERE request_hash = $1 AND model_name = $2 AND created_at >= $3"; where != want {
+		t.Errorf("where = %q, want %q", where, want)
+	}
+	page, args := q.page(args)
+	if want := " ORDER BY created_at DESC, id DESC LIMIT $4 OFFSET $5"; page != want {
+		t.Errorf("page = %q, want %q", page, want)
+	}
+	if len(args) != 5 || args[0] != "abc" || args[1] != "gpt-4" || args[2] != since || args[3] != 10 || args[4] != 5 {
+		t.Errorf("unexpected args: %v", args)
+	}
+}
+
+// TestListAndDeleteLLMs tests the admin queries over llm_cache
+func TestListAndDeleteLLMs(t *testing.T) {
+	pg := setupTestDB(t)
+	defer pg.Close()
+
+	ctx := context.Background()
+	model := fmt.Sprintf("test_admin_%d", time.Now().UnixNano())
+	defer func() {
+		if _, err := pg.Pool.Exec(ctx, "DELETE FROM llm_cache WHERE model_name = $1", model); err != nil {
+			t.Logf("Warning: failed to cleanup llm records: %v", err)
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		rec := &LLMRecord{
+			RequestID: fmt.Sprintf("req-%d", i),
+			Request:   []byte(fmt.Sprintf(`{"model":%q,"n":%d}`, model, i)),
+			ModelName: model,
+			Response:  []byte(`{"choices":[]}`),
+		}
+		if err := pg.UpsertLLM(ctx, rec); err != nil {
+			t.Fatalf("UpsertLLM failed: %v", err)
+		}
+	}
+
+	records, err := pg.ListLLMs(ctx, CacheQuery{ModelName: model, Limit: 2})
+	if err != nil {
+		t.Fatalf("ListLLMs failed: %v", err)
+	}
+	total, err := pg.CountLLMs(ctx, CacheQuery{ModelName: model, Limit: 2})
+	if err != nil {
+		t.Fatalf("CountLLMs failed: %v", err)
+	}
+	if total != 3 || len(records) != 2 {
+		t.Fatalf("expected 2 of 3 records, got %d of %d", len(records), total)
+	}
+
+	records, err = pg.ListLLMs(ctx, CacheQuery{ModelName: model, RequestID: "req-1", Limit: 10})
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected one record for req-1, got %d (%v)", len(records), err)
+	}
+	got, err := pg.GetLLMByHash(ctx, records[0].RequestHash)
+	if err != nil || got.RequestID != "req-1" {
+		t.Fatalf("GetLLMByHash returned %+v, %v", got, err)
+	}
+
+	if _, err := pg.DeleteLLMs(ctx, CacheQuery{}); err != ErrEmptyQuery {
+		t.Errorf("expected ErrEmptyQuery, got %v", err)
+	}
+	hashes, err := pg.DeleteLLMs(ctx, CacheQuery{Hash: got.RequestHash})
+	if err != nil || len(hashes) != 1 || hashes[0] != got.RequestHash {
+		t.Fatalf("DeleteLLMs by hash returned %v, %v", hashes, err)
+	}
+	hashes, err = pg.DeleteLLMs(ctx, CacheQuery{ModelName: model})
+	if err != nil || len(hashes) != 2 {
+		t.Fatalf("DeleteLLMs by model returned %v, %v", hashes, err)
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b []float64
+		want float64
+	}{
+		{[]float64{1, 0}, []float64{2, 0}, 1},
+		{[]float64{1, 0}, []float64{0, 3}, 0},
+		{[]float64{1, 1}, []float64{-1, -1}, -1},
+		{[]float64{1, 0}, []float64{1, 0, 0}, -1},
+		{[]float64{0, 0}, []float64{1, 0}, -1},
+		{nil, nil, -1},
+	}
+	for _, tt := range tests {
+		if got := CosineSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("CosineSimilarity(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// TestFindSimilarLLM tests semantic lookups within a semantic group
+func TestFindSimilarLLM(t *testing.T) {
+	pg := setupTestDB(t)
+	defer pg.Close()
+
+	ctx := context.Background()
+	model := fmt.Sprintf("test_semantic_%d", time.Now().UnixNano())
+	defer func() {
+		if _, err := pg.Pool.Exec(ctx, "DELETE FROM llm_cache WHERE model_name = $1", model); err != nil {
+			t.Logf("Warning: failed to cleanup llm records: %v", err)
+		}
+	}()
+
+	semanticKey := fmt.Sprintf("%064d", time.Now().UnixNano())
+	for i, embedding := range [][]float64{{1, 0, 0}, {0, 1, 0}} {
+		rec := &LLMRecord{
+			RequestID:       fmt.Sprintf("req-%d", i),
+			Request:         []byte(fmt.Sprintf(`{"model":%q,"n":%d}`, model, i)),
+			ModelName:       model,
+			Response:        []byte(fmt.Sprintf(`{"n":%d}`, i)),
+			SemanticKey:     semanticKey,
+			PromptEmbedding: embedding,
+		}
+		if err := pg.UpsertLLM(ctx, rec); err != nil {
+			t.Fatalf("UpsertLLM failed: %v", err)
+		}
+	}
+
+	q := SimilarityQuery{ModelName: model, SemanticKey: semanticKey, Embedding: []float64{0.1, 0.99, 0}, Threshold: 0.9, Candidates: 10}
+	rec, similarity, err := pg.FindSimilarLLM(ctx, q)
+	if err != nil {
+		t.Fatalf("FindSimilarLLM failed: %v", err)
+	}
+	if rec == nil || rec.RequestID != "req-1" || similarity < 0.99 {
+		t.Fatalf("expected req-1 with similarity >= 0.99, got %+v, %v", rec, similarity)
+	}
+
+	q.Threshold = 0.999
+	if rec, _, err := pg.FindSimilarLLM(ctx, q); err != nil || rec != nil {
+		t.Errorf("expected no match above threshold, got %+v, %v", rec, err)
+	}
+
+	q.Threshold, q.SemanticKey = 0.9, fmt.Sprintf("%064d", 0)
+	if rec, _, err := pg.FindSimilarLLM(ctx, q); err != nil || rec != nil {
+		t.Errorf("expected no match in another semantic group, got %+v, %v", rec, err)
+	}
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	embeddingColumns = `id, input_hash, input_text, model_name, dimensions, request_id, token_count, embedding, start_time, end_time, duration_ms, created_at, updated_at, expire_at`
+	llmColumns       = `id, request_hash, request_id, request, model_name, temperature, max_tokens, response, total_tokens, prompt_tokens, completion_tokens, start_time, end_time, created_at, updated_at, expire_at`
+)
+
+// ErrEmptyQuery is returned when a delete would match every row of a cache table.
+var ErrEmptyQuery = errors.New("cache query must have at least one filter")
+
+// CacheQuery filters cache entries for the admin API. Empty fields are ignored;
+// expired entries are included so that they can be inspected and purged.
+type CacheQuery struct {
+	Hash      string // input_hash for embeddings, request_hash for LLM responses
+	ModelName string
+	RequestID string
+	Since     time.Time // created_at >= Since
+	Until     time.Time // created_at < Until
+	Limit     int
+	Offset    int
+}
+
+// Empty reports whether the query has no filters.
+func (q CacheQuery) Empty() bool {
+	return q.Hash == "" && q.ModelName == "" && q.RequestID == "" && q.Since.IsZero() && q.Until.IsZero()
+}
+
+// where builds the WHERE clause; hashColumn differs between the cache tables.
+func (q CacheQuery) where(hashColumn string) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if q.Hash != "" {
+		add(hashColumn+" = $%d", q.Hash)
+	}
+	if q.ModelName != "" {
+		add("model_name = $%d", q.ModelName)
+	}
+	if q.RequestID != "" {
+		add("request_id = $%d", q.RequestID)
+	}
+	if !q.Since.IsZero() {
+		add("created_at >= $%d", q.Since)
+	}
+	if !q.Until.IsZero() {
+		add("created_at < $%d", q.Until)
+	}
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// page appends ORDER BY and LIMIT/OFFSET to a select statement.
+func (q CacheQuery) page(args []interface{}) (string, []interface{}) {
+	args = append(args, q.Limit, q.Offset)
+	return fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args)), args
+}
+
+// GetEmbeddingByHash retrieves an embedding record by its input hash, including expired records.
+func (p *Postgres) GetEmbeddingByHash(ctx context.Context, hash string) (*EmbeddingRecord, error) {
+	return scanEmbedding(p.Pool.QueryRow(ctx, "SELECT "+embeddingColumns+" FROM embedding_cache WHERE input_hash = $1", hash))
+}
+
+// GetLLMByHash retrieves the most recently updated LLM record for a request hash, including expired records.
+func (p *Postgres) GetLLMByHash(ctx context.Context, hash string) (*LLMRecord, error) {
+	return scanLLM(p.Pool.QueryRow(ctx, "SELECT "+llmColumns+" FROM llm_cache WHERE request_hash = $1 ORDER BY updated_at DESC LIMIT 1", hash))
+}
+
+// DeleteEmbeddings deletes the embedding records matching q and returns their input hashes.
+// Limit and Offset are ignored; an empty query returns ErrEmptyQuery.
+func (p *Postgres) DeleteEmbeddings(ctx context.Context, q CacheQuery) ([]string, error) {
+	return p.deleteCacheEntries(ctx, "embedding_cache", "input_hash", q)
+}
+
+// DeleteLLMs deletes the LLM records matching q and returns their request hashes.
+// Limit and Offset are ignored; an empty query returns ErrEmptyQuery.
+func (p *Postgres) DeleteLLMs(ctx context.Context, q CacheQuery) ([]string, error) {
+	return p.deleteCacheEntries(ctx, "llm_cache", "request_hash", q)
+}
+
+func (p *Postgres) deleteCacheEntries(ctx context.Context, table, hashColumn string, q CacheQuery) ([]string, error) {
+	if q.Empty() {
+		return nil, ErrEmptyQuery
+	}
+	where, args := q.where(hashColumn)
+	rows, err := p.Pool.Query(ctx, "DELETE FROM "+table+where+" RETURNING "+hashColumn, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
+
+func scanEmbedding(row pgx.Row) (*EmbeddingRecord, error) {
+	var record EmbeddingRecord
+	err := row.Scan(
+		&record.ID, &record.InputHash, &record.InputText, &record.ModelName, &record.Dimensions,
+		&record.RequestID, &record.TokenCount, &record.Embedding,
+		&record.StartTime, &record.EndTime, &record.DurationMs,
+		&record.CreatedAt, &record.UpdatedAt, &record.ExpireAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func scanLLM(row pgx.Row) (*LLMRecord, error) {
+	var record LLMRecord
+	err := row.Scan(
+		&record.ID, &record.RequestHash, &record.RequestID, &record.Request, &record.ModelName,
+		&record.Temperature, &record.MaxTokens, &record.Response, &record.TotalTokens,
+		&record.PromptTokens, &record.CompletionTokens,
+		&record.StartTime, &record.EndTime,
+		&record.CreatedAt, &record.UpdatedAt, &record.ExpireAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
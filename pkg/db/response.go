@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	sqlInsertResponse = `
+		INSERT INTO llm_responses (response_id, previous_response_id, request_id, api_key_id, model_name, messages, response, total_tokens, prompt_tokens, completion_tokens, expire_at)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at`
+
+	sqlGetResponse = `
+		SELECT id, response_id, COALESCE(previous_response_id, ''), request_id, api_key_id, model_name, messages, response, total_tokens, prompt_tokens, completion_tokens, created_at, expire_at
+		FROM llm_responses
+		WHERE response_id = $1
+		  AND (expire_at IS NULL OR expire_at < 0 OR expire_at > $2)`
+
+	sqlDeleteResponse = `DELETE FROM llm_responses WHERE response_id = $1`
+
+	sqlDeleteExpiredResponses = `
+		DELETE FROM llm_responses
+		WHERE id IN (
+			SELECT id FROM llm_responses
+			WHERE expire_at >= 0 AND expire_at <= $1
+			LIMIT $2
+		)`
+)
+
+// InsertResponse stores a Responses API response; response IDs are generated by the caller and never reused
+func (p *Postgres) InsertResponse(ctx context.Context, rec *ResponseRecord) error {
+	if rec == nil {
+		return fmt.Errorf("response record cannot be nil")
+	}
+	if rec.ResponseID == "" || rec.ModelName == "" {
+		return fmt.Errorf("response record missing required fields")
+	}
+	if rec.ExpireAt == nil {
+		defaultExpire := NeverExpire
+		rec.ExpireAt = &defaultExpire
+	}
+	return p.Pool.QueryRow(ctx, sqlInsertResponse,
+		rec.ResponseID, rec.PreviousResponseID, rec.RequestID, rec.APIKeyID, rec.ModelName, rec.Messages, rec.Response,
+		rec.TotalTokens, rec.PromptTokens, rec.CompletionTokens, rec.ExpireAt,
+	).Scan(&rec.ID, &rec.CreatedAt)
+}
+
+// GetResponse retrieves an unexpired response by its response ID
+func (p *Postgres) GetResponse(ctx context.Context, responseID string) (*ResponseRecord, error) {
+	var record ResponseRecord
+	err := p.Pool.QueryRow(ctx, sqlGetResponse, responseID, time.Now().UnixMilli()).Scan(
+		&record.ID, &record.ResponseID, &record.PreviousResponseID, &record.RequestID, &record.APIKeyID,
+		&record.ModelName, &record.Messages, &record.Response,
+		&record.TotalTokens, &record.PromptTokens, &record.CompletionTokens,
+		&record.CreatedAt, &record.ExpireAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// DeleteResponse deletes a response by its response ID and reports whether it existed
+func (p *Postgres) DeleteResponse(ctx context.Context, responseID string) (bool, error) {
+	tag, err := p.Pool.Exec(ctx, sqlDeleteResponse, responseID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// DeleteExpiredResponses deletes at most limit expired responses and returns the number deleted
+func (p *Postgres) DeleteExpiredResponses(ctx context.Context, now time.Time, limit int) (int64, error) {
+	tag, err := p.Pool.Exec(ctx, sqlDeleteExpiredResponses, now.UnixMilli(), limit)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
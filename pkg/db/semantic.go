@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"go-llm-server/pkg/logger"
+
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	// sqlSimilarLLMCandidates loads the most recent vectors of a semantic group for brute-force ranking.
+	sqlSimilarLLMCandidates = `
+		SELECT id, prompt_embedding
+		FROM llm_cache
+		WHERE model_name = $1 AND semantic_key = $2 AND prompt_embedding IS NOT NULL
+		  AND (expire_at IS NULL OR expire_at < 0 OR expire_at > $3)
+		ORDER BY updated_at DESC
+		LIMIT $4`
+
+	// sqlSimilarLLMVector ranks the whole semantic group with pgvector's cosine distance operator.
+	sqlSimilarLLMVector = `
+		SELECT id, 1 - (prompt_embedding::vector <=> $4::float8[]::vector) AS similarity
+		FROM llm_cache
+		WHERE model_name = $1 AND semantic_key = $2 AND cardinality(prompt_embedding) = $5
+		  AND (expire_at IS NULL OR expire_at < 0 OR expire_at > $3)
+		ORDER BY prompt_embedding::vector <=> $4::float8[]::vector
+		LIMIT 1`
+
+	sqlHasVectorExtension = `SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'vector')`
+)
+
+// SimilarityQuery describes a semantic cache lookup.
+type SimilarityQuery struct {
+	ModelName   string
+	SemanticKey string
+	Embedding   []float64
+	Threshold   float64 // minimum cosine similarity for a hit
+	Candidates  int     // most recent entries compared when pgvector is not installed
+}
+
+// detectVector reports whether pgvector is installed. The extension is never created here
+// because that requires elevated privileges; without it lookups fall back to brute force.
+func (p *Postgres) detectVector(ctx context.Context) bool {
+	var installed bool
+	if err := p.Pool.QueryRow(ctx, sqlHasVectorExtension).Scan(&installed); err != nil {
+		logger.Warn("failed to detect pgvector, using brute-force semantic lookup", zap.Error(err))
+		return false
+	}
+	if installed {
+		logger.Info("pgvector detected, semantic cache lookups use vector distance")
+	}
+	return installed
+}
+
+// FindSimilarLLM returns the unexpired LLM record in the same semantic group whose prompt embedding
+// is most similar to q.Embedding, together with the cosine similarity. It returns nil when no record
+// reaches q.Threshold.
+func (p *Postgres) FindSimilarLLM(ctx context.Context, q SimilarityQuery) (*LLMRecord, float64, error) {
+	if len(q.Embedding) == 0 {
+		return nil, 0, nil
+	}
+	now := time.Now().UnixMilli()
+
+	var id int
+	var similarity float64
+	var err error
+	if p.vector {
+		err = p.Pool.QueryRow(ctx, sqlSimilarLLMVector, q.ModelName, q.SemanticKey, now, q.Embedding, len(q.Embedding)).Scan(&id, &similarity)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, 0, nil
+		}
+	} else {
+		id, similarity, err = p.rankSimilarLLMs(ctx, q, now)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if id == 0 || similarity < q.Threshold {
+		return nil, similarity, nil
+	}
+
+	rec, err := scanLLM(p.Pool.QueryRow(ctx, "SELECT "+llmColumns+" FROM llm_cache WHERE id = $1", id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		// deleted between ranking and loading
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return rec, similarity, nil
+}
+
+// rankSimilarLLMs compares q.Embedding with the most recent candidates in Go.
+func (p *Postgres) rankSimilarLLMs(ctx context.Context, q SimilarityQuery, now int64) (int, float64, error) {
+	rows, err := p.Pool.Query(ctx, sqlSimilarLLMCandidates, q.ModelName, q.SemanticKey, now, q.Candidates)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	bestID, best := 0, math.Inf(-1)
+	for rows.Next() {
+		var id int
+		var embedding []float64
+		if err := rows.Scan(&id, &embedding); err != nil {
+			return 0, 0, err
+		}
+		if similarity := CosineSimilarity(q.Embedding, embedding); similarity > best {
+			bestID, best = id, similarity
+		}
+	}
+	if bestID == 0 {
+		return 0, 0, rows.Err()
+	}
+	return bestID, best, rows.Err()
+}
+
+// CosineSimilarity returns the cosine similarity of a and b, or -1 when they differ
+// in length or either is a zero vector.
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return -1
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return -1
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
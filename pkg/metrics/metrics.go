@@ -0,0 +1,372 @@
+// Package metrics is a small, dependency-free implementation of Prometheus counters,
+// gauges and histograms rendered in the text exposition format (version 0.0.4).
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the Content-Type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are latency buckets in seconds suited to LLM requests, which range
+// from milliseconds for cache hits to minutes for long generations.
+var DefaultBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// collector is a metric family that can render itself.
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds metric families and renders them sorted by name.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.collectors[c.name()]; exists {
+		panic("metrics: duplicate metric name " + c.name())
+	}
+	r.collectors[c.name()] = c
+}
+
+// NewCounterVec registers a counter family partitioned by the given labels.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{family: newFamily(name, help, "counter", labels)}
+	r.register(c)
+	return c
+}
+
+// NewGaugeVec registers a gauge family partitioned by the given labels.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{family: newFamily(name, help, "gauge", labels)}
+	r.register(g)
+	return g
+}
+
+// NewHistogramVec registers a histogram family with the given upper bounds, which must be sorted.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{family: newFamily(name, help, "histogram", labels), buckets: buckets}
+	r.register(h)
+	return h
+}
+
+// NewGaugeFunc registers a gauge family whose samples are produced at scrape time.
+// collect is called with an emit function taking the value followed by the label values.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func(emit func(value float64, labelValues ...string))) {
+	r.register(&funcFamily{family: newFamily(name, help, "gauge", labels), collect: collect})
+}
+
+// NewCounterFunc registers a counter family whose samples are produced at scrape time from
+// cumulative values maintained elsewhere, such as connection pool statistics.
+// collect must only emit values that never decrease, except on process restart.
+func (r *Registry) NewCounterFunc(name, help string, labels []string, collect func(emit func(value float64, labelValues ...string))) {
+	r.register(&funcFamily{family: newFamily(name, help, "counter", labels), collect: collect})
+}
+
+// WriteText renders all registered families in the text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]collector, len(names))
+	for i, name := range names {
+		collectors[i] = r.collectors[name]
+	}
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry over HTTP.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_ = r.WriteText(w)
+	})
+}
+
+// ---------------- families ----------------
+
+type family struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+
+	mu     sync.RWMutex
+	series map[string]interface{} // joined label values -> *Counter/*Gauge/*Histogram
+	values map[string][]string
+}
+
+func newFamily(name, help, kind string, labels []string) *family {
+	return &family{
+		metricName: name,
+		help:       help,
+		kind:       kind,
+		labels:     labels,
+		series:     make(map[string]interface{}),
+		values:     make(map[string][]string),
+	}
+}
+
+func (f *family) name() string { return f.metricName }
+
+// get returns the series for the label values, creating it with create on first use.
+func (f *family) get(labelValues []string, create func() interface{}) interface{} {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.metricName, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.series[key]; ok {
+		return s
+	}
+	s = create()
+	f.series[key] = s
+	f.values[key] = append([]string(nil), labelValues...)
+	return s
+}
+
+// sorted returns series keys in a stable order.
+func (f *family) sorted() []string {
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *family) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.metricName, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.metricName, f.kind)
+}
+
+// CounterVec is a family of monotonically increasing counters.
+type CounterVec struct{ *family }
+
+// WithLabelValues returns the counter for the given label values.
+func (c *CounterVec) WithLabelValues(labelValues ...string) *Counter {
+	return c.get(labelValues, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	c.writeHeader(w)
+	for _, key := range c.sorted() {
+		writeSample(w, c.metricName, c.labels, c.values[key], "", "", c.series[key].(*Counter).Value())
+	}
+}
+
+// GaugeVec is a family of gauges that can go up and down.
+type GaugeVec struct{ *family }
+
+// WithLabelValues returns the gauge for the given label values.
+func (g *GaugeVec) WithLabelValues(labelValues ...string) *Gauge {
+	return g.get(labelValues, func() interface{} { return &Gauge{} }).(*Gauge)
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	g.writeHeader(w)
+	for _, key := range g.sorted() {
+		writeSample(w, g.metricName, g.labels, g.values[key], "", "", g.series[key].(*Gauge).Value())
+	}
+}
+
+// HistogramVec is a family of histograms sharing the same buckets.
+type HistogramVec struct {
+	*family
+	buckets []float64
+}
+
+// WithLabelValues returns the histogram for the given label values.
+func (h *HistogramVec) WithLabelValues(labelValues ...string) *Histogram {
+	return h.get(labelValues, func() interface{} {
+		return &Histogram{buckets: h.buckets, counts: make([]uint64, len(h.buckets))}
+	}).(*Histogram)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	h.writeHeader(w)
+	for _, key := range h.sorted() {
+		counts, count, sum := h.series[key].(*Histogram).snapshot()
+		labelValues := h.values[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += counts[i]
+			writeSample(w, h.metricName+"_bucket", h.labels, labelValues, "le", formatFloat(bound), float64(cumulative))
+		}
+		writeSample(w, h.metricName+"_bucket", h.labels, labelValues, "le", "+Inf", float64(count))
+		writeSample(w, h.metricName+"_sum", h.labels, labelValues, "", "", sum)
+		writeSample(w, h.metricName+"_count", h.labels, labelValues, "", "", float64(count))
+	}
+}
+
+// funcFamily is a gauge or counter family collected by a callback at scrape time.
+type funcFamily struct {
+	*family
+	collect func(emit func(value float64, labelValues ...string))
+}
+
+func (f *funcFamily) write(w *bufio.Writer) {
+	f.writeHeader(w)
+	f.collect(func(value float64, labelValues ...string) {
+		writeSample(w, f.metricName, f.labels, labelValues, "", "", value)
+	})
+}
+
+// ---------------- series ----------------
+
+// Counter is a monotonically increasing float64.
+type Counter struct{ bits uint64 }
+
+// Inc adds one.
+func (c *Counter) Inc() { c.Add(1) }
+
+// Add adds v, which must not be negative.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	addFloat(&c.bits, v)
+}
+
+// Value returns the current value.
+func (c *Counter) Value() float64 { return math.Float64frombits(atomic.LoadUint64(&c.bits)) }
+
+// Gauge is a float64 that can go up and down.
+type Gauge struct{ bits uint64 }
+
+// Set replaces the value.
+func (g *Gauge) Set(v float64) { atomic.StoreUint64(&g.bits, math.Float64bits(v)) }
+
+// Add adds v, which may be negative.
+func (g *Gauge) Add(v float64) { addFloat(&g.bits, v) }
+
+// Value returns the current value.
+func (g *Gauge) Value() float64 { return math.Float64frombits(atomic.LoadUint64(&g.bits)) }
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64 // non-cumulative per bucket; observations above the last bound only count towards +Inf
+	count   uint64
+	sum     float64
+}
+
+// Observe records one observation.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *Histogram) snapshot() ([]uint64, uint64, float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]uint64(nil), h.counts...), h.count, h.sum
+}
+
+func addFloat(bits *uint64, v float64) {
+	for {
+		old := atomic.LoadUint64(bits)
+		if atomic.CompareAndSwapUint64(bits, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// ---------------- exposition ----------------
+
+func writeSample(w *bufio.Writer, name string, labels, labelValues []string, extraLabel, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label)
+			w.WriteString(`="`)
+			w.WriteString(escapeLabelValue(labelValues[i]))
+			w.WriteByte('"')
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraLabel)
+			w.WriteString(`="`)
+			w.WriteString(extraValue)
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string       { return helpEscaper.Replace(s) }
+func escapeLabelValue(s string) string { return labelValueEscaper.Replace(s) }
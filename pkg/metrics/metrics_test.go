@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func render(t *testing.T, reg *Registry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, reg.WriteText(&buf))
+	return buf.String()
+}
+
+func TestCounterVec_TextFormat(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.NewCounterVec("http_requests_total", "Total requests.", "path", "status")
+	requests.WithLabelValues("/chat/completions", "200").Inc()
+	requests.WithLabelValues("/chat/completions", "200").Add(2)
+	requests.WithLabelValues("/embeddings", "429").Inc()
+	requests.WithLabelValues("/embeddings", "429").Add(-5) // counters never decrease
+
+	expected := `# HELP http_requests_total Total requests.
+# TYPE http_requests_total counter
+http_requests_total{path="/chat/completions",status="200"} 3
+http_requests_total{path="/embeddings",status="429"} 1
+`
+	assert.Equal(t, expected, render(t, reg))
+}
+
+func TestHistogramVec_TextFormat(t *testing.T) {
+	reg := NewRegistry()
+	latency := reg.NewHistogramVec("request_duration_seconds", "Request latency.", []float64{0.1, 1, 10}, "model")
+	h := latency.WithLabelValues("gpt-4")
+	h.Observe(0.05)
+	h.Observe(0.1) // upper bounds are inclusive
+	h.Observe(3)
+	h.Observe(42)
+
+	expected := `# HELP request_duration_seconds Request latency.
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{model="gpt-4",le="0.1"} 2
+request_duration_seconds_bucket{model="gpt-4",le="1"} 2
+request_duration_seconds_bucket{model="gpt-4",le="10"} 3
+request_duration_seconds_bucket{model="gpt-4",le="+Inf"} 4
+request_duration_seconds_sum{model="gpt-4"} 45.15
+request_duration_seconds_count{model="gpt-4"} 4
+`
+	assert.Equal(t, expected, render(t, reg))
+}
+
+func TestGauges_TextFormat(t *testing.T) {
+	reg := NewRegistry()
+	inflight := reg.NewGaugeVec("inflight", "In-flight requests.")
+	inflight.WithLabelValues().Add(3)
+	inflight.WithLabelValues().Add(-1)
+	reg.NewGaugeFunc("pool_connections", "Pool connections.", []string{"pool", "state"}, func(emit func(float64, ...string)) {
+		emit(4, "redis", "idle")
+		emit(1, "redis", "total")
+	})
+
+	// families are sorted by name
+	expected := `# HELP inflight In-flight requests.
+# TYPE inflight gauge
+inflight 2
+# HELP pool_connections Pool connections.
+# TYPE pool_connections gauge
+pool_connections{pool="redis",state="idle"} 4
+pool_connections{pool="redis",state="total"} 1
+`
+	assert.Equal(t, expected, render(t, reg))
+}
+
+func TestCounterFunc_TextFormat(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounterFunc("pool_events_total", "Pool events.", []string{"pool", "event"}, func(emit func(float64, ...string)) {
+		emit(42, "redis", "hit")
+		emit(3, "redis", "miss")
+	})
+
+	expected := `# HELP pool_events_total Pool events.
+# TYPE pool_events_total counter
+pool_events_total{pool="redis",event="hit"} 42
+pool_events_total{pool="redis",event="miss"} 3
+`
+	assert.Equal(t, expected, render(t, reg))
+}
+
+func TestEscaping(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounterVec("escaped_total", "Help with \\ backslash\nand newline.", "value")
+	c.WithLabelValues("quote\" backslash\\ newline\n").Inc()
+
+	expected := `# HELP escaped_total Help with \\ backslash\nand newline.
+# TYPE escaped_total counter
+escaped_total{value="quote\" backslash\\ newline\n"} 1
+`
+	assert.Equal(t, expected, render(t, reg))
+}
+
+func TestRegistry_Panics(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounterVec("dup_total", "help", "a")
+	assert.Panics(t, func() { reg.NewCounterVec("dup_total", "help") })
+	assert.Panics(t, func() { c.WithLabelValues("x", "y") })
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounterVec("up_total", "Up.").WithLabelValues().Inc()
+
+	resp := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, ContentType, resp.Header().Get("Content-Type"))
+	assert.Contains(t, resp.Body.String(), "up_total 1\n")
+}
+
+func TestCounter_Concurrent(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounterVec("concurrent_total", "help", "worker")
+	h := reg.NewHistogramVec("concurrent_seconds", "help", DefaultBuckets)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.WithLabelValues("w").Inc()
+				h.WithLabelValues().Observe(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, float64(8000), c.WithLabelValues("w").Value())
+	assert.Contains(t, render(t, reg), "concurrent_seconds_count 8000\n")
+}
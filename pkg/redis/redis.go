@@ -85,6 +85,59 @@ func (r *Redis) Set(ctx context.Context, key string, value any, ttl time.Duratio
 	return r.client.Set(ctx, key, data, ttl).Err()
 }
 
+// IncrBy atomically adds delta to the integer stored at key and returns the new value.
+// The ttl is applied only when the key is created, so fixed windows expire on schedule.
+func (r *Redis) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	pipe := r.client.TxPipeline()
+	incr := pipe.IncrBy(ctx, key, delta)
+	if ttl > 0 {
+		pipe.ExpireNX(ctx, key, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// GetInt returns the integer stored at key, or 0 when the key does not exist.
+func (r *Redis) GetInt(ctx context.Context, key string) (int64, error) {
+	val, err := r.client.Get(ctx, key).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return val, err
+}
+
+// Del removes the given keys.
+func (r *Redis) Del(ctx context.Context, keys ...string) error {
+	return r.client.Del(ctx, keys...).Err()
+}
+
+// Script is a Lua script executed with EVALSHA, falling back to EVAL when Redis has not cached it yet.
+type Script struct {
+	script *redis.Script
+}
+
+// NewScript wraps Lua source so it can be run with RunInt64s.
+func NewScript(src string) *Script {
+	return &Script{script: redis.NewScript(src)}
+}
+
+// RunInt64s runs a script that returns an array of integers.
+func (r *Redis) RunInt64s(ctx context.Context, script *Script, keys []string, args ...interface{}) ([]int64, error) {
+	return script.script.Run(ctx, r.client, keys, args...).Int64Slice()
+}
+
+// Ping checks that the server is reachable.
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// PoolStats returns connection pool statistics.
+func (r *Redis) PoolStats() *redis.PoolStats {
+	return r.client.PoolStats()
+}
+
 // Close closes the Redis connection
 func (r *Redis) Close() error {
 	return r.client.Close()
@@ -458,3 +458,56 @@ func BenchmarkRedis_Get(b *testing.B) {
 		}
 	}
 }
+
+func TestRedis_IncrBy(t *testing.T) {
+	client, err := NewRedis(testConfig)
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+	key := fmt.Sprintf("test:incr:%d", time.Now().UnixNano())
+	defer client.Del(ctx, key)
+
+	val, err := client.GetInt(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), val)
+
+	val, err = client.IncrBy(ctx, key, 5, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), val)
+
+	val, err = client.IncrBy(ctx, key, 3, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), val)
+
+	val, err = client.GetInt(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), val)
+
+	time.Sleep(1100 * time.Millisecond)
+	val, err = client.GetInt(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), val)
+}
+
+func TestRedis_RunInt64s(t *testing.T) {
+	client, err := NewRedis(testConfig)
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx := context.Background()
+	key := fmt.Sprintf("test:script:%d", time.Now().UnixNano())
+	defer client.Del(ctx, key)
+
+	script := NewScript(`
+local v = redis.call("INCRBY", KEYS[1], ARGV[1])
+return {v, tonumber(ARGV[2])}
+`)
+	vals, err := client.RunInt64s(ctx, script, []string{key}, 4, 7)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4, 7}, vals)
+
+	vals, err = client.RunInt64s(ctx, script, []string{key}, 4, 7)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{8, 7}, vals)
+}
@@ -0,0 +1,209 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const defaultOTLPTimeout = 10 * time.Second
+
+// OTLPConfig configures an OTLPExporter.
+type OTLPConfig struct {
+	// Endpoint is the full traces URL of the collector, e.g. http://otel-collector:4318/v1/traces.
+	Endpoint string
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName string
+	// Headers are added to every export request, e.g. for collector authentication.
+	Headers map[string]string
+	Timeout time.Duration
+}
+
+// OTLPExporter sends spans to an OpenTelemetry collector using OTLP/HTTP with the JSON encoding.
+type OTLPExporter struct {
+	cfg    OTLPConfig
+	client *http.Client
+}
+
+// NewOTLPExporter creates an exporter for the given collector endpoint.
+func NewOTLPExporter(cfg OTLPConfig) (*OTLPExporter, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("otlp endpoint cannot be empty")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultOTLPTimeout
+	}
+	return &OTLPExporter{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}, nil
+}
+
+// ExportSpans posts one ExportTraceServiceRequest containing spans.
+func (e *OTLPExporter) ExportSpans(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export failed: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Shutdown releases idle connections to the collector.
+func (e *OTLPExporter) Shutdown(context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// ---------------- OTLP JSON encoding ----------------
+// Field names follow the proto3 JSON mapping of opentelemetry/proto/collector/trace/v1;
+// trace and span IDs are hex strings and 64-bit integers are decimal strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+// otlpStatus codes: 0 unset, 2 error.
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (e *OTLPExporter) encode(spans []SpanData) otlpRequest {
+	serviceName := e.cfg.ServiceName
+	if serviceName == "" {
+		serviceName = "go-llm-server"
+	}
+	out := make([]otlpSpan, len(spans))
+	for i, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.SpanContext.TraceID.String(),
+			SpanID:            span.SpanContext.SpanID.String(),
+			Name:              span.Name,
+			Kind:              int(span.Kind),
+			StartTimeUnixNano: unixNano(span.Start),
+			EndTimeUnixNano:   unixNano(span.End),
+			Attributes:        encodeAttributes(span.Attributes),
+		}
+		if span.Parent.IsValid() {
+			s.ParentSpanID = span.Parent.String()
+		}
+		for _, event := range span.Events {
+			s.Events = append(s.Events, otlpEvent{
+				TimeUnixNano: unixNano(event.Time),
+				Name:         event.Name,
+				Attributes:   encodeAttributes(event.Attributes),
+			})
+		}
+		if span.Error {
+			s.Status = otlpStatus{Code: 2, Message: span.StatusMessage}
+		}
+		out[i] = s
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: encodeAttributes([]Attribute{{Key: "service.name", Value: serviceName}})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "go-llm-server/pkg/tracing"}, Spans: out}},
+	}}}
+}
+
+func encodeAttributes(attrs []Attribute) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	out := make([]otlpKeyValue, len(attrs))
+	for i, attr := range attrs {
+		out[i] = otlpKeyValue{Key: attr.Key, Value: encodeValue(attr.Value)}
+	}
+	return out
+}
+
+func encodeValue(value interface{}) otlpValue {
+	switch v := value.(type) {
+	case string:
+		return otlpValue{StringValue: &v}
+	case bool:
+		return otlpValue{BoolValue: &v}
+	case int:
+		s := strconv.Itoa(v)
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpValue{IntValue: &s}
+	case float64:
+		return otlpValue{DoubleValue: &v}
+	default:
+		s := fmt.Sprint(v)
+		return otlpValue{StringValue: &s}
+	}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
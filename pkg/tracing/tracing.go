@@ -0,0 +1,519 @@
+// Package tracing is a small, dependency-free tracer that follows the OpenTelemetry data
+// model: spans propagate through context.Context and across services via the W3C
+// traceparent header, and finished spans are batched to an Exporter.
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-llm-server/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// TraceparentHeader is the W3C Trace Context propagation header.
+const TraceparentHeader = "traceparent"
+
+const (
+	defaultBatchSize      = 512
+	defaultMaxQueueSize   = 4096
+	defaultExportInterval = 5 * time.Second
+)
+
+// SpanKind mirrors the OTLP span kinds.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// IsValid reports whether the ID is non-zero.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// IsValid reports whether the ID is non-zero.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanContext is the part of a span that propagates to children and downstream services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set.
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// Traceparent formats the span context as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := 0
+	if sc.Sampled {
+		flags = 1
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a traceparent header value. Unknown future versions are accepted
+// as long as they start with the version 00 fields, as the specification requires.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 55 || (len(value) > 55 && value[55] != '-') {
+		return SpanContext{}, false
+	}
+	parts := strings.Split(value[:55], "-")
+	if len(parts) != 4 {
+		return SpanContext{}, false
+	}
+	var version [1]byte
+	if !decodeLowerHex(version[:], parts[0]) || version[0] == 0xff || (version[0] == 0 && len(value) != 55) {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	if !decodeLowerHex(sc.TraceID[:], parts[1]) || !decodeLowerHex(sc.SpanID[:], parts[2]) {
+		return SpanContext{}, false
+	}
+	var flags [1]byte
+	if !decodeLowerHex(flags[:], parts[3]) || !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, true
+}
+
+func decodeLowerHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// Extract returns the span context carried by the traceparent header, if any.
+func Extract(header http.Header) (SpanContext, bool) {
+	return ParseTraceparent(header.Get(TraceparentHeader))
+}
+
+// Inject sets the traceparent header to the span in ctx. It does nothing without a span.
+func Inject(ctx context.Context, header http.Header) {
+	if span := SpanFromContext(ctx); span != nil {
+		header.Set(TraceparentHeader, span.Context().Traceparent())
+	}
+}
+
+// ---------------- spans ----------------
+
+// Attribute is a key/value pair attached to a span or event. Values may be string, bool,
+// int, int64 or float64; anything else is exported as its fmt representation.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Event is a timestamped annotation on a span.
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes []Attribute
+}
+
+// SpanData is the immutable record of a finished span handed to exporters.
+type SpanData struct {
+	Name          string
+	Kind          SpanKind
+	SpanContext   SpanContext
+	Parent        SpanID
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	Events        []Event
+	Error         bool
+	StatusMessage string
+}
+
+// Attr returns the value of the named attribute, or nil.
+func (d SpanData) Attr(key string) interface{} {
+	for _, attr := range d.Attributes {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return nil
+}
+
+// Span is an in-progress operation. All methods are safe on a nil Span, so instrumented
+// code does not need to check whether tracing is enabled.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// Context returns the span's propagation context.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetAttributes adds or replaces attributes.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil || !s.data.SpanContext.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, attr := range attrs {
+		s.setAttribute(attr)
+	}
+}
+
+// SetAttribute is shorthand for SetAttributes with a single attribute.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.SetAttributes(Attribute{Key: key, Value: value})
+}
+
+func (s *Span) setAttribute(attr Attribute) {
+	for i := range s.data.Attributes {
+		if s.data.Attributes[i].Key == attr.Key {
+			s.data.Attributes[i].Value = attr.Value
+			return
+		}
+	}
+	s.data.Attributes = append(s.data.Attributes, attr)
+}
+
+// AddEvent records a named event at the current time.
+func (s *Span) AddEvent(name string, attrs ...Attribute) {
+	if s == nil || !s.data.SpanContext.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Events = append(s.data.Events, Event{Name: name, Time: time.Now(), Attributes: attrs})
+}
+
+// RecordError marks the span as failed. A nil error is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil || !s.data.SpanContext.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = true
+	s.data.StatusMessage = err.Error()
+}
+
+// SetError marks the span as failed with the given message.
+func (s *Span) SetError(message string) {
+	if s == nil || !s.data.SpanContext.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = true
+	s.data.StatusMessage = message
+}
+
+// End finishes the span and queues it for export. Calls after the first are ignored.
+func (s *Span) End() {
+	if s == nil || !s.data.SpanContext.Sampled {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	s.tracer.enqueue(data)
+}
+
+type spanContextKey struct{}
+
+type remoteContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span as the current span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the current span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteParent returns a copy of ctx whose next root span continues the given
+// remote trace, typically one extracted from an incoming request.
+func ContextWithRemoteParent(ctx context.Context, parent SpanContext) context.Context {
+	return context.WithValue(ctx, remoteContextKey{}, parent)
+}
+
+// Start starts a child of the current span in ctx using that span's tracer. Without a
+// current span it returns ctx unchanged and a nil Span.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind)
+}
+
+// ---------------- tracer ----------------
+
+// Exporter sends finished spans to a backend.
+type Exporter interface {
+	ExportSpans(ctx context.Context, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// Options tunes sampling and batching. Zero values select the defaults.
+type Options struct {
+	// SampleRatio is the fraction of new traces that are recorded, in (0, 1]. Traces
+	// continued from an incoming traceparent follow the caller's sampled flag instead.
+	SampleRatio    float64
+	BatchSize      int
+	MaxQueueSize   int
+	ExportInterval time.Duration
+}
+
+// Tracer creates spans and exports finished ones in batches from a background goroutine.
+type Tracer struct {
+	exporter    Exporter
+	sampleRatio float64
+	batchSize   int
+	maxQueue    int
+
+	mu      sync.Mutex
+	queue   []SpanData
+	dropped int
+
+	exportMu sync.Mutex
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewTracer creates a tracer that exports to exporter and starts its export loop.
+func NewTracer(exporter Exporter, opts Options) *Tracer {
+	t := &Tracer{
+		exporter:    exporter,
+		sampleRatio: opts.SampleRatio,
+		batchSize:   opts.BatchSize,
+		maxQueue:    opts.MaxQueueSize,
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if t.sampleRatio <= 0 || t.sampleRatio > 1 {
+		t.sampleRatio = 1
+	}
+	if t.batchSize <= 0 {
+		t.batchSize = defaultBatchSize
+	}
+	if t.maxQueue <= 0 {
+		t.maxQueue = defaultMaxQueueSize
+	}
+	interval := opts.ExportInterval
+	if interval <= 0 {
+		interval = defaultExportInterval
+	}
+	go t.loop(interval)
+	return t
+}
+
+// Start starts a span as a child of the current span in ctx, or of the remote parent set
+// by ContextWithRemoteParent, or as the root of a new trace.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	var parent SpanContext
+	if span := SpanFromContext(ctx); span != nil {
+		parent = span.Context()
+	} else if remote, ok := ctx.Value(remoteContextKey{}).(SpanContext); ok {
+		parent = remote
+	}
+
+	sc := SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+	} else {
+		sc.TraceID = newTraceID()
+		sc.Sampled = t.sampleRatio >= 1 || rand.Float64() < t.sampleRatio
+	}
+
+	span := &Span{tracer: t, data: SpanData{
+		Name:        name,
+		Kind:        kind,
+		SpanContext: sc,
+		Parent:      parent.SpanID,
+		Start:       time.Now(),
+	}}
+	return ContextWithSpan(ctx, span), span
+}
+
+func (t *Tracer) enqueue(data SpanData) {
+	t.mu.Lock()
+	if len(t.queue) >= t.maxQueue {
+		t.dropped++
+		t.mu.Unlock()
+		return
+	}
+	t.queue = append(t.queue, data)
+	full := len(t.queue) >= t.batchSize
+	t.mu.Unlock()
+	if full {
+		select {
+		case t.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Tracer) loop(interval time.Duration) {
+	defer close(t.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		case <-t.wake:
+		}
+		if err := t.Flush(context.Background()); err != nil {
+			logger.Warn("Failed to export spans", zap.Error(err))
+		}
+	}
+}
+
+// Flush exports all queued spans now.
+func (t *Tracer) Flush(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.exportMu.Lock()
+	defer t.exportMu.Unlock()
+	for {
+		t.mu.Lock()
+		if t.dropped > 0 {
+			logger.Warn("Span queue full, spans dropped", zap.Int("dropped", t.dropped))
+			t.dropped = 0
+		}
+		n := len(t.queue)
+		if n > t.batchSize {
+			n = t.batchSize
+		}
+		batch := t.queue[:n:n]
+		t.queue = t.queue[n:]
+		t.mu.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := t.exporter.ExportSpans(ctx, batch); err != nil {
+			return err
+		}
+	}
+}
+
+// Shutdown stops the export loop, exports the remaining spans and shuts down the exporter.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.stopOnce.Do(func() { close(t.stop) })
+	<-t.done
+	err := t.Flush(ctx)
+	if shutdownErr := t.exporter.Shutdown(ctx); err == nil {
+		err = shutdownErr
+	}
+	return err
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		putUint64(id[:8], rand.Uint64())
+		putUint64(id[8:], rand.Uint64())
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		putUint64(id[:], rand.Uint64())
+	}
+	return id
+}
+
+func putUint64(b []byte, v uint64) {
+	for i := range b {
+		b[i] = byte(v >> (8 * (7 - i)))
+	}
+}
+
+// ---------------- in-memory exporter ----------------
+
+// InMemoryExporter keeps exported spans in memory, for tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// NewInMemoryExporter creates an empty in-memory exporter.
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// ExportSpans appends spans to the exporter.
+func (e *InMemoryExporter) ExportSpans(_ context.Context, spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// Shutdown is a no-op.
+func (e *InMemoryExporter) Shutdown(context.Context) error { return nil }
+
+// Spans returns a copy of the exported spans in export order.
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset discards the exported spans.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,177 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	sc, ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	sc, ok = ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	require.True(t, ok)
+	assert.False(t, sc.Sampled)
+
+	// future versions may append fields
+	_, ok = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.True(t, ok)
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-600f067aa0ba902b7-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736_00f067aa0ba902b7_01",
+	} {
+		_, ok := ParseTraceparent(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestTracer_ParentChild(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer(exporter, Options{})
+	defer tracer.Shutdown(context.Background())
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, root := tracer.Start(ContextWithRemoteParent(context.Background(), remote), "request", SpanKindServer)
+	childCtx, child := Start(ctx, "upstream", SpanKindClient)
+	child.SetAttribute("http.status_code", 200)
+	child.AddEvent("first_byte")
+	child.RecordError(errors.New("boom"))
+
+	header := http.Header{}
+	Inject(childCtx, header)
+	assert.Equal(t, child.Context().Traceparent(), header.Get(TraceparentHeader))
+
+	child.End()
+	child.End()
+	root.End()
+	require.NoError(t, tracer.Flush(context.Background()))
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "upstream", spans[0].Name)
+	assert.Equal(t, remote.TraceID, spans[0].SpanContext.TraceID)
+	assert.Equal(t, root.Context().SpanID, spans[0].Parent)
+	assert.Equal(t, 200, spans[0].Attr("http.status_code"))
+	assert.True(t, spans[0].Error)
+	assert.Equal(t, "boom", spans[0].StatusMessage)
+	require.Len(t, spans[0].Events, 1)
+	assert.Equal(t, remote.SpanID, spans[1].Parent)
+	assert.False(t, spans[1].End.Before(spans[1].Start))
+}
+
+func TestTracer_Sampling(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer(exporter, Options{})
+	defer tracer.Shutdown(context.Background())
+
+	// an unsampled caller keeps propagating but nothing is recorded
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx, root := tracer.Start(ContextWithRemoteParent(context.Background(), remote), "request", SpanKindServer)
+	_, child := Start(ctx, "child", SpanKindInternal)
+	assert.False(t, child.Context().Sampled)
+	assert.Equal(t, remote.TraceID, child.Context().TraceID)
+	child.End()
+	root.End()
+	require.NoError(t, tracer.Flush(context.Background()))
+	assert.Empty(t, exporter.Spans())
+
+	// without a current span nothing is started
+	ctx, span := Start(context.Background(), "orphan", SpanKindInternal)
+	assert.Nil(t, span)
+	assert.Nil(t, SpanFromContext(ctx))
+	span.SetAttribute("ignored", true)
+	span.End()
+}
+
+func TestTracer_BatchesAndShutdown(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer(exporter, Options{BatchSize: 2, MaxQueueSize: 3, ExportInterval: time.Hour})
+
+	for i := 0; i < 2; i++ {
+		_, span := tracer.Start(context.Background(), "span", SpanKindInternal)
+		span.End()
+	}
+	// a full batch wakes the export loop
+	require.Eventually(t, func() bool { return len(exporter.Spans()) == 2 }, time.Second, 5*time.Millisecond)
+
+	_, span := tracer.Start(context.Background(), "last", SpanKindInternal)
+	span.End()
+	require.NoError(t, tracer.Shutdown(context.Background()))
+	assert.Len(t, exporter.Spans(), 3)
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]interface{}
+	var header http.Header
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		raw, _ := io.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(raw, &body))
+	}))
+	defer collector.Close()
+
+	exporter, err := NewOTLPExporter(OTLPConfig{
+		Endpoint:    collector.URL + "/v1/traces",
+		ServiceName: "llm-proxy",
+		Headers:     map[string]string{"Authorization": "Bearer secret"},
+	})
+	require.NoError(t, err)
+
+	tracer := NewTracer(exporter, Options{})
+	_, span := tracer.Start(context.Background(), "redis.get", SpanKindClient)
+	span.SetAttributes(Attribute{Key: "db.system", Value: "redis"}, Attribute{Key: "hit", Value: true},
+		Attribute{Key: "bytes", Value: int64(42)}, Attribute{Key: "ratio", Value: 0.5})
+	span.SetError("timeout")
+	span.End()
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	assert.Equal(t, "application/json", header.Get("Content-Type"))
+	assert.Equal(t, "Bearer secret", header.Get("Authorization"))
+
+	resourceSpans := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	resourceAttr := resourceSpans["resource"].(map[string]interface{})["attributes"].([]interface{})[0]
+	assert.Equal(t, map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "llm-proxy"}}, resourceAttr)
+
+	spans := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	require.Len(t, spans, 1)
+	encoded := spans[0].(map[string]interface{})
+	assert.Equal(t, "redis.get", encoded["name"])
+	assert.Equal(t, float64(SpanKindClient), encoded["kind"])
+	assert.Equal(t, span.Context().TraceID.String(), encoded["traceId"])
+	assert.NotContains(t, encoded, "parentSpanId")
+	assert.Equal(t, map[string]interface{}{"code": float64(2), "message": "timeout"}, encoded["status"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"key": "db.system", "value": map[string]interface{}{"stringValue": "redis"}},
+		map[string]interface{}{"key": "hit", "value": map[string]interface{}{"boolValue": true}},
+		map[string]interface{}{"key": "bytes", "value": map[string]interface{}{"intValue": "42"}},
+		map[string]interface{}{"key": "ratio", "value": map[string]interface{}{"doubleValue": 0.5}},
+	}, encoded["attributes"])
+
+	collector.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	assert.Error(t, exporter.ExportSpans(context.Background(), []SpanData{{Name: "x"}}))
+
+	_, err = NewOTLPExporter(OTLPConfig{})
+	assert.Error(t, err)
+}